@@ -232,6 +232,19 @@ type ReadFilterRequest struct {
 	ReadSource *types.Any     `protobuf:"bytes,1,opt,name=read_source,json=readSource,proto3" json:"read_source,omitempty"`
 	Range      TimestampRange `protobuf:"bytes,2,opt,name=range,proto3" json:"range"`
 	Predicate  *Predicate     `protobuf:"bytes,3,opt,name=predicate,proto3" json:"predicate,omitempty"`
+	// Descending makes ReadFilter produce the points of each series newest
+	// first; the order of the series is unchanged. The shards are read newest
+	// first, so that no series is read into memory to reverse it.
+	Descending bool `protobuf:"varint,4,opt,name=descending,proto3" json:"descending,omitempty"`
+	// SeriesPointLimit, when greater than 0, limits each series to its first
+	// SeriesPointLimit points. The points are counted in the order they are
+	// produced, so a descending request keeps the most recent points, and once
+	// the limit is reached, the remaining points of the series are not read.
+	SeriesPointLimit int64 `protobuf:"varint,5,opt,name=series_point_limit,json=seriesPointLimit,proto3" json:"series_point_limit,omitempty"`
+	// PointLimit, when greater than 0, limits the points of all series to
+	// PointLimit, after which no further series are produced and the result set
+	// reports that it was truncated. It is applied after SeriesPointLimit.
+	PointLimit int64 `protobuf:"varint,6,opt,name=point_limit,json=pointLimit,proto3" json:"point_limit,omitempty"`
 }
 
 func (m *ReadFilterRequest) Reset()         { *m = ReadFilterRequest{} }
@@ -1009,6 +1022,27 @@ type TagValuesRequest struct {
 	Range      TimestampRange `protobuf:"bytes,2,opt,name=range,proto3" json:"range"`
 	Predicate  *Predicate     `protobuf:"bytes,3,opt,name=predicate,proto3" json:"predicate,omitempty"`
 	TagKey     string         `protobuf:"bytes,4,opt,name=tag_key,json=tagKey,proto3" json:"tag_key,omitempty"`
+	// Limit, when greater than 0, limits the values returned to the least Limit
+	// values in lexicographic order, so that the result is deterministic.
+	Limit int64 `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	// TagKeyRegex, when not empty, is a regular expression selecting the tag keys
+	// whose values are read by a request for the values of several keys, as
+	// SHOW TAG VALUES WITH KEY =~ /regex/ does. The _measurement and _field keys
+	// are never matched. Limit then applies to the values of each key.
+	TagKeyRegex string `protobuf:"bytes,6,opt,name=tag_key_regex,json=tagKeyRegex,proto3" json:"tag_key_regex,omitempty"`
+	// Offset, when greater than 0, skips the least Offset values of _measurement
+	// in lexicographic order, so that the names can be read in pages of Limit
+	// values.
+	Offset int64 `protobuf:"varint,7,opt,name=offset,proto3" json:"offset,omitempty"`
+	// TagKeys, when not empty, lists the tag keys whose values are read by a
+	// request for the values of several keys, in place of TagKey. The
+	// _measurement and _field keys may be listed. Limit then applies to the
+	// values of each key.
+	TagKeys []string `protobuf:"bytes,8,rep,name=tag_keys,json=tagKeys,proto3" json:"tag_keys,omitempty"`
+	// CountOnly makes TagValues report the number of distinct values of TagKey
+	// rather than the values, so that they are neither sorted nor materialized
+	// as strings. Limit applies to the count as it does to the values.
+	CountOnly bool `protobuf:"varint,9,opt,name=count_only,json=countOnly,proto3" json:"count_only,omitempty"`
 }
 
 func (m *TagValuesRequest) Reset()         { *m = TagValuesRequest{} }
@@ -1487,126 +1521,133 @@ func init() {
 func init() { proto.RegisterFile("storage_common.proto", fileDescriptor_715e4bf4cdf1f73d) }
 
 var fileDescriptor_715e4bf4cdf1f73d = []byte{
-	// 1891 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe4, 0x58, 0xcd, 0x6f, 0x1b, 0xc7,
-	0x15, 0xe7, 0xf2, 0x4b, 0xdc, 0x47, 0x8a, 0x5e, 0x4f, 0x54, 0x47, 0x5e, 0xc7, 0xe4, 0x86, 0x69,
-	0x12, 0x01, 0x75, 0x29, 0x40, 0x49, 0x81, 0xc0, 0xae, 0x81, 0x8a, 0x12, 0x25, 0xb1, 0x16, 0x49,
-	0x61, 0x48, 0xa5, 0x1f, 0x17, 0x76, 0x24, 0x0e, 0xd7, 0x8b, 0x90, 0xbb, 0xec, 0xee, 0xd2, 0x31,
-	0x81, 0x5e, 0x0a, 0xf4, 0x10, 0xf0, 0xd4, 0x02, 0xed, 0xa5, 0x05, 0x4f, 0x3d, 0xf6, 0xd0, 0x5b,
-	0xff, 0x06, 0x17, 0xe8, 0x21, 0xa7, 0xa2, 0x27, 0xa2, 0xa5, 0x81, 0x02, 0x3d, 0xf7, 0xd4, 0xf4,
-	0x52, 0xcc, 0xc7, 0x2e, 0x97, 0xb2, 0xaa, 0x88, 0x86, 0x0f, 0x81, 0x73, 0x9b, 0x79, 0xf3, 0xde,
-	0xef, 0xcd, 0x7b, 0xfb, 0xbe, 0x76, 0x60, 0xc3, 0xf3, 0x1d, 0x97, 0x98, 0xb4, 0x73, 0xee, 0x0c,
-	0x06, 0x8e, 0x5d, 0x1e, 0xba, 0x8e, 0xef, 0xa0, 0x3b, 0x96, 0xdd, 0xeb, 0x8f, 0x9e, 0x76, 0x89,
-	0x4f, 0xca, 0xc3, 0x3e, 0xf1, 0x7b, 0x8e, 0x3b, 0x28, 0x4b, 0x4e, 0x7d, 0xc3, 0x74, 0x4c, 0x87,
-	0xf3, 0x6d, 0xb3, 0x95, 0x10, 0xd1, 0x6f, 0x9b, 0x8e, 0x63, 0xf6, 0xe9, 0x36, 0xdf, 0x9d, 0x8d,
-	0x7a, 0xdb, 0xc4, 0x1e, 0xcb, 0xa3, 0x1b, 0x43, 0x97, 0x76, 0xad, 0x73, 0xe2, 0x53, 0x41, 0x28,
-	0xfd, 0x4b, 0x81, 0x9b, 0x98, 0x92, 0xee, 0x81, 0xd5, 0xf7, 0xa9, 0x8b, 0xe9, 0x4f, 0x47, 0xd4,
-	0xf3, 0x51, 0x15, 0xb2, 0x2e, 0x25, 0xdd, 0x8e, 0xe7, 0x8c, 0xdc, 0x73, 0xba, 0xa9, 0x18, 0xca,
-	0x56, 0x76, 0x67, 0xa3, 0x2c, 0x70, 0xcb, 0x01, 0x6e, 0x79, 0xd7, 0x1e, 0x57, 0xf2, 0xf3, 0x59,
-	0x11, 0x18, 0x42, 0x8b, 0xf3, 0x62, 0x70, 0xc3, 0x35, 0x3a, 0x84, 0x94, 0x4b, 0x6c, 0x93, 0x6e,
-	0xc6, 0x39, 0xc0, 0xb7, 0xca, 0x57, 0xd8, 0x52, 0x6e, 0x5b, 0x03, 0xea, 0xf9, 0x64, 0x30, 0xc4,
-	0x4c, 0xa4, 0x92, 0x7c, 0x36, 0x2b, 0xc6, 0xb0, 0x90, 0x47, 0xfb, 0xa0, 0x86, 0x17, 0xdf, 0x4c,
-	0x70, 0xb0, 0xf7, 0xae, 0x04, 0x3b, 0x09, 0xb8, 0xf1, 0x42, 0xb0, 0xf4, 0x97, 0x14, 0x68, 0xec,
-	0xa6, 0x87, 0xae, 0x33, 0x1a, 0xbe, 0xd6, 0xa6, 0xa2, 0x7b, 0x00, 0x26, 0xb3, 0xb2, 0xf3, 0x09,
-	0x1d, 0x7b, 0x9b, 0x49, 0x23, 0xb1, 0xa5, 0x56, 0xd6, 0xe7, 0xb3, 0xa2, 0xca, 0x6d, 0x7f, 0x44,
-	0xc7, 0x1e, 0x56, 0xcd, 0x60, 0x89, 0x6a, 0x90, 0xe2, 0x9b, 0xcd, 0x94, 0xa1, 0x6c, 0xe5, 0x77,
-	0x3e, 0xb8, 0x52, 0xdf, 0x45, 0x0f, 0x96, 0xc5, 0x46, 0x20, 0xb0, 0xeb, 0x13, 0xd3, 0x74, 0xa9,
-	0xc9, 0xae, 0x9f, 0xbe, 0xc6, 0xf5, 0x77, 0x03, 0x6e, 0xbc, 0x10, 0x44, 0xf7, 0x20, 0xf5, 0xd8,
-	0xb2, 0x7d, 0x6f, 0x73, 0xcd, 0x50, 0xb6, 0xd6, 0x2a, 0xb7, 0xe6, 0xb3, 0x62, 0xea, 0x88, 0x11,
-	0xbe, 0x98, 0x15, 0x55, 0xb6, 0x38, 0xe8, 0x13, 0xd3, 0xc3, 0x82, 0xa9, 0x74, 0x08, 0x29, 0x7e,
-	0x07, 0x74, 0x17, 0xe0, 0x10, 0x37, 0x4f, 0x4f, 0x3a, 0x8d, 0x66, 0xa3, 0xaa, 0xc5, 0xf4, 0xf5,
-	0xc9, 0xd4, 0x10, 0x16, 0x37, 0x1c, 0x9b, 0xa2, 0xdb, 0x90, 0x11, 0xc7, 0x95, 0x1f, 0x69, 0x71,
-	0x3d, 0x3b, 0x99, 0x1a, 0x6b, 0xfc, 0xb0, 0x32, 0xd6, 0x93, 0x9f, 0xfd, 0xbe, 0x10, 0x2b, 0xfd,
-	0x41, 0x81, 0x05, 0x3a, 0xba, 0x03, 0xea, 0x51, 0xad, 0xd1, 0x0e, 0xc0, 0x72, 0x93, 0xa9, 0x91,
-	0x61, 0xa7, 0x1c, 0xeb, 0x9b, 0x90, 0x97, 0x87, 0x9d, 0x93, 0x66, 0xad, 0xd1, 0x6e, 0x69, 0x8a,
-	0xae, 0x4d, 0xa6, 0x46, 0x4e, 0x70, 0x9c, 0x38, 0xec, 0x66, 0x51, 0xae, 0x56, 0x15, 0xd7, 0xaa,
-	0x2d, 0x2d, 0x1e, 0xe5, 0x6a, 0x51, 0xd7, 0xa2, 0x1e, 0xda, 0x86, 0x0d, 0xce, 0xd5, 0xda, 0x3b,
-	0xaa, 0xd6, 0x77, 0x3b, 0xbb, 0xc7, 0xc7, 0x9d, 0x76, 0xad, 0x5e, 0xd5, 0x92, 0xfa, 0x37, 0x26,
-	0x53, 0xe3, 0x26, 0xe3, 0x6d, 0x9d, 0x3f, 0xa6, 0x03, 0xb2, 0xdb, 0xef, 0xb3, 0xd0, 0x91, 0xb7,
-	0xfd, 0x77, 0x1c, 0xd4, 0xd0, 0x7b, 0xe8, 0x08, 0x92, 0xfe, 0x78, 0x28, 0x02, 0x38, 0xbf, 0xf3,
-	0xe1, 0xf5, 0x7c, 0xbe, 0x58, 0xb5, 0xc7, 0x43, 0x8a, 0x39, 0x42, 0xe9, 0x77, 0x71, 0x58, 0x5f,
-	0xa2, 0xa3, 0x22, 0x24, 0xa5, 0x13, 0xf8, 0x85, 0x96, 0x0e, 0xb9, 0x37, 0xee, 0x42, 0xa2, 0x75,
-	0x5a, 0xd7, 0x14, 0x7d, 0x63, 0x32, 0x35, 0xb4, 0xa5, 0xf3, 0xd6, 0x68, 0x80, 0xde, 0x86, 0xd4,
-	0x5e, 0xf3, 0xb4, 0xd1, 0xd6, 0xe2, 0xfa, 0xad, 0xc9, 0xd4, 0x40, 0x4b, 0x0c, 0x7b, 0xce, 0xc8,
-	0xf6, 0x19, 0x42, 0xbd, 0xd6, 0xd0, 0x12, 0x97, 0x20, 0xd4, 0x2d, 0x9b, 0x1f, 0xef, 0xfe, 0x50,
-	0x4b, 0x5e, 0x76, 0x4c, 0x9e, 0x32, 0x05, 0x07, 0x35, 0xdc, 0x6a, 0x6b, 0xa9, 0x4b, 0x14, 0x1c,
-	0x58, 0xae, 0xe7, 0x33, 0x1b, 0x8e, 0x77, 0x5b, 0x6d, 0x2d, 0x7d, 0x89, 0x0d, 0xc7, 0x44, 0x30,
-	0xd4, 0xab, 0xbb, 0x0d, 0x6d, 0xed, 0x12, 0x86, 0x3a, 0x25, 0xb6, 0xf4, 0xfa, 0xb7, 0x21, 0xd1,
-	0x26, 0x26, 0xd2, 0x20, 0xf1, 0x09, 0x1d, 0x73, 0x6f, 0xe7, 0x30, 0x5b, 0xa2, 0x0d, 0x48, 0x3d,
-	0x21, 0xfd, 0x91, 0xa8, 0x00, 0x39, 0x2c, 0x36, 0xa5, 0x5f, 0xe5, 0x21, 0xc7, 0x32, 0x06, 0x53,
-	0x6f, 0xe8, 0xd8, 0x1e, 0x45, 0x75, 0x48, 0xf7, 0x5c, 0x32, 0xa0, 0xde, 0xa6, 0x62, 0x24, 0xb6,
-	0xb2, 0x3b, 0xdb, 0x5f, 0x9a, 0x6c, 0x81, 0x68, 0xf9, 0x80, 0xc9, 0xc9, 0x6a, 0x21, 0x41, 0xf4,
-	0xcf, 0xd2, 0x90, 0xe2, 0x74, 0x74, 0x1c, 0x24, 0xf1, 0x1a, 0xcf, 0xba, 0x0f, 0xaf, 0x8f, 0xcb,
-	0x93, 0x80, 0x83, 0x1c, 0xc5, 0x82, 0x3c, 0x6e, 0x42, 0xda, 0xe3, 0xd1, 0x29, 0x2b, 0xe2, 0x77,
-	0xae, 0x0f, 0x27, 0xa2, 0x3a, 0xc0, 0x93, 0x30, 0x68, 0x08, 0xb9, 0x5e, 0xdf, 0x21, 0x7e, 0x67,
-	0xc8, 0x53, 0x43, 0xd6, 0xc9, 0xfb, 0x2b, 0x58, 0xcf, 0xa4, 0x45, 0x5e, 0x09, 0x47, 0xdc, 0x98,
-	0xcf, 0x8a, 0xd9, 0x08, 0xf5, 0x28, 0x86, 0xb3, 0xbd, 0xc5, 0x16, 0x3d, 0x85, 0xbc, 0x65, 0xfb,
-	0xd4, 0xa4, 0x6e, 0xa0, 0x53, 0x94, 0xd3, 0xef, 0x5e, 0x5f, 0x67, 0x4d, 0xc8, 0x47, 0xb5, 0xde,
-	0x9c, 0xcf, 0x8a, 0xeb, 0x4b, 0xf4, 0xa3, 0x18, 0x5e, 0xb7, 0xa2, 0x04, 0xf4, 0x33, 0xb8, 0x31,
-	0xb2, 0x3d, 0xcb, 0xb4, 0x69, 0x37, 0x50, 0x9d, 0xe4, 0xaa, 0x1f, 0x5e, 0x5f, 0xf5, 0xa9, 0x04,
-	0x88, 0xea, 0x46, 0xf3, 0x59, 0x31, 0xbf, 0x7c, 0x70, 0x14, 0xc3, 0xf9, 0xd1, 0x12, 0x85, 0xd9,
-	0x7d, 0xe6, 0x38, 0x7d, 0x4a, 0xec, 0x40, 0x79, 0x6a, 0x55, 0xbb, 0x2b, 0x42, 0xfe, 0x05, 0xbb,
-	0x97, 0xe8, 0xcc, 0xee, 0xb3, 0x28, 0x01, 0xf9, 0xb0, 0xee, 0xf9, 0xae, 0x65, 0x9b, 0x81, 0x62,
-	0xd1, 0x00, 0x1e, 0xac, 0x10, 0x3b, 0x5c, 0x3c, 0xaa, 0x57, 0x9b, 0xcf, 0x8a, 0xb9, 0x28, 0xf9,
-	0x28, 0x86, 0x73, 0x5e, 0x64, 0x5f, 0x49, 0x43, 0x92, 0x21, 0xeb, 0x4f, 0x01, 0x16, 0x91, 0x8c,
-	0xde, 0x83, 0x8c, 0x4f, 0x4c, 0xd1, 0xff, 0x58, 0xa6, 0xe5, 0x2a, 0xd9, 0xf9, 0xac, 0xb8, 0xd6,
-	0x26, 0x26, 0xef, 0x7e, 0x6b, 0xbe, 0x58, 0xa0, 0x0a, 0xa0, 0x21, 0x71, 0x7d, 0xcb, 0xb7, 0x1c,
-	0x9b, 0x71, 0x77, 0x9e, 0x90, 0x3e, 0x8b, 0x4e, 0x26, 0xb1, 0x31, 0x9f, 0x15, 0xb5, 0x93, 0xe0,
-	0xf4, 0x11, 0x1d, 0x7f, 0x4c, 0xfa, 0x1e, 0xd6, 0x86, 0x17, 0x28, 0xfa, 0x6f, 0x15, 0xc8, 0x46,
-	0xa2, 0x1e, 0xdd, 0x87, 0xa4, 0x4f, 0xcc, 0x20, 0xc3, 0x8d, 0xab, 0x67, 0x01, 0x62, 0xca, 0x94,
-	0xe6, 0x32, 0xa8, 0x09, 0x2a, 0x63, 0xec, 0xf0, 0x62, 0x1e, 0xe7, 0xc5, 0x7c, 0xe7, 0xfa, 0xfe,
-	0xdb, 0x27, 0x3e, 0xe1, 0xa5, 0x3c, 0xd3, 0x95, 0x2b, 0xfd, 0xfb, 0xa0, 0x5d, 0x4c, 0x1d, 0x54,
-	0x00, 0xf0, 0x83, 0x19, 0x44, 0x5c, 0x53, 0xc3, 0x11, 0x0a, 0xba, 0x05, 0x69, 0x5e, 0xbe, 0x84,
-	0x23, 0x14, 0x2c, 0x77, 0xfa, 0x31, 0xa0, 0x17, 0x53, 0x62, 0x45, 0xb4, 0x44, 0x88, 0x56, 0x87,
-	0x37, 0x2e, 0x89, 0xf2, 0x15, 0xe1, 0x92, 0xd1, 0xcb, 0xbd, 0x18, 0xb7, 0x2b, 0xa2, 0x65, 0x42,
-	0xb4, 0x47, 0x70, 0xf3, 0x85, 0x60, 0x5c, 0x11, 0x4c, 0x0d, 0xc0, 0x4a, 0x2d, 0x50, 0x39, 0x80,
-	0xec, 0xa6, 0x69, 0x39, 0x0c, 0xc4, 0xf4, 0x37, 0x26, 0x53, 0xe3, 0x46, 0x78, 0x24, 0xe7, 0x81,
-	0x22, 0xa4, 0xc3, 0x99, 0x62, 0x99, 0x41, 0xdc, 0x45, 0x76, 0xa2, 0x3f, 0x29, 0x90, 0x09, 0xbe,
-	0x37, 0x7a, 0x0b, 0x52, 0x07, 0xc7, 0xcd, 0xdd, 0xb6, 0x16, 0xd3, 0x6f, 0x4e, 0xa6, 0xc6, 0x7a,
-	0x70, 0xc0, 0x3f, 0x3d, 0x32, 0x60, 0xad, 0xd6, 0x68, 0x57, 0x0f, 0xab, 0x38, 0x80, 0x0c, 0xce,
-	0xe5, 0xe7, 0x44, 0x25, 0xc8, 0x9c, 0x36, 0x5a, 0xb5, 0xc3, 0x46, 0x75, 0x5f, 0x8b, 0x8b, 0x2e,
-	0x1b, 0xb0, 0x04, 0xdf, 0x88, 0xa1, 0x54, 0x9a, 0xcd, 0x63, 0xd6, 0x24, 0x13, 0xcb, 0x28, 0xd2,
-	0xef, 0xa8, 0x00, 0xe9, 0x56, 0x1b, 0xd7, 0x1a, 0x87, 0x5a, 0x52, 0x47, 0x93, 0xa9, 0x91, 0x0f,
-	0x18, 0x84, 0x2b, 0xe5, 0xc5, 0xb7, 0x00, 0xf6, 0xc8, 0x90, 0x9c, 0x59, 0x7d, 0xcb, 0x1f, 0x23,
-	0x1d, 0x32, 0x3d, 0x4a, 0xfc, 0x91, 0x2b, 0x5b, 0xa2, 0x8a, 0xc3, 0x7d, 0xe9, 0xcf, 0x0a, 0x6c,
-	0x84, 0xac, 0x16, 0xf5, 0xc2, 0x2e, 0xda, 0x84, 0xe4, 0x39, 0x19, 0x06, 0x19, 0x76, 0x75, 0x81,
-	0xb9, 0x0c, 0x80, 0x11, 0xbd, 0xaa, 0xed, 0xbb, 0x63, 0xcc, 0x81, 0xf4, 0x9f, 0x80, 0x1a, 0x92,
-	0xa2, 0xcd, 0x5d, 0x15, 0xcd, 0xfd, 0x61, 0xb4, 0xb9, 0x67, 0x77, 0xde, 0xbf, 0x9e, 0xc2, 0xb1,
-	0x9c, 0x02, 0xee, 0xc7, 0x3f, 0x52, 0x4a, 0x1f, 0x41, 0x7e, 0x79, 0xee, 0x67, 0x13, 0x83, 0xe7,
-	0x13, 0xd7, 0xe7, 0x8a, 0x12, 0x58, 0x6c, 0x98, 0x72, 0x6a, 0x77, 0xb9, 0xa2, 0x04, 0x66, 0xcb,
-	0xd2, 0x3f, 0x15, 0xc8, 0x07, 0x75, 0x6b, 0xf1, 0xd7, 0xc2, 0xaa, 0xc5, 0xb5, 0xff, 0x5a, 0xda,
-	0xc4, 0xf4, 0x82, 0xbf, 0x16, 0x3f, 0x5c, 0x7f, 0xd5, 0x7e, 0xd0, 0x7e, 0x1e, 0x07, 0xad, 0x4d,
-	0xcc, 0x8f, 0x79, 0xd2, 0xbc, 0xd6, 0xa6, 0xa2, 0x37, 0x61, 0x4d, 0xb6, 0x27, 0x3e, 0x1a, 0xa8,
-	0x38, 0x2d, 0x1a, 0x52, 0xa9, 0x0c, 0x1b, 0x22, 0x59, 0x02, 0x2f, 0xc8, 0x88, 0x5f, 0x94, 0x16,
-	0xde, 0xcd, 0xc2, 0xd2, 0xf2, 0x57, 0x05, 0xde, 0xac, 0x53, 0xe2, 0x8d, 0x5c, 0x3a, 0xa0, 0xb6,
-	0xdf, 0x60, 0x53, 0x61, 0xe0, 0xba, 0x7b, 0x90, 0xfe, 0x72, 0xaf, 0x61, 0xc9, 0xf3, 0x55, 0x0b,
-	0x86, 0x2f, 0x14, 0xb8, 0x1d, 0x31, 0xec, 0x42, 0x02, 0xac, 0x66, 0x9a, 0x01, 0xd9, 0xc1, 0x02,
-	0x8a, 0x1b, 0xa8, 0xe2, 0x28, 0x69, 0x61, 0x7c, 0xe2, 0x55, 0x1a, 0x9f, 0x7c, 0x59, 0xe3, 0x7f,
-	0x13, 0x87, 0x3b, 0xcb, 0xc6, 0x2f, 0x27, 0xc5, 0xab, 0x36, 0x3f, 0x12, 0x8e, 0x89, 0x68, 0x38,
-	0x2e, 0xfc, 0x92, 0x7c, 0x95, 0x7e, 0x49, 0xbd, 0xac, 0x5f, 0xfe, 0xa3, 0xc0, 0x66, 0xc4, 0x2f,
-	0x07, 0x16, 0xed, 0x77, 0xbf, 0x2e, 0x31, 0xf1, 0xdf, 0xc4, 0x52, 0x42, 0x04, 0xb6, 0xcb, 0xfa,
-	0x40, 0x20, 0xdd, 0xe3, 0x14, 0xd9, 0x13, 0xf7, 0xae, 0x54, 0xf0, 0x7f, 0x71, 0xca, 0x75, 0xea,
-	0x79, 0xc4, 0xa4, 0x9c, 0x1a, 0xfe, 0x6b, 0x72, 0x16, 0xfd, 0xd7, 0x0a, 0xe4, 0xa2, 0xc7, 0x97,
-	0xf4, 0xc9, 0xb6, 0x7c, 0x85, 0x10, 0x83, 0xeb, 0xf7, 0x5e, 0xf2, 0x0e, 0x7c, 0xbb, 0x78, 0x91,
-	0x40, 0x6f, 0x81, 0x1a, 0x0e, 0x59, 0xfc, 0x63, 0x68, 0x78, 0x41, 0x28, 0x3d, 0x57, 0x40, 0x0d,
-	0x25, 0xd0, 0xdd, 0xc5, 0x20, 0xc4, 0x27, 0x90, 0xf0, 0x44, 0x4c, 0x42, 0x6f, 0x47, 0x27, 0x21,
-	0x3e, 0xe6, 0x84, 0x0c, 0xc1, 0x28, 0xf4, 0xce, 0xd2, 0x28, 0xc4, 0x1f, 0x03, 0x42, 0x9e, 0x70,
-	0x16, 0x2a, 0x86, 0x93, 0x8e, 0x1c, 0x85, 0x42, 0x16, 0x51, 0xbd, 0x99, 0xa2, 0x60, 0x58, 0x4a,
-	0x5e, 0x50, 0x14, 0x4c, 0x4b, 0xef, 0x82, 0x7a, 0xda, 0xd8, 0xaf, 0x1e, 0xd4, 0x98, 0x26, 0xf9,
-	0x72, 0x11, 0xd1, 0xd4, 0xa5, 0x3d, 0xcb, 0xa6, 0x5d, 0x39, 0x34, 0xfd, 0x31, 0x01, 0x3a, 0x1b,
-	0xf5, 0x7f, 0x60, 0xd9, 0x5d, 0xe7, 0xd3, 0xc5, 0xab, 0xd9, 0x6b, 0xfd, 0x8c, 0x69, 0x40, 0x56,
-	0xd8, 0x5b, 0x7d, 0x42, 0x5d, 0xd1, 0x29, 0x13, 0x38, 0x4a, 0x62, 0x6d, 0xb1, 0xd9, 0xeb, 0x79,
-	0xd4, 0xe7, 0xff, 0x9a, 0x09, 0x2c, 0x77, 0xcb, 0xef, 0x90, 0x29, 0x9e, 0x11, 0x2f, 0xf1, 0x0e,
-	0xf9, 0x00, 0xd2, 0x9f, 0x72, 0x65, 0xf2, 0x51, 0xe5, 0x9d, 0x2b, 0x21, 0xc4, 0xbd, 0xb0, 0x14,
-	0x29, 0xfd, 0x42, 0x81, 0xb4, 0x20, 0xa1, 0x07, 0x90, 0xa2, 0xdc, 0x02, 0xf1, 0x5d, 0xde, 0xbd,
-	0x12, 0x66, 0x7f, 0xe4, 0x12, 0xf6, 0x77, 0x89, 0x85, 0x0c, 0x7a, 0x08, 0x69, 0x47, 0x98, 0x18,
-	0x5f, 0x45, 0x5a, 0x0a, 0x95, 0xda, 0x90, 0x09, 0x68, 0x6c, 0xe2, 0xb4, 0x3d, 0x7a, 0xee, 0x05,
-	0x13, 0x27, 0xdf, 0x30, 0x1f, 0x0e, 0x1c, 0xdb, 0x7f, 0xec, 0xc9, 0xa1, 0x53, 0xee, 0xd8, 0x64,
-	0x6e, 0x33, 0x3f, 0x58, 0x4f, 0xc4, 0x27, 0xcc, 0xe0, 0x70, 0x5f, 0x79, 0xff, 0xd9, 0x3f, 0x0a,
-	0xb1, 0x67, 0xf3, 0x82, 0xf2, 0xf9, 0xbc, 0xa0, 0xfc, 0x7d, 0x5e, 0x50, 0x7e, 0xf9, 0xbc, 0x10,
-	0xfb, 0xfc, 0x79, 0x21, 0xf6, 0xb7, 0xe7, 0x85, 0xd8, 0x8f, 0xf9, 0x2f, 0x2c, 0x4b, 0x5d, 0xef,
-	0x2c, 0xcd, 0x63, 0xef, 0x83, 0xff, 0x05, 0x00, 0x00, 0xff, 0xff, 0x73, 0xf6, 0x75, 0xc6, 0xde,
-	0x18, 0x00, 0x00,
+	// 2005 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe4, 0x58, 0xcd, 0x8f, 0x1a, 0xc9,
+	0x15, 0xa7, 0x69, 0x60, 0xe8, 0xc7, 0x0c, 0x6e, 0xd7, 0x4e, 0xbc, 0xb8, 0xbd, 0x86, 0x36, 0x9b,
+	0xdd, 0x1d, 0x29, 0x0e, 0x96, 0x66, 0x37, 0xd2, 0xca, 0x8e, 0xa5, 0x0c, 0x36, 0x33, 0x43, 0x3c,
+	0x80, 0x55, 0x30, 0x9b, 0x8f, 0x0b, 0x29, 0x0f, 0x45, 0xbb, 0xb5, 0xd0, 0x4d, 0xba, 0x1b, 0xaf,
+	0x91, 0x72, 0xcc, 0x61, 0x85, 0x14, 0x29, 0x91, 0x92, 0x4b, 0x22, 0x4e, 0x39, 0xe6, 0x90, 0x5b,
+	0xfe, 0x06, 0x47, 0xca, 0x61, 0x4f, 0xd1, 0x9e, 0x50, 0x82, 0xa5, 0xfc, 0x03, 0x39, 0x65, 0x73,
+	0x89, 0xea, 0xa3, 0x9b, 0x66, 0x4c, 0xc6, 0x33, 0x96, 0x0f, 0x2b, 0xef, 0xad, 0xea, 0xd5, 0x7b,
+	0xbf, 0x57, 0xef, 0x55, 0xbd, 0x8f, 0x2a, 0xd8, 0xf6, 0x03, 0xd7, 0x23, 0x16, 0xed, 0x9e, 0xb8,
+	0xc3, 0xa1, 0xeb, 0x54, 0x46, 0x9e, 0x1b, 0xb8, 0xe8, 0x9a, 0xed, 0xf4, 0x07, 0xe3, 0xa7, 0x3d,
+	0x12, 0x90, 0xca, 0x68, 0x40, 0x82, 0xbe, 0xeb, 0x0d, 0x2b, 0x92, 0xd3, 0xd8, 0xb6, 0x5c, 0xcb,
+	0xe5, 0x7c, 0xb7, 0xd8, 0x48, 0x88, 0x18, 0x57, 0x2d, 0xd7, 0xb5, 0x06, 0xf4, 0x16, 0x9f, 0x3d,
+	0x1a, 0xf7, 0x6f, 0x11, 0x67, 0x22, 0x97, 0x2e, 0x8d, 0x3c, 0xda, 0xb3, 0x4f, 0x48, 0x40, 0x05,
+	0xa1, 0xfc, 0x65, 0x12, 0x2e, 0x63, 0x4a, 0x7a, 0xfb, 0xf6, 0x20, 0xa0, 0x1e, 0xa6, 0x3f, 0x1f,
+	0x53, 0x3f, 0x40, 0x35, 0xc8, 0x79, 0x94, 0xf4, 0xba, 0xbe, 0x3b, 0xf6, 0x4e, 0x68, 0x41, 0x31,
+	0x95, 0x9d, 0xdc, 0xee, 0x76, 0x45, 0xe0, 0x56, 0x42, 0xdc, 0xca, 0x9e, 0x33, 0xa9, 0xe6, 0x17,
+	0xf3, 0x12, 0x30, 0x84, 0x36, 0xe7, 0xc5, 0xe0, 0x45, 0x63, 0x74, 0x00, 0x69, 0x8f, 0x38, 0x16,
+	0x2d, 0x24, 0x39, 0xc0, 0x77, 0x2a, 0x67, 0xd8, 0x52, 0xe9, 0xd8, 0x43, 0xea, 0x07, 0x64, 0x38,
+	0xc2, 0x4c, 0xa4, 0x9a, 0x7a, 0x36, 0x2f, 0x25, 0xb0, 0x90, 0x47, 0xf7, 0x41, 0x8b, 0x36, 0x5e,
+	0x50, 0x39, 0xd8, 0xfb, 0x67, 0x82, 0x3d, 0x0c, 0xb9, 0xf1, 0x52, 0x10, 0x15, 0x01, 0x7a, 0xd4,
+	0x3f, 0xa1, 0x4e, 0xcf, 0x76, 0xac, 0x42, 0xca, 0x54, 0x76, 0xb2, 0x38, 0x46, 0x41, 0x37, 0x01,
+	0xf9, 0xd4, 0xb3, 0xa9, 0xdf, 0x1d, 0xb9, 0xb6, 0x13, 0x74, 0x07, 0xf6, 0xd0, 0x0e, 0x0a, 0x69,
+	0x53, 0xd9, 0x51, 0xb1, 0x2e, 0x56, 0x1e, 0xb2, 0x85, 0x23, 0x46, 0x47, 0x25, 0xc8, 0xc5, 0xd9,
+	0x32, 0x9c, 0x0d, 0x46, 0x11, 0x43, 0xf9, 0x6f, 0x69, 0xd0, 0x99, 0x63, 0x0e, 0x3c, 0x77, 0x3c,
+	0x7a, 0xb3, 0x3d, 0x7b, 0x13, 0xc0, 0x62, 0x56, 0x76, 0x3f, 0xa5, 0x13, 0xbf, 0x90, 0x32, 0xd5,
+	0x1d, 0xad, 0xba, 0xb5, 0x98, 0x97, 0x34, 0x6e, 0xfb, 0x03, 0x3a, 0xf1, 0xb1, 0x66, 0x85, 0x43,
+	0x54, 0x87, 0x34, 0x9f, 0x70, 0xd7, 0xe6, 0x77, 0x3f, 0x3c, 0x53, 0xdf, 0x69, 0x0f, 0x56, 0xc4,
+	0x44, 0x20, 0xb0, 0xed, 0x13, 0xcb, 0xf2, 0xa8, 0xc5, 0xb6, 0x9f, 0x39, 0xc7, 0xf6, 0xf7, 0x42,
+	0x6e, 0xbc, 0x14, 0x44, 0x37, 0x21, 0xfd, 0xd8, 0x76, 0x02, 0xbf, 0xb0, 0x61, 0x2a, 0x3b, 0x1b,
+	0xd5, 0x2b, 0x8b, 0x79, 0x29, 0x7d, 0xc8, 0x08, 0x5f, 0xcd, 0x4b, 0x1a, 0x1b, 0xec, 0x0f, 0x88,
+	0xe5, 0x63, 0xc1, 0x54, 0x3e, 0x80, 0x34, 0xdf, 0x03, 0xba, 0x0e, 0x70, 0x80, 0x5b, 0xc7, 0x0f,
+	0xbb, 0xcd, 0x56, 0xb3, 0xa6, 0x27, 0x8c, 0xad, 0xe9, 0xcc, 0x14, 0x16, 0x37, 0x5d, 0x87, 0xa2,
+	0xab, 0x90, 0x15, 0xcb, 0xd5, 0x9f, 0xe8, 0x49, 0x23, 0x37, 0x9d, 0x99, 0x1b, 0x7c, 0xb1, 0x3a,
+	0x31, 0x52, 0x9f, 0xff, 0xb1, 0x98, 0x28, 0xff, 0x49, 0x81, 0x25, 0x3a, 0xba, 0x06, 0xda, 0x61,
+	0xbd, 0xd9, 0x09, 0xc1, 0x36, 0xa7, 0x33, 0x33, 0xcb, 0x56, 0x39, 0xd6, 0xb7, 0x21, 0x2f, 0x17,
+	0xbb, 0x0f, 0x5b, 0xf5, 0x66, 0xa7, 0xad, 0x2b, 0x86, 0x3e, 0x9d, 0x99, 0x9b, 0x82, 0x83, 0x5f,
+	0x4b, 0x3f, 0xce, 0xd5, 0xae, 0xe1, 0x7a, 0xad, 0xad, 0x27, 0xe3, 0x5c, 0x6d, 0x7e, 0x85, 0xd1,
+	0x2d, 0xd8, 0xe6, 0x5c, 0xed, 0x7b, 0x87, 0xb5, 0xc6, 0x5e, 0x77, 0xef, 0xe8, 0xa8, 0xdb, 0xa9,
+	0x37, 0x6a, 0x7a, 0xca, 0xf8, 0xd6, 0x74, 0x66, 0x5e, 0x66, 0xbc, 0xed, 0x93, 0xc7, 0x74, 0x48,
+	0xf6, 0x06, 0x03, 0x76, 0x75, 0xe4, 0x6e, 0xff, 0x9d, 0x04, 0x2d, 0xf2, 0x1e, 0x3a, 0x84, 0x54,
+	0x30, 0x19, 0x89, 0x0b, 0x9c, 0xdf, 0xfd, 0xe8, 0x7c, 0x3e, 0x5f, 0x8e, 0x3a, 0x93, 0x11, 0xc5,
+	0x1c, 0xa1, 0xfc, 0x87, 0x24, 0x6c, 0xad, 0xd0, 0x51, 0x09, 0x52, 0xd2, 0x09, 0x7c, 0x43, 0x2b,
+	0x8b, 0xdc, 0x1b, 0xd7, 0x41, 0x6d, 0x1f, 0x37, 0x74, 0xc5, 0xd8, 0x9e, 0xce, 0x4c, 0x7d, 0x65,
+	0xbd, 0x3d, 0x1e, 0xa2, 0x1b, 0x90, 0xbe, 0xd7, 0x3a, 0x6e, 0x76, 0xf4, 0xa4, 0x71, 0x65, 0x3a,
+	0x33, 0xd1, 0x0a, 0xc3, 0x3d, 0x77, 0xec, 0x04, 0x0c, 0xa1, 0x51, 0x6f, 0xea, 0xea, 0x1a, 0x84,
+	0x86, 0xed, 0xf0, 0xe5, 0xbd, 0x1f, 0xeb, 0xa9, 0x75, 0xcb, 0xe4, 0x29, 0x53, 0xb0, 0x5f, 0xc7,
+	0xed, 0x8e, 0x9e, 0x5e, 0xa3, 0x60, 0xdf, 0xf6, 0x7c, 0x96, 0x1d, 0x52, 0x47, 0x7b, 0xed, 0x8e,
+	0x9e, 0x59, 0x63, 0xc3, 0x11, 0x11, 0x0c, 0x8d, 0xda, 0x5e, 0x53, 0xdf, 0x58, 0xc3, 0xd0, 0xa0,
+	0xc4, 0x91, 0x5e, 0xff, 0x2e, 0xa8, 0x1d, 0x62, 0x21, 0x1d, 0xd4, 0x4f, 0xe9, 0x84, 0x7b, 0x7b,
+	0x13, 0xb3, 0x21, 0xda, 0x86, 0xf4, 0x13, 0x32, 0x18, 0x8b, 0x0c, 0xb0, 0x89, 0xc5, 0xa4, 0xfc,
+	0x9b, 0x3c, 0x6c, 0xb2, 0x88, 0xc1, 0xd4, 0x1f, 0xb9, 0x8e, 0x4f, 0x51, 0x03, 0x32, 0x7d, 0x8f,
+	0x0c, 0xa9, 0x5f, 0x50, 0x4c, 0x75, 0x27, 0xb7, 0x7b, 0xeb, 0xa5, 0xc1, 0x16, 0x8a, 0x56, 0xf6,
+	0x99, 0x9c, 0xcc, 0x16, 0x12, 0xc4, 0xf8, 0x3c, 0x03, 0x69, 0x4e, 0x47, 0x47, 0x61, 0x10, 0x6f,
+	0xf0, 0xa8, 0xfb, 0xe8, 0xfc, 0xb8, 0x3c, 0x08, 0x38, 0xc8, 0x61, 0x22, 0x8c, 0xe3, 0x16, 0x64,
+	0x44, 0x82, 0x95, 0x19, 0xf1, 0x7b, 0xe7, 0x87, 0x13, 0xb7, 0x3a, 0xc4, 0x93, 0x30, 0x68, 0x04,
+	0x9b, 0xfd, 0x81, 0x4b, 0x02, 0x91, 0xca, 0x7d, 0x99, 0x27, 0x6f, 0x5f, 0xc0, 0x7a, 0x26, 0x2d,
+	0xe2, 0x4a, 0x38, 0xe2, 0xd2, 0x62, 0x5e, 0xca, 0xc5, 0xa8, 0x87, 0x09, 0x9c, 0xeb, 0x2f, 0xa7,
+	0xe8, 0x29, 0xe4, 0x6d, 0x27, 0xa0, 0x16, 0xf5, 0x42, 0x9d, 0x22, 0x9d, 0x7e, 0xff, 0xfc, 0x3a,
+	0xeb, 0x42, 0x3e, 0xae, 0xf5, 0xf2, 0x62, 0x5e, 0xda, 0x5a, 0xa1, 0x1f, 0x26, 0xf0, 0x96, 0x1d,
+	0x27, 0xa0, 0x5f, 0xc0, 0xa5, 0xb1, 0xe3, 0xdb, 0x96, 0x43, 0x7b, 0xa1, 0xea, 0x14, 0x57, 0x7d,
+	0xf7, 0xfc, 0xaa, 0x8f, 0x25, 0x40, 0x5c, 0x37, 0x5a, 0xcc, 0x4b, 0xf9, 0xd5, 0x85, 0xc3, 0x04,
+	0xce, 0x8f, 0x57, 0x28, 0xcc, 0xee, 0x47, 0xae, 0x3b, 0xa0, 0xc4, 0x09, 0x95, 0xa7, 0x2f, 0x6a,
+	0x77, 0x55, 0xc8, 0xbf, 0x60, 0xf7, 0x0a, 0x9d, 0xd9, 0xfd, 0x28, 0x4e, 0x40, 0x01, 0x6c, 0xf9,
+	0x81, 0x67, 0x3b, 0x56, 0xa8, 0x58, 0x14, 0x80, 0x3b, 0x17, 0xb8, 0x3b, 0x5c, 0x3c, 0xae, 0x57,
+	0x5f, 0xcc, 0x4b, 0x9b, 0x71, 0xf2, 0x61, 0x02, 0x6f, 0xfa, 0xb1, 0x79, 0x35, 0x03, 0x29, 0x86,
+	0x6c, 0x3c, 0x05, 0x58, 0xde, 0x64, 0xf4, 0x3e, 0x64, 0x03, 0x62, 0x89, 0xfa, 0xc7, 0x22, 0x6d,
+	0xb3, 0x9a, 0x5b, 0xcc, 0x4b, 0x1b, 0x1d, 0x62, 0xf1, 0xea, 0xb7, 0x11, 0x88, 0x01, 0xaa, 0x02,
+	0x1a, 0x11, 0x2f, 0xb0, 0x03, 0xdb, 0x75, 0x18, 0x77, 0xf7, 0x09, 0x19, 0xb0, 0xdb, 0xc9, 0x24,
+	0xb6, 0x17, 0xf3, 0x92, 0xfe, 0x30, 0x5c, 0x7d, 0x40, 0x27, 0x9f, 0x90, 0x81, 0x8f, 0xf5, 0xd1,
+	0x29, 0x8a, 0xf1, 0x7b, 0x05, 0x72, 0xb1, 0x5b, 0x8f, 0x6e, 0x43, 0x2a, 0x20, 0x56, 0x18, 0xe1,
+	0xe6, 0xd9, 0xbd, 0x00, 0xb1, 0x64, 0x48, 0x73, 0x19, 0xd4, 0x02, 0x8d, 0x31, 0x76, 0x79, 0x32,
+	0x4f, 0xf2, 0x64, 0xbe, 0x7b, 0x7e, 0xff, 0xdd, 0x27, 0x01, 0xe1, 0xa9, 0x3c, 0xdb, 0x93, 0x23,
+	0xe3, 0x87, 0xa0, 0x9f, 0x0e, 0x1d, 0xd6, 0x78, 0x05, 0x61, 0x0f, 0x22, 0xb6, 0xa9, 0xe3, 0x18,
+	0x05, 0x5d, 0x81, 0x0c, 0x4f, 0x5f, 0xc2, 0x11, 0x0a, 0x96, 0x33, 0xe3, 0x08, 0xd0, 0x8b, 0x21,
+	0x71, 0x41, 0x34, 0x35, 0x42, 0x6b, 0xc0, 0x5b, 0x6b, 0x6e, 0xf9, 0x05, 0xe1, 0x52, 0xf1, 0xcd,
+	0xbd, 0x78, 0x6f, 0x2f, 0x88, 0x96, 0x8d, 0xd0, 0x1e, 0xc0, 0xe5, 0x17, 0x2e, 0xe3, 0x05, 0xc1,
+	0xb4, 0x10, 0xac, 0xdc, 0x06, 0x8d, 0x03, 0xc8, 0x6a, 0x9a, 0x91, 0xcd, 0x40, 0xc2, 0x78, 0x6b,
+	0x3a, 0x33, 0x2f, 0x45, 0x4b, 0xb2, 0x1f, 0x28, 0x41, 0x26, 0xea, 0x29, 0x56, 0x19, 0xc4, 0x5e,
+	0x64, 0x25, 0xfa, 0x8b, 0x02, 0xd9, 0xf0, 0xbc, 0xd1, 0x3b, 0x90, 0xde, 0x3f, 0x6a, 0xed, 0x75,
+	0xf4, 0x84, 0x71, 0x79, 0x3a, 0x33, 0xb7, 0xc2, 0x05, 0x7e, 0xf4, 0xc8, 0x84, 0x8d, 0x7a, 0xb3,
+	0x53, 0x3b, 0xa8, 0xe1, 0x10, 0x32, 0x5c, 0x97, 0xc7, 0x89, 0xca, 0x90, 0x3d, 0x6e, 0xb6, 0xeb,
+	0x07, 0xcd, 0xda, 0x7d, 0x3d, 0x29, 0xaa, 0x6c, 0xc8, 0x12, 0x9e, 0x11, 0x43, 0xa9, 0xb6, 0x5a,
+	0x47, 0xac, 0x48, 0xaa, 0xab, 0x28, 0xd2, 0xef, 0xa8, 0x08, 0x99, 0x76, 0x07, 0xd7, 0x9b, 0x07,
+	0x7a, 0xca, 0x40, 0xd3, 0x99, 0x99, 0x0f, 0x19, 0x84, 0x2b, 0xe5, 0xc6, 0x77, 0x00, 0xee, 0x91,
+	0x11, 0x79, 0x64, 0x0f, 0xec, 0x60, 0x82, 0x0c, 0xc8, 0xf6, 0x29, 0x09, 0xc6, 0x9e, 0x2c, 0x89,
+	0x1a, 0x8e, 0xe6, 0xe5, 0xbf, 0x2a, 0xb0, 0x1d, 0xb1, 0xda, 0xd4, 0x8f, 0xaa, 0x68, 0x0b, 0x52,
+	0x27, 0x64, 0x14, 0x46, 0xd8, 0xd9, 0x09, 0x66, 0x1d, 0x00, 0x23, 0xfa, 0x35, 0x27, 0xf0, 0x26,
+	0x98, 0x03, 0x19, 0x3f, 0x03, 0x2d, 0x22, 0xc5, 0x8b, 0xbb, 0x26, 0x8a, 0xfb, 0xdd, 0x78, 0x71,
+	0xcf, 0xed, 0x7e, 0x70, 0x3e, 0x85, 0x13, 0xd9, 0x05, 0xdc, 0x4e, 0x7e, 0xac, 0x94, 0x3f, 0x86,
+	0xfc, 0x6a, 0xdf, 0xcf, 0x3a, 0x06, 0x3f, 0x20, 0x5e, 0xc0, 0x15, 0xa9, 0x58, 0x4c, 0x98, 0x72,
+	0xea, 0xf4, 0xb8, 0x22, 0x15, 0xb3, 0x61, 0xf9, 0x5f, 0x0a, 0xe4, 0xc3, 0xbc, 0xb5, 0x7c, 0xb5,
+	0xb0, 0x6c, 0x71, 0xee, 0x57, 0x4b, 0x87, 0x58, 0x7e, 0xf8, 0x6a, 0x09, 0xa2, 0xf1, 0xd7, 0xec,
+	0xd5, 0x52, 0xfe, 0x95, 0x0a, 0x7a, 0x87, 0x58, 0x9f, 0xf0, 0xa0, 0x79, 0xa3, 0x4d, 0x45, 0x6f,
+	0xc3, 0x86, 0x2c, 0x4f, 0xbc, 0x35, 0xd0, 0x70, 0x46, 0x14, 0x24, 0x76, 0x29, 0xe2, 0xcf, 0x5c,
+	0x31, 0x41, 0x65, 0xd8, 0x92, 0xec, 0x5d, 0x8f, 0x5a, 0xf4, 0x29, 0xaf, 0xac, 0x1a, 0xce, 0x09,
+	0x21, 0xcc, 0x48, 0x2c, 0xf9, 0xb8, 0xfd, 0xbe, 0x4f, 0x03, 0xde, 0x01, 0xaa, 0x58, 0xce, 0xd8,
+	0xb3, 0x27, 0xaa, 0x84, 0x59, 0x1e, 0x60, 0x51, 0xf1, 0xbb, 0x0e, 0x70, 0xc2, 0xda, 0xef, 0xae,
+	0xeb, 0x0c, 0x26, 0x05, 0x8d, 0x3f, 0xc0, 0x35, 0x4e, 0x69, 0x39, 0x83, 0x49, 0xb9, 0x02, 0xdb,
+	0x22, 0x70, 0xc3, 0x13, 0x91, 0xd1, 0xb7, 0x4c, 0x73, 0xbc, 0xb2, 0x46, 0x69, 0xee, 0xef, 0x0a,
+	0xbc, 0xdd, 0xa0, 0xc4, 0x1f, 0x7b, 0x74, 0x48, 0x9d, 0xa0, 0x49, 0x86, 0xcb, 0x63, 0xbc, 0x09,
+	0x99, 0x97, 0x9f, 0x20, 0xce, 0xf8, 0x5f, 0xc7, 0xd3, 0x2a, 0x7f, 0xa5, 0xc0, 0xd5, 0x98, 0x61,
+	0xa7, 0x82, 0xf1, 0x62, 0xa6, 0x99, 0x90, 0x1b, 0x2e, 0xa1, 0xb8, 0x81, 0x1a, 0x8e, 0x93, 0x96,
+	0xc6, 0xab, 0xaf, 0xd3, 0xf8, 0xd4, 0xab, 0x1a, 0xff, 0xbb, 0x24, 0x5c, 0x5b, 0x35, 0x7e, 0x35,
+	0x40, 0x5f, 0xb7, 0xf9, 0xb1, 0xd0, 0x50, 0x57, 0x42, 0x23, 0xf2, 0x4b, 0xea, 0x75, 0xfa, 0x25,
+	0xfd, 0xaa, 0x7e, 0xf9, 0x8f, 0x02, 0x85, 0x98, 0x5f, 0xf6, 0x6d, 0x3a, 0xe8, 0x7d, 0x53, 0xee,
+	0xc4, 0x7f, 0x55, 0xb8, 0xba, 0xc6, 0x76, 0x99, 0x1f, 0x08, 0x64, 0xfa, 0x9c, 0x22, 0xeb, 0xf3,
+	0xbd, 0x33, 0x15, 0xfc, 0x5f, 0x9c, 0x4a, 0x83, 0xfa, 0x3e, 0xb1, 0x28, 0xa7, 0x46, 0xef, 0x5e,
+	0xce, 0x62, 0xfc, 0x56, 0x81, 0xcd, 0xf8, 0xf2, 0x9a, 0x9a, 0xdd, 0x91, 0x3f, 0x22, 0xa2, 0x89,
+	0xfe, 0xc1, 0x2b, 0xee, 0x81, 0x4f, 0x97, 0xbf, 0x23, 0xe8, 0x1d, 0xd0, 0xa2, 0x86, 0x8f, 0x1f,
+	0x86, 0x8e, 0x97, 0x84, 0xf2, 0x73, 0x05, 0xb4, 0x48, 0x02, 0x5d, 0x5f, 0x36, 0x65, 0xbc, 0x1b,
+	0x8a, 0x56, 0x44, 0x57, 0x76, 0x23, 0xde, 0x95, 0xf1, 0x96, 0x2b, 0x62, 0x08, 0xdb, 0xb2, 0x77,
+	0x57, 0xda, 0x32, 0xfe, 0x31, 0x11, 0xf1, 0x44, 0x7d, 0x59, 0x29, 0xea, 0xba, 0x64, 0x5b, 0x16,
+	0xb1, 0x88, 0xec, 0x8d, 0x6e, 0x2c, 0x1b, 0xb7, 0xd4, 0x29, 0x45, 0x61, 0xe7, 0xf6, 0x1e, 0x68,
+	0xc7, 0xcd, 0xfb, 0xb5, 0xfd, 0x3a, 0xd3, 0x24, 0x7f, 0x51, 0x62, 0x9a, 0x7a, 0xb4, 0x6f, 0x3b,
+	0xb4, 0x27, 0x1b, 0xb8, 0x3f, 0xab, 0x60, 0xb0, 0x67, 0xc7, 0x8f, 0x6c, 0xa7, 0xe7, 0x7e, 0xb6,
+	0xfc, 0xc1, 0x7b, 0xa3, 0xbf, 0x54, 0x4d, 0xc8, 0x09, 0x7b, 0x6b, 0x4f, 0xa8, 0x27, 0xaa, 0xb6,
+	0x8a, 0xe3, 0x24, 0x56, 0x16, 0x5b, 0xa2, 0x00, 0x8b, 0xbf, 0x67, 0x39, 0x5b, 0xfd, 0x13, 0x4d,
+	0x9b, 0xea, 0x4b, 0xf5, 0xaf, 0xfd, 0x13, 0xbd, 0x03, 0x99, 0xcf, 0xb8, 0x32, 0xf9, 0xc1, 0xf3,
+	0xee, 0x99, 0x10, 0x62, 0x5f, 0x58, 0x8a, 0x94, 0x7f, 0xa9, 0x40, 0x46, 0x90, 0xd0, 0x1d, 0x48,
+	0x53, 0x6e, 0x81, 0x38, 0x97, 0xf7, 0xce, 0x84, 0xb9, 0x3f, 0xf6, 0x08, 0x7b, 0xe9, 0x62, 0x21,
+	0x83, 0xee, 0x46, 0x3d, 0x46, 0xf2, 0x22, 0xd2, 0x52, 0xa8, 0xdc, 0x81, 0x6c, 0x48, 0x63, 0x8d,
+	0x8e, 0xe3, 0xd3, 0x13, 0x3f, 0xec, 0x7e, 0xf9, 0x84, 0xf9, 0x70, 0xe8, 0x3a, 0xc1, 0x63, 0x5f,
+	0x36, 0xc0, 0x72, 0xc6, 0x5e, 0x09, 0x0e, 0xf3, 0x83, 0xfd, 0x44, 0x1c, 0x61, 0x16, 0x47, 0xf3,
+	0xea, 0x07, 0xcf, 0xfe, 0x59, 0x4c, 0x3c, 0x5b, 0x14, 0x95, 0x2f, 0x16, 0x45, 0xe5, 0x1f, 0x8b,
+	0xa2, 0xf2, 0xeb, 0xe7, 0xc5, 0xc4, 0x17, 0xcf, 0x8b, 0x89, 0x2f, 0x9f, 0x17, 0x13, 0x3f, 0xe5,
+	0xcf, 0x69, 0x16, 0xba, 0xfe, 0xa3, 0x0c, 0xbf, 0x7b, 0x1f, 0xfe, 0x6f, 0x00, 0x2e, 0x69, 0x46,
+	0x2d, 0xd9, 0x19, 0x00, 0x00,
 }
 
 func (m *ReadFilterRequest) Marshal() (dAtA []byte, err error) {
@@ -1629,6 +1670,26 @@ func (m *ReadFilterRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.PointLimit != 0 {
+		i = encodeVarintStorageCommon(dAtA, i, uint64(m.PointLimit))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.SeriesPointLimit != 0 {
+		i = encodeVarintStorageCommon(dAtA, i, uint64(m.SeriesPointLimit))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.Descending {
+		i--
+		if m.Descending {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x20
+	}
 	if m.Predicate != nil {
 		{
 			size, err := m.Predicate.MarshalToSizedBuffer(dAtA[:i])
@@ -2539,6 +2600,42 @@ func (m *TagValuesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.CountOnly {
+		i--
+		if m.CountOnly {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x48
+	}
+	if len(m.TagKeys) > 0 {
+		for iNdEx := len(m.TagKeys) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.TagKeys[iNdEx])
+			copy(dAtA[i:], m.TagKeys[iNdEx])
+			i = encodeVarintStorageCommon(dAtA, i, uint64(len(m.TagKeys[iNdEx])))
+			i--
+			dAtA[i] = 0x42
+		}
+	}
+	if m.Offset != 0 {
+		i = encodeVarintStorageCommon(dAtA, i, uint64(m.Offset))
+		i--
+		dAtA[i] = 0x38
+	}
+	if len(m.TagKeyRegex) > 0 {
+		i -= len(m.TagKeyRegex)
+		copy(dAtA[i:], m.TagKeyRegex)
+		i = encodeVarintStorageCommon(dAtA, i, uint64(len(m.TagKeyRegex)))
+		i--
+		dAtA[i] = 0x32
+	}
+	if m.Limit != 0 {
+		i = encodeVarintStorageCommon(dAtA, i, uint64(m.Limit))
+		i--
+		dAtA[i] = 0x28
+	}
 	if len(m.TagKey) > 0 {
 		i -= len(m.TagKey)
 		copy(dAtA[i:], m.TagKey)
@@ -3159,6 +3256,15 @@ func (m *ReadFilterRequest) Size() (n int) {
 		l = m.Predicate.Size()
 		n += 1 + l + sovStorageCommon(uint64(l))
 	}
+	if m.Descending {
+		n += 2
+	}
+	if m.SeriesPointLimit != 0 {
+		n += 1 + sovStorageCommon(uint64(m.SeriesPointLimit))
+	}
+	if m.PointLimit != 0 {
+		n += 1 + sovStorageCommon(uint64(m.PointLimit))
+	}
 	return n
 }
 
@@ -3553,6 +3659,25 @@ func (m *TagValuesRequest) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovStorageCommon(uint64(l))
 	}
+	if m.Limit != 0 {
+		n += 1 + sovStorageCommon(uint64(m.Limit))
+	}
+	l = len(m.TagKeyRegex)
+	if l > 0 {
+		n += 1 + l + sovStorageCommon(uint64(l))
+	}
+	if m.Offset != 0 {
+		n += 1 + sovStorageCommon(uint64(m.Offset))
+	}
+	if len(m.TagKeys) > 0 {
+		for _, s := range m.TagKeys {
+			l = len(s)
+			n += 1 + l + sovStorageCommon(uint64(l))
+		}
+	}
+	if m.CountOnly {
+		n += 2
+	}
 	return n
 }
 
@@ -3907,6 +4032,64 @@ func (m *ReadFilterRequest) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Descending", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Descending = bool(v != 0)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SeriesPointLimit", wireType)
+			}
+			m.SeriesPointLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SeriesPointLimit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PointLimit", wireType)
+			}
+			m.PointLimit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PointLimit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStorageCommon(dAtA[iNdEx:])
@@ -6502,6 +6685,128 @@ func (m *TagValuesRequest) Unmarshal(dAtA []byte) error {
 			}
 			m.TagKey = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Limit", wireType)
+			}
+			m.Limit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Limit |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TagKeyRegex", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthStorageCommon
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthStorageCommon
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TagKeyRegex = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Offset", wireType)
+			}
+			m.Offset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Offset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TagKeys", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthStorageCommon
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthStorageCommon
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TagKeys = append(m.TagKeys, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CountOnly", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStorageCommon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.CountOnly = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStorageCommon(dAtA[iNdEx:])
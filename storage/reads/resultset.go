@@ -19,10 +19,18 @@ type resultSet struct {
 }
 
 func NewFilteredResultSet(ctx context.Context, start, end int64, seriesCursor SeriesCursor) ResultSet {
+	return NewFilteredResultSetOrder(ctx, start, end, true, seriesCursor)
+}
+
+// NewFilteredResultSetOrder is like NewFilteredResultSet, but the cursors
+// produce points in descending order of time unless asc is true. The shards
+// of each series row are read in order, so for a descending read they
+// should be ordered newest first.
+func NewFilteredResultSetOrder(ctx context.Context, start, end int64, asc bool, seriesCursor SeriesCursor) ResultSet {
 	return &resultSet{
 		ctx:          ctx,
 		seriesCursor: seriesCursor,
-		arrayCursors: newMultiShardArrayCursors(ctx, start, end, true),
+		arrayCursors: newMultiShardArrayCursors(ctx, start, end, asc),
 	}
 }
 
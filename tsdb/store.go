@@ -686,6 +686,72 @@ func (s *Store) CreateShardSnapshot(id uint64) (string, error) {
 	return sh.CreateSnapshot()
 }
 
+// Snapshot returns a read-only Store holding a point-in-time copy of the
+// shards with the given IDs, which is not affected by writes, deletes or
+// compactions performed afterwards. IDs of shards that do not exist are
+// ignored. The TSM files of each shard are hard linked, as by
+// CreateShardSnapshot, into a directory next to the store's path. The index
+// files are not linked, and the shards of the copy are opened with an
+// in-memory index rebuilt from the TSM files. release closes the returned
+// Store and removes its files.
+func (s *Store) Snapshot(ctx context.Context, shardIDs []uint64) (_ *Store, release func() error, err error) {
+	dir, err := ioutil.TempDir(filepath.Dir(s.path), filepath.Base(s.path)+".snapshot")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	dataPath := filepath.Join(dir, "data")
+	for _, id := range shardIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		sh := s.Shard(id)
+		if sh == nil {
+			continue
+		}
+
+		tmpPath, err := sh.CreateSnapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+		path := filepath.Join(dataPath, sh.Database(), sh.RetentionPolicy(), strconv.FormatUint(id, 10))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			os.RemoveAll(tmpPath)
+			return nil, nil, err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.RemoveAll(tmpPath)
+			return nil, nil, err
+		}
+	}
+
+	ss := NewStore(dataPath)
+	ss.WithLogger(s.baseLogger)
+	ss.EngineOptions = s.EngineOptions
+	ss.EngineOptions.IndexVersion = InmemIndexName
+	ss.EngineOptions.Config.WALDir = filepath.Join(dir, "wal")
+	ss.EngineOptions.CompactionDisabled = true
+	ss.EngineOptions.MonitorDisabled = true
+	if err := ss.Open(); err != nil {
+		return nil, nil, err
+	}
+
+	release = func() error {
+		err := ss.Close()
+		if rerr := os.RemoveAll(dir); err == nil {
+			err = rerr
+		}
+		return err
+	}
+	return ss, release, nil
+}
+
 // SetShardEnabled enables or disables a shard for read and writes.
 func (s *Store) SetShardEnabled(shardID uint64, enabled bool) error {
 	sh := s.Shard(shardID)
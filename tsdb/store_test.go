@@ -795,6 +795,82 @@ func TestStore_BackupRestoreShard(t *testing.T) {
 		})
 	}
 }
+
+// Ensure a snapshot of the store is not affected by later writes.
+func TestStore_Snapshot(t *testing.T) {
+	test := func(t *testing.T, index string) {
+		s := MustOpenStore(index)
+		defer s.Close()
+
+		s.MustCreateShardWithData("db0", "rp0", 100,
+			`cpu value=1 0`,
+			`cpu value=2 10`,
+		)
+		s.MustCreateShardWithData("db0", "rp0", 101, `mem value=1 0`)
+
+		ss, release, err := s.Snapshot(context.Background(), []uint64{100, 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the requested shards are copied.
+		if got, exp := ss.ShardIDs(), []uint64{100}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("snapshot shards: got %v, exp %v", got, exp)
+		}
+		if got, exp := ss.Shard(100).IndexType(), tsdb.InmemIndexName; got != exp {
+			t.Fatalf("snapshot index: got %s, exp %s", got, exp)
+		}
+
+		s.MustWriteToShardString(100, `cpu value=3 20`)
+
+		values := func(st *tsdb.Store) []float64 {
+			m := &influxql.Measurement{Name: "cpu"}
+			itr, err := st.Shard(100).CreateIterator(context.Background(), m, query.IteratorOptions{
+				Expr:      influxql.MustParseExpr(`value`),
+				Ascending: true,
+				StartTime: influxql.MinTime,
+				EndTime:   influxql.MaxTime,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer itr.Close()
+
+			var a []float64
+			fitr := itr.(query.FloatIterator)
+			for p, err := fitr.Next(); p != nil || err != nil; p, err = fitr.Next() {
+				if err != nil {
+					t.Fatal(err)
+				}
+				a = append(a, p.Value)
+			}
+			return a
+		}
+
+		if got, exp := values(ss), []float64{1, 2}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("snapshot: got %v, exp %v", got, exp)
+		}
+		if got, exp := values(s.Store), []float64{1, 2, 3}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("store: got %v, exp %v", got, exp)
+		}
+
+		// Releasing the snapshot removes its files only.
+		if err := release(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(ss.Path()); !os.IsNotExist(err) {
+			t.Fatalf("expected snapshot files to be removed, got %v", err)
+		}
+		if got, exp := values(s.Store), []float64{1, 2, 3}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("store after release: got %v, exp %v", got, exp)
+		}
+	}
+
+	for _, index := range tsdb.RegisteredIndexes() {
+		t.Run(index, func(t *testing.T) { test(t, index) })
+	}
+}
+
 func TestStore_Shard_SeriesN(t *testing.T) {
 
 	test := func(index string) error {
@@ -0,0 +1,2346 @@
+// Generated by tmpl
+// https://github.com/benbjohnson/tmpl
+//
+// DO NOT EDIT!
+// Source: array_cursor.gen.go.tmpl
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+func newSizeLimitArrayCursor(cur cursors.Cursor, rs *sizeLimitResultSet) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatSizeLimitArrayCursor{FloatArrayCursor: cur, rs: rs}
+
+	case cursors.IntegerArrayCursor:
+		return &integerSizeLimitArrayCursor{IntegerArrayCursor: cur, rs: rs}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedSizeLimitArrayCursor{UnsignedArrayCursor: cur, rs: rs}
+
+	case cursors.StringArrayCursor:
+		return &stringSizeLimitArrayCursor{StringArrayCursor: cur, rs: rs}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanSizeLimitArrayCursor{BooleanArrayCursor: cur, rs: rs}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatSizeLimitArrayCursor truncates the arrays of the underlying cursor
+// once the byte budget of the result set is exhausted.
+type floatSizeLimitArrayCursor struct {
+	cursors.FloatArrayCursor
+	rs *sizeLimitResultSet
+}
+
+func (c *floatSizeLimitArrayCursor) Next() *cursors.FloatArray {
+	if c.rs.truncated {
+		return &cursors.FloatArray{}
+	}
+
+	a := c.FloatArrayCursor.Next()
+	for i := range a.Timestamps {
+		if !c.rs.take(timestampSize + 8) {
+			a.Timestamps = a.Timestamps[:i]
+			a.Values = a.Values[:i]
+			break
+		}
+	}
+	return a
+}
+
+// integerSizeLimitArrayCursor truncates the arrays of the underlying cursor
+// once the byte budget of the result set is exhausted.
+type integerSizeLimitArrayCursor struct {
+	cursors.IntegerArrayCursor
+	rs *sizeLimitResultSet
+}
+
+func (c *integerSizeLimitArrayCursor) Next() *cursors.IntegerArray {
+	if c.rs.truncated {
+		return &cursors.IntegerArray{}
+	}
+
+	a := c.IntegerArrayCursor.Next()
+	for i := range a.Timestamps {
+		if !c.rs.take(timestampSize + 8) {
+			a.Timestamps = a.Timestamps[:i]
+			a.Values = a.Values[:i]
+			break
+		}
+	}
+	return a
+}
+
+// unsignedSizeLimitArrayCursor truncates the arrays of the underlying cursor
+// once the byte budget of the result set is exhausted.
+type unsignedSizeLimitArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	rs *sizeLimitResultSet
+}
+
+func (c *unsignedSizeLimitArrayCursor) Next() *cursors.UnsignedArray {
+	if c.rs.truncated {
+		return &cursors.UnsignedArray{}
+	}
+
+	a := c.UnsignedArrayCursor.Next()
+	for i := range a.Timestamps {
+		if !c.rs.take(timestampSize + 8) {
+			a.Timestamps = a.Timestamps[:i]
+			a.Values = a.Values[:i]
+			break
+		}
+	}
+	return a
+}
+
+// stringSizeLimitArrayCursor truncates the arrays of the underlying cursor
+// once the byte budget of the result set is exhausted.
+type stringSizeLimitArrayCursor struct {
+	cursors.StringArrayCursor
+	rs *sizeLimitResultSet
+}
+
+func (c *stringSizeLimitArrayCursor) Next() *cursors.StringArray {
+	if c.rs.truncated {
+		return &cursors.StringArray{}
+	}
+
+	a := c.StringArrayCursor.Next()
+	for i := range a.Timestamps {
+		if !c.rs.take(timestampSize + int64(len(a.Values[i]))) {
+			a.Timestamps = a.Timestamps[:i]
+			a.Values = a.Values[:i]
+			break
+		}
+	}
+	return a
+}
+
+// booleanSizeLimitArrayCursor truncates the arrays of the underlying cursor
+// once the byte budget of the result set is exhausted.
+type booleanSizeLimitArrayCursor struct {
+	cursors.BooleanArrayCursor
+	rs *sizeLimitResultSet
+}
+
+func (c *booleanSizeLimitArrayCursor) Next() *cursors.BooleanArray {
+	if c.rs.truncated {
+		return &cursors.BooleanArray{}
+	}
+
+	a := c.BooleanArrayCursor.Next()
+	for i := range a.Timestamps {
+		if !c.rs.take(timestampSize + 1) {
+			a.Timestamps = a.Timestamps[:i]
+			a.Values = a.Values[:i]
+			break
+		}
+	}
+	return a
+}
+
+// newMergeArrayCursor returns a cursor merging the points of curs, which are
+// ordered by ascending precedence. Cursors of a different type than the first
+// are closed and ignored.
+func newMergeArrayCursor(curs []cursors.Cursor) cursors.Cursor {
+	switch curs[0].(type) {
+
+	case cursors.FloatArrayCursor:
+		c := &floatMergeArrayCursor{}
+		for _, cur := range curs {
+			if cur, ok := cur.(cursors.FloatArrayCursor); ok {
+				c.curs = append(c.curs, cur)
+			} else {
+				cur.Close()
+			}
+		}
+		return c
+
+	case cursors.IntegerArrayCursor:
+		c := &integerMergeArrayCursor{}
+		for _, cur := range curs {
+			if cur, ok := cur.(cursors.IntegerArrayCursor); ok {
+				c.curs = append(c.curs, cur)
+			} else {
+				cur.Close()
+			}
+		}
+		return c
+
+	case cursors.UnsignedArrayCursor:
+		c := &unsignedMergeArrayCursor{}
+		for _, cur := range curs {
+			if cur, ok := cur.(cursors.UnsignedArrayCursor); ok {
+				c.curs = append(c.curs, cur)
+			} else {
+				cur.Close()
+			}
+		}
+		return c
+
+	case cursors.StringArrayCursor:
+		c := &stringMergeArrayCursor{}
+		for _, cur := range curs {
+			if cur, ok := cur.(cursors.StringArrayCursor); ok {
+				c.curs = append(c.curs, cur)
+			} else {
+				cur.Close()
+			}
+		}
+		return c
+
+	case cursors.BooleanArrayCursor:
+		c := &booleanMergeArrayCursor{}
+		for _, cur := range curs {
+			if cur, ok := cur.(cursors.BooleanArrayCursor); ok {
+				c.curs = append(c.curs, cur)
+			} else {
+				cur.Close()
+			}
+		}
+		return c
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", curs[0]))
+	}
+}
+
+// floatMergeArrayCursor merges the points of several ascending cursors,
+// which are read in full on the first call to Next. Where timestamps
+// coincide, the value of the later cursor is used.
+type floatMergeArrayCursor struct {
+	curs  []cursors.FloatArrayCursor
+	res   *cursors.FloatArray
+	tmp   cursors.FloatArray
+	stats cursors.CursorStats
+	err   error
+}
+
+func (c *floatMergeArrayCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+	c.curs = nil
+}
+
+func (c *floatMergeArrayCursor) Err() error { return c.err }
+
+func (c *floatMergeArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+func (c *floatMergeArrayCursor) Next() *cursors.FloatArray {
+	if c.res == nil {
+		c.res = &cursors.FloatArray{}
+		for _, cur := range c.curs {
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				// The array is reused by the cursor, so it is copied.
+				b := &cursors.FloatArray{
+					Timestamps: append([]int64(nil), a.Timestamps...),
+					Values:     append([]float64(nil), a.Values...),
+				}
+				c.res.Merge(b)
+			}
+			if err := cur.Err(); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.stats.Add(cur.Stats())
+		}
+		c.Close()
+	}
+
+	n := c.res.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.res.Timestamps = c.res.Timestamps[:n], c.res.Timestamps[n:]
+	c.tmp.Values, c.res.Values = c.res.Values[:n], c.res.Values[n:]
+	return &c.tmp
+}
+
+// integerMergeArrayCursor merges the points of several ascending cursors,
+// which are read in full on the first call to Next. Where timestamps
+// coincide, the value of the later cursor is used.
+type integerMergeArrayCursor struct {
+	curs  []cursors.IntegerArrayCursor
+	res   *cursors.IntegerArray
+	tmp   cursors.IntegerArray
+	stats cursors.CursorStats
+	err   error
+}
+
+func (c *integerMergeArrayCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+	c.curs = nil
+}
+
+func (c *integerMergeArrayCursor) Err() error { return c.err }
+
+func (c *integerMergeArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+func (c *integerMergeArrayCursor) Next() *cursors.IntegerArray {
+	if c.res == nil {
+		c.res = &cursors.IntegerArray{}
+		for _, cur := range c.curs {
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				// The array is reused by the cursor, so it is copied.
+				b := &cursors.IntegerArray{
+					Timestamps: append([]int64(nil), a.Timestamps...),
+					Values:     append([]int64(nil), a.Values...),
+				}
+				c.res.Merge(b)
+			}
+			if err := cur.Err(); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.stats.Add(cur.Stats())
+		}
+		c.Close()
+	}
+
+	n := c.res.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.res.Timestamps = c.res.Timestamps[:n], c.res.Timestamps[n:]
+	c.tmp.Values, c.res.Values = c.res.Values[:n], c.res.Values[n:]
+	return &c.tmp
+}
+
+// unsignedMergeArrayCursor merges the points of several ascending cursors,
+// which are read in full on the first call to Next. Where timestamps
+// coincide, the value of the later cursor is used.
+type unsignedMergeArrayCursor struct {
+	curs  []cursors.UnsignedArrayCursor
+	res   *cursors.UnsignedArray
+	tmp   cursors.UnsignedArray
+	stats cursors.CursorStats
+	err   error
+}
+
+func (c *unsignedMergeArrayCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+	c.curs = nil
+}
+
+func (c *unsignedMergeArrayCursor) Err() error { return c.err }
+
+func (c *unsignedMergeArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+func (c *unsignedMergeArrayCursor) Next() *cursors.UnsignedArray {
+	if c.res == nil {
+		c.res = &cursors.UnsignedArray{}
+		for _, cur := range c.curs {
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				// The array is reused by the cursor, so it is copied.
+				b := &cursors.UnsignedArray{
+					Timestamps: append([]int64(nil), a.Timestamps...),
+					Values:     append([]uint64(nil), a.Values...),
+				}
+				c.res.Merge(b)
+			}
+			if err := cur.Err(); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.stats.Add(cur.Stats())
+		}
+		c.Close()
+	}
+
+	n := c.res.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.res.Timestamps = c.res.Timestamps[:n], c.res.Timestamps[n:]
+	c.tmp.Values, c.res.Values = c.res.Values[:n], c.res.Values[n:]
+	return &c.tmp
+}
+
+// stringMergeArrayCursor merges the points of several ascending cursors,
+// which are read in full on the first call to Next. Where timestamps
+// coincide, the value of the later cursor is used.
+type stringMergeArrayCursor struct {
+	curs  []cursors.StringArrayCursor
+	res   *cursors.StringArray
+	tmp   cursors.StringArray
+	stats cursors.CursorStats
+	err   error
+}
+
+func (c *stringMergeArrayCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+	c.curs = nil
+}
+
+func (c *stringMergeArrayCursor) Err() error { return c.err }
+
+func (c *stringMergeArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+func (c *stringMergeArrayCursor) Next() *cursors.StringArray {
+	if c.res == nil {
+		c.res = &cursors.StringArray{}
+		for _, cur := range c.curs {
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				// The array is reused by the cursor, so it is copied.
+				b := &cursors.StringArray{
+					Timestamps: append([]int64(nil), a.Timestamps...),
+					Values:     append([]string(nil), a.Values...),
+				}
+				c.res.Merge(b)
+			}
+			if err := cur.Err(); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.stats.Add(cur.Stats())
+		}
+		c.Close()
+	}
+
+	n := c.res.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.res.Timestamps = c.res.Timestamps[:n], c.res.Timestamps[n:]
+	c.tmp.Values, c.res.Values = c.res.Values[:n], c.res.Values[n:]
+	return &c.tmp
+}
+
+// booleanMergeArrayCursor merges the points of several ascending cursors,
+// which are read in full on the first call to Next. Where timestamps
+// coincide, the value of the later cursor is used.
+type booleanMergeArrayCursor struct {
+	curs  []cursors.BooleanArrayCursor
+	res   *cursors.BooleanArray
+	tmp   cursors.BooleanArray
+	stats cursors.CursorStats
+	err   error
+}
+
+func (c *booleanMergeArrayCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+	c.curs = nil
+}
+
+func (c *booleanMergeArrayCursor) Err() error { return c.err }
+
+func (c *booleanMergeArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+func (c *booleanMergeArrayCursor) Next() *cursors.BooleanArray {
+	if c.res == nil {
+		c.res = &cursors.BooleanArray{}
+		for _, cur := range c.curs {
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				// The array is reused by the cursor, so it is copied.
+				b := &cursors.BooleanArray{
+					Timestamps: append([]int64(nil), a.Timestamps...),
+					Values:     append([]bool(nil), a.Values...),
+				}
+				c.res.Merge(b)
+			}
+			if err := cur.Err(); err != nil && c.err == nil {
+				c.err = err
+			}
+			c.stats.Add(cur.Stats())
+		}
+		c.Close()
+	}
+
+	n := c.res.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.res.Timestamps = c.res.Timestamps[:n], c.res.Timestamps[n:]
+	c.tmp.Values, c.res.Values = c.res.Values[:n], c.res.Values[n:]
+	return &c.tmp
+}
+
+func newTimeShiftArrayCursor(cur cursors.Cursor, offset int64) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatTimeShiftArrayCursor{FloatArrayCursor: cur, offset: offset}
+
+	case cursors.IntegerArrayCursor:
+		return &integerTimeShiftArrayCursor{IntegerArrayCursor: cur, offset: offset}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedTimeShiftArrayCursor{UnsignedArrayCursor: cur, offset: offset}
+
+	case cursors.StringArrayCursor:
+		return &stringTimeShiftArrayCursor{StringArrayCursor: cur, offset: offset}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanTimeShiftArrayCursor{BooleanArrayCursor: cur, offset: offset}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatTimeShiftArrayCursor adds a constant offset to the timestamps of
+// the underlying cursor, dropping points whose timestamps would fall outside
+// the range of valid timestamps.
+type floatTimeShiftArrayCursor struct {
+	cursors.FloatArrayCursor
+	offset int64
+}
+
+func (c *floatTimeShiftArrayCursor) Next() *cursors.FloatArray {
+	for {
+		a := c.FloatArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		// The timestamps are ascending, so only the points at the end of
+		// the series may overflow and only those at the start may underflow.
+		i, j := 0, len(a.Timestamps)
+		if c.offset > 0 {
+			for j > 0 && a.Timestamps[j-1] > models.MaxNanoTime-c.offset {
+				j--
+			}
+		} else {
+			for i < j && a.Timestamps[i] < models.MinNanoTime-c.offset {
+				i++
+			}
+		}
+		a.Timestamps, a.Values = a.Timestamps[i:j], a.Values[i:j]
+		for k := range a.Timestamps {
+			a.Timestamps[k] += c.offset
+		}
+
+		// Later arrays may hold valid points after an underflow.
+		if a.Len() > 0 || c.offset > 0 {
+			return a
+		}
+	}
+}
+
+// integerTimeShiftArrayCursor adds a constant offset to the timestamps of
+// the underlying cursor, dropping points whose timestamps would fall outside
+// the range of valid timestamps.
+type integerTimeShiftArrayCursor struct {
+	cursors.IntegerArrayCursor
+	offset int64
+}
+
+func (c *integerTimeShiftArrayCursor) Next() *cursors.IntegerArray {
+	for {
+		a := c.IntegerArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		// The timestamps are ascending, so only the points at the end of
+		// the series may overflow and only those at the start may underflow.
+		i, j := 0, len(a.Timestamps)
+		if c.offset > 0 {
+			for j > 0 && a.Timestamps[j-1] > models.MaxNanoTime-c.offset {
+				j--
+			}
+		} else {
+			for i < j && a.Timestamps[i] < models.MinNanoTime-c.offset {
+				i++
+			}
+		}
+		a.Timestamps, a.Values = a.Timestamps[i:j], a.Values[i:j]
+		for k := range a.Timestamps {
+			a.Timestamps[k] += c.offset
+		}
+
+		// Later arrays may hold valid points after an underflow.
+		if a.Len() > 0 || c.offset > 0 {
+			return a
+		}
+	}
+}
+
+// unsignedTimeShiftArrayCursor adds a constant offset to the timestamps of
+// the underlying cursor, dropping points whose timestamps would fall outside
+// the range of valid timestamps.
+type unsignedTimeShiftArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	offset int64
+}
+
+func (c *unsignedTimeShiftArrayCursor) Next() *cursors.UnsignedArray {
+	for {
+		a := c.UnsignedArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		// The timestamps are ascending, so only the points at the end of
+		// the series may overflow and only those at the start may underflow.
+		i, j := 0, len(a.Timestamps)
+		if c.offset > 0 {
+			for j > 0 && a.Timestamps[j-1] > models.MaxNanoTime-c.offset {
+				j--
+			}
+		} else {
+			for i < j && a.Timestamps[i] < models.MinNanoTime-c.offset {
+				i++
+			}
+		}
+		a.Timestamps, a.Values = a.Timestamps[i:j], a.Values[i:j]
+		for k := range a.Timestamps {
+			a.Timestamps[k] += c.offset
+		}
+
+		// Later arrays may hold valid points after an underflow.
+		if a.Len() > 0 || c.offset > 0 {
+			return a
+		}
+	}
+}
+
+// stringTimeShiftArrayCursor adds a constant offset to the timestamps of
+// the underlying cursor, dropping points whose timestamps would fall outside
+// the range of valid timestamps.
+type stringTimeShiftArrayCursor struct {
+	cursors.StringArrayCursor
+	offset int64
+}
+
+func (c *stringTimeShiftArrayCursor) Next() *cursors.StringArray {
+	for {
+		a := c.StringArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		// The timestamps are ascending, so only the points at the end of
+		// the series may overflow and only those at the start may underflow.
+		i, j := 0, len(a.Timestamps)
+		if c.offset > 0 {
+			for j > 0 && a.Timestamps[j-1] > models.MaxNanoTime-c.offset {
+				j--
+			}
+		} else {
+			for i < j && a.Timestamps[i] < models.MinNanoTime-c.offset {
+				i++
+			}
+		}
+		a.Timestamps, a.Values = a.Timestamps[i:j], a.Values[i:j]
+		for k := range a.Timestamps {
+			a.Timestamps[k] += c.offset
+		}
+
+		// Later arrays may hold valid points after an underflow.
+		if a.Len() > 0 || c.offset > 0 {
+			return a
+		}
+	}
+}
+
+// booleanTimeShiftArrayCursor adds a constant offset to the timestamps of
+// the underlying cursor, dropping points whose timestamps would fall outside
+// the range of valid timestamps.
+type booleanTimeShiftArrayCursor struct {
+	cursors.BooleanArrayCursor
+	offset int64
+}
+
+func (c *booleanTimeShiftArrayCursor) Next() *cursors.BooleanArray {
+	for {
+		a := c.BooleanArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		// The timestamps are ascending, so only the points at the end of
+		// the series may overflow and only those at the start may underflow.
+		i, j := 0, len(a.Timestamps)
+		if c.offset > 0 {
+			for j > 0 && a.Timestamps[j-1] > models.MaxNanoTime-c.offset {
+				j--
+			}
+		} else {
+			for i < j && a.Timestamps[i] < models.MinNanoTime-c.offset {
+				i++
+			}
+		}
+		a.Timestamps, a.Values = a.Timestamps[i:j], a.Values[i:j]
+		for k := range a.Timestamps {
+			a.Timestamps[k] += c.offset
+		}
+
+		// Later arrays may hold valid points after an underflow.
+		if a.Len() > 0 || c.offset > 0 {
+			return a
+		}
+	}
+}
+
+func newDedupArrayCursor(cur cursors.Cursor, keepLast bool) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatDedupArrayCursor{FloatArrayCursor: cur, keepLast: keepLast}
+
+	case cursors.IntegerArrayCursor:
+		return &integerDedupArrayCursor{IntegerArrayCursor: cur, keepLast: keepLast}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedDedupArrayCursor{UnsignedArrayCursor: cur, keepLast: keepLast}
+
+	case cursors.StringArrayCursor:
+		return &stringDedupArrayCursor{StringArrayCursor: cur, keepLast: keepLast}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanDedupArrayCursor{BooleanArrayCursor: cur, keepLast: keepLast}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatDedupArrayCursor emits the points of the underlying cursor with
+// strictly increasing timestamps, keeping the first or last of the points
+// sharing a timestamp. The last point read is held back until a point with a
+// greater timestamp is read, as the next array may hold its duplicates.
+type floatDedupArrayCursor struct {
+	cursors.FloatArrayCursor
+	keepLast bool
+	res      cursors.FloatArray
+	ts       int64
+	v        float64
+	pending  bool
+	eof      bool
+}
+
+func (c *floatDedupArrayCursor) Next() *cursors.FloatArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for c.res.Len() == 0 && !c.eof {
+		a := c.FloatArrayCursor.Next()
+		if a.Len() == 0 {
+			c.eof = true
+			if c.pending {
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+			}
+			break
+		}
+
+		for i, ts := range a.Timestamps {
+			switch {
+			case !c.pending:
+				c.ts, c.v, c.pending = ts, a.Values[i], true
+			case ts == c.ts:
+				if c.keepLast {
+					c.v = a.Values[i]
+				}
+			case ts > c.ts:
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+				c.ts, c.v = ts, a.Values[i]
+			}
+			// Points preceding the held point are dropped.
+		}
+	}
+	return &c.res
+}
+
+// integerDedupArrayCursor emits the points of the underlying cursor with
+// strictly increasing timestamps, keeping the first or last of the points
+// sharing a timestamp. The last point read is held back until a point with a
+// greater timestamp is read, as the next array may hold its duplicates.
+type integerDedupArrayCursor struct {
+	cursors.IntegerArrayCursor
+	keepLast bool
+	res      cursors.IntegerArray
+	ts       int64
+	v        int64
+	pending  bool
+	eof      bool
+}
+
+func (c *integerDedupArrayCursor) Next() *cursors.IntegerArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for c.res.Len() == 0 && !c.eof {
+		a := c.IntegerArrayCursor.Next()
+		if a.Len() == 0 {
+			c.eof = true
+			if c.pending {
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+			}
+			break
+		}
+
+		for i, ts := range a.Timestamps {
+			switch {
+			case !c.pending:
+				c.ts, c.v, c.pending = ts, a.Values[i], true
+			case ts == c.ts:
+				if c.keepLast {
+					c.v = a.Values[i]
+				}
+			case ts > c.ts:
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+				c.ts, c.v = ts, a.Values[i]
+			}
+			// Points preceding the held point are dropped.
+		}
+	}
+	return &c.res
+}
+
+// unsignedDedupArrayCursor emits the points of the underlying cursor with
+// strictly increasing timestamps, keeping the first or last of the points
+// sharing a timestamp. The last point read is held back until a point with a
+// greater timestamp is read, as the next array may hold its duplicates.
+type unsignedDedupArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	keepLast bool
+	res      cursors.UnsignedArray
+	ts       int64
+	v        uint64
+	pending  bool
+	eof      bool
+}
+
+func (c *unsignedDedupArrayCursor) Next() *cursors.UnsignedArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for c.res.Len() == 0 && !c.eof {
+		a := c.UnsignedArrayCursor.Next()
+		if a.Len() == 0 {
+			c.eof = true
+			if c.pending {
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+			}
+			break
+		}
+
+		for i, ts := range a.Timestamps {
+			switch {
+			case !c.pending:
+				c.ts, c.v, c.pending = ts, a.Values[i], true
+			case ts == c.ts:
+				if c.keepLast {
+					c.v = a.Values[i]
+				}
+			case ts > c.ts:
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+				c.ts, c.v = ts, a.Values[i]
+			}
+			// Points preceding the held point are dropped.
+		}
+	}
+	return &c.res
+}
+
+// stringDedupArrayCursor emits the points of the underlying cursor with
+// strictly increasing timestamps, keeping the first or last of the points
+// sharing a timestamp. The last point read is held back until a point with a
+// greater timestamp is read, as the next array may hold its duplicates.
+type stringDedupArrayCursor struct {
+	cursors.StringArrayCursor
+	keepLast bool
+	res      cursors.StringArray
+	ts       int64
+	v        string
+	pending  bool
+	eof      bool
+}
+
+func (c *stringDedupArrayCursor) Next() *cursors.StringArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for c.res.Len() == 0 && !c.eof {
+		a := c.StringArrayCursor.Next()
+		if a.Len() == 0 {
+			c.eof = true
+			if c.pending {
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+			}
+			break
+		}
+
+		for i, ts := range a.Timestamps {
+			switch {
+			case !c.pending:
+				c.ts, c.v, c.pending = ts, a.Values[i], true
+			case ts == c.ts:
+				if c.keepLast {
+					c.v = a.Values[i]
+				}
+			case ts > c.ts:
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+				c.ts, c.v = ts, a.Values[i]
+			}
+			// Points preceding the held point are dropped.
+		}
+	}
+	return &c.res
+}
+
+// booleanDedupArrayCursor emits the points of the underlying cursor with
+// strictly increasing timestamps, keeping the first or last of the points
+// sharing a timestamp. The last point read is held back until a point with a
+// greater timestamp is read, as the next array may hold its duplicates.
+type booleanDedupArrayCursor struct {
+	cursors.BooleanArrayCursor
+	keepLast bool
+	res      cursors.BooleanArray
+	ts       int64
+	v        bool
+	pending  bool
+	eof      bool
+}
+
+func (c *booleanDedupArrayCursor) Next() *cursors.BooleanArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for c.res.Len() == 0 && !c.eof {
+		a := c.BooleanArrayCursor.Next()
+		if a.Len() == 0 {
+			c.eof = true
+			if c.pending {
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+			}
+			break
+		}
+
+		for i, ts := range a.Timestamps {
+			switch {
+			case !c.pending:
+				c.ts, c.v, c.pending = ts, a.Values[i], true
+			case ts == c.ts:
+				if c.keepLast {
+					c.v = a.Values[i]
+				}
+			case ts > c.ts:
+				c.res.Timestamps = append(c.res.Timestamps, c.ts)
+				c.res.Values = append(c.res.Values, c.v)
+				c.ts, c.v = ts, a.Values[i]
+			}
+			// Points preceding the held point are dropped.
+		}
+	}
+	return &c.res
+}
+
+func newDecimateArrayCursor(cur cursors.Cursor, stride int64) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatDecimateArrayCursor{FloatArrayCursor: cur, stride: stride}
+
+	case cursors.IntegerArrayCursor:
+		return &integerDecimateArrayCursor{IntegerArrayCursor: cur, stride: stride}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedDecimateArrayCursor{UnsignedArrayCursor: cur, stride: stride}
+
+	case cursors.StringArrayCursor:
+		return &stringDecimateArrayCursor{StringArrayCursor: cur, stride: stride}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanDecimateArrayCursor{BooleanArrayCursor: cur, stride: stride}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatDecimateArrayCursor emits every stride-th point of the underlying
+// cursor, starting with the first.
+type floatDecimateArrayCursor struct {
+	cursors.FloatArrayCursor
+	stride int64
+	n      int64 // n is the index of the next point of the series.
+}
+
+func (c *floatDecimateArrayCursor) Next() *cursors.FloatArray {
+	for {
+		a := c.FloatArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		j := 0
+		for i := range a.Timestamps {
+			if c.n%c.stride == 0 {
+				a.Timestamps[j], a.Values[j] = a.Timestamps[i], a.Values[i]
+				j++
+			}
+			c.n++
+		}
+		a.Timestamps, a.Values = a.Timestamps[:j], a.Values[:j]
+
+		// An array may hold no selected points if it is shorter than
+		// the stride.
+		if j > 0 {
+			return a
+		}
+	}
+}
+
+// integerDecimateArrayCursor emits every stride-th point of the underlying
+// cursor, starting with the first.
+type integerDecimateArrayCursor struct {
+	cursors.IntegerArrayCursor
+	stride int64
+	n      int64 // n is the index of the next point of the series.
+}
+
+func (c *integerDecimateArrayCursor) Next() *cursors.IntegerArray {
+	for {
+		a := c.IntegerArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		j := 0
+		for i := range a.Timestamps {
+			if c.n%c.stride == 0 {
+				a.Timestamps[j], a.Values[j] = a.Timestamps[i], a.Values[i]
+				j++
+			}
+			c.n++
+		}
+		a.Timestamps, a.Values = a.Timestamps[:j], a.Values[:j]
+
+		// An array may hold no selected points if it is shorter than
+		// the stride.
+		if j > 0 {
+			return a
+		}
+	}
+}
+
+// unsignedDecimateArrayCursor emits every stride-th point of the underlying
+// cursor, starting with the first.
+type unsignedDecimateArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	stride int64
+	n      int64 // n is the index of the next point of the series.
+}
+
+func (c *unsignedDecimateArrayCursor) Next() *cursors.UnsignedArray {
+	for {
+		a := c.UnsignedArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		j := 0
+		for i := range a.Timestamps {
+			if c.n%c.stride == 0 {
+				a.Timestamps[j], a.Values[j] = a.Timestamps[i], a.Values[i]
+				j++
+			}
+			c.n++
+		}
+		a.Timestamps, a.Values = a.Timestamps[:j], a.Values[:j]
+
+		// An array may hold no selected points if it is shorter than
+		// the stride.
+		if j > 0 {
+			return a
+		}
+	}
+}
+
+// stringDecimateArrayCursor emits every stride-th point of the underlying
+// cursor, starting with the first.
+type stringDecimateArrayCursor struct {
+	cursors.StringArrayCursor
+	stride int64
+	n      int64 // n is the index of the next point of the series.
+}
+
+func (c *stringDecimateArrayCursor) Next() *cursors.StringArray {
+	for {
+		a := c.StringArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		j := 0
+		for i := range a.Timestamps {
+			if c.n%c.stride == 0 {
+				a.Timestamps[j], a.Values[j] = a.Timestamps[i], a.Values[i]
+				j++
+			}
+			c.n++
+		}
+		a.Timestamps, a.Values = a.Timestamps[:j], a.Values[:j]
+
+		// An array may hold no selected points if it is shorter than
+		// the stride.
+		if j > 0 {
+			return a
+		}
+	}
+}
+
+// booleanDecimateArrayCursor emits every stride-th point of the underlying
+// cursor, starting with the first.
+type booleanDecimateArrayCursor struct {
+	cursors.BooleanArrayCursor
+	stride int64
+	n      int64 // n is the index of the next point of the series.
+}
+
+func (c *booleanDecimateArrayCursor) Next() *cursors.BooleanArray {
+	for {
+		a := c.BooleanArrayCursor.Next()
+		if a.Len() == 0 {
+			return a
+		}
+
+		j := 0
+		for i := range a.Timestamps {
+			if c.n%c.stride == 0 {
+				a.Timestamps[j], a.Values[j] = a.Timestamps[i], a.Values[i]
+				j++
+			}
+			c.n++
+		}
+		a.Timestamps, a.Values = a.Timestamps[:j], a.Values[:j]
+
+		// An array may hold no selected points if it is shorter than
+		// the stride.
+		if j > 0 {
+			return a
+		}
+	}
+}
+
+func newPointLimitArrayCursor(cur cursors.Cursor, rs *pointLimitResultSet) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatPointLimitArrayCursor{FloatArrayCursor: cur, rs: rs}
+
+	case cursors.IntegerArrayCursor:
+		return &integerPointLimitArrayCursor{IntegerArrayCursor: cur, rs: rs}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedPointLimitArrayCursor{UnsignedArrayCursor: cur, rs: rs}
+
+	case cursors.StringArrayCursor:
+		return &stringPointLimitArrayCursor{StringArrayCursor: cur, rs: rs}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanPointLimitArrayCursor{BooleanArrayCursor: cur, rs: rs}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatPointLimitArrayCursor truncates the arrays of the underlying cursor
+// to the points allowed by the limits of the result set, and stops reading
+// it once they are reached.
+type floatPointLimitArrayCursor struct {
+	cursors.FloatArrayCursor
+	rs *pointLimitResultSet
+	n  int64 // n is the number of points of the series produced.
+}
+
+func (c *floatPointLimitArrayCursor) Next() *cursors.FloatArray {
+	if c.rs.done(c.n) {
+		return &cursors.FloatArray{}
+	}
+
+	a := c.FloatArrayCursor.Next()
+	if k := c.rs.take(c.n, a.Len()); k < a.Len() {
+		a.Timestamps, a.Values = a.Timestamps[:k], a.Values[:k]
+	}
+	c.n += int64(a.Len())
+	return a
+}
+
+// integerPointLimitArrayCursor truncates the arrays of the underlying cursor
+// to the points allowed by the limits of the result set, and stops reading
+// it once they are reached.
+type integerPointLimitArrayCursor struct {
+	cursors.IntegerArrayCursor
+	rs *pointLimitResultSet
+	n  int64 // n is the number of points of the series produced.
+}
+
+func (c *integerPointLimitArrayCursor) Next() *cursors.IntegerArray {
+	if c.rs.done(c.n) {
+		return &cursors.IntegerArray{}
+	}
+
+	a := c.IntegerArrayCursor.Next()
+	if k := c.rs.take(c.n, a.Len()); k < a.Len() {
+		a.Timestamps, a.Values = a.Timestamps[:k], a.Values[:k]
+	}
+	c.n += int64(a.Len())
+	return a
+}
+
+// unsignedPointLimitArrayCursor truncates the arrays of the underlying cursor
+// to the points allowed by the limits of the result set, and stops reading
+// it once they are reached.
+type unsignedPointLimitArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	rs *pointLimitResultSet
+	n  int64 // n is the number of points of the series produced.
+}
+
+func (c *unsignedPointLimitArrayCursor) Next() *cursors.UnsignedArray {
+	if c.rs.done(c.n) {
+		return &cursors.UnsignedArray{}
+	}
+
+	a := c.UnsignedArrayCursor.Next()
+	if k := c.rs.take(c.n, a.Len()); k < a.Len() {
+		a.Timestamps, a.Values = a.Timestamps[:k], a.Values[:k]
+	}
+	c.n += int64(a.Len())
+	return a
+}
+
+// stringPointLimitArrayCursor truncates the arrays of the underlying cursor
+// to the points allowed by the limits of the result set, and stops reading
+// it once they are reached.
+type stringPointLimitArrayCursor struct {
+	cursors.StringArrayCursor
+	rs *pointLimitResultSet
+	n  int64 // n is the number of points of the series produced.
+}
+
+func (c *stringPointLimitArrayCursor) Next() *cursors.StringArray {
+	if c.rs.done(c.n) {
+		return &cursors.StringArray{}
+	}
+
+	a := c.StringArrayCursor.Next()
+	if k := c.rs.take(c.n, a.Len()); k < a.Len() {
+		a.Timestamps, a.Values = a.Timestamps[:k], a.Values[:k]
+	}
+	c.n += int64(a.Len())
+	return a
+}
+
+// booleanPointLimitArrayCursor truncates the arrays of the underlying cursor
+// to the points allowed by the limits of the result set, and stops reading
+// it once they are reached.
+type booleanPointLimitArrayCursor struct {
+	cursors.BooleanArrayCursor
+	rs *pointLimitResultSet
+	n  int64 // n is the number of points of the series produced.
+}
+
+func (c *booleanPointLimitArrayCursor) Next() *cursors.BooleanArray {
+	if c.rs.done(c.n) {
+		return &cursors.BooleanArray{}
+	}
+
+	a := c.BooleanArrayCursor.Next()
+	if k := c.rs.take(c.n, a.Len()); k < a.Len() {
+		a.Timestamps, a.Values = a.Timestamps[:k], a.Values[:k]
+	}
+	c.n += int64(a.Len())
+	return a
+}
+
+func newWindowFillArrayCursor(cur cursors.Cursor, fill *windowFill) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatWindowFillArrayCursor{FloatArrayCursor: cur, fill: fill, stop: fill.first}
+
+	case cursors.IntegerArrayCursor:
+		return &integerWindowFillArrayCursor{IntegerArrayCursor: cur, fill: fill, stop: fill.first}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedWindowFillArrayCursor{UnsignedArrayCursor: cur, fill: fill, stop: fill.first}
+
+	case cursors.StringArrayCursor:
+		return &stringWindowFillArrayCursor{StringArrayCursor: cur, fill: fill, stop: fill.first}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanWindowFillArrayCursor{BooleanArrayCursor: cur, fill: fill, stop: fill.first}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatWindowFillArrayCursor reports the windows of the underlying cursor
+// without points according to the fill mode.
+type floatWindowFillArrayCursor struct {
+	cursors.FloatArrayCursor
+	fill    *windowFill
+	stop    int64 // stop is the stop time of the next window to report.
+	buf     *cursors.FloatArray
+	eof     bool
+	res     cursors.FloatArray
+	nulls   []bool
+	prev    float64
+	hasPrev bool
+}
+
+func (c *floatWindowFillArrayCursor) Nulls() []bool { return c.nulls }
+
+func (c *floatWindowFillArrayCursor) Next() *cursors.FloatArray {
+	c.res.Timestamps, c.res.Values, c.nulls = c.res.Timestamps[:0], c.res.Values[:0], c.nulls[:0]
+	for c.res.Len() < cursors.DefaultMaxPointsPerBlock && c.stop <= c.fill.last {
+		if !c.eof && (c.buf == nil || c.buf.Len() == 0) {
+			c.buf = c.FloatArrayCursor.Next()
+			c.eof = c.buf.Len() == 0
+		}
+
+		if !c.eof {
+			if stop := c.fill.pointStop(c.buf.Timestamps[0]); stop <= c.stop {
+				c.append(c.buf.Timestamps[0], c.buf.Values[0], false)
+				c.prev, c.hasPrev = c.buf.Values[0], true
+				c.buf.Timestamps, c.buf.Values = c.buf.Timestamps[1:], c.buf.Values[1:]
+				if stop == c.stop {
+					c.stop += c.fill.every
+				}
+				continue
+			}
+		}
+
+		switch c.fill.mode {
+		case WindowFillNull:
+			var zero float64
+			c.append(c.stop, zero, true)
+		case WindowFillPrevious:
+			if c.hasPrev {
+				c.append(c.stop, c.prev, false)
+			}
+		}
+		c.stop += c.fill.every
+	}
+	return &c.res
+}
+
+func (c *floatWindowFillArrayCursor) append(ts int64, v float64, null bool) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+	c.nulls = append(c.nulls, null)
+}
+
+// integerWindowFillArrayCursor reports the windows of the underlying cursor
+// without points according to the fill mode.
+type integerWindowFillArrayCursor struct {
+	cursors.IntegerArrayCursor
+	fill    *windowFill
+	stop    int64 // stop is the stop time of the next window to report.
+	buf     *cursors.IntegerArray
+	eof     bool
+	res     cursors.IntegerArray
+	nulls   []bool
+	prev    int64
+	hasPrev bool
+}
+
+func (c *integerWindowFillArrayCursor) Nulls() []bool { return c.nulls }
+
+func (c *integerWindowFillArrayCursor) Next() *cursors.IntegerArray {
+	c.res.Timestamps, c.res.Values, c.nulls = c.res.Timestamps[:0], c.res.Values[:0], c.nulls[:0]
+	for c.res.Len() < cursors.DefaultMaxPointsPerBlock && c.stop <= c.fill.last {
+		if !c.eof && (c.buf == nil || c.buf.Len() == 0) {
+			c.buf = c.IntegerArrayCursor.Next()
+			c.eof = c.buf.Len() == 0
+		}
+
+		if !c.eof {
+			if stop := c.fill.pointStop(c.buf.Timestamps[0]); stop <= c.stop {
+				c.append(c.buf.Timestamps[0], c.buf.Values[0], false)
+				c.prev, c.hasPrev = c.buf.Values[0], true
+				c.buf.Timestamps, c.buf.Values = c.buf.Timestamps[1:], c.buf.Values[1:]
+				if stop == c.stop {
+					c.stop += c.fill.every
+				}
+				continue
+			}
+		}
+
+		switch c.fill.mode {
+		case WindowFillNull:
+			var zero int64
+			c.append(c.stop, zero, true)
+		case WindowFillPrevious:
+			if c.hasPrev {
+				c.append(c.stop, c.prev, false)
+			}
+		}
+		c.stop += c.fill.every
+	}
+	return &c.res
+}
+
+func (c *integerWindowFillArrayCursor) append(ts int64, v int64, null bool) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+	c.nulls = append(c.nulls, null)
+}
+
+// unsignedWindowFillArrayCursor reports the windows of the underlying cursor
+// without points according to the fill mode.
+type unsignedWindowFillArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	fill    *windowFill
+	stop    int64 // stop is the stop time of the next window to report.
+	buf     *cursors.UnsignedArray
+	eof     bool
+	res     cursors.UnsignedArray
+	nulls   []bool
+	prev    uint64
+	hasPrev bool
+}
+
+func (c *unsignedWindowFillArrayCursor) Nulls() []bool { return c.nulls }
+
+func (c *unsignedWindowFillArrayCursor) Next() *cursors.UnsignedArray {
+	c.res.Timestamps, c.res.Values, c.nulls = c.res.Timestamps[:0], c.res.Values[:0], c.nulls[:0]
+	for c.res.Len() < cursors.DefaultMaxPointsPerBlock && c.stop <= c.fill.last {
+		if !c.eof && (c.buf == nil || c.buf.Len() == 0) {
+			c.buf = c.UnsignedArrayCursor.Next()
+			c.eof = c.buf.Len() == 0
+		}
+
+		if !c.eof {
+			if stop := c.fill.pointStop(c.buf.Timestamps[0]); stop <= c.stop {
+				c.append(c.buf.Timestamps[0], c.buf.Values[0], false)
+				c.prev, c.hasPrev = c.buf.Values[0], true
+				c.buf.Timestamps, c.buf.Values = c.buf.Timestamps[1:], c.buf.Values[1:]
+				if stop == c.stop {
+					c.stop += c.fill.every
+				}
+				continue
+			}
+		}
+
+		switch c.fill.mode {
+		case WindowFillNull:
+			var zero uint64
+			c.append(c.stop, zero, true)
+		case WindowFillPrevious:
+			if c.hasPrev {
+				c.append(c.stop, c.prev, false)
+			}
+		}
+		c.stop += c.fill.every
+	}
+	return &c.res
+}
+
+func (c *unsignedWindowFillArrayCursor) append(ts int64, v uint64, null bool) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+	c.nulls = append(c.nulls, null)
+}
+
+// stringWindowFillArrayCursor reports the windows of the underlying cursor
+// without points according to the fill mode.
+type stringWindowFillArrayCursor struct {
+	cursors.StringArrayCursor
+	fill    *windowFill
+	stop    int64 // stop is the stop time of the next window to report.
+	buf     *cursors.StringArray
+	eof     bool
+	res     cursors.StringArray
+	nulls   []bool
+	prev    string
+	hasPrev bool
+}
+
+func (c *stringWindowFillArrayCursor) Nulls() []bool { return c.nulls }
+
+func (c *stringWindowFillArrayCursor) Next() *cursors.StringArray {
+	c.res.Timestamps, c.res.Values, c.nulls = c.res.Timestamps[:0], c.res.Values[:0], c.nulls[:0]
+	for c.res.Len() < cursors.DefaultMaxPointsPerBlock && c.stop <= c.fill.last {
+		if !c.eof && (c.buf == nil || c.buf.Len() == 0) {
+			c.buf = c.StringArrayCursor.Next()
+			c.eof = c.buf.Len() == 0
+		}
+
+		if !c.eof {
+			if stop := c.fill.pointStop(c.buf.Timestamps[0]); stop <= c.stop {
+				c.append(c.buf.Timestamps[0], c.buf.Values[0], false)
+				c.prev, c.hasPrev = c.buf.Values[0], true
+				c.buf.Timestamps, c.buf.Values = c.buf.Timestamps[1:], c.buf.Values[1:]
+				if stop == c.stop {
+					c.stop += c.fill.every
+				}
+				continue
+			}
+		}
+
+		switch c.fill.mode {
+		case WindowFillNull:
+			var zero string
+			c.append(c.stop, zero, true)
+		case WindowFillPrevious:
+			if c.hasPrev {
+				c.append(c.stop, c.prev, false)
+			}
+		}
+		c.stop += c.fill.every
+	}
+	return &c.res
+}
+
+func (c *stringWindowFillArrayCursor) append(ts int64, v string, null bool) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+	c.nulls = append(c.nulls, null)
+}
+
+// booleanWindowFillArrayCursor reports the windows of the underlying cursor
+// without points according to the fill mode.
+type booleanWindowFillArrayCursor struct {
+	cursors.BooleanArrayCursor
+	fill    *windowFill
+	stop    int64 // stop is the stop time of the next window to report.
+	buf     *cursors.BooleanArray
+	eof     bool
+	res     cursors.BooleanArray
+	nulls   []bool
+	prev    bool
+	hasPrev bool
+}
+
+func (c *booleanWindowFillArrayCursor) Nulls() []bool { return c.nulls }
+
+func (c *booleanWindowFillArrayCursor) Next() *cursors.BooleanArray {
+	c.res.Timestamps, c.res.Values, c.nulls = c.res.Timestamps[:0], c.res.Values[:0], c.nulls[:0]
+	for c.res.Len() < cursors.DefaultMaxPointsPerBlock && c.stop <= c.fill.last {
+		if !c.eof && (c.buf == nil || c.buf.Len() == 0) {
+			c.buf = c.BooleanArrayCursor.Next()
+			c.eof = c.buf.Len() == 0
+		}
+
+		if !c.eof {
+			if stop := c.fill.pointStop(c.buf.Timestamps[0]); stop <= c.stop {
+				c.append(c.buf.Timestamps[0], c.buf.Values[0], false)
+				c.prev, c.hasPrev = c.buf.Values[0], true
+				c.buf.Timestamps, c.buf.Values = c.buf.Timestamps[1:], c.buf.Values[1:]
+				if stop == c.stop {
+					c.stop += c.fill.every
+				}
+				continue
+			}
+		}
+
+		switch c.fill.mode {
+		case WindowFillNull:
+			var zero bool
+			c.append(c.stop, zero, true)
+		case WindowFillPrevious:
+			if c.hasPrev {
+				c.append(c.stop, c.prev, false)
+			}
+		}
+		c.stop += c.fill.every
+	}
+	return &c.res
+}
+
+func (c *booleanWindowFillArrayCursor) append(ts int64, v bool, null bool) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+	c.nulls = append(c.nulls, null)
+}
+
+func newCountArrayCursor(cur cursors.Cursor, n *int64) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatCountArrayCursor{FloatArrayCursor: cur, n: n}
+
+	case cursors.IntegerArrayCursor:
+		return &integerCountArrayCursor{IntegerArrayCursor: cur, n: n}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedCountArrayCursor{UnsignedArrayCursor: cur, n: n}
+
+	case cursors.StringArrayCursor:
+		return &stringCountArrayCursor{StringArrayCursor: cur, n: n}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanCountArrayCursor{BooleanArrayCursor: cur, n: n}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatCountArrayCursor adds the number of points read from the underlying
+// cursor to n.
+type floatCountArrayCursor struct {
+	cursors.FloatArrayCursor
+	n *int64
+}
+
+func (c *floatCountArrayCursor) Next() *cursors.FloatArray {
+	a := c.FloatArrayCursor.Next()
+	*c.n += int64(a.Len())
+	return a
+}
+
+// integerCountArrayCursor adds the number of points read from the underlying
+// cursor to n.
+type integerCountArrayCursor struct {
+	cursors.IntegerArrayCursor
+	n *int64
+}
+
+func (c *integerCountArrayCursor) Next() *cursors.IntegerArray {
+	a := c.IntegerArrayCursor.Next()
+	*c.n += int64(a.Len())
+	return a
+}
+
+// unsignedCountArrayCursor adds the number of points read from the underlying
+// cursor to n.
+type unsignedCountArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	n *int64
+}
+
+func (c *unsignedCountArrayCursor) Next() *cursors.UnsignedArray {
+	a := c.UnsignedArrayCursor.Next()
+	*c.n += int64(a.Len())
+	return a
+}
+
+// stringCountArrayCursor adds the number of points read from the underlying
+// cursor to n.
+type stringCountArrayCursor struct {
+	cursors.StringArrayCursor
+	n *int64
+}
+
+func (c *stringCountArrayCursor) Next() *cursors.StringArray {
+	a := c.StringArrayCursor.Next()
+	*c.n += int64(a.Len())
+	return a
+}
+
+// booleanCountArrayCursor adds the number of points read from the underlying
+// cursor to n.
+type booleanCountArrayCursor struct {
+	cursors.BooleanArrayCursor
+	n *int64
+}
+
+func (c *booleanCountArrayCursor) Next() *cursors.BooleanArray {
+	a := c.BooleanArrayCursor.Next()
+	*c.n += int64(a.Len())
+	return a
+}
+
+// splitArrayCursor reads cur in full, returning a cursor over the points of
+// each bucket, keyed by the bucket returned for their timestamp.
+func splitArrayCursor(cur cursors.Cursor, bucket func(ts int64) int) (map[int]cursors.Cursor, error) {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		m := make(map[int]*floatSliceArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			for i, ts := range a.Timestamps {
+				b := bucket(ts)
+				c := m[b]
+				if c == nil {
+					c = &floatSliceArrayCursor{}
+					m[b] = c
+				}
+				c.a.Timestamps = append(c.a.Timestamps, ts)
+				c.a.Values = append(c.a.Values, a.Values[i])
+			}
+		}
+		out := make(map[int]cursors.Cursor, len(m))
+		for b, c := range m {
+			out[b] = c
+		}
+		return out, cur.Err()
+
+	case cursors.IntegerArrayCursor:
+		m := make(map[int]*integerSliceArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			for i, ts := range a.Timestamps {
+				b := bucket(ts)
+				c := m[b]
+				if c == nil {
+					c = &integerSliceArrayCursor{}
+					m[b] = c
+				}
+				c.a.Timestamps = append(c.a.Timestamps, ts)
+				c.a.Values = append(c.a.Values, a.Values[i])
+			}
+		}
+		out := make(map[int]cursors.Cursor, len(m))
+		for b, c := range m {
+			out[b] = c
+		}
+		return out, cur.Err()
+
+	case cursors.UnsignedArrayCursor:
+		m := make(map[int]*unsignedSliceArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			for i, ts := range a.Timestamps {
+				b := bucket(ts)
+				c := m[b]
+				if c == nil {
+					c = &unsignedSliceArrayCursor{}
+					m[b] = c
+				}
+				c.a.Timestamps = append(c.a.Timestamps, ts)
+				c.a.Values = append(c.a.Values, a.Values[i])
+			}
+		}
+		out := make(map[int]cursors.Cursor, len(m))
+		for b, c := range m {
+			out[b] = c
+		}
+		return out, cur.Err()
+
+	case cursors.StringArrayCursor:
+		m := make(map[int]*stringSliceArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			for i, ts := range a.Timestamps {
+				b := bucket(ts)
+				c := m[b]
+				if c == nil {
+					c = &stringSliceArrayCursor{}
+					m[b] = c
+				}
+				c.a.Timestamps = append(c.a.Timestamps, ts)
+				c.a.Values = append(c.a.Values, a.Values[i])
+			}
+		}
+		out := make(map[int]cursors.Cursor, len(m))
+		for b, c := range m {
+			out[b] = c
+		}
+		return out, cur.Err()
+
+	case cursors.BooleanArrayCursor:
+		m := make(map[int]*booleanSliceArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			for i, ts := range a.Timestamps {
+				b := bucket(ts)
+				c := m[b]
+				if c == nil {
+					c = &booleanSliceArrayCursor{}
+					m[b] = c
+				}
+				c.a.Timestamps = append(c.a.Timestamps, ts)
+				c.a.Values = append(c.a.Values, a.Values[i])
+			}
+		}
+		out := make(map[int]cursors.Cursor, len(m))
+		for b, c := range m {
+			out[b] = c
+		}
+		return out, cur.Err()
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatSliceArrayCursor produces the points of an array held in memory.
+type floatSliceArrayCursor struct {
+	a   cursors.FloatArray
+	tmp cursors.FloatArray
+}
+
+func (c *floatSliceArrayCursor) Close() {}
+
+func (c *floatSliceArrayCursor) Err() error { return nil }
+
+func (c *floatSliceArrayCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *floatSliceArrayCursor) Next() *cursors.FloatArray {
+	n := c.a.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.a.Timestamps = c.a.Timestamps[:n], c.a.Timestamps[n:]
+	c.tmp.Values, c.a.Values = c.a.Values[:n], c.a.Values[n:]
+	return &c.tmp
+}
+
+// integerSliceArrayCursor produces the points of an array held in memory.
+type integerSliceArrayCursor struct {
+	a   cursors.IntegerArray
+	tmp cursors.IntegerArray
+}
+
+func (c *integerSliceArrayCursor) Close() {}
+
+func (c *integerSliceArrayCursor) Err() error { return nil }
+
+func (c *integerSliceArrayCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *integerSliceArrayCursor) Next() *cursors.IntegerArray {
+	n := c.a.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.a.Timestamps = c.a.Timestamps[:n], c.a.Timestamps[n:]
+	c.tmp.Values, c.a.Values = c.a.Values[:n], c.a.Values[n:]
+	return &c.tmp
+}
+
+// unsignedSliceArrayCursor produces the points of an array held in memory.
+type unsignedSliceArrayCursor struct {
+	a   cursors.UnsignedArray
+	tmp cursors.UnsignedArray
+}
+
+func (c *unsignedSliceArrayCursor) Close() {}
+
+func (c *unsignedSliceArrayCursor) Err() error { return nil }
+
+func (c *unsignedSliceArrayCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *unsignedSliceArrayCursor) Next() *cursors.UnsignedArray {
+	n := c.a.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.a.Timestamps = c.a.Timestamps[:n], c.a.Timestamps[n:]
+	c.tmp.Values, c.a.Values = c.a.Values[:n], c.a.Values[n:]
+	return &c.tmp
+}
+
+// stringSliceArrayCursor produces the points of an array held in memory.
+type stringSliceArrayCursor struct {
+	a   cursors.StringArray
+	tmp cursors.StringArray
+}
+
+func (c *stringSliceArrayCursor) Close() {}
+
+func (c *stringSliceArrayCursor) Err() error { return nil }
+
+func (c *stringSliceArrayCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *stringSliceArrayCursor) Next() *cursors.StringArray {
+	n := c.a.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.a.Timestamps = c.a.Timestamps[:n], c.a.Timestamps[n:]
+	c.tmp.Values, c.a.Values = c.a.Values[:n], c.a.Values[n:]
+	return &c.tmp
+}
+
+// booleanSliceArrayCursor produces the points of an array held in memory.
+type booleanSliceArrayCursor struct {
+	a   cursors.BooleanArray
+	tmp cursors.BooleanArray
+}
+
+func (c *booleanSliceArrayCursor) Close() {}
+
+func (c *booleanSliceArrayCursor) Err() error { return nil }
+
+func (c *booleanSliceArrayCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *booleanSliceArrayCursor) Next() *cursors.BooleanArray {
+	n := c.a.Len()
+	if n > cursors.DefaultMaxPointsPerBlock {
+		n = cursors.DefaultMaxPointsPerBlock
+	}
+	c.tmp.Timestamps, c.a.Timestamps = c.a.Timestamps[:n], c.a.Timestamps[n:]
+	c.tmp.Values, c.a.Values = c.a.Values[:n], c.a.Values[n:]
+	return &c.tmp
+}
+
+// multiAggregateArrayCursor reads cur in full, computing the aggregates of
+// each window in a single pass. It returns a cursor over the values of each
+// of aggs, in the same order, all reported at the stop time of their window.
+func multiAggregateArrayCursor(cur cursors.Cursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return floatMultiAggregate(cur, aggs, windowStop)
+
+	case cursors.IntegerArrayCursor:
+		return integerMultiAggregate(cur, aggs, windowStop)
+
+	case cursors.UnsignedArrayCursor:
+		return unsignedMultiAggregate(cur, aggs, windowStop)
+
+	case cursors.StringArrayCursor:
+		return stringMultiAggregate(cur, aggs, windowStop)
+
+	case cursors.BooleanArrayCursor:
+		return booleanMultiAggregate(cur, aggs, windowStop)
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+func floatMultiAggregate(cur cursors.FloatArrayCursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	var (
+		stop          int64
+		n             int64
+		first, last   float64
+		sum, min, max float64
+		fsum          float64
+	)
+	var (
+		timestamps       []int64
+		counts           []int64
+		firsts, lasts    []float64
+		sums, mins, maxs []float64
+		means            []float64
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		timestamps = append(timestamps, stop)
+		counts = append(counts, n)
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+		sums = append(sums, sum)
+		mins = append(mins, min)
+		maxs = append(maxs, max)
+		means = append(means, fsum/float64(n))
+	}
+
+	for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+		for i, ts := range a.Timestamps {
+			v := a.Values[i]
+			if s := windowStop(ts); n == 0 || s != stop {
+				flush()
+				stop, n = s, 0
+				first = v
+				sum, min, max, fsum = 0, v, v, 0
+			}
+			n++
+			last = v
+			sum += v
+			fsum += float64(v)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+	flush()
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]cursors.Cursor, len(aggs))
+	for i, agg := range aggs {
+		switch agg {
+		case datatypes.AggregateTypeCount:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: counts}}
+		case datatypes.AggregateTypeFirst:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: firsts}}
+		case datatypes.AggregateTypeLast:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: lasts}}
+		case datatypes.AggregateTypeSum:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: sums}}
+		case datatypes.AggregateTypeMin:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: mins}}
+		case datatypes.AggregateTypeMax:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: maxs}}
+		case datatypes.AggregateTypeMean:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: means}}
+		default:
+			return nil, fmt.Errorf("%w: %s of float field", ErrInvalidMultiAggregate, agg)
+		}
+	}
+	return out, nil
+}
+
+func integerMultiAggregate(cur cursors.IntegerArrayCursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	var (
+		stop          int64
+		n             int64
+		first, last   int64
+		sum, min, max int64
+		fsum          float64
+	)
+	var (
+		timestamps       []int64
+		counts           []int64
+		firsts, lasts    []int64
+		sums, mins, maxs []int64
+		means            []float64
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		timestamps = append(timestamps, stop)
+		counts = append(counts, n)
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+		sums = append(sums, sum)
+		mins = append(mins, min)
+		maxs = append(maxs, max)
+		means = append(means, fsum/float64(n))
+	}
+
+	for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+		for i, ts := range a.Timestamps {
+			v := a.Values[i]
+			if s := windowStop(ts); n == 0 || s != stop {
+				flush()
+				stop, n = s, 0
+				first = v
+				sum, min, max, fsum = 0, v, v, 0
+			}
+			n++
+			last = v
+			sum += v
+			fsum += float64(v)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+	flush()
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]cursors.Cursor, len(aggs))
+	for i, agg := range aggs {
+		switch agg {
+		case datatypes.AggregateTypeCount:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: counts}}
+		case datatypes.AggregateTypeFirst:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: firsts}}
+		case datatypes.AggregateTypeLast:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: lasts}}
+		case datatypes.AggregateTypeSum:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: sums}}
+		case datatypes.AggregateTypeMin:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: mins}}
+		case datatypes.AggregateTypeMax:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: maxs}}
+		case datatypes.AggregateTypeMean:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: means}}
+		default:
+			return nil, fmt.Errorf("%w: %s of integer field", ErrInvalidMultiAggregate, agg)
+		}
+	}
+	return out, nil
+}
+
+func unsignedMultiAggregate(cur cursors.UnsignedArrayCursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	var (
+		stop          int64
+		n             int64
+		first, last   uint64
+		sum, min, max uint64
+		fsum          float64
+	)
+	var (
+		timestamps       []int64
+		counts           []int64
+		firsts, lasts    []uint64
+		sums, mins, maxs []uint64
+		means            []float64
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		timestamps = append(timestamps, stop)
+		counts = append(counts, n)
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+		sums = append(sums, sum)
+		mins = append(mins, min)
+		maxs = append(maxs, max)
+		means = append(means, fsum/float64(n))
+	}
+
+	for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+		for i, ts := range a.Timestamps {
+			v := a.Values[i]
+			if s := windowStop(ts); n == 0 || s != stop {
+				flush()
+				stop, n = s, 0
+				first = v
+				sum, min, max, fsum = 0, v, v, 0
+			}
+			n++
+			last = v
+			sum += v
+			fsum += float64(v)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+	}
+	flush()
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]cursors.Cursor, len(aggs))
+	for i, agg := range aggs {
+		switch agg {
+		case datatypes.AggregateTypeCount:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: counts}}
+		case datatypes.AggregateTypeFirst:
+			out[i] = &unsignedSliceArrayCursor{a: cursors.UnsignedArray{Timestamps: timestamps, Values: firsts}}
+		case datatypes.AggregateTypeLast:
+			out[i] = &unsignedSliceArrayCursor{a: cursors.UnsignedArray{Timestamps: timestamps, Values: lasts}}
+		case datatypes.AggregateTypeSum:
+			out[i] = &unsignedSliceArrayCursor{a: cursors.UnsignedArray{Timestamps: timestamps, Values: sums}}
+		case datatypes.AggregateTypeMin:
+			out[i] = &unsignedSliceArrayCursor{a: cursors.UnsignedArray{Timestamps: timestamps, Values: mins}}
+		case datatypes.AggregateTypeMax:
+			out[i] = &unsignedSliceArrayCursor{a: cursors.UnsignedArray{Timestamps: timestamps, Values: maxs}}
+		case datatypes.AggregateTypeMean:
+			out[i] = &floatSliceArrayCursor{a: cursors.FloatArray{Timestamps: timestamps, Values: means}}
+		default:
+			return nil, fmt.Errorf("%w: %s of unsigned field", ErrInvalidMultiAggregate, agg)
+		}
+	}
+	return out, nil
+}
+
+func stringMultiAggregate(cur cursors.StringArrayCursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	var (
+		stop        int64
+		n           int64
+		first, last string
+	)
+	var (
+		timestamps    []int64
+		counts        []int64
+		firsts, lasts []string
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		timestamps = append(timestamps, stop)
+		counts = append(counts, n)
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+	}
+
+	for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+		for i, ts := range a.Timestamps {
+			v := a.Values[i]
+			if s := windowStop(ts); n == 0 || s != stop {
+				flush()
+				stop, n = s, 0
+				first = v
+			}
+			n++
+			last = v
+		}
+	}
+	flush()
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]cursors.Cursor, len(aggs))
+	for i, agg := range aggs {
+		switch agg {
+		case datatypes.AggregateTypeCount:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: counts}}
+		case datatypes.AggregateTypeFirst:
+			out[i] = &stringSliceArrayCursor{a: cursors.StringArray{Timestamps: timestamps, Values: firsts}}
+		case datatypes.AggregateTypeLast:
+			out[i] = &stringSliceArrayCursor{a: cursors.StringArray{Timestamps: timestamps, Values: lasts}}
+		default:
+			return nil, fmt.Errorf("%w: %s of string field", ErrInvalidMultiAggregate, agg)
+		}
+	}
+	return out, nil
+}
+
+func booleanMultiAggregate(cur cursors.BooleanArrayCursor, aggs []datatypes.Aggregate_AggregateType, windowStop func(ts int64) int64) ([]cursors.Cursor, error) {
+	var (
+		stop        int64
+		n           int64
+		first, last bool
+	)
+	var (
+		timestamps    []int64
+		counts        []int64
+		firsts, lasts []bool
+	)
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		timestamps = append(timestamps, stop)
+		counts = append(counts, n)
+		firsts = append(firsts, first)
+		lasts = append(lasts, last)
+	}
+
+	for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+		for i, ts := range a.Timestamps {
+			v := a.Values[i]
+			if s := windowStop(ts); n == 0 || s != stop {
+				flush()
+				stop, n = s, 0
+				first = v
+			}
+			n++
+			last = v
+		}
+	}
+	flush()
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]cursors.Cursor, len(aggs))
+	for i, agg := range aggs {
+		switch agg {
+		case datatypes.AggregateTypeCount:
+			out[i] = &integerSliceArrayCursor{a: cursors.IntegerArray{Timestamps: timestamps, Values: counts}}
+		case datatypes.AggregateTypeFirst:
+			out[i] = &booleanSliceArrayCursor{a: cursors.BooleanArray{Timestamps: timestamps, Values: firsts}}
+		case datatypes.AggregateTypeLast:
+			out[i] = &booleanSliceArrayCursor{a: cursors.BooleanArray{Timestamps: timestamps, Values: lasts}}
+		default:
+			return nil, fmt.Errorf("%w: %s of boolean field", ErrInvalidMultiAggregate, agg)
+		}
+	}
+	return out, nil
+}
+
+func newGapArrayCursor(cur cursors.Cursor, gaps *gapRecorder) cursors.Cursor {
+	switch cur := cur.(type) {
+
+	case cursors.FloatArrayCursor:
+		return &floatGapArrayCursor{FloatArrayCursor: cur, gaps: gaps}
+
+	case cursors.IntegerArrayCursor:
+		return &integerGapArrayCursor{IntegerArrayCursor: cur, gaps: gaps}
+
+	case cursors.UnsignedArrayCursor:
+		return &unsignedGapArrayCursor{UnsignedArrayCursor: cur, gaps: gaps}
+
+	case cursors.StringArrayCursor:
+		return &stringGapArrayCursor{StringArrayCursor: cur, gaps: gaps}
+
+	case cursors.BooleanArrayCursor:
+		return &booleanGapArrayCursor{BooleanArrayCursor: cur, gaps: gaps}
+
+	default:
+		panic(fmt.Sprintf("unreachable: %T", cur))
+	}
+}
+
+// floatGapArrayCursor records the gaps between the points read from the
+// underlying cursor.
+type floatGapArrayCursor struct {
+	cursors.FloatArrayCursor
+	gaps *gapRecorder
+}
+
+func (c *floatGapArrayCursor) Next() *cursors.FloatArray {
+	a := c.FloatArrayCursor.Next()
+	for _, ts := range a.Timestamps {
+		c.gaps.add(ts)
+	}
+	return a
+}
+
+// integerGapArrayCursor records the gaps between the points read from the
+// underlying cursor.
+type integerGapArrayCursor struct {
+	cursors.IntegerArrayCursor
+	gaps *gapRecorder
+}
+
+func (c *integerGapArrayCursor) Next() *cursors.IntegerArray {
+	a := c.IntegerArrayCursor.Next()
+	for _, ts := range a.Timestamps {
+		c.gaps.add(ts)
+	}
+	return a
+}
+
+// unsignedGapArrayCursor records the gaps between the points read from the
+// underlying cursor.
+type unsignedGapArrayCursor struct {
+	cursors.UnsignedArrayCursor
+	gaps *gapRecorder
+}
+
+func (c *unsignedGapArrayCursor) Next() *cursors.UnsignedArray {
+	a := c.UnsignedArrayCursor.Next()
+	for _, ts := range a.Timestamps {
+		c.gaps.add(ts)
+	}
+	return a
+}
+
+// stringGapArrayCursor records the gaps between the points read from the
+// underlying cursor.
+type stringGapArrayCursor struct {
+	cursors.StringArrayCursor
+	gaps *gapRecorder
+}
+
+func (c *stringGapArrayCursor) Next() *cursors.StringArray {
+	a := c.StringArrayCursor.Next()
+	for _, ts := range a.Timestamps {
+		c.gaps.add(ts)
+	}
+	return a
+}
+
+// booleanGapArrayCursor records the gaps between the points read from the
+// underlying cursor.
+type booleanGapArrayCursor struct {
+	cursors.BooleanArrayCursor
+	gaps *gapRecorder
+}
+
+func (c *booleanGapArrayCursor) Next() *cursors.BooleanArray {
+	a := c.BooleanArrayCursor.Next()
+	for _, ts := range a.Timestamps {
+		c.gaps.add(ts)
+	}
+	return a
+}
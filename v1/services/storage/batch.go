@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb"
+)
+
+// ReadFilterBatch reads each of reqs as ReadFilter does and returns their
+// result sets in the order of reqs. The shards of the requests reading the
+// same retention policy and range in the same order are resolved once, while
+// the series of each request are still selected by its own predicate. Each
+// result set must be closed. If any request fails, the result sets read so
+// far are closed and the error is returned.
+func (s *Store) ReadFilterBatch(ctx context.Context, reqs []*datatypes.ReadFilterRequest) ([]reads.ResultSet, error) {
+	sets := make(shardSets)
+	results := make([]reads.ResultSet, 0, len(reqs))
+	for _, req := range reqs {
+		rs, err := s.readFilter(ctx, req, sets)
+		if err != nil {
+			for _, rs := range results {
+				rs.Close()
+			}
+			return nil, err
+		}
+		results = append(results, rs)
+	}
+	return results, nil
+}
+
+type shardSetKey struct {
+	database, rp string
+	desc         bool
+	start, end   int64
+}
+
+type shardSet struct {
+	ids    []uint64
+	shards []*tsdb.Shard
+}
+
+// shardSets holds the shards resolved for the requests of a batch. A nil
+// shardSets resolves the shards of each request.
+type shardSets map[shardSetKey]shardSet
+
+// resolve returns the IDs of the shards selected for key and the shards, if
+// there are any.
+func (m shardSets) resolve(ctx context.Context, s *Store, key shardSetKey) ([]uint64, []*tsdb.Shard, error) {
+	if set, ok := m[key]; ok {
+		return set.ids, set.shards, nil
+	}
+
+	ids, err := s.findShardIDs(ctx, key.database, key.rp, key.desc, key.start, key.end)
+	if err != nil {
+		return nil, nil, err
+	}
+	var shards []*tsdb.Shard
+	if len(ids) > 0 {
+		if shards, err = s.shards(ctx, ids); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if m != nil {
+		m[key] = shardSet{ids: ids, shards: shards}
+	}
+	return ids, shards, nil
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"math"
+
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// CoercionResultSet is implemented by the result sets returned by ReadFilter,
+// reporting the values affected by the CoerceFields read option.
+type CoercionResultSet interface {
+	reads.ResultSet
+
+	// CoercionStats returns the number of values that lost precision or
+	// were dropped by coercion. It is only accurate after the result set
+	// has been fully consumed.
+	CoercionStats() CoercionStats
+}
+
+// CoercionStats counts the values affected by coercion.
+type CoercionStats struct {
+	// Lossy is the number of values that were coerced with a loss of
+	// precision: integers whose magnitude exceeds 2^53 coerced to float, and
+	// floats with a fractional part coerced to integer.
+	Lossy int64
+
+	// Dropped is the number of values that could not be represented by the
+	// target type and were omitted.
+	Dropped int64
+}
+
+// coercion holds the target types of the CoerceFields read option and counts
+// the values affected while a ReadFilter request is read.
+type coercion struct {
+	types map[string]cursors.FieldType
+	stats CoercionStats
+}
+
+// maxExactFloat is the largest magnitude from which every integer converts
+// to a float64 exactly.
+const maxExactFloat = 1 << 53
+
+// coerceSeriesCursor replaces the cursor iterators of the rows of fields with
+// a target type, so that the cursor of every shard produces the target type.
+type coerceSeriesCursor struct {
+	reads.SeriesCursor
+	coerce *coercion
+	row    reads.SeriesRow
+}
+
+func (c *coerceSeriesCursor) Next() *reads.SeriesRow {
+	row := c.SeriesCursor.Next()
+	if row == nil {
+		return nil
+	}
+	typ, ok := c.coerce.types[row.Field]
+	if !ok {
+		return row
+	}
+
+	// The row is copied, as its query is owned by the underlying cursor.
+	c.row = *row
+	c.row.Query = make(cursors.CursorIterators, len(row.Query))
+	for i, itr := range row.Query {
+		c.row.Query[i] = &coerceCursorIterator{CursorIterator: itr, typ: typ, coerce: c.coerce}
+	}
+	return &c.row
+}
+
+// coerceCursorIterator coerces the values of the cursors of a shard to typ.
+type coerceCursorIterator struct {
+	cursors.CursorIterator
+	typ    cursors.FieldType
+	coerce *coercion
+}
+
+func (itr *coerceCursorIterator) Next(ctx context.Context, r *cursors.CursorRequest) (cursors.Cursor, error) {
+	cur, err := itr.CursorIterator.Next(ctx, r)
+	if err != nil || cur == nil {
+		return cur, err
+	}
+
+	switch itr.typ {
+	case cursors.Float:
+		if _, ok := cur.(cursors.FloatArrayCursor); !ok {
+			return &floatCoerceArrayCursor{cur: cur, stats: &itr.coerce.stats}, nil
+		}
+	case cursors.Integer:
+		if _, ok := cur.(cursors.IntegerArrayCursor); !ok {
+			return &integerCoerceArrayCursor{cur: cur, stats: &itr.coerce.stats}, nil
+		}
+	}
+	return cur, nil
+}
+
+// floatCoerceArrayCursor coerces the values of the underlying cursor to
+// float. Integers and unsigned integers are converted, with a loss of
+// precision if their magnitude exceeds 2^53, and booleans are converted to 1
+// or 0. Strings are dropped.
+type floatCoerceArrayCursor struct {
+	cur   cursors.Cursor
+	res   cursors.FloatArray
+	stats *CoercionStats
+}
+
+func (c *floatCoerceArrayCursor) Close()                     { c.cur.Close() }
+func (c *floatCoerceArrayCursor) Err() error                 { return c.cur.Err() }
+func (c *floatCoerceArrayCursor) Stats() cursors.CursorStats { return c.cur.Stats() }
+
+func (c *floatCoerceArrayCursor) Next() *cursors.FloatArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for {
+		switch cur := c.cur.(type) {
+		case cursors.IntegerArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				if v > maxExactFloat || v < -maxExactFloat {
+					c.stats.Lossy++
+				}
+				c.append(a.Timestamps[i], float64(v))
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.UnsignedArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				if v > maxExactFloat {
+					c.stats.Lossy++
+				}
+				c.append(a.Timestamps[i], float64(v))
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.BooleanArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				var f float64
+				if v {
+					f = 1
+				}
+				c.append(a.Timestamps[i], f)
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.StringArrayCursor:
+			a := cur.Next()
+			c.stats.Dropped += int64(a.Len())
+			if a.Len() == 0 {
+				return &c.res
+			}
+		default:
+			return &c.res
+		}
+
+		if c.res.Len() > 0 {
+			return &c.res
+		}
+	}
+}
+
+func (c *floatCoerceArrayCursor) append(ts int64, v float64) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+}
+
+// integerCoerceArrayCursor coerces the values of the underlying cursor to
+// integer. Floats are truncated toward zero, with a loss of precision if they
+// have a fractional part, and are dropped if they are NaN or out of range.
+// Unsigned integers greater than math.MaxInt64 are dropped, and booleans are
+// converted to 1 or 0. Strings are dropped.
+type integerCoerceArrayCursor struct {
+	cur   cursors.Cursor
+	res   cursors.IntegerArray
+	stats *CoercionStats
+}
+
+func (c *integerCoerceArrayCursor) Close()                     { c.cur.Close() }
+func (c *integerCoerceArrayCursor) Err() error                 { return c.cur.Err() }
+func (c *integerCoerceArrayCursor) Stats() cursors.CursorStats { return c.cur.Stats() }
+
+func (c *integerCoerceArrayCursor) Next() *cursors.IntegerArray {
+	c.res.Timestamps, c.res.Values = c.res.Timestamps[:0], c.res.Values[:0]
+	for {
+		switch cur := c.cur.(type) {
+		case cursors.FloatArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				// float64(math.MaxInt64) rounds up to 2^63, which is out of range.
+				if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+					c.stats.Dropped++
+					continue
+				}
+				if v != math.Trunc(v) {
+					c.stats.Lossy++
+				}
+				c.append(a.Timestamps[i], int64(v))
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.UnsignedArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				if v > math.MaxInt64 {
+					c.stats.Dropped++
+					continue
+				}
+				c.append(a.Timestamps[i], int64(v))
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.BooleanArrayCursor:
+			a := cur.Next()
+			for i, v := range a.Values {
+				var n int64
+				if v {
+					n = 1
+				}
+				c.append(a.Timestamps[i], n)
+			}
+			if a.Len() == 0 {
+				return &c.res
+			}
+		case cursors.StringArrayCursor:
+			a := cur.Next()
+			c.stats.Dropped += int64(a.Len())
+			if a.Len() == 0 {
+				return &c.res
+			}
+		default:
+			return &c.res
+		}
+
+		if c.res.Len() > 0 {
+			return &c.res
+		}
+	}
+}
+
+func (c *integerCoerceArrayCursor) append(ts int64, v int64) {
+	c.res.Timestamps = append(c.res.Timestamps, ts)
+	c.res.Values = append(c.res.Values, v)
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// testArrayCursor implements the methods shared by the array cursors of the
+// tests.
+type testArrayCursor struct {
+	err    error
+	stats  cursors.CursorStats
+	closed bool
+}
+
+func (c *testArrayCursor) Close()                     { c.closed = true }
+func (c *testArrayCursor) Err() error                 { return c.err }
+func (c *testArrayCursor) Stats() cursors.CursorStats { return c.stats }
+
+// testFloatArrayCursor produces arrays, followed by an empty array.
+type testFloatArrayCursor struct {
+	testArrayCursor
+	arrays []*cursors.FloatArray
+}
+
+func (c *testFloatArrayCursor) Next() *cursors.FloatArray {
+	if len(c.arrays) == 0 {
+		return &cursors.FloatArray{}
+	}
+	a := c.arrays[0]
+	c.arrays = c.arrays[1:]
+	return a
+}
+
+// testIntegerArrayCursor produces arrays, followed by an empty array.
+type testIntegerArrayCursor struct {
+	testArrayCursor
+	arrays []*cursors.IntegerArray
+}
+
+func (c *testIntegerArrayCursor) Next() *cursors.IntegerArray {
+	if len(c.arrays) == 0 {
+		return &cursors.IntegerArray{}
+	}
+	a := c.arrays[0]
+	c.arrays = c.arrays[1:]
+	return a
+}
+
+// testUnsignedArrayCursor produces arrays, followed by an empty array.
+type testUnsignedArrayCursor struct {
+	testArrayCursor
+	arrays []*cursors.UnsignedArray
+}
+
+func (c *testUnsignedArrayCursor) Next() *cursors.UnsignedArray {
+	if len(c.arrays) == 0 {
+		return &cursors.UnsignedArray{}
+	}
+	a := c.arrays[0]
+	c.arrays = c.arrays[1:]
+	return a
+}
+
+// testStringArrayCursor produces arrays, followed by an empty array.
+type testStringArrayCursor struct {
+	testArrayCursor
+	arrays []*cursors.StringArray
+}
+
+func (c *testStringArrayCursor) Next() *cursors.StringArray {
+	if len(c.arrays) == 0 {
+		return &cursors.StringArray{}
+	}
+	a := c.arrays[0]
+	c.arrays = c.arrays[1:]
+	return a
+}
+
+// testBooleanArrayCursor produces arrays, followed by an empty array.
+type testBooleanArrayCursor struct {
+	testArrayCursor
+	arrays []*cursors.BooleanArray
+}
+
+func (c *testBooleanArrayCursor) Next() *cursors.BooleanArray {
+	if len(c.arrays) == 0 {
+		return &cursors.BooleanArray{}
+	}
+	a := c.arrays[0]
+	c.arrays = c.arrays[1:]
+	return a
+}
+
+// testCursorIterator returns cur, or err if set.
+type testCursorIterator struct {
+	cur   cursors.Cursor
+	err   error
+	stats cursors.CursorStats
+}
+
+func (itr *testCursorIterator) Next(ctx context.Context, r *cursors.CursorRequest) (cursors.Cursor, error) {
+	if itr.err != nil {
+		return nil, itr.err
+	}
+	return itr.cur, nil
+}
+
+func (itr *testCursorIterator) Stats() cursors.CursorStats { return itr.stats }
+
+// testSeriesCursor produces rows, then reports err.
+type testSeriesCursor struct {
+	rows []reads.SeriesRow
+	row  reads.SeriesRow
+	err  error
+}
+
+func (c *testSeriesCursor) Close()     {}
+func (c *testSeriesCursor) Err() error { return c.err }
+
+func (c *testSeriesCursor) Next() *reads.SeriesRow {
+	if len(c.rows) == 0 {
+		return nil
+	}
+	c.row, c.rows = c.rows[0], c.rows[1:]
+	return &c.row
+}
+
+func TestCoerceSeriesCursor(t *testing.T) {
+	integers := &testCursorIterator{cur: &testIntegerArrayCursor{}}
+	floats := &testCursorIterator{cur: &testFloatArrayCursor{}}
+	c := &coerceSeriesCursor{
+		SeriesCursor: &testSeriesCursor{rows: []reads.SeriesRow{
+			{Name: []byte("cpu"), Field: "v", Query: cursors.CursorIterators{integers, floats}},
+			{Name: []byte("cpu"), Field: "w", Query: cursors.CursorIterators{integers}},
+		}},
+		coerce: &coercion{types: map[string]cursors.FieldType{"v": cursors.Float}},
+	}
+
+	// The iterators of a field with a target type are wrapped.
+	row := c.Next()
+	if row == nil || row.Field != "v" || len(row.Query) != 2 {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	cur, err := row.Query[0].Next(context.Background(), &cursors.CursorRequest{})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := cur.(*floatCoerceArrayCursor); !ok {
+		t.Fatalf("got cursor %T, exp *floatCoerceArrayCursor", cur)
+	}
+	if cur, err := row.Query[1].Next(context.Background(), &cursors.CursorRequest{}); err != nil {
+		t.Fatal(err)
+	} else if cur != floats.cur {
+		t.Fatalf("got cursor %T, exp the cursor of the shard", cur)
+	}
+
+	// The iterators of other fields are unchanged.
+	row = c.Next()
+	if row == nil || row.Field != "w" || len(row.Query) != 1 || row.Query[0] != integers {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	if row := c.Next(); row != nil {
+		t.Fatalf("unexpected row %+v", row)
+	}
+}
+
+func TestFloatCoerceArrayCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cur    cursors.Cursor
+		ts     []int64
+		values []float64
+		stats  CoercionStats
+	}{
+		{
+			name: "integer",
+			cur: &testIntegerArrayCursor{arrays: []*cursors.IntegerArray{
+				{Timestamps: []int64{1, 2, 3}, Values: []int64{1, maxExactFloat + 1, -maxExactFloat - 1}},
+			}},
+			ts:     []int64{1, 2, 3},
+			values: []float64{1, maxExactFloat + 1, -maxExactFloat - 1},
+			stats:  CoercionStats{Lossy: 2},
+		},
+		{
+			name: "unsigned",
+			cur: &testUnsignedArrayCursor{arrays: []*cursors.UnsignedArray{
+				{Timestamps: []int64{1, 2}, Values: []uint64{maxExactFloat, math.MaxUint64}},
+			}},
+			ts:     []int64{1, 2},
+			values: []float64{maxExactFloat, math.MaxUint64},
+			stats:  CoercionStats{Lossy: 1},
+		},
+		{
+			name: "boolean",
+			cur: &testBooleanArrayCursor{arrays: []*cursors.BooleanArray{
+				{Timestamps: []int64{1, 2}, Values: []bool{true, false}},
+			}},
+			ts:     []int64{1, 2},
+			values: []float64{1, 0},
+		},
+		{
+			name: "string",
+			cur: &testStringArrayCursor{arrays: []*cursors.StringArray{
+				{Timestamps: []int64{1, 2}, Values: []string{"a", "b"}},
+				{Timestamps: []int64{3}, Values: []string{"c"}},
+			}},
+			stats: CoercionStats{Dropped: 3},
+		},
+		{
+			name: "untyped",
+			cur:  untypedCursor{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats CoercionStats
+			c := &floatCoerceArrayCursor{cur: tt.cur, stats: &stats}
+			var ts []int64
+			var values []float64
+			for a := c.Next(); a.Len() > 0; a = c.Next() {
+				ts = append(ts, a.Timestamps...)
+				values = append(values, a.Values...)
+			}
+			if !cmp.Equal(ts, tt.ts) {
+				t.Errorf("unexpected timestamps -got/+exp\n%s", cmp.Diff(ts, tt.ts))
+			}
+			if !cmp.Equal(values, tt.values) {
+				t.Errorf("unexpected values -got/+exp\n%s", cmp.Diff(values, tt.values))
+			}
+			if stats != tt.stats {
+				t.Errorf("got stats %+v, exp %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestIntegerCoerceArrayCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cur    cursors.Cursor
+		ts     []int64
+		values []int64
+		stats  CoercionStats
+	}{
+		{
+			name: "float",
+			cur: &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+				// A block of dropped values does not end the cursor.
+				{Timestamps: []int64{1}, Values: []float64{math.NaN()}},
+				{
+					Timestamps: []int64{2, 3, 4, 5, 6, 7},
+					Values:     []float64{1.5, -2.5, 1e19, math.MaxInt64, math.MinInt64, 3},
+				},
+			}},
+			ts:     []int64{2, 3, 6, 7},
+			values: []int64{1, -2, math.MinInt64, 3},
+			stats:  CoercionStats{Lossy: 2, Dropped: 3},
+		},
+		{
+			name: "unsigned",
+			cur: &testUnsignedArrayCursor{arrays: []*cursors.UnsignedArray{
+				{Timestamps: []int64{1, 2, 3}, Values: []uint64{1, math.MaxInt64, math.MaxInt64 + 1}},
+			}},
+			ts:     []int64{1, 2},
+			values: []int64{1, math.MaxInt64},
+			stats:  CoercionStats{Dropped: 1},
+		},
+		{
+			name: "boolean",
+			cur: &testBooleanArrayCursor{arrays: []*cursors.BooleanArray{
+				{Timestamps: []int64{1, 2}, Values: []bool{false, true}},
+			}},
+			ts:     []int64{1, 2},
+			values: []int64{0, 1},
+		},
+		{
+			name: "string",
+			cur: &testStringArrayCursor{arrays: []*cursors.StringArray{
+				{Timestamps: []int64{1}, Values: []string{"a"}},
+			}},
+			stats: CoercionStats{Dropped: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats CoercionStats
+			c := &integerCoerceArrayCursor{cur: tt.cur, stats: &stats}
+			var ts, values []int64
+			for a := c.Next(); a.Len() > 0; a = c.Next() {
+				ts = append(ts, a.Timestamps...)
+				values = append(values, a.Values...)
+			}
+			if !cmp.Equal(ts, tt.ts) {
+				t.Errorf("unexpected timestamps -got/+exp\n%s", cmp.Diff(ts, tt.ts))
+			}
+			if !cmp.Equal(values, tt.values) {
+				t.Errorf("unexpected values -got/+exp\n%s", cmp.Diff(values, tt.values))
+			}
+			if stats != tt.stats {
+				t.Errorf("got stats %+v, exp %+v", stats, tt.stats)
+			}
+		})
+	}
+}
@@ -2,6 +2,13 @@ package storage
 
 import (
 	"context"
+	"regexp"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/influxql/query"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
 )
 
 type key int
@@ -14,8 +21,497 @@ const (
 // to configure the behavior of a storage read request.
 type ReadOptions struct {
 	NodeID uint64
+
+	// Authorizer, when not nil, determines the series a request may read.
+	// Series it does not authorize are skipped by the index, as are their
+	// tag keys, tag values and measurements, as if they were not written.
+	// By default, every series may be read.
+	Authorizer query.Authorizer
+
+	// SeriesFilter, when not nil, is called for each series that satisfies
+	// the index predicate of a ReadFilter request. Series for which it
+	// returns false are skipped before any of their field values are read.
+	SeriesFilter SeriesFilterFunc
+
+	// SeriesKeyPrefix, when not empty, restricts a ReadFilter request to the
+	// series whose keys begin with the prefix. The key of a series is its
+	// measurement followed by its tags sorted by key, in the escaped form of
+	// line protocol, such as "cpu,host=a,region=east"; it excludes the field.
+	// The comparison is bytewise, so the prefix "cpu,host=a" also matches
+	// "cpu,host=ab". Series are skipped before any of their field values
+	// are read, and before SeriesFilter is called.
+	SeriesKeyPrefix []byte
+
+	// IncludeSeriesKey adds a _seriesKey tag to the series emitted by
+	// ReadFilter, holding the series key as stored by the index: the
+	// measurement and the tags of the series sorted by key, escaped and
+	// separated as in line protocol, for example "cpu,host=a,region=east".
+	// It excludes the field. The tag replaces a stored tag using the same
+	// key.
+	IncludeSeriesKey bool
+
+	// Fields, when not empty, restricts a ReadFilter request to the named
+	// fields. ExcludeFields names fields that are skipped. Fields and
+	// ExcludeFields are mutually exclusive.
+	Fields        []string
+	ExcludeFields []string
+
+	// CaseInsensitiveTagKeys names tag keys whose comparisons in a TagValues
+	// predicate ignore case. The comparisons are translated to regular
+	// expressions, so the index must test every value of the tag key rather
+	// than perform a direct lookup.
+	CaseInsensitiveTagKeys []string
+
+	// MaxPredicateEvalTime, when greater than 0, limits the time spent
+	// evaluating the predicate of a ReadFilter request, or of a TagValues
+	// request using a block scan, for each series and field. Predicates
+	// comparing _field are evaluated for each series and field rather than
+	// by the index. If the average time of an evaluation over a window of
+	// evaluations exceeds MaxPredicateEvalTime, the request fails with
+	// ErrPredicateTooSlow, so that isolated slow evaluations are tolerated.
+	MaxPredicateEvalTime time.Duration
+
+	// NEQRequiresTag excludes series without a tag from the != and !~
+	// comparisons of the tag in the predicate of a ReadFilter or TagValues
+	// request. By default a missing tag is equivalent to an empty value, so
+	// host != 'a' matches the series without a host tag; with NEQRequiresTag
+	// set it matches only the series with a host tag of another value.
+	NEQRequiresTag bool
+
+	// StrictPredicateKeys makes a ReadFilter, ReadGroup, WindowAggregate,
+	// TagKeys or TagValues request fail with ErrUnknownPredicateKey if its
+	// predicate references a tag key, or compares _field to a field, that no
+	// measurement has in the shards of the request. The error names the key,
+	// so that a misspelled key is not mistaken for the absence of data. The
+	// keys are looked up in the shards overlapping the range, and a request
+	// without shards is not checked. By default, an unknown key matches no
+	// series.
+	StrictPredicateKeys bool
+
+	// MaxResponseBytes, when greater than 0, limits the estimated size of a
+	// ReadFilter response, accounting for the tags of each series and the
+	// timestamp and value of each point. Once reached, the result set stops
+	// early and reports Truncated, or, if FailOnMaxResponseBytes is set,
+	// returns ErrResponseTooLarge from Err.
+	MaxResponseBytes       int64
+	FailOnMaxResponseBytes bool
+
+	// CountFieldPoints makes the result set of a ReadFilter request count
+	// the points read for each field, which are reported by
+	// FieldPointCountResultSet.
+	CountFieldPoints bool
+
+	// SortFieldsByFrequency orders the field keys returned for the _field
+	// tag by the number of points written in the requested range, most
+	// frequent first, instead of by name. Fields without points in the
+	// range are omitted. Determining the frequency requires reading every
+	// matching block, which is considerably more expensive.
+	SortFieldsByFrequency bool
+
+	// SortTagValuesByRecency orders the values returned by TagValues by the
+	// time of the most recent point in the requested range of a series with
+	// the value, most recent first, instead of by value. Values written at
+	// the same time are ordered by value, and values without points in the
+	// range are omitted. Like SortFieldsByFrequency, it requires reading
+	// every matching block.
+	SortTagValuesByRecency bool
+
+	// IncludeEmptyTagValues makes TagValues report the empty string as a
+	// value of the tag key if a series matching the request has no value
+	// for it. By default the empty string is never reported. The storage
+	// engine does not distinguish a tag with an empty value from an absent
+	// tag: tags with an empty value are omitted from the series key when a
+	// point is written, so ReadFilter never reports them, and a predicate
+	// comparing a tag to the empty string matches the series without it.
+	IncludeEmptyTagValues bool
+
+	// MaxDistinctValues, when greater than 0, limits the number of distinct
+	// values accumulated by a TagValues request for a tag key, and for
+	// _measurement or _field when their values are found by a block scan.
+	// Once reached, further values are ignored and the iterator returned
+	// reports Truncated, or, if FailOnMaxDistinctValues is set, the request
+	// fails with ErrTooManyDistinctValues. The values retained are those
+	// found first, which are not necessarily the least. The empty value
+	// reported with IncludeEmptyTagValues is not counted.
+	//
+	// The Limit of a TagValues request is applied to the same values while
+	// they are accumulated, so that at most twice as many values are held
+	// at a time. Values omitted because of the Limit are not reported by
+	// Truncated, and the empty value is not counted either.
+	MaxDistinctValues       int
+	FailOnMaxDistinctValues bool
+
+	// MeasurementNameRegex, when not nil, restricts the names returned by
+	// MeasurementNames, including those of a TagValues request for
+	// _measurement, and ActiveMeasurements to those it matches, as SHOW
+	// MEASUREMENTS WITH MEASUREMENT =~ /regex/ does. It is combined with the
+	// predicate of the request. The index evaluates it whenever it is
+	// consulted, and the names found by a block scan are filtered before
+	// they are sorted and paged.
+	MeasurementNameRegex *regexp.Regexp
+
+	// TagKeysLimit, when greater than 0, limits the keys returned by a
+	// TagKeys request to the least TagKeysLimit keys in lexicographic order,
+	// counting _measurement and _field like any other key. The iterator
+	// returned then implements TruncatedStringIterator, reporting whether
+	// keys were omitted. The keys are limited after they are sorted, whether
+	// they are read from the index or by a block scan, so that the keys
+	// returned are stable.
+	TagKeysLimit int
+
+	// TagKeyAliases renames tag keys in the series emitted by ReadFilter and
+	// ReadGroup, mapping a stored tag key to the key reported to the client.
+	// Tag keys without an alias are passed through unchanged. If a series
+	// has both a renamed tag and a tag already using the new key, the
+	// renamed tag replaces the other. Predicates and the group keys of a
+	// ReadGroup request refer to the stored tag keys. Aliases must be unique
+	// and may not rename to or from _measurement or _field.
+	TagKeyAliases map[string]string
+
+	// RetentionPolicies, when not empty, reads a ReadFilter request from the
+	// union of the named retention policies of the bucket rather than the
+	// default retention policy. The retention policies are listed in order
+	// of precedence, highest first. RetentionPolicyConflict determines how
+	// a series with points in more than one of them is read.
+	RetentionPolicies       []string
+	RetentionPolicyConflict RetentionPolicyConflict
+
+	// V1Compat enumerates the _measurement and _field values of a TagValues
+	// request with the semantics of InfluxDB 1.x SHOW MEASUREMENTS and SHOW
+	// FIELD KEYS. The values are read from the index rather than by scanning
+	// blocks, regardless of the predicate:
+	//
+	//   * _measurement lists the measurements with series matching the tag
+	//     comparisons of the predicate and, if the predicate compares
+	//     _field, a field matching it.
+	//   * _field lists every field of those measurements that matches the
+	//     _field comparisons of the predicate, whether or not the series
+	//     matching the tag comparisons have written it.
+	V1Compat bool
+
+	// GapThreshold, when greater than 0, makes ReadFilter record the gaps
+	// between consecutive points of each series that are longer than the
+	// threshold, which are reported by the GapResultSet of the result set.
+	// The periods before the first and after the last point of a series in
+	// the range are not gaps. If GapsOnly is set, the cursor of each series
+	// produces its gaps instead of its points, as integers whose timestamp
+	// is the start of the gap and whose value is its duration in
+	// nanoseconds. Gaps are found before MaxPointsPerSeries is applied,
+	// and are shifted by TimeShift like the points.
+	GapThreshold time.Duration
+	GapsOnly     bool
+
+	// TimeShift is added to the timestamp of every point emitted by a
+	// ReadFilter request. A positive shift moves points forward in time. The
+	// range of the request selects points by their stored timestamps, before
+	// the shift is applied. Points whose shifted timestamps would fall
+	// outside models.MinNanoTime and models.MaxNanoTime are dropped.
+	TimeShift time.Duration
+
+	// MaxPointsPerSeries, when greater than 0, decimates each series of a
+	// ReadFilter request to at most the given number of points. A series of
+	// n points is read with a stride of ceil(n / MaxPointsPerSeries), that
+	// is, every stride-th point is emitted, starting with the first. Series
+	// that do not exceed the target are read in full. Counting the points
+	// requires reading each series twice. The SeriesPointLimit and
+	// PointLimit of the request apply to the points left by
+	// MaxPointsPerSeries and TimeShift.
+	MaxPointsPerSeries int
+
+	// MaxStringLength, when greater than 0, truncates the values of string
+	// fields of a ReadFilter request that are longer than the given number
+	// of bytes. A truncated value holds at most MaxStringLength bytes of the
+	// original value, ending on a UTF-8 character boundary so that no
+	// multibyte character is split, followed by StringTruncationMarker.
+	MaxStringLength int
+
+	// DuplicateTimestamps determines how ReadFilter handles points of a
+	// series sharing a timestamp, which may be read from the shards of
+	// overlapping shard groups. The points of a shard never share a
+	// timestamp.
+	DuplicateTimestamps DuplicateTimestamps
+
+	// IncludeShardGroups, if not empty, restricts the shard groups read by a
+	// request to those with the given IDs. ExcludeShardGroups lists the IDs
+	// of shard groups that are not read, taking precedence over
+	// IncludeShardGroups. Both apply to the shard groups overlapping the
+	// range of the request, before the ShardSelector of the Store chooses
+	// their shards, and to every retention policy read.
+	IncludeShardGroups []uint64
+	ExcludeShardGroups []uint64
+
+	// CoerceFields maps field keys to the type to which the values of the
+	// field are coerced by a ReadFilter request, resolving type conflicts
+	// between shards. The target type must be cursors.Float or
+	// cursors.Integer:
+	//
+	//   - Integers are coerced to float exactly up to a magnitude of 2^53,
+	//     and with a loss of precision above it.
+	//   - Floats are coerced to integer by truncating toward zero, with a
+	//     loss of precision if they have a fractional part. NaN and values
+	//     out of range are dropped.
+	//   - Unsigned integers are converted like integers, and those greater
+	//     than math.MaxInt64 are dropped when coerced to integer.
+	//   - Booleans are coerced to 1 or 0, and strings are dropped.
+	//
+	// Values that lose precision or are dropped are counted by the
+	// CoercionStats of the result set. Coercion is applied to the cursor of
+	// each shard, so it does not resolve conflicts between the retention
+	// policies merged by RetentionPolicyConflictMerge.
+	CoerceFields map[string]cursors.FieldType
+
+	// GroupSeriesTags, when greater than 0, makes the group cursors of a
+	// ReadGroup request implement SeriesTagsGroupCursor, which reports the
+	// distinct tag sets of the series of each group. At most GroupSeriesTags
+	// tag sets are retained for each group, bounding the memory used. The
+	// tag sets are collected by an additional scan of the series, reading
+	// the first block of each, before the first group is produced.
+	GroupSeriesTags int
+
+	// GroupTopN, when greater than 0, limits each group of a ReadGroup
+	// request to the GroupTopN series ranked highest by GroupTopNAggregate
+	// of the points of the field GroupTopNField in the range, or lowest if
+	// GroupTopNAscending is set. A series is identified by its tags,
+	// including _measurement but not _field, and every field of a selected
+	// series is read. Series without numeric points of the field in the
+	// range are not ranked and are omitted, as are groups left without
+	// series. Series ranked equally are ordered by their tags. The
+	// aggregate must be count, sum, mean, min or max, otherwise the request
+	// fails with ErrInvalidGroupTopN. The ranking requires an additional
+	// scan of the points of the field before the first group is produced.
+	GroupTopN          int
+	GroupTopNField     string
+	GroupTopNAggregate datatypes.Aggregate_AggregateType
+	GroupTopNAscending bool
+
+	// GroupOrder requires the groups of a ReadGroup request to be produced
+	// in the given order, which is only defined for a request grouping by
+	// tag keys; otherwise the request fails with ErrInvalidGroupOrder. The
+	// default, GroupOrderDefault, leaves the order to the request.
+	GroupOrder GroupOrder
+
+	// TimeOfDayBucket, when greater than 0, splits each group of a ReadGroup
+	// request by the time of day of its points, regardless of their date.
+	// It is the width of the buckets, which must evenly divide a day, so
+	// time.Hour produces up to 24 groups for each group of the request,
+	// ordered by bucket. The group cursors implement TimeOfDayGroupCursor,
+	// and only buckets with points are reported. The time of day is the
+	// wall clock time in TimeOfDayLocation, or UTC if it is nil, so on days
+	// with a daylight saving transition a bucket may hold the points of two
+	// hours, or none. Each group of the request is read into memory before
+	// it is split. It may not be combined with an aggregate, which would
+	// be computed over the entire range rather than each bucket.
+	TimeOfDayBucket   time.Duration
+	TimeOfDayLocation *time.Location
+
+	// WindowFill determines how the windows of a WindowAggregate request
+	// without points are reported. Filled windows are reported at their
+	// stop time. Filling requires windows of a fixed duration and a bounded
+	// range, otherwise the request fails with ErrInvalidWindowFill.
+	WindowFill WindowFill
 }
 
+// RetentionPolicyConflict determines how a read spanning several retention
+// policies handles a series and field with points in the requested range in
+// the shards of more than one of them.
+type RetentionPolicyConflict int
+
+const (
+	// RetentionPolicyConflictError fails the read with
+	// ErrRetentionPolicyConflict. It is the default.
+	RetentionPolicyConflictError RetentionPolicyConflict = iota
+
+	// RetentionPolicyConflictPrefer reads the series only from the retention
+	// policy with the highest precedence.
+	RetentionPolicyConflictPrefer
+
+	// RetentionPolicyConflictMerge reads the points of the series from every
+	// retention policy. Where timestamps coincide, the value from the
+	// retention policy with the highest precedence is used. Merged series
+	// are read into memory in full.
+	RetentionPolicyConflictMerge
+)
+
+// DuplicateTimestamps determines how the points of a series sharing a
+// timestamp are read.
+type DuplicateTimestamps int
+
+const (
+	// DuplicateTimestampsKeep reads every point, in the order of the shards
+	// holding them. It is the default.
+	DuplicateTimestampsKeep DuplicateTimestamps = iota
+
+	// DuplicateTimestampsFirst reads the first of the points sharing a
+	// timestamp, in the order of the shards holding them. Points preceding
+	// the timestamp of the previous point of the series are dropped, so
+	// that timestamps are strictly increasing.
+	DuplicateTimestampsFirst
+
+	// DuplicateTimestampsLast reads the last of the points sharing a
+	// timestamp, in the order of the shards holding them. As with
+	// DuplicateTimestampsFirst, timestamps are strictly increasing.
+	DuplicateTimestampsLast
+)
+
+// WindowFill determines how a WindowAggregate request reports windows
+// without points.
+type WindowFill int
+
+const (
+	// WindowFillNone omits windows without points. It is the default.
+	WindowFillNone WindowFill = iota
+
+	// WindowFillNull reports a null for each window without points. The
+	// cursors of the series implement NullArrayCursor, which identifies the
+	// nulls; their values are the zero value of the type of the field.
+	WindowFillNull
+
+	// WindowFillPrevious reports the value of the previous window for each
+	// window without points. Windows preceding the first point of a series
+	// are omitted.
+	WindowFillPrevious
+)
+
+// GroupOrder determines the order of the groups of a ReadGroup request.
+type GroupOrder int
+
+const (
+	// GroupOrderDefault leaves the order of the groups to the request. The
+	// groups of a GroupBy request are ordered by their group key, with the
+	// series lacking a group key tag sorted after any value, and a GroupNone
+	// request produces a single group. It is the default.
+	GroupOrderDefault GroupOrder = iota
+
+	// GroupOrderKeyNilLast orders the groups by their group key, with the
+	// series lacking a group key tag sorted after any value.
+	GroupOrderKeyNilLast
+
+	// GroupOrderKeyNilFirst orders the groups by their group key, with the
+	// series lacking a group key tag sorted before any value.
+	GroupOrderKeyNilFirst
+)
+
+// validate returns an error if the options are inconsistent.
+func (o *ReadOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Fields) > 0 && len(o.ExcludeFields) > 0 {
+		return ErrConflictingFieldOptions
+	}
+	if o.TimeOfDayBucket < 0 || (o.TimeOfDayBucket > 0 && (24*time.Hour)%o.TimeOfDayBucket != 0) {
+		return ErrInvalidTimeOfDayBucket
+	}
+	if o.GroupTopN < 0 || (o.GroupTopN > 0 && (o.GroupTopNField == "" || !isGroupTopNAggregate(o.GroupTopNAggregate))) {
+		return ErrInvalidGroupTopN
+	}
+	if o.GroupOrder < GroupOrderDefault || o.GroupOrder > GroupOrderKeyNilFirst {
+		return ErrInvalidGroupOrder
+	}
+	for _, typ := range o.CoerceFields {
+		if typ != cursors.Float && typ != cursors.Integer {
+			return ErrInvalidCoercion
+		}
+	}
+	if len(o.TagKeyAliases) > 0 {
+		seen := make(map[string]struct{}, len(o.TagKeyAliases))
+		for k, v := range o.TagKeyAliases {
+			if isReservedTagKey(k) || isReservedTagKey(v) {
+				return ErrInvalidTagKeyAliases
+			}
+			if _, ok := seen[v]; ok {
+				return ErrInvalidTagKeyAliases
+			}
+			seen[v] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// validateReadFilter returns an error if the options are inconsistent, or
+// may not be combined with req. A descending read may not be combined with
+// GapThreshold, RetentionPolicies or a DuplicateTimestamps other than
+// DuplicateTimestampsKeep, which read points oldest first.
+func (o *ReadOptions) validateReadFilter(req *datatypes.ReadFilterRequest) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if req.Descending && o != nil && (o.GapThreshold > 0 || len(o.RetentionPolicies) > 0 || o.DuplicateTimestamps != DuplicateTimestampsKeep) {
+		return ErrInvalidDescending
+	}
+	return nil
+}
+
+// validateReadGroup returns an error if the options are inconsistent, or may
+// not be combined with req. A TimeOfDayBucket may not be combined with an
+// aggregate, and a GroupOrder requires grouping by tag keys.
+func (o *ReadOptions) validateReadGroup(req *datatypes.ReadGroupRequest) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if o == nil {
+		return nil
+	}
+	if o.TimeOfDayBucket > 0 && req.Aggregate != nil {
+		return ErrInvalidTimeOfDayBucket
+	}
+	if o.GroupOrder != GroupOrderDefault && (req.Group != datatypes.GroupBy || len(req.GroupKeys) == 0) {
+		return ErrInvalidGroupOrder
+	}
+	return nil
+}
+
+func isGroupTopNAggregate(typ datatypes.Aggregate_AggregateType) bool {
+	switch typ {
+	case datatypes.AggregateTypeCount, datatypes.AggregateTypeSum, datatypes.AggregateTypeMean,
+		datatypes.AggregateTypeMin, datatypes.AggregateTypeMax:
+		return true
+	default:
+		return false
+	}
+}
+
+func isReservedTagKey(k string) bool {
+	return k == measurementKey || k == fieldKey
+}
+
+// ContextError is returned when a scan is aborted because its context was
+// cancelled or its deadline was exceeded. Err is the error of the context, so
+// errors.Is distinguishes context.Canceled from context.DeadlineExceeded.
+type ContextError struct {
+	Err error
+}
+
+func (e *ContextError) Error() string { return "scan aborted: " + e.Err.Error() }
+
+func (e *ContextError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the scan was aborted because the deadline of its
+// context was exceeded, in which case it may be retried.
+func (e *ContextError) Timeout() bool { return e.Err == context.DeadlineExceeded }
+
+// checkContext returns a ContextError if ctx is done.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &ContextError{Err: err}
+	}
+	return nil
+}
+
+// authorizerFromContext returns the Authorizer of the ReadOptions of ctx, or
+// query.OpenAuthorizer if it has none.
+func authorizerFromContext(ctx context.Context) query.Authorizer {
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.Authorizer != nil {
+		return opts.Authorizer
+	}
+	return query.OpenAuthorizer
+}
+
+// SeriesFilterFunc reports whether the series identified by seriesKey should
+// be included in the results. tags are the tags of the series, excluding the
+// _measurement and _field keys.
+type SeriesFilterFunc func(seriesKey []byte, tags models.Tags) bool
+
 // NewContextWithRequestOptions returns a new Context with nodeID added.
 func NewContextWithReadOptions(ctx context.Context, opts *ReadOptions) context.Context {
 	return context.WithValue(ctx, readOptionsKey, opts)
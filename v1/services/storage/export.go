@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// ExportCSVHeader is the header row written by ExportCSV.
+var ExportCSVHeader = []string{"_time", "_measurement", "_tags", "_field", "_value"}
+
+// ExportCSV runs a ReadFilter request and writes its points to w as CSV, one
+// row per point, preceded by ExportCSVHeader. The columns of each row are:
+//
+//   - _time, the timestamp of the point in RFC 3339 format with nanosecond
+//     precision, in UTC.
+//   - _measurement, the measurement of the series.
+//   - _tags, the remaining tags of the series as comma-separated key=value
+//     pairs ordered by key, with commas, equal signs and spaces escaped by
+//     a backslash as in line protocol. It is empty if the series has no tags.
+//   - _field, the field key.
+//   - _value, the field value. Floats are formatted in the shortest
+//     representation that parses back to the same value, and booleans as
+//     true or false.
+//
+// Fields are quoted as described by RFC 4180, that is, when they contain a
+// comma, a double quote or a line break, with double quotes doubled. Rows
+// are flushed to w after each block of points, so the memory used does not
+// depend on the size of the export. The context is checked before each
+// series; if it is cancelled, the rows written so far are flushed and the
+// error is returned.
+func (s *Store) ExportCSV(ctx context.Context, req *datatypes.ReadFilterRequest, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ExportCSVHeader); err != nil {
+		return err
+	}
+
+	rs, err := s.ReadFilter(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			cw.Flush()
+			return err
+		}
+
+		cur := rs.Cursor()
+		if cur == nil {
+			continue
+		}
+		err := exportCSVSeries(cw, rs.Tags(), cur)
+		cur.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := rs.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportCSVSeries writes the points of cur, the cursor of the series with
+// the given tags, to cw.
+func exportCSVSeries(cw *csv.Writer, tags models.Tags, cur cursors.Cursor) error {
+	var measurement, field string
+	other := make(models.Tags, 0, len(tags))
+	for _, t := range tags {
+		switch {
+		case bytes.Equal(t.Key, measurementKeyBytes):
+			measurement = string(t.Value)
+		case bytes.Equal(t.Key, fieldKeyBytes):
+			field = string(t.Value)
+		default:
+			other = append(other, t)
+		}
+	}
+	var tagsCol string
+	if len(other) > 0 {
+		// HashKey escapes the tags as in line protocol, with a leading comma.
+		tagsCol = string(other.HashKey()[1:])
+	}
+
+	row := []string{"", measurement, tagsCol, field, ""}
+	write := func(ts int64, v string) error {
+		row[0] = time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+		row[4] = v
+		return cw.Write(row)
+	}
+
+	for {
+		var n int
+		switch c := cur.(type) {
+		case cursors.FloatArrayCursor:
+			a := c.Next()
+			for i, ts := range a.Timestamps {
+				if err := write(ts, strconv.FormatFloat(a.Values[i], 'g', -1, 64)); err != nil {
+					return err
+				}
+			}
+			n = a.Len()
+		case cursors.IntegerArrayCursor:
+			a := c.Next()
+			for i, ts := range a.Timestamps {
+				if err := write(ts, strconv.FormatInt(a.Values[i], 10)); err != nil {
+					return err
+				}
+			}
+			n = a.Len()
+		case cursors.UnsignedArrayCursor:
+			a := c.Next()
+			for i, ts := range a.Timestamps {
+				if err := write(ts, strconv.FormatUint(a.Values[i], 10)); err != nil {
+					return err
+				}
+			}
+			n = a.Len()
+		case cursors.StringArrayCursor:
+			a := c.Next()
+			for i, ts := range a.Timestamps {
+				if err := write(ts, a.Values[i]); err != nil {
+					return err
+				}
+			}
+			n = a.Len()
+		case cursors.BooleanArrayCursor:
+			a := c.Next()
+			for i, ts := range a.Timestamps {
+				if err := write(ts, strconv.FormatBool(a.Values[i])); err != nil {
+					return err
+				}
+			}
+			n = a.Len()
+		default:
+			return fmt.Errorf("unexpected cursor type: %T", cur)
+		}
+		if n == 0 {
+			return cur.Err()
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+func TestExportCSVSeries(t *testing.T) {
+	tags := func(measurement, field string, kv ...string) models.Tags {
+		m := map[string]string{string(measurementKeyBytes): measurement, string(fieldKeyBytes): field}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = kv[i+1]
+		}
+		return models.NewTags(m)
+	}
+
+	tests := []struct {
+		name string
+		tags models.Tags
+		cur  cursors.Cursor
+		exp  [][]string
+	}{
+		{
+			name: "float",
+			tags: tags("cpu", "v", "host", "a,b", "region", "us west"),
+			cur: &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+				{Timestamps: []int64{0, 1}, Values: []float64{1.5, 1e21}},
+				{Timestamps: []int64{1000000000}, Values: []float64{0.1}},
+			}},
+			exp: [][]string{
+				{"1970-01-01T00:00:00Z", "cpu", `host=a\,b,region=us\ west`, "v", "1.5"},
+				{"1970-01-01T00:00:00.000000001Z", "cpu", `host=a\,b,region=us\ west`, "v", "1e+21"},
+				{"1970-01-01T00:00:01Z", "cpu", `host=a\,b,region=us\ west`, "v", "0.1"},
+			},
+		},
+		{
+			name: "integer",
+			tags: tags("cpu", "v"),
+			cur: &testIntegerArrayCursor{arrays: []*cursors.IntegerArray{
+				{Timestamps: []int64{0}, Values: []int64{-3}},
+			}},
+			exp: [][]string{{"1970-01-01T00:00:00Z", "cpu", "", "v", "-3"}},
+		},
+		{
+			name: "unsigned",
+			tags: tags("cpu", "v"),
+			cur: &testUnsignedArrayCursor{arrays: []*cursors.UnsignedArray{
+				{Timestamps: []int64{0}, Values: []uint64{18446744073709551615}},
+			}},
+			exp: [][]string{{"1970-01-01T00:00:00Z", "cpu", "", "v", "18446744073709551615"}},
+		},
+		{
+			name: "string",
+			tags: tags(`c"pu`, "msg"),
+			cur: &testStringArrayCursor{arrays: []*cursors.StringArray{
+				{Timestamps: []int64{0}, Values: []string{"a \"b\",\nc"}},
+			}},
+			exp: [][]string{{"1970-01-01T00:00:00Z", `c"pu`, "", "msg", "a \"b\",\nc"}},
+		},
+		{
+			name: "boolean",
+			tags: tags("cpu", "up"),
+			cur: &testBooleanArrayCursor{arrays: []*cursors.BooleanArray{
+				{Timestamps: []int64{0, 1}, Values: []bool{true, false}},
+			}},
+			exp: [][]string{
+				{"1970-01-01T00:00:00Z", "cpu", "", "up", "true"},
+				{"1970-01-01T00:00:00.000000001Z", "cpu", "", "up", "false"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cw := csv.NewWriter(&buf)
+			if err := exportCSVSeries(cw, tt.tags, tt.cur); err != nil {
+				t.Fatal(err)
+			}
+
+			// The rows are flushed by exportCSVSeries.
+			got, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, tt.exp) {
+				t.Errorf("unexpected rows -got/+exp\n%s", cmp.Diff(got, tt.exp))
+			}
+		})
+	}
+}
+
+func TestExportCSVSeries_Errors(t *testing.T) {
+	t.Run("cursor error", func(t *testing.T) {
+		errCursor := errors.New("cursor failed")
+		cur := &testFloatArrayCursor{
+			testArrayCursor: testArrayCursor{err: errCursor},
+			arrays:          []*cursors.FloatArray{{Timestamps: []int64{0}, Values: []float64{1}}},
+		}
+		var buf bytes.Buffer
+		if err := exportCSVSeries(csv.NewWriter(&buf), nil, cur); err != errCursor {
+			t.Fatalf("got error %v, exp %v", err, errCursor)
+		}
+	})
+
+	t.Run("unexpected cursor type", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := exportCSVSeries(csv.NewWriter(&buf), nil, untypedCursor{}); err == nil {
+			t.Fatal("expected an error for an unexpected cursor type")
+		}
+	})
+}
@@ -0,0 +1,550 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// SeriesTagsGroupCursor is implemented by the group cursors of a ReadGroup
+// request using the GroupSeriesTags read option.
+type SeriesTagsGroupCursor interface {
+	reads.GroupCursor
+
+	// SeriesTags returns the distinct tag sets of the series of the group
+	// with points in the range, ordered by models.CompareTags. The tag sets
+	// include _measurement but not _field, so each series is reported once
+	// regardless of the number of its fields.
+	SeriesTags() []models.Tags
+
+	// SeriesTagsTruncated reports whether the group has more distinct tag
+	// sets than were retained.
+	SeriesTagsTruncated() bool
+}
+
+// seriesTagSet holds up to max distinct series tag sets of a group.
+type seriesTagSet struct {
+	max       int
+	seen      map[string]struct{}
+	tags      []models.Tags
+	truncated bool
+}
+
+func (s *seriesTagSet) add(tags models.Tags) {
+	t := make(models.Tags, 0, len(tags))
+	for _, tag := range tags {
+		if !bytes.Equal(tag.Key, fieldKeyBytes) {
+			t = append(t, tag)
+		}
+	}
+
+	key := string(t.HashKey())
+	if _, ok := s.seen[key]; ok {
+		return
+	}
+	if len(s.tags) == s.max {
+		s.truncated = true
+		return
+	}
+	s.seen[key] = struct{}{}
+	s.tags = append(s.tags, t.Clone())
+}
+
+// groupKey returns the key identifying the group with the partition key
+// values vals. A missing value is equivalent to an empty one.
+func groupKey(vals [][]byte) string {
+	var b []byte
+	for _, v := range vals {
+		b = append(b, v...)
+		b = append(b, 0)
+	}
+	return string(b)
+}
+
+// groupSeriesTags scans the series of a ReadGroup request, returning the tag
+// sets of the series of each group, keyed by groupKey. At most max tag sets
+// are retained for each group.
+func groupSeriesTags(ctx context.Context, req *datatypes.ReadGroupRequest, newCursor func() (reads.SeriesCursor, error), max int) (map[string]*seriesTagSet, error) {
+	cur, err := newCursor()
+	if err != nil || cur == nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, len(req.GroupKeys))
+	for i, k := range req.GroupKeys {
+		keys[i] = []byte(k)
+	}
+	vals := make([][]byte, len(keys))
+
+	groups := make(map[string]*seriesTagSet)
+	rs := reads.NewFilteredResultSet(ctx, req.Range.Start, req.Range.End, cur)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		hasData, err := cursorHasData(c)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !hasData {
+			continue
+		}
+
+		tags := rs.Tags()
+		var key string
+		if req.Group == datatypes.GroupBy {
+			for i, k := range keys {
+				vals[i] = tags.Get(k)
+			}
+			key = groupKey(vals)
+		}
+
+		g := groups[key]
+		if g == nil {
+			g = &seriesTagSet{max: max, seen: make(map[string]struct{})}
+			groups[key] = g
+		}
+		g.add(tags)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		sort.Slice(g.tags, func(i, j int) bool {
+			return models.CompareTags(g.tags[i], g.tags[j]) < 0
+		})
+	}
+	return groups, nil
+}
+
+// seriesTagsGroupResultSet reports the series tag sets of each group.
+type seriesTagsGroupResultSet struct {
+	reads.GroupResultSet
+	groups map[string]*seriesTagSet
+}
+
+func (r *seriesTagsGroupResultSet) Next() reads.GroupCursor {
+	gc := r.GroupResultSet.Next()
+	if gc == nil {
+		return nil
+	}
+	c := &seriesTagsGroupCursor{GroupCursor: gc}
+	if g := r.groups[groupKey(gc.PartitionKeyVals())]; g != nil {
+		c.tags, c.truncated = g.tags, g.truncated
+	}
+	return c
+}
+
+type seriesTagsGroupCursor struct {
+	reads.GroupCursor
+	tags      []models.Tags
+	truncated bool
+}
+
+func (c *seriesTagsGroupCursor) SeriesTags() []models.Tags { return c.tags }
+
+func (c *seriesTagsGroupCursor) SeriesTagsTruncated() bool { return c.truncated }
+
+// seriesKeyWithoutField returns the key identifying the series of tags,
+// ignoring _field.
+func seriesKeyWithoutField(tags models.Tags) string {
+	t := make(models.Tags, 0, len(tags))
+	for _, tag := range tags {
+		if !bytes.Equal(tag.Key, fieldKeyBytes) {
+			t = append(t, tag)
+		}
+	}
+	return string(t.HashKey())
+}
+
+// groupTopNSeries scans the points of the GroupTopNField of a ReadGroup
+// request, returning the keys of the series selected by the GroupTopN read
+// option across all groups.
+func groupTopNSeries(ctx context.Context, req *datatypes.ReadGroupRequest, newCursor func() (reads.SeriesCursor, error), opts *ReadOptions) (map[string]struct{}, error) {
+	cur, err := newCursor()
+	if err != nil || cur == nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, len(req.GroupKeys))
+	for i, k := range req.GroupKeys {
+		keys[i] = []byte(k)
+	}
+	vals := make([][]byte, len(keys))
+
+	type rankedSeries struct {
+		key   string
+		value float64
+	}
+	groups := make(map[string][]rankedSeries)
+	aggs := []datatypes.Aggregate_AggregateType{opts.GroupTopNAggregate}
+	stop := func(int64) int64 { return 0 }
+
+	rs := reads.NewFilteredResultSet(ctx, req.Range.Start, req.Range.End, cur)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		tags := rs.Tags()
+		if string(tags.Get(fieldKeyBytes)) != opts.GroupTopNField {
+			continue
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		switch c.(type) {
+		case cursors.FloatArrayCursor, cursors.IntegerArrayCursor, cursors.UnsignedArrayCursor:
+		default:
+			c.Close()
+			continue
+		}
+		curs, err := multiAggregateArrayCursor(c, aggs, stop)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		v, ok := cursorFirstFloat(curs[0])
+		if !ok {
+			continue
+		}
+
+		var key string
+		if req.Group == datatypes.GroupBy {
+			for i, k := range keys {
+				vals[i] = tags.Get(k)
+			}
+			key = groupKey(vals)
+		}
+		groups[key] = append(groups[key], rankedSeries{key: seriesKeyWithoutField(tags), value: v})
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]struct{})
+	for _, series := range groups {
+		sort.Slice(series, func(i, j int) bool {
+			if series[i].value != series[j].value {
+				return (series[i].value < series[j].value) == opts.GroupTopNAscending
+			}
+			return series[i].key < series[j].key
+		})
+		if len(series) > opts.GroupTopN {
+			series = series[:opts.GroupTopN]
+		}
+		for _, s := range series {
+			selected[s.key] = struct{}{}
+		}
+	}
+	return selected, nil
+}
+
+// cursorFirstFloat returns the value of the first point of the numeric
+// cursor c as a float, or false if c has no points.
+func cursorFirstFloat(c cursors.Cursor) (float64, bool) {
+	switch c := c.(type) {
+	case cursors.FloatArrayCursor:
+		if a := c.Next(); a.Len() > 0 {
+			return a.Values[0], true
+		}
+	case cursors.IntegerArrayCursor:
+		if a := c.Next(); a.Len() > 0 {
+			return float64(a.Values[0]), true
+		}
+	case cursors.UnsignedArrayCursor:
+		if a := c.Next(); a.Len() > 0 {
+			return float64(a.Values[0]), true
+		}
+	}
+	return 0, false
+}
+
+// topNGroupResultSet limits the series of each group to those selected by
+// the GroupTopN read option, omitting groups without selected series.
+type topNGroupResultSet struct {
+	reads.GroupResultSet
+	selected map[string]struct{}
+}
+
+func (r *topNGroupResultSet) Next() reads.GroupCursor {
+	for {
+		gc := r.GroupResultSet.Next()
+		if gc == nil {
+			return nil
+		}
+		c := &topNGroupCursor{GroupCursor: gc, selected: r.selected}
+		if c.next() {
+			c.advanced = true
+			return c
+		}
+		gc.Close()
+	}
+}
+
+type topNGroupCursor struct {
+	reads.GroupCursor
+	selected map[string]struct{}
+	advanced bool // the first selected series was found by Next of the result set
+}
+
+func (c *topNGroupCursor) Next() bool {
+	if c.advanced {
+		c.advanced = false
+		return true
+	}
+	return c.next()
+}
+
+// next advances to the next selected series, closing the cursors of the
+// series that are skipped.
+func (c *topNGroupCursor) next() bool {
+	for c.GroupCursor.Next() {
+		if _, ok := c.selected[seriesKeyWithoutField(c.GroupCursor.Tags())]; ok {
+			return true
+		}
+		if cur := c.GroupCursor.Cursor(); cur != nil {
+			cur.Close()
+		}
+	}
+	return false
+}
+
+// TimeOfDayGroupCursor is implemented by the group cursors of a ReadGroup
+// request using the TimeOfDayBucket read option.
+type TimeOfDayGroupCursor interface {
+	reads.GroupCursor
+
+	// TimeOfDay returns the start of the time-of-day bucket of the group,
+	// as the duration since midnight.
+	TimeOfDay() time.Duration
+}
+
+// timeOfDayBucket returns the function mapping a timestamp to the index of
+// its time-of-day bucket of the given width, in loc.
+func timeOfDayBucket(width time.Duration, loc *time.Location) func(ts int64) int {
+	return func(ts int64) int {
+		t := time.Unix(0, ts).In(loc)
+		h, m, sec := t.Clock()
+		d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+			time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+		return int(d / width)
+	}
+}
+
+// timeOfDayGroupResultSet splits each group of the underlying result set into
+// a group for each time-of-day bucket with points, ordered by bucket.
+type timeOfDayGroupResultSet struct {
+	reads.GroupResultSet
+	width   time.Duration
+	bucket  func(ts int64) int
+	pending []*timeOfDayGroupCursor
+	err     error
+}
+
+func (r *timeOfDayGroupResultSet) Next() reads.GroupCursor {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return nil
+		}
+		gc := r.GroupResultSet.Next()
+		if gc == nil {
+			return nil
+		}
+		r.pending, r.err = r.split(gc)
+		gc.Close()
+	}
+
+	c := r.pending[0]
+	r.pending = r.pending[1:]
+	return c
+}
+
+// split reads the series of gc in full, partitioning their points by bucket.
+func (r *timeOfDayGroupResultSet) split(gc reads.GroupCursor) ([]*timeOfDayGroupCursor, error) {
+	keys := make([][]byte, len(gc.Keys()))
+	for i, k := range gc.Keys() {
+		keys[i] = append([]byte(nil), k...)
+	}
+	var vals [][]byte
+	if pv := gc.PartitionKeyVals(); pv != nil {
+		vals = make([][]byte, len(pv))
+		for i, v := range pv {
+			vals[i] = append([]byte(nil), v...)
+		}
+	}
+
+	groups := make(map[int]*timeOfDayGroupCursor)
+	for gc.Next() {
+		cur := gc.Cursor()
+		if cur == nil {
+			continue
+		}
+		parts, err := splitArrayCursor(cur, r.bucket)
+		cur.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags := gc.Tags().Clone()
+		for b, c := range parts {
+			g := groups[b]
+			if g == nil {
+				g = &timeOfDayGroupCursor{
+					timeOfDay: time.Duration(b) * r.width,
+					keys:      keys,
+					vals:      vals,
+					agg:       gc.Aggregate(),
+					i:         -1,
+				}
+				groups[b] = g
+			}
+			g.series = append(g.series, timeOfDaySeries{tags: tags, cur: c})
+		}
+	}
+	if err := gc.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]*timeOfDayGroupCursor, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].timeOfDay < out[j].timeOfDay })
+	return out, nil
+}
+
+func (r *timeOfDayGroupResultSet) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.GroupResultSet.Err()
+}
+
+type timeOfDaySeries struct {
+	tags models.Tags
+	cur  cursors.Cursor
+}
+
+// timeOfDayGroupCursor produces the points of the series of a group within a
+// time-of-day bucket, which are held in memory.
+type timeOfDayGroupCursor struct {
+	timeOfDay time.Duration
+	keys      [][]byte
+	vals      [][]byte
+	agg       *datatypes.Aggregate
+	series    []timeOfDaySeries
+	i         int
+}
+
+func (c *timeOfDayGroupCursor) Next() bool {
+	if c.i < len(c.series) {
+		c.i++
+	}
+	return c.i < len(c.series)
+}
+
+func (c *timeOfDayGroupCursor) Cursor() cursors.Cursor { return c.series[c.i].cur }
+
+func (c *timeOfDayGroupCursor) Tags() models.Tags { return c.series[c.i].tags }
+
+func (c *timeOfDayGroupCursor) Keys() [][]byte { return c.keys }
+
+func (c *timeOfDayGroupCursor) PartitionKeyVals() [][]byte { return c.vals }
+
+func (c *timeOfDayGroupCursor) Close() { c.series = nil }
+
+func (c *timeOfDayGroupCursor) Err() error { return nil }
+
+func (c *timeOfDayGroupCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func (c *timeOfDayGroupCursor) Aggregate() *datatypes.Aggregate { return c.agg }
+
+func (c *timeOfDayGroupCursor) TimeOfDay() time.Duration { return c.timeOfDay }
+
+// emptyGroupResultSet is the result set of a ReadGroup selecting no series.
+type emptyGroupResultSet struct{}
+
+func (emptyGroupResultSet) Next() reads.GroupCursor { return nil }
+func (emptyGroupResultSet) Close()                  {}
+func (emptyGroupResultSet) Err() error              { return nil }
+
+// releaseGroupResultSet calls release when the result set is closed, ending
+// a read reserved by acquireOrgRead.
+type releaseGroupResultSet struct {
+	reads.GroupResultSet
+	release func()
+}
+
+func (r *releaseGroupResultSet) Close() {
+	r.GroupResultSet.Close()
+	r.release()
+}
+
+// contextGroupResultSet is the contextResultSet of ReadGroup. It stops once
+// its context is done, before reading the next group or the next series of a
+// group, and reports a ContextError from the Err of both the result set and
+// the group cursor.
+type contextGroupResultSet struct {
+	reads.GroupResultSet
+	ctx context.Context
+	err error
+}
+
+func (r *contextGroupResultSet) check() bool {
+	if r.err == nil {
+		r.err = checkContext(r.ctx)
+	}
+	return r.err == nil
+}
+
+func (r *contextGroupResultSet) Next() reads.GroupCursor {
+	if !r.check() {
+		return nil
+	}
+	gc := r.GroupResultSet.Next()
+	if gc == nil {
+		return nil
+	}
+	return &contextGroupCursor{GroupCursor: gc, rs: r}
+}
+
+func (r *contextGroupResultSet) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.GroupResultSet.Err()
+}
+
+type contextGroupCursor struct {
+	reads.GroupCursor
+	rs *contextGroupResultSet
+}
+
+func (c *contextGroupCursor) Next() bool {
+	if !c.rs.check() {
+		return false
+	}
+	return c.GroupCursor.Next()
+}
+
+func (c *contextGroupCursor) Err() error {
+	if c.rs.err != nil {
+		return c.rs.err
+	}
+	return c.GroupCursor.Err()
+}
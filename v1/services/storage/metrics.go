@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"github.com/influxdata/influxdb/v2/kit/metric"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	tagValuesPathIndex = "index"
+	tagValuesPathScan  = "scan"
+)
+
+// storeMetrics holds the metrics of the reads served by a Store.
+type storeMetrics struct {
+	// RED metrics
+	rec *metric.REDClient
+
+	// tagValuesPaths counts the TagValues requests served by the index and
+	// by the block scan of tagValuesSlow.
+	tagValuesPaths *prometheus.CounterVec
+}
+
+func newStoreMetrics(reg prometheus.Registerer) *storeMetrics {
+	m := &storeMetrics{
+		rec: metric.New(reg, "storage_reads"),
+		tagValuesPaths: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "service",
+			Subsystem: "storage_reads",
+			Name:      "tag_values_path_total",
+			Help:      "Number of tag values requests served by the index or by a block scan",
+		}, []string{"path"}),
+	}
+	reg.MustRegister(m.tagValuesPaths)
+	return m
+}
+
+// record returns a function recording a call of method, which failed if the
+// error it is passed is not nil. If m is nil, nothing is recorded.
+func (m *storeMetrics) record(method string) func(err *error) {
+	if m == nil {
+		return func(*error) {}
+	}
+	rec := m.rec.Record(method)
+	return func(err *error) { rec(*err) }
+}
+
+// tagValuesPath counts a tag values request served by path.
+func (m *storeMetrics) tagValuesPath(path string) {
+	if m == nil {
+		return
+	}
+	m.tagValuesPaths.WithLabelValues(path).Inc()
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// parallelScanBatchSize is the number of rows a shard scan produces before
+// handing them to the merge.
+const parallelScanBatchSize = 256
+
+// newParallelSeriesCursor returns a cursor scanning the index of each of
+// shards concurrently, with at most parallelism scans running at once. The
+// rows are merged in the order produced by a single indexSeriesCursor over
+// all of shards. It returns nil if none of the shards have matching series.
+func newParallelSeriesCursor(ctx context.Context, predicate *datatypes.Predicate, shards []*tsdb.Shard, parallelism int, opts *ReadOptions) (*parallelSeriesCursor, error) {
+	c := &parallelSeriesCursor{
+		sem:  make(chan struct{}, parallelism),
+		done: make(chan struct{}),
+	}
+
+	for _, sh := range shards {
+		ic, err := newIndexSeriesCursor(ctx, predicate, []*tsdb.Shard{sh})
+		if err != nil {
+			c.Close()
+			return nil, err
+		} else if ic == nil {
+			continue
+		}
+		c.scans = append(c.scans, &shardSeriesScan{cur: ic, ch: make(chan []reads.SeriesRow, 1)})
+	}
+
+	if len(c.scans) == 0 {
+		return nil, nil
+	}
+
+	// A single cursor produces every field of a measurement known to any of
+	// the shards, so each shard cursor is given the union of the fields.
+	fields := make(measurementFields)
+	for _, s := range c.scans {
+		for name, fs := range s.cur.fields {
+			fields[name] = mergeFields(fields[name], fs)
+		}
+	}
+	for _, s := range c.scans {
+		s.cur.fields = fields
+		s.cur.applyReadOptions(opts)
+	}
+
+	c.wg.Add(len(c.scans))
+	for _, s := range c.scans {
+		go c.scan(s)
+	}
+	return c, nil
+}
+
+// mergeFields returns the sorted union of the sorted fields a and b.
+func mergeFields(a, b []field) []field {
+	out := make([]field, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].n < b[j].n:
+			out = append(out, a[i])
+			i++
+		case a[i].n > b[j].n:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// shardSeriesScan holds the state of the index scan of a single shard.
+type shardSeriesScan struct {
+	cur   *indexSeriesCursor
+	ch    chan []reads.SeriesRow
+	batch []reads.SeriesRow
+	row   *reads.SeriesRow // current row, nil when exhausted
+	err   error            // set before ch is closed
+}
+
+// parallelSeriesCursor merges the rows of concurrently scanned shards. Rows
+// of the same series and field from several shards are combined into a
+// single row, whose cursor iterators are ordered as the shards were, so that
+// the points of the series are produced in time order.
+type parallelSeriesCursor struct {
+	scans []*shardSeriesScan // ordered as the shards
+	sem   chan struct{}
+	done  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+	match []int
+	row   reads.SeriesRow
+	init  bool
+}
+
+func (c *parallelSeriesCursor) scan(s *shardSeriesScan) {
+	defer c.wg.Done()
+	defer close(s.ch)
+
+	for {
+		select {
+		case c.sem <- struct{}{}:
+		case <-c.done:
+			return
+		}
+
+		batch := make([]reads.SeriesRow, 0, parallelScanBatchSize)
+		for len(batch) < cap(batch) {
+			row := s.cur.Next()
+			if row == nil {
+				break
+			}
+			batch = append(batch, copySeriesRow(row))
+		}
+		<-c.sem
+
+		if len(batch) > 0 {
+			select {
+			case s.ch <- batch:
+			case <-c.done:
+				return
+			}
+		}
+		if len(batch) < cap(batch) {
+			s.err = s.cur.Err()
+			return
+		}
+	}
+}
+
+// copySeriesRow returns a copy of row that remains valid once the cursor
+// producing it is advanced.
+func copySeriesRow(row *reads.SeriesRow) reads.SeriesRow {
+	r := *row
+	r.SeriesTags = copyTags(nil, row.SeriesTags)
+	r.Tags = copyTags(nil, row.Tags)
+	return r
+}
+
+func (c *parallelSeriesCursor) Close() {
+	c.once.Do(func() { close(c.done) })
+	c.wg.Wait()
+	for _, s := range c.scans {
+		s.cur.Close()
+	}
+}
+
+func (c *parallelSeriesCursor) Err() error {
+	for _, s := range c.scans {
+		if s.row == nil && s.err != nil {
+			return s.err
+		}
+	}
+	return nil
+}
+
+func (s *shardSeriesScan) next() {
+	if len(s.batch) == 0 {
+		batch, ok := <-s.ch
+		if !ok {
+			s.row = nil
+			return
+		}
+		s.batch = batch
+	}
+	s.row, s.batch = &s.batch[0], s.batch[1:]
+}
+
+func (c *parallelSeriesCursor) Next() *reads.SeriesRow {
+	if !c.init {
+		for _, s := range c.scans {
+			s.next()
+		}
+		c.init = true
+	}
+
+	// The merge stops at the first failed scan, as the rows that would
+	// follow are incomplete.
+	if c.Err() != nil {
+		return nil
+	}
+
+	// Find the scans positioned on the lowest series and field.
+	c.match = c.match[:0]
+	for i, s := range c.scans {
+		if s.row == nil {
+			continue
+		}
+		if len(c.match) == 0 {
+			c.match = append(c.match, i)
+			continue
+		}
+		switch cmp := compareSeriesRows(s.row, c.scans[c.match[0]].row); {
+		case cmp < 0:
+			c.match = append(c.match[:0], i)
+		case cmp == 0:
+			c.match = append(c.match, i)
+		}
+	}
+
+	if len(c.match) == 0 {
+		return nil
+	}
+
+	c.row = *c.scans[c.match[0]].row
+	if len(c.match) > 1 {
+		// The iterators are copied to a new slice, as the previous row may
+		// still be read.
+		query := make(cursors.CursorIterators, 0, len(c.match))
+		for _, i := range c.match {
+			query = append(query, c.scans[i].row.Query...)
+		}
+		c.row.Query = query
+	}
+
+	for _, i := range c.match {
+		c.scans[i].next()
+	}
+	return &c.row
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// newTestParallelSeriesCursor returns a cursor merging the rows of each of
+// shards, as if the scan of shard i had produced shards[i] in batches of a
+// single row and then failed with errs[i].
+func newTestParallelSeriesCursor(shards [][]reads.SeriesRow, errs []error) *parallelSeriesCursor {
+	c := &parallelSeriesCursor{done: make(chan struct{})}
+	for i, rows := range shards {
+		s := &shardSeriesScan{cur: &indexSeriesCursor{}, ch: make(chan []reads.SeriesRow, len(rows))}
+		for _, row := range rows {
+			s.ch <- []reads.SeriesRow{row}
+		}
+		if errs != nil {
+			s.err = errs[i]
+		}
+		close(s.ch)
+		c.scans = append(c.scans, s)
+	}
+	return c
+}
+
+// testSeriesRow returns a row of the series key and field, whose cursor
+// iterators are query.
+func testSeriesRow(key, field string, query ...cursors.CursorIterator) reads.SeriesRow {
+	name, tags := models.ParseKeyBytes([]byte(key))
+	return reads.SeriesRow{Name: name, SeriesTags: tags, Tags: tags, Field: field, Query: query}
+}
+
+// parallelRow is a row produced by a parallelSeriesCursor, with the index
+// in itrs of each of its cursor iterators.
+type parallelRow struct {
+	Key  string
+	Itrs []int
+}
+
+func readParallelRows(c *parallelSeriesCursor, itrs []cursors.CursorIterator) []parallelRow {
+	var rows []parallelRow
+	for row := c.Next(); row != nil; row = c.Next() {
+		r := parallelRow{Key: string(models.MakeKey(row.Name, row.SeriesTags)) + " " + row.Field}
+		for _, itr := range row.Query {
+			i := len(itrs) - 1
+			for i >= 0 && itrs[i] != itr {
+				i--
+			}
+			r.Itrs = append(r.Itrs, i)
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func TestMergeFields(t *testing.T) {
+	a := []field{{n: "a", nb: []byte("a")}, {n: "c", nb: []byte("a")}, {n: "d", nb: []byte("a")}}
+	b := []field{{n: "b", nb: []byte("b")}, {n: "c", nb: []byte("b")}, {n: "e", nb: []byte("b")}}
+	got := mergeFields(a, b)
+	exp := []field{
+		{n: "a", nb: []byte("a")},
+		{n: "b", nb: []byte("b")},
+		{n: "c", nb: []byte("a")},
+		{n: "d", nb: []byte("a")},
+		{n: "e", nb: []byte("b")},
+	}
+	if !cmp.Equal(got, exp, cmp.AllowUnexported(field{})) {
+		t.Errorf("unexpected fields -got/+exp\n%s", cmp.Diff(got, exp, cmp.AllowUnexported(field{})))
+	}
+	if got := mergeFields(nil, b); !cmp.Equal(got, b, cmp.AllowUnexported(field{})) {
+		t.Errorf("unexpected fields -got/+exp\n%s", cmp.Diff(got, b, cmp.AllowUnexported(field{})))
+	}
+}
+
+func TestParallelSeriesCursor_PartialSeries(t *testing.T) {
+	itrs := make([]cursors.CursorIterator, 6)
+	for i := range itrs {
+		itrs[i] = &testCursorIterator{}
+	}
+
+	// Each series is present in some of the shards only.
+	c := newTestParallelSeriesCursor([][]reads.SeriesRow{
+		{
+			testSeriesRow("cpu,host=a", "v", itrs[0]),
+			testSeriesRow("cpu,host=b", "u", itrs[1]),
+		},
+		{
+			testSeriesRow("cpu,host=b", "u", itrs[2]),
+			testSeriesRow("cpu,host=b", "v", itrs[3]),
+			testSeriesRow("mem,host=a", "v", itrs[4]),
+		},
+		{
+			testSeriesRow("cpu,host=a", "v", itrs[5]),
+		},
+	}, nil)
+	defer c.Close()
+
+	// The iterators of a series are ordered as the shards.
+	exp := []parallelRow{
+		{Key: "cpu,host=a v", Itrs: []int{0, 5}},
+		{Key: "cpu,host=b u", Itrs: []int{1, 2}},
+		{Key: "cpu,host=b v", Itrs: []int{3}},
+		{Key: "mem,host=a v", Itrs: []int{4}},
+	}
+	got := readParallelRows(c, itrs)
+	if !cmp.Equal(got, exp) {
+		t.Errorf("unexpected rows -got/+exp\n%s", cmp.Diff(got, exp))
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParallelSeriesCursor_ScanError(t *testing.T) {
+	errScan := errors.New("scan failed")
+
+	t.Run("mid-stream", func(t *testing.T) {
+		c := newTestParallelSeriesCursor([][]reads.SeriesRow{
+			{testSeriesRow("cpu,host=a", "v"), testSeriesRow("cpu,host=c", "v")},
+			{testSeriesRow("cpu,host=b", "v"), testSeriesRow("cpu,host=d", "v")},
+		}, []error{errScan, nil})
+		defer c.Close()
+
+		// The rows of the other shards following the failed scan are not
+		// produced.
+		var keys []string
+		for _, row := range readParallelRows(c, nil) {
+			keys = append(keys, row.Key)
+		}
+		exp := []string{"cpu,host=a v", "cpu,host=b v", "cpu,host=c v"}
+		if !cmp.Equal(keys, exp) {
+			t.Errorf("unexpected rows -got/+exp\n%s", cmp.Diff(keys, exp))
+		}
+		if err := c.Err(); err != errScan {
+			t.Fatalf("got error %v, exp %v", err, errScan)
+		}
+	})
+
+	t.Run("no rows", func(t *testing.T) {
+		c := newTestParallelSeriesCursor([][]reads.SeriesRow{
+			{testSeriesRow("cpu,host=a", "v")},
+			nil,
+		}, []error{nil, errScan})
+		defer c.Close()
+
+		if row := c.Next(); row != nil {
+			t.Fatalf("unexpected row %+v", row)
+		}
+		if err := c.Err(); err != errScan {
+			t.Fatalf("got error %v, exp %v", err, errScan)
+		}
+	})
+}
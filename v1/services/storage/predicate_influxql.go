@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"regexp"
+
 	"github.com/influxdata/influxdb/v2/models"
 	"github.com/influxdata/influxql"
 )
@@ -25,6 +27,54 @@ func RewriteExprRemoveFieldKeyAndValue(expr influxql.Expr) influxql.Expr {
 	})
 }
 
+// rewriteExprCaseInsensitive rewrites comparisons of the tag keys in keys
+// against string literals or regular expressions so that they ignore case.
+// Equality comparisons become anchored, case-insensitive regular expressions.
+func rewriteExprCaseInsensitive(expr influxql.Expr, keys []string) influxql.Expr {
+	return influxql.RewriteExpr(expr, func(expr influxql.Expr) influxql.Expr {
+		be, ok := expr.(*influxql.BinaryExpr)
+		if !ok {
+			return expr
+		}
+		ref, ok := be.LHS.(*influxql.VarRef)
+		if !ok || !containsString(keys, ref.Val) {
+			return expr
+		}
+
+		switch rhs := be.RHS.(type) {
+		case *influxql.StringLiteral:
+			var op influxql.Token
+			switch be.Op {
+			case influxql.EQ:
+				op = influxql.EQREGEX
+			case influxql.NEQ:
+				op = influxql.NEQREGEX
+			default:
+				return expr
+			}
+			re := regexp.MustCompile("(?i)^" + regexp.QuoteMeta(rhs.Val) + "$")
+			return &influxql.BinaryExpr{Op: op, LHS: ref, RHS: &influxql.RegexLiteral{Val: re}}
+
+		case *influxql.RegexLiteral:
+			if be.Op != influxql.EQREGEX && be.Op != influxql.NEQREGEX {
+				return expr
+			}
+			re := regexp.MustCompile("(?i)" + rhs.Val.String())
+			return &influxql.BinaryExpr{Op: be.Op, LHS: ref, RHS: &influxql.RegexLiteral{Val: re}}
+		}
+		return expr
+	})
+}
+
+func containsString(a []string, v string) bool {
+	for _, s := range a {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
 // HasSingleMeasurementNoOR determines if an index optimisation is available.
 //
 // Typically the read service will use the query engine to retrieve all field
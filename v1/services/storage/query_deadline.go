@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/storage/reads"
+)
+
+// WithMaxQueryDuration bounds the duration of each call of the store
+// resolving or reading shards, such as ReadFilter, TagValues,
+// MeasurementNames, ActiveMeasurements, Warm or ExplainRead, to d. The bound
+// starts when the call is made, before the shards of the read are resolved,
+// and a read exceeding it fails with ErrQueryTimeout, unless the context of
+// the read was done first. The bound of ReadFilter, ReadGroup and
+// WindowAggregate extends to reading the returned result set, until it is
+// closed, which also bounds ReadPointCounts and ExportCSV. A duration of 0
+// or less leaves reads unbounded.
+func (s *Store) WithMaxQueryDuration(d time.Duration) {
+	s.maxQueryDuration = d
+}
+
+// queryDeadline bounds the context of a read by the MaxQueryDuration of the
+// store. A nil *queryDeadline is unbounded.
+type queryDeadline struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// withQueryDeadline returns ctx bounded by the MaxQueryDuration of the store
+// and the bound, which must be released once the read is served.
+func (s *Store) withQueryDeadline(ctx context.Context) (context.Context, *queryDeadline) {
+	if s.maxQueryDuration <= 0 {
+		return ctx, nil
+	}
+	dctx, cancel := context.WithTimeout(ctx, s.maxQueryDuration)
+	return dctx, &queryDeadline{parent: ctx, ctx: dctx, cancel: cancel}
+}
+
+// err returns ErrQueryTimeout if err is not nil and the read was aborted by
+// the bound rather than by its own context, and err otherwise.
+func (d *queryDeadline) err(err error) error {
+	if d == nil || err == nil {
+		return err
+	}
+	if d.ctx.Err() == context.DeadlineExceeded && d.parent.Err() == nil {
+		return ErrQueryTimeout
+	}
+	return err
+}
+
+// release releases the resources of the bound.
+func (d *queryDeadline) release() {
+	if d != nil {
+		d.cancel()
+	}
+}
+
+// done replaces *err as err does and releases the bound. It is deferred by
+// the methods returning once the read is served.
+func (d *queryDeadline) done(err *error) {
+	*err = d.err(*err)
+	d.release()
+}
+
+// deadlineResultSet releases the bound of a read when the result set is
+// closed, and reports ErrQueryTimeout from Err if the bound aborted it.
+type deadlineResultSet struct {
+	reads.ResultSet
+	deadline *queryDeadline
+}
+
+func (r *deadlineResultSet) Err() error { return r.deadline.err(r.ResultSet.Err()) }
+
+func (r *deadlineResultSet) Close() {
+	r.ResultSet.Close()
+	r.deadline.release()
+}
+
+// deadlineGroupResultSet is the deadlineResultSet of ReadGroup.
+type deadlineGroupResultSet struct {
+	reads.GroupResultSet
+	deadline *queryDeadline
+}
+
+func (r *deadlineGroupResultSet) Err() error { return r.deadline.err(r.GroupResultSet.Err()) }
+
+func (r *deadlineGroupResultSet) Close() {
+	r.GroupResultSet.Close()
+	r.deadline.release()
+}
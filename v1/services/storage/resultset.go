@@ -0,0 +1,644 @@
+package storage
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+	"github.com/influxdata/influxql"
+)
+
+// TruncatedResultSet is implemented by result sets that may stop before all
+// matching data has been produced because a configured limit was reached.
+type TruncatedResultSet interface {
+	reads.ResultSet
+
+	// Truncated reports whether the result set stopped early. It is only
+	// accurate after the result set has been fully consumed.
+	Truncated() bool
+}
+
+// FieldTypeResultSet is implemented by the result sets returned by
+// ReadFilter, reporting the type of the field of each series.
+type FieldTypeResultSet interface {
+	reads.ResultSet
+
+	// FieldType returns the type of the field of the current series, as
+	// recorded by the shards. If the type differs between shards, the type
+	// with the highest precedence is returned. If the field is coerced by
+	// the CoerceFields read option, the target type is returned.
+	FieldType() cursors.FieldType
+}
+
+// fieldTypeResultSet resolves the field type of each series from the shards
+// of the request.
+type fieldTypeResultSet struct {
+	reads.ResultSet
+	shards   tsdb.Shards
+	coerce   *coercion
+	gaps     *gapRecorder
+	gapsOnly bool
+}
+
+func (r *fieldTypeResultSet) FieldType() cursors.FieldType {
+	if r.gapsOnly {
+		return cursors.Integer
+	}
+	tags := r.ResultSet.Tags()
+	if r.coerce != nil {
+		if typ, ok := r.coerce.types[string(tags.Get(fieldKeyBytes))]; ok {
+			return typ
+		}
+	}
+	typ := r.shards.MapType(string(tags.Get(measurementKeyBytes)), string(tags.Get(fieldKeyBytes)))
+	return dataTypeToFieldType(typ)
+}
+
+// Truncated forwards to the wrapped result set, so that a limit applied by
+// MaxResponseBytes or PointLimit remains visible.
+func (r *fieldTypeResultSet) Truncated() bool {
+	t, ok := r.ResultSet.(TruncatedResultSet)
+	return ok && t.Truncated()
+}
+
+func (r *fieldTypeResultSet) CoercionStats() CoercionStats {
+	if r.coerce == nil {
+		return CoercionStats{}
+	}
+	return r.coerce.stats
+}
+
+func (r *fieldTypeResultSet) Gaps() []Gap {
+	if r.gaps == nil {
+		return nil
+	}
+	return r.gaps.gaps
+}
+
+// FieldPointCounts forwards to the wrapped result set, returning nil unless
+// the CountFieldPoints read option is set.
+func (r *fieldTypeResultSet) FieldPointCounts() map[string]int64 {
+	if c, ok := r.ResultSet.(FieldPointCountResultSet); ok {
+		return c.FieldPointCounts()
+	}
+	return nil
+}
+
+func dataTypeToFieldType(typ influxql.DataType) cursors.FieldType {
+	switch typ {
+	case influxql.Float:
+		return cursors.Float
+	case influxql.Integer:
+		return cursors.Integer
+	case influxql.Unsigned:
+		return cursors.Unsigned
+	case influxql.String:
+		return cursors.String
+	case influxql.Boolean:
+		return cursors.Boolean
+	default:
+		return cursors.Undefined
+	}
+}
+
+// FieldPointCountResultSet is implemented by the result sets returned by
+// ReadFilter, reporting the number of points read for each field.
+type FieldPointCountResultSet interface {
+	reads.ResultSet
+
+	// FieldPointCounts returns the number of points read from the cursors
+	// of the result set for each field key, after all filtering. Fields of
+	// the same key in different measurements are counted together. It
+	// returns nil unless the CountFieldPoints read option is set, and is
+	// only complete after the result set has been fully consumed.
+	FieldPointCounts() map[string]int64
+}
+
+// fieldCountResultSet counts the points read from the cursors of each field.
+type fieldCountResultSet struct {
+	reads.ResultSet
+	counts map[string]*int64
+}
+
+func (r *fieldCountResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	field := string(r.ResultSet.Tags().Get(fieldKeyBytes))
+	n := r.counts[field]
+	if n == nil {
+		n = new(int64)
+		r.counts[field] = n
+	}
+	return newCountArrayCursor(cur, n)
+}
+
+func (r *fieldCountResultSet) FieldPointCounts() map[string]int64 {
+	counts := make(map[string]int64, len(r.counts))
+	for field, n := range r.counts {
+		counts[field] = *n
+	}
+	return counts
+}
+
+// Truncated forwards to the wrapped result set, so that a limit applied by
+// MaxResponseBytes or PointLimit remains visible.
+func (r *fieldCountResultSet) Truncated() bool {
+	t, ok := r.ResultSet.(TruncatedResultSet)
+	return ok && t.Truncated()
+}
+
+// timestampSize is the number of bytes accounted for each point's timestamp.
+const timestampSize = 8
+
+// sizeLimitResultSet stops producing series and points once the estimated
+// serialized size of the response reaches limit. The size of a series is the
+// size of its tags, and the size of each point is its timestamp plus value.
+type sizeLimitResultSet struct {
+	reads.ResultSet
+	limit     int64
+	size      int64
+	fail      bool
+	truncated bool
+}
+
+func newSizeLimitResultSet(rs reads.ResultSet, limit int64, fail bool) *sizeLimitResultSet {
+	return &sizeLimitResultSet{ResultSet: rs, limit: limit, fail: fail}
+}
+
+func (r *sizeLimitResultSet) Next() bool {
+	if r.truncated || !r.ResultSet.Next() {
+		return false
+	}
+	return r.take(int64(r.ResultSet.Tags().Size()))
+}
+
+func (r *sizeLimitResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	return newSizeLimitArrayCursor(cur, r)
+}
+
+// take accounts n bytes against the limit, returning false and marking the
+// result set as truncated if the limit would be exceeded.
+func (r *sizeLimitResultSet) take(n int64) bool {
+	if r.size+n > r.limit {
+		r.truncated = true
+		return false
+	}
+	r.size += n
+	return true
+}
+
+func (r *sizeLimitResultSet) Err() error {
+	if err := r.ResultSet.Err(); err != nil {
+		return err
+	}
+	if r.truncated && r.fail {
+		return ErrResponseTooLarge
+	}
+	return nil
+}
+
+// Truncated also reports whether the wrapped result set was truncated by
+// PointLimit, which is applied first.
+func (r *sizeLimitResultSet) Truncated() bool {
+	if r.truncated {
+		return true
+	}
+	t, ok := r.ResultSet.(TruncatedResultSet)
+	return ok && t.Truncated()
+}
+
+// pointLimitResultSet limits the points of each series to perSeries, and the
+// points of all series to total, stopping once the total is reached. A limit
+// of 0 is unlimited. The points are counted in the order they are produced,
+// so that a descending read keeps the most recent points.
+type pointLimitResultSet struct {
+	reads.ResultSet
+	perSeries int64
+	total     int64
+	n         int64 // n is the number of points produced by all series.
+	truncated bool
+}
+
+func (r *pointLimitResultSet) Next() bool {
+	if r.truncated || !r.ResultSet.Next() {
+		return false
+	}
+	if r.total > 0 && r.n >= r.total {
+		r.truncated = true
+		return false
+	}
+	return true
+}
+
+func (r *pointLimitResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	return newPointLimitArrayCursor(cur, r)
+}
+
+// take returns how many of the next n points of a series, of which seriesN
+// points were already produced, may be produced, and accounts for them. The
+// result set is truncated if points are dropped because of the total limit.
+func (r *pointLimitResultSet) take(seriesN int64, n int) int {
+	k := int64(n)
+	if r.perSeries > 0 && r.perSeries-seriesN < k {
+		k = r.perSeries - seriesN
+	}
+	if r.total > 0 && r.total-r.n < k {
+		k = r.total - r.n
+		r.truncated = true
+	}
+	r.n += k
+	return int(k)
+}
+
+// done reports whether a series of which seriesN points were produced may
+// not produce any more, so that its cursor is not read further.
+func (r *pointLimitResultSet) done(seriesN int64) bool {
+	return r.truncated || (r.perSeries > 0 && seriesN >= r.perSeries)
+}
+
+// Truncated reports whether points were dropped because of the total limit.
+// Points dropped because of the limit of each series are not reported.
+func (r *pointLimitResultSet) Truncated() bool { return r.truncated }
+
+// emptyResultSet is the result set of a read selecting no series.
+type emptyResultSet struct{}
+
+func (emptyResultSet) Next() bool                 { return false }
+func (emptyResultSet) Cursor() cursors.Cursor     { return nil }
+func (emptyResultSet) Tags() models.Tags          { return nil }
+func (emptyResultSet) Close()                     {}
+func (emptyResultSet) Err() error                 { return nil }
+func (emptyResultSet) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+// newEmptyFilterResultSet returns the result set of a ReadFilter selecting no
+// series, which implements the interfaces of any other.
+func newEmptyFilterResultSet() reads.ResultSet {
+	return &fieldTypeResultSet{ResultSet: emptyResultSet{}}
+}
+
+// releaseResultSet calls release when the result set is closed, ending a
+// read reserved by acquireOrgRead.
+type releaseResultSet struct {
+	reads.ResultSet
+	release func()
+}
+
+func (r *releaseResultSet) Close() {
+	r.ResultSet.Close()
+	r.release()
+}
+
+// contextResultSet stops once its context is done, before reading the next
+// series, and reports a ContextError from Err, so that a read abandoned by
+// its client does not scan the remaining series.
+type contextResultSet struct {
+	reads.ResultSet
+	ctx context.Context
+	err error
+}
+
+func (r *contextResultSet) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.err = checkContext(r.ctx); r.err != nil {
+		return false
+	}
+	return r.ResultSet.Next()
+}
+
+func (r *contextResultSet) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.ResultSet.Err()
+}
+
+// Gap is a period without points of a series, between the points at Start
+// and End.
+type Gap struct {
+	Start, End int64
+}
+
+// GapResultSet is implemented by the result sets returned by ReadFilter,
+// reporting the gaps between the points of each series found with the
+// GapThreshold read option.
+type GapResultSet interface {
+	reads.ResultSet
+
+	// Gaps returns the gaps of the current series longer than the
+	// threshold, in time order. It is only complete after the cursor of the
+	// series has been fully consumed, and returns nil unless GapThreshold
+	// is set.
+	Gaps() []Gap
+}
+
+// gapRecorder collects the gaps longer than threshold between consecutive
+// timestamps of a series.
+type gapRecorder struct {
+	threshold int64
+	offset    int64 // added to the reported gaps, as by TimeShift
+	last      int64
+	seen      bool
+	gaps      []Gap
+}
+
+func (g *gapRecorder) reset() {
+	g.seen, g.gaps = false, nil
+}
+
+func (g *gapRecorder) add(ts int64) {
+	if g.seen && ts-g.last > g.threshold {
+		g.gaps = append(g.gaps, Gap{Start: g.last + g.offset, End: ts + g.offset})
+	}
+	g.last, g.seen = ts, true
+}
+
+// gapResultSet records the gaps of the cursor of each series. If only is
+// set, the cursor produces the gaps instead of the points, as an integer
+// cursor with a point at the start of each gap whose value is its duration.
+type gapResultSet struct {
+	reads.ResultSet
+	gaps *gapRecorder
+	only bool
+}
+
+func (r *gapResultSet) Cursor() cursors.Cursor {
+	r.gaps.reset()
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	cur = newGapArrayCursor(cur, r.gaps)
+	if !r.only {
+		return cur
+	}
+
+	_, err := cursorCount(cur)
+	if err == nil {
+		err = cur.Err()
+	}
+	cur.Close()
+	c := &gapsArrayCursor{err: err}
+	for _, g := range r.gaps.gaps {
+		// The gaps are reported in stored time, and shifted with the cursor.
+		c.a.Timestamps = append(c.a.Timestamps, g.Start-r.gaps.offset)
+		c.a.Values = append(c.a.Values, g.End-g.Start)
+	}
+	return c
+}
+
+// gapsArrayCursor produces the gaps of a series, reporting the error of the
+// cursor from which they were read.
+type gapsArrayCursor struct {
+	integerSliceArrayCursor
+	err error
+}
+
+func (c *gapsArrayCursor) Err() error { return c.err }
+
+// seriesCursorResultSet reports the error of the series cursor from which the
+// result set was created, which reads.NewFilteredResultSet does not.
+type seriesCursorResultSet struct {
+	reads.ResultSet
+	cur reads.SeriesCursor
+}
+
+func (r *seriesCursorResultSet) Err() error {
+	if err := r.ResultSet.Err(); err != nil {
+		return err
+	}
+	return r.cur.Err()
+}
+
+// timeShiftResultSet adds a constant offset to the timestamps of the points
+// of every cursor.
+type timeShiftResultSet struct {
+	reads.ResultSet
+	offset int64
+}
+
+func (r *timeShiftResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	return newTimeShiftArrayCursor(cur, r.offset)
+}
+
+// dedupResultSet removes the points of every cursor sharing a timestamp with
+// the previous point.
+type dedupResultSet struct {
+	reads.ResultSet
+	keepLast bool
+}
+
+func (r *dedupResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	return newDedupArrayCursor(cur, r.keepLast)
+}
+
+// decimateResultSet decimates the points of every cursor to at most max
+// points, using an even stride.
+type decimateResultSet struct {
+	reads.ResultSet
+	max int64
+}
+
+func (r *decimateResultSet) Cursor() cursors.Cursor {
+	// The series is read once to count its points, which determines the
+	// stride of the second read.
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	n, err := cursorCount(cur)
+	cur.Close()
+
+	// A series that could not be counted is produced without decimation by a
+	// new cursor, as the first may be partially read. The new cursor reports
+	// the error if it persists.
+	cur = r.ResultSet.Cursor()
+	if cur == nil || err != nil || n <= r.max {
+		return cur
+	}
+	return newDecimateArrayCursor(cur, (n+r.max-1)/r.max)
+}
+
+// StringTruncationMarker is appended to string values truncated by the
+// MaxStringLength read option.
+const StringTruncationMarker = "..."
+
+// stringTruncateResultSet truncates the values of string cursors to at most
+// max bytes.
+type stringTruncateResultSet struct {
+	reads.ResultSet
+	max int
+}
+
+func (r *stringTruncateResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if sc, ok := cur.(cursors.StringArrayCursor); ok {
+		return &stringTruncateArrayCursor{StringArrayCursor: sc, max: r.max}
+	}
+	return cur
+}
+
+type stringTruncateArrayCursor struct {
+	cursors.StringArrayCursor
+	max int
+}
+
+func (c *stringTruncateArrayCursor) Next() *cursors.StringArray {
+	a := c.StringArrayCursor.Next()
+	for i, v := range a.Values {
+		if len(v) > c.max {
+			a.Values[i] = truncateString(v, c.max)
+		}
+	}
+	return a
+}
+
+// truncateString returns the longest prefix of v of at most n bytes that does
+// not split a UTF-8 character, followed by StringTruncationMarker.
+func truncateString(v string, n int) string {
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return v[:n] + StringTruncationMarker
+}
+
+// MultiAggregateResultSet is implemented by the result sets returned by
+// WindowAggregate for a request with more than one aggregate.
+type MultiAggregateResultSet interface {
+	reads.ResultSet
+
+	// Cursors returns a cursor for each aggregate of the request, in the
+	// order of the request, over the windows of the current series. The
+	// cursors produce a point for the same windows, at their stop time.
+	// Cursor returns the first of them.
+	Cursors() []cursors.Cursor
+}
+
+// multiAggregateResultSet computes the aggregates of a WindowAggregate
+// request with a single read of the points of each series.
+type multiAggregateResultSet struct {
+	reads.ResultSet
+	aggs       []datatypes.Aggregate_AggregateType
+	windowStop func(ts int64) int64
+	curs       []cursors.Cursor
+	read       bool
+	err        error
+}
+
+func (r *multiAggregateResultSet) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	r.curs, r.read = nil, false
+	return r.ResultSet.Next()
+}
+
+func (r *multiAggregateResultSet) Cursors() []cursors.Cursor {
+	if r.read {
+		return r.curs
+	}
+	r.read = true
+
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	r.curs, r.err = multiAggregateArrayCursor(cur, r.aggs, r.windowStop)
+	cur.Close()
+	return r.curs
+}
+
+func (r *multiAggregateResultSet) Cursor() cursors.Cursor {
+	if curs := r.Cursors(); len(curs) > 0 {
+		return curs[0]
+	}
+	return nil
+}
+
+func (r *multiAggregateResultSet) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.ResultSet.Err()
+}
+
+// NullArrayCursor is implemented by the cursors of a WindowAggregate request
+// using WindowFillNull.
+type NullArrayCursor interface {
+	cursors.Cursor
+
+	// Nulls reports, for each point of the array last returned by Next,
+	// whether it is a null reported for a window without points.
+	Nulls() []bool
+}
+
+// windowFill describes the windows of a WindowAggregate request and how those
+// without points are reported.
+type windowFill struct {
+	mode          WindowFill
+	every, offset int64
+	first, last   int64 // stop times of the first and last windows
+	selector      bool  // points are reported at their own timestamp
+}
+
+// windowStop returns the stop time of the window holding ts.
+func (f *windowFill) windowStop(ts int64) int64 {
+	return windowStop(ts, f.every, f.offset)
+}
+
+// windowStop returns the stop time of the window holding ts, of windows of
+// the given duration starting at offset.
+func windowStop(ts, every, offset int64) int64 {
+	m := (ts - offset) % every
+	if m < 0 {
+		m += every
+	}
+	return ts - m + every
+}
+
+// pointStop returns the stop time of the window of a point reported at ts.
+// Aggregates are reported at the stop time of their window, and selectors at
+// the timestamp of the point they select.
+func (f *windowFill) pointStop(ts int64) int64 {
+	if f.selector {
+		return f.windowStop(ts)
+	}
+	return ts
+}
+
+// windowFillResultSet reports the windows without points of every cursor.
+type windowFillResultSet struct {
+	reads.ResultSet
+	fill *windowFill
+}
+
+func (r *windowFillResultSet) Cursor() cursors.Cursor {
+	cur := r.ResultSet.Cursor()
+	if cur == nil {
+		return nil
+	}
+	return newWindowFillArrayCursor(cur, r.fill)
+}
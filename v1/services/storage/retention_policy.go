@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+// newRetentionPolicySeriesCursor returns a cursor over the series of the
+// retention policies named by opts, or nil if none of them have shards in the
+// requested range.
+func (s *Store) newRetentionPolicySeriesCursor(ctx context.Context, predicate *datatypes.Predicate, database string, start, end int64, opts *ReadOptions) (*retentionPolicySeriesCursor, error) {
+	di := s.MetaClient.Database(database)
+	if di == nil {
+		return nil, ErrDatabaseNotFound
+	}
+
+	c := &retentionPolicySeriesCursor{
+		ctx:      ctx,
+		req:      cursors.CursorRequest{Ascending: true, StartTime: start, EndTime: end},
+		conflict: opts.RetentionPolicyConflict,
+	}
+	for _, rp := range opts.RetentionPolicies {
+		if di.RetentionPolicy(rp) == nil {
+			c.Close()
+			return nil, fmt.Errorf("%w: %q", ErrRetentionPolicyNotFound, rp)
+		}
+
+		shardIDs, err := s.findRetentionPolicyShardIDs(ctx, database, rp, false, start, end)
+		if err != nil {
+			c.Close()
+			return nil, err
+		} else if len(shardIDs) == 0 {
+			continue
+		}
+
+		shards, err := s.shards(ctx, shardIDs)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		ic, err := newIndexSeriesCursor(ctx, predicate, shards)
+		if err != nil {
+			c.Close()
+			return nil, err
+		} else if ic == nil {
+			continue
+		}
+		ic.applyReadOptions(opts)
+		c.curs = append(c.curs, ic)
+		c.shards = append(c.shards, shards...)
+	}
+
+	if len(c.curs) == 0 {
+		return nil, nil
+	}
+	c.rows = make([]*reads.SeriesRow, len(c.curs))
+	return c, nil
+}
+
+// retentionPolicySeriesCursor merges the series of several retention
+// policies, each read by an indexSeriesCursor. The cursors produce rows
+// ordered by measurement, series tags and field, which permits a series
+// produced by more than one retention policy to be detected as the rows are
+// merged. As the index may be shared by the retention policies of a
+// database, such a series is only in conflict if it has points in the range
+// in more than one of them.
+type retentionPolicySeriesCursor struct {
+	ctx      context.Context
+	req      cursors.CursorRequest
+	curs     []*indexSeriesCursor // ordered by precedence
+	shards   []*tsdb.Shard        // shards of all cursors
+	rows     []*reads.SeriesRow   // current row of each cursor, nil when exhausted
+	conflict RetentionPolicyConflict
+	match    []int // cursors positioned on the current series
+	use      []int // cursors of match whose series is read
+	row      reads.SeriesRow
+	init     bool
+	err      error
+}
+
+func (c *retentionPolicySeriesCursor) Close() {
+	for _, cur := range c.curs {
+		cur.Close()
+	}
+}
+
+func (c *retentionPolicySeriesCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	for _, cur := range c.curs {
+		if err := cur.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *retentionPolicySeriesCursor) Next() *reads.SeriesRow {
+	if c.err != nil {
+		return nil
+	}
+
+	if !c.init {
+		for i, cur := range c.curs {
+			c.rows[i] = cur.Next()
+		}
+		c.init = true
+	}
+
+	// Find the cursors positioned on the lowest series and field.
+	c.match = c.match[:0]
+	for i, row := range c.rows {
+		if row == nil {
+			continue
+		}
+		if len(c.match) == 0 {
+			c.match = append(c.match, i)
+			continue
+		}
+		switch cmp := compareSeriesRows(row, c.rows[c.match[0]]); {
+		case cmp < 0:
+			c.match = append(c.match[:0], i)
+		case cmp == 0:
+			c.match = append(c.match, i)
+		}
+	}
+
+	if len(c.match) == 0 {
+		return nil
+	}
+
+	// Of the retention policies producing the series, only those with points
+	// in the range are in conflict. If none of them have points, the row of
+	// the highest precedence is produced.
+	c.use = append(c.use[:0], c.match...)
+	if len(c.match) > 1 {
+		c.use = c.use[:0]
+		for _, i := range c.match {
+			ok, err := c.hasData(c.rows[i])
+			if err != nil {
+				c.err = err
+				return nil
+			}
+			if ok {
+				c.use = append(c.use, i)
+			}
+		}
+		if len(c.use) == 0 {
+			c.use = append(c.use, c.match[0])
+		}
+	}
+
+	if len(c.use) > 1 && c.conflict == RetentionPolicyConflictError {
+		c.err = ErrRetentionPolicyConflict
+		return nil
+	}
+
+	// The row of the cursor with the highest precedence is copied, as it is
+	// overwritten once the cursor is advanced.
+	row := c.rows[c.use[0]]
+	c.row.Name = row.Name
+	c.row.SeriesTags = copyTags(c.row.SeriesTags, row.SeriesTags)
+	c.row.Tags = copyTags(c.row.Tags, row.Tags)
+	c.row.Field = row.Field
+	c.row.ValueCond = row.ValueCond
+	c.row.Query = row.Query
+
+	if len(c.use) > 1 && c.conflict == RetentionPolicyConflictMerge {
+		m := &mergeCursorIterator{queries: make([]cursors.CursorIterators, len(c.use))}
+		for i, j := range c.use {
+			m.queries[i] = c.rows[j].Query
+		}
+		c.row.Query = cursors.CursorIterators{m}
+	}
+
+	for _, i := range c.match {
+		c.rows[i] = c.curs[i].Next()
+	}
+	return &c.row
+}
+
+// hasData reports whether the series of row has points in the range read by
+// the cursor.
+func (c *retentionPolicySeriesCursor) hasData(row *reads.SeriesRow) (bool, error) {
+	return seriesRowHasData(c.ctx, &c.req, row)
+}
+
+// seriesRowHasData reports whether the series of row has points in the range
+// of req. The name, tags and field of req are set to those of row.
+func seriesRowHasData(ctx context.Context, req *cursors.CursorRequest, row *reads.SeriesRow) (bool, error) {
+	req.Name = row.Name
+	req.Tags = row.SeriesTags
+	req.Field = row.Field
+	for _, itr := range row.Query {
+		cur, err := itr.Next(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		if cur == nil {
+			continue
+		}
+		ok, err := cursorHasData(cur)
+		cur.Close()
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// dataSeriesCursor skips the rows of the underlying cursor whose series has
+// no points in the range of req. It is used to read a fallback retention
+// policy, as the index may hold the series of every retention policy of the
+// database.
+type dataSeriesCursor struct {
+	reads.SeriesCursor
+	ctx context.Context
+	req cursors.CursorRequest
+	err error
+}
+
+func (c *dataSeriesCursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.SeriesCursor.Err()
+}
+
+func (c *dataSeriesCursor) Next() *reads.SeriesRow {
+	if c.err != nil {
+		return nil
+	}
+	for {
+		row := c.SeriesCursor.Next()
+		if row == nil {
+			return nil
+		}
+		ok, err := seriesRowHasData(c.ctx, &c.req, row)
+		if err != nil {
+			c.err = err
+			return nil
+		}
+		if ok {
+			return row
+		}
+	}
+}
+
+// compareSeriesRows orders rows by measurement, series tags and field, which
+// is the order in which an indexSeriesCursor produces them.
+func compareSeriesRows(a, b *reads.SeriesRow) int {
+	if cmp := bytes.Compare(a.Name, b.Name); cmp != 0 {
+		return cmp
+	}
+	if cmp := models.CompareTags(a.SeriesTags, b.SeriesTags); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a.Field, b.Field)
+}
+
+// mergeCursorIterator creates cursors merging the points of a series from the
+// shards of several retention policies. queries holds the cursor iterators of
+// the shards of each retention policy, in order of precedence.
+type mergeCursorIterator struct {
+	queries []cursors.CursorIterators
+}
+
+func (m *mergeCursorIterator) Next(ctx context.Context, r *cursors.CursorRequest) (cursors.Cursor, error) {
+	// The cursors are ordered by ascending precedence, so that values of the
+	// retention policies with a higher precedence are merged last.
+	var curs []cursors.Cursor
+	for i := len(m.queries) - 1; i >= 0; i-- {
+		for _, itr := range m.queries[i] {
+			cur, err := itr.Next(ctx, r)
+			if err != nil {
+				for _, cur := range curs {
+					cur.Close()
+				}
+				return nil, err
+			} else if cur != nil {
+				curs = append(curs, cur)
+			}
+		}
+	}
+
+	if len(curs) == 0 {
+		return nil, nil
+	}
+	return newMergeArrayCursor(curs), nil
+}
+
+func (m *mergeCursorIterator) Stats() cursors.CursorStats {
+	var stats cursors.CursorStats
+	for _, q := range m.queries {
+		stats.Add(q.Stats())
+	}
+	return stats
+}
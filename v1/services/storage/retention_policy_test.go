@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+)
+
+func TestCompareSeriesRows(t *testing.T) {
+	tests := []struct {
+		a, b string
+		af   string
+		bf   string
+		exp  int
+	}{
+		{a: "cpu,host=a", af: "v", b: "cpu,host=a", bf: "v", exp: 0},
+		{a: "cpu,host=a", af: "v", b: "mem,host=a", bf: "v", exp: -1},
+		{a: "cpu,host=b", af: "v", b: "cpu,host=a", bf: "v", exp: 1},
+		{a: "cpu", af: "v", b: "cpu,host=a", bf: "v", exp: -1},
+		{a: "cpu,host=a", af: "u", b: "cpu,host=a", bf: "v", exp: -1},
+		// The measurement is compared before the tags.
+		{a: "cpu,host=b", af: "v", b: "cpu0,host=a", bf: "v", exp: -1},
+	}
+
+	for _, tt := range tests {
+		a, b := testSeriesRow(tt.a, tt.af), testSeriesRow(tt.b, tt.bf)
+		if got := compareSeriesRows(&a, &b); got != tt.exp {
+			t.Errorf("compareSeriesRows(%s %s, %s %s) = %d, exp %d", tt.a, tt.af, tt.b, tt.bf, got, tt.exp)
+		}
+	}
+}
+
+func TestMergeCursorIterator(t *testing.T) {
+	ctx := context.Background()
+	req := &cursors.CursorRequest{}
+
+	t.Run("precedence", func(t *testing.T) {
+		high := &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+			{Timestamps: []int64{20, 30}, Values: []float64{2, 3}},
+		}}
+		low := &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+			{Timestamps: []int64{10, 20}, Values: []float64{10, 20}},
+		}}
+		lower := &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+			{Timestamps: []int64{30, 40}, Values: []float64{30, 40}},
+		}}
+		m := &mergeCursorIterator{queries: []cursors.CursorIterators{
+			{&testCursorIterator{cur: high, stats: cursors.CursorStats{ScannedValues: 2}}},
+			{
+				&testCursorIterator{cur: low, stats: cursors.CursorStats{ScannedValues: 2}},
+				&testCursorIterator{},
+			},
+			{&testCursorIterator{cur: lower, stats: cursors.CursorStats{ScannedValues: 2}}},
+		}}
+
+		cur, err := m.Next(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cur.Close()
+
+		// Where timestamps coincide, the value of the retention policy with
+		// the highest precedence is used.
+		var ts []int64
+		var values []float64
+		fc := cur.(cursors.FloatArrayCursor)
+		for a := fc.Next(); a.Len() > 0; a = fc.Next() {
+			ts = append(ts, a.Timestamps...)
+			values = append(values, a.Values...)
+		}
+		if exp := []int64{10, 20, 30, 40}; !cmp.Equal(ts, exp) {
+			t.Errorf("unexpected timestamps -got/+exp\n%s", cmp.Diff(ts, exp))
+		}
+		if exp := []float64{10, 2, 3, 40}; !cmp.Equal(values, exp) {
+			t.Errorf("unexpected values -got/+exp\n%s", cmp.Diff(values, exp))
+		}
+		if got, exp := m.Stats(), (cursors.CursorStats{ScannedValues: 6}); got != exp {
+			t.Errorf("got stats %+v, exp %+v", got, exp)
+		}
+	})
+
+	t.Run("no cursors", func(t *testing.T) {
+		m := &mergeCursorIterator{queries: []cursors.CursorIterators{
+			{&testCursorIterator{}},
+			{&testCursorIterator{}},
+		}}
+		if cur, err := m.Next(ctx, req); err != nil {
+			t.Fatal(err)
+		} else if cur != nil {
+			t.Fatalf("unexpected cursor %T", cur)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errNext := errors.New("next failed")
+		low := &testFloatArrayCursor{}
+		m := &mergeCursorIterator{queries: []cursors.CursorIterators{
+			{&testCursorIterator{err: errNext}},
+			{&testCursorIterator{cur: low}},
+		}}
+
+		// The cursors already created are closed.
+		if _, err := m.Next(ctx, req); err != errNext {
+			t.Fatalf("got error %v, exp %v", err, errNext)
+		}
+		if !low.closed {
+			t.Fatal("expected the cursor of the lower precedence to be closed")
+		}
+	})
+}
+
+func TestDataSeriesCursor(t *testing.T) {
+	withData := func() cursors.CursorIterator {
+		return &testCursorIterator{cur: &testFloatArrayCursor{arrays: []*cursors.FloatArray{
+			{Timestamps: []int64{10}, Values: []float64{1}},
+		}}}
+	}
+	errNext := errors.New("next failed")
+	c := &dataSeriesCursor{
+		SeriesCursor: &testSeriesCursor{rows: []reads.SeriesRow{
+			testSeriesRow("cpu,host=a", "v", withData()),
+			testSeriesRow("cpu,host=b", "v", &testCursorIterator{}),
+			testSeriesRow("cpu,host=c", "v", &testCursorIterator{cur: &testFloatArrayCursor{}}),
+			// A series has points if any of its shards do.
+			testSeriesRow("cpu,host=d", "v", &testCursorIterator{}, withData()),
+			testSeriesRow("cpu,host=e", "v", &testCursorIterator{err: errNext}),
+			testSeriesRow("cpu,host=f", "v", withData()),
+		}},
+		ctx: context.Background(),
+		req: cursors.CursorRequest{Ascending: true, StartTime: 0, EndTime: 100},
+	}
+
+	var keys []string
+	for row := c.Next(); row != nil; row = c.Next() {
+		keys = append(keys, string(models.MakeKey(row.Name, row.SeriesTags)))
+	}
+	if exp := []string{"cpu,host=a", "cpu,host=d"}; !cmp.Equal(keys, exp) {
+		t.Errorf("unexpected rows -got/+exp\n%s", cmp.Diff(keys, exp))
+	}
+	if err := c.Err(); err != errNext {
+		t.Fatalf("got error %v, exp %v", err, errNext)
+	}
+}
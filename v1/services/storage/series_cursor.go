@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"sort"
+	"time"
 
 	"github.com/influxdata/influxdb/v2/influxql/query"
 	"github.com/influxdata/influxdb/v2/models"
@@ -15,11 +18,20 @@ import (
 const (
 	measurementKey = "_measurement"
 	fieldKey       = "_field"
+	seriesKeyKey   = "_seriesKey"
+
+	// fieldKeySeparator separates the series key and field name in TSM keys.
+	fieldKeySeparator = "#!~#"
+
+	// predicateEvalWindow is the number of predicate evaluations whose
+	// average time is compared to the MaxPredicateEvalTime read option.
+	predicateEvalWindow = 64
 )
 
 var (
 	measurementKeyBytes = []byte(measurementKey)
 	fieldKeyBytes       = []byte(fieldKey)
+	seriesKeyKeyBytes   = []byte(seriesKeyKey)
 )
 
 type indexSeriesCursor struct {
@@ -35,6 +47,17 @@ type indexSeriesCursor struct {
 	eof             bool
 	hasFieldExpr    bool
 	hasValueExpr    bool
+	seriesFilter    SeriesFilterFunc
+	keyPrefix       []byte
+	keyBuf          []byte
+	withSeriesKey   bool
+	aliases         map[string][]byte
+	aliasSources    map[string]string
+	auth            query.Authorizer
+	database        string
+	evalMax         time.Duration
+	evalN           int
+	evalTotal       time.Duration
 }
 
 func newIndexSeriesCursor(ctx context.Context, predicate *datatypes.Predicate, shards []*tsdb.Shard) (*indexSeriesCursor, error) {
@@ -50,6 +73,13 @@ func newIndexSeriesCursor(ctx context.Context, predicate *datatypes.Predicate, s
 }
 
 func newIndexSeriesCursorInfluxQLPred(ctx context.Context, predicate influxql.Expr, shards []*tsdb.Shard) (*indexSeriesCursor, error) {
+	return newIndexSeriesCursorMeasurements(ctx, predicate, shards, nil)
+}
+
+// newIndexSeriesCursorMeasurements returns a cursor producing the series of
+// the named measurements matching predicate. The names must be sorted. If
+// names is nil, the series of every measurement are produced.
+func newIndexSeriesCursorMeasurements(ctx context.Context, predicate influxql.Expr, shards []*tsdb.Shard, names [][]byte) (*indexSeriesCursor, error) {
 	queries, err := tsdb.CreateCursorIterators(ctx, shards)
 	if err != nil {
 		return nil, err
@@ -67,11 +97,15 @@ func newIndexSeriesCursorInfluxQLPred(ctx context.Context, predicate influxql.Ex
 
 	opt := query.IteratorOptions{
 		Aux:        []influxql.VarRef{{Val: "key"}},
-		Authorizer: query.OpenAuthorizer,
+		Authorizer: authorizerFromContext(ctx),
 		Ascending:  true,
 		Ordered:    true,
 	}
 	p := &indexSeriesCursor{row: reads.SeriesRow{Query: queries}}
+	if opt.Authorizer != query.OpenAuthorizer {
+		p.auth = opt.Authorizer
+		p.database = shards[0].Database()
+	}
 
 	if predicate != nil {
 		p.cond = predicate
@@ -97,6 +131,8 @@ func newIndexSeriesCursorInfluxQLPred(ctx context.Context, predicate influxql.Ex
 	name, singleMeasurement := HasSingleMeasurementNoOR(p.measurementCond)
 	if singleMeasurement {
 		mitr = tsdb.NewMeasurementSliceIterator([][]byte{[]byte(name)})
+	} else if names != nil {
+		mitr = tsdb.NewMeasurementSliceIterator(names)
 	}
 
 	sg := tsdb.Shards(shards)
@@ -142,6 +178,38 @@ CLEANUP:
 	return nil, err
 }
 
+// filterFields restricts the fields produced by the cursor. When include is
+// not empty, only the named fields are produced. Fields named in exclude are
+// never produced, so their blocks are not read.
+func (c *indexSeriesCursor) filterFields(include, exclude []string) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return
+	}
+
+	inc := make(map[string]struct{}, len(include))
+	for _, f := range include {
+		inc[f] = struct{}{}
+	}
+	exc := make(map[string]struct{}, len(exclude))
+	for _, f := range exclude {
+		exc[f] = struct{}{}
+	}
+
+	for name, fields := range c.fields {
+		filtered := fields[:0]
+		for _, f := range fields {
+			if _, ok := exc[f.n]; ok {
+				continue
+			}
+			if _, ok := inc[f.n]; len(inc) > 0 && !ok {
+				continue
+			}
+			filtered = append(filtered, f)
+		}
+		c.fields[name] = filtered
+	}
+}
+
 func (c *indexSeriesCursor) Close() {
 	if !c.eof {
 		c.eof = true
@@ -152,6 +220,53 @@ func (c *indexSeriesCursor) Close() {
 	}
 }
 
+// applyReadOptions configures the series filters, field selection and tag
+// key aliases of the cursor from opts, which may be nil.
+func (c *indexSeriesCursor) applyReadOptions(opts *ReadOptions) {
+	if opts == nil {
+		return
+	}
+	c.seriesFilter = opts.SeriesFilter
+	if len(opts.SeriesKeyPrefix) > 0 {
+		c.keyPrefix = opts.SeriesKeyPrefix
+	}
+	c.filterFields(opts.Fields, opts.ExcludeFields)
+	c.aliasTagKeys(opts.TagKeyAliases)
+	c.evalMax = opts.MaxPredicateEvalTime
+	c.withSeriesKey = opts.IncludeSeriesKey
+}
+
+// aliasTagKeys configures the cursor to rename the tag keys of emitted rows
+// according to aliases, which maps a stored tag key to its new name. aliases
+// must be validated by ReadOptions.
+func (c *indexSeriesCursor) aliasTagKeys(aliases map[string]string) {
+	if len(aliases) == 0 {
+		return
+	}
+	c.aliases = make(map[string][]byte, len(aliases))
+	c.aliasSources = make(map[string]string, len(aliases))
+	for k, v := range aliases {
+		c.aliases[k] = []byte(v)
+		c.aliasSources[v] = k
+	}
+}
+
+// appendAliasedTags appends src to dst, renaming the keys found in the
+// aliases of the cursor. A renamed tag replaces a tag of the series already
+// using its new key. The returned tags are sorted.
+func (c *indexSeriesCursor) appendAliasedTags(dst, src models.Tags) models.Tags {
+	for _, t := range src {
+		if alias, ok := c.aliases[string(t.Key)]; ok {
+			t.Key = alias
+		} else if key, ok := c.aliasSources[string(t.Key)]; ok && src.Get([]byte(key)) != nil {
+			continue
+		}
+		dst = append(dst, t)
+	}
+	sort.Sort(dst)
+	return dst
+}
+
 func copyTags(dst, src models.Tags) models.Tags {
 	if cap(dst) < src.Len() {
 		dst = make(models.Tags, src.Len())
@@ -180,19 +295,42 @@ func (c *indexSeriesCursor) Next() *reads.SeriesRow {
 				return nil
 			}
 
+			if c.auth != nil && !c.auth.AuthorizeSeriesRead(c.database, sr.Name, sr.Tags) {
+				continue
+			}
+
+			if c.seriesFilter != nil || c.keyPrefix != nil || c.withSeriesKey {
+				c.keyBuf = models.AppendMakeKey(c.keyBuf[:0], sr.Name, sr.Tags)
+				if c.keyPrefix != nil && !bytes.HasPrefix(c.keyBuf, c.keyPrefix) {
+					continue
+				}
+				if c.seriesFilter != nil && !c.seriesFilter(c.keyBuf, sr.Tags) {
+					continue
+				}
+			}
+
 			c.row.Name = sr.Name
 			c.row.SeriesTags = sr.Tags
 			c.tags = copyTags(c.tags, sr.Tags)
 			c.tags.Set(measurementKeyBytes, sr.Name)
+			if c.withSeriesKey {
+				// The key is copied, as rows may be retained once the cursor
+				// is advanced, which reuses keyBuf.
+				c.tags.Set(seriesKeyKeyBytes, append([]byte(nil), c.keyBuf...))
+			}
 
 			c.nf = c.fields[string(sr.Name)]
 			// c.nf may be nil if there are no fields
 		} else {
 			c.field, c.nf = c.nf[0], c.nf[1:]
 
-			if c.measurementCond == nil || reads.EvalExprBool(c.measurementCond, c) {
+			if c.measurementCond == nil || c.evalMeasurementCond() {
 				break
 			}
+			if c.err != nil {
+				c.Close()
+				return nil
+			}
 		}
 	}
 
@@ -208,11 +346,36 @@ func (c *indexSeriesCursor) Next() *reads.SeriesRow {
 		}
 	}
 
-	c.row.Tags = copyTags(c.row.Tags, c.tags)
+	if c.aliases != nil {
+		c.row.Tags = c.appendAliasedTags(c.row.Tags[:0], c.tags)
+	} else {
+		c.row.Tags = copyTags(c.row.Tags, c.tags)
+	}
 
 	return &c.row
 }
 
+// evalMeasurementCond evaluates the predicate for the current series and
+// field. If the average time of an evaluation over the last window exceeds
+// evalMax, the cursor fails with ErrPredicateTooSlow.
+func (c *indexSeriesCursor) evalMeasurementCond() bool {
+	if c.evalMax <= 0 {
+		return reads.EvalExprBool(c.measurementCond, c)
+	}
+
+	start := time.Now()
+	ok := reads.EvalExprBool(c.measurementCond, c)
+	c.evalTotal += time.Since(start)
+	if c.evalN++; c.evalN == predicateEvalWindow {
+		if c.evalTotal/predicateEvalWindow > c.evalMax {
+			c.err = ErrPredicateTooSlow
+			return false
+		}
+		c.evalN, c.evalTotal = 0, 0
+	}
+	return ok
+}
+
 func (c *indexSeriesCursor) Value(key string) (interface{}, bool) {
 	switch key {
 	case "_name":
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/v1/services/meta"
+)
+
+// metaDataChangeNotifier is implemented by MetaClients signalling changes of
+// the meta data, such as *meta.Client.
+type metaDataChangeNotifier interface {
+	// WaitForDataChanged returns a channel closed when the meta data
+	// changes.
+	WaitForDataChanged() chan struct{}
+}
+
+type shardGroupCacheKey struct {
+	database, rp string
+	start, end   int64
+}
+
+type shardGroupCacheEntry struct {
+	groups  []meta.ShardGroupInfo
+	expires time.Time
+
+	// changed is closed when the meta data the groups were read from
+	// changes, or nil if the MetaClient does not signal changes.
+	changed chan struct{}
+}
+
+// shardGroupCache caches the shard groups overlapping the ranges of reads.
+type shardGroupCache struct {
+	mu      sync.Mutex
+	entries map[shardGroupCacheKey]shardGroupCacheEntry
+	swept   time.Time
+}
+
+// get returns the groups cached for key, unless they expired by now or the
+// meta data changed since they were read.
+func (c *shardGroupCache) get(key shardGroupCacheKey, now time.Time) ([]meta.ShardGroupInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) || isClosed(e.changed) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.groups, true
+}
+
+// put caches groups for key until expires. As ranges relative to the current
+// time produce new keys, the expired entries are removed once per ttl.
+func (c *shardGroupCache) put(key shardGroupCacheKey, groups []meta.ShardGroupInfo, changed chan struct{}, now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[shardGroupCacheKey]shardGroupCacheEntry)
+	}
+	if now.Sub(c.swept) >= ttl {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) || isClosed(e.changed) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[key] = shardGroupCacheEntry{groups: groups, expires: now.Add(ttl), changed: changed}
+}
+
+// isClosed reports whether ch is closed. A nil channel is never closed.
+func isClosed(ch chan struct{}) bool {
+	if ch == nil {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// shardGroupsByTimeRange returns the shard groups of rp overlapping the range,
+// which are cached for ShardGroupCacheTTL when it is greater than 0 and the
+// Store was created with NewStore. The returned slice may be modified by the
+// caller.
+func (s *Store) shardGroupsByTimeRange(database, rp string, start, end int64) ([]meta.ShardGroupInfo, error) {
+	if s.ShardGroupCacheTTL <= 0 || s.shardGroups == nil {
+		return s.MetaClient.ShardGroupsByTimeRange(database, rp, time.Unix(0, start), time.Unix(0, end))
+	}
+
+	key := shardGroupCacheKey{database: database, rp: rp, start: start, end: end}
+	now := s.now()
+	groups, ok := s.shardGroups.get(key, now)
+	if !ok {
+		// The channel is obtained before the groups are read, so that a
+		// change made while they are read invalidates them.
+		var changed chan struct{}
+		if n, ok := s.MetaClient.(metaDataChangeNotifier); ok {
+			changed = n.WaitForDataChanged()
+		}
+
+		var err error
+		groups, err = s.MetaClient.ShardGroupsByTimeRange(database, rp, time.Unix(0, start), time.Unix(0, end))
+		if err != nil {
+			return nil, err
+		}
+		s.shardGroups.put(key, groups, changed, now, s.ShardGroupCacheTTL)
+	}
+
+	// Callers sort and filter the groups in place.
+	return append([]meta.ShardGroupInfo(nil), groups...), nil
+}
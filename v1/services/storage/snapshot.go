@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/tsdb"
+	"github.com/influxdata/influxdb/v2/v1/services/meta"
+)
+
+// ErrSnapshotUnsupported is returned by OpenSnapshot when the TSDBStore does
+// not implement TSDBSnapshotter.
+var ErrSnapshotUnsupported = errors.New("tsdb store does not support snapshots")
+
+// TSDBSnapshotter is implemented by a TSDBStore that is able to pin a
+// point-in-time view of the data files of its shards, such as *tsdb.Store.
+type TSDBSnapshotter interface {
+	// Snapshot returns a store serving the data of the shards with the
+	// given IDs as it existed when Snapshot was called. Writes and
+	// compactions performed afterwards are not visible to the returned
+	// store. release frees the resources held by the view.
+	Snapshot(ctx context.Context, shardIDs []uint64) (store *tsdb.Store, release func() error, err error)
+}
+
+// Snapshot is a consistent, read-only view of a bucket over a time range. All
+// reads served by a Snapshot observe the same data and shard groups,
+// regardless of writes, compactions or shard group changes performed after it
+// was opened, which makes it suitable for exports spanning multiple requests.
+// Reads outside the range of the snapshot produce no data. A Snapshot must be
+// closed to release the pinned files.
+type Snapshot struct {
+	*Store
+
+	once    sync.Once
+	release func() error
+	err     error
+}
+
+// OpenSnapshot pins the shard groups of the bucket overlapping the range and
+// the current data files of their shards, and returns a Snapshot serving
+// reads from them. It returns ErrSnapshotUnsupported if the TSDBStore does not
+// implement TSDBSnapshotter.
+func (s *Store) OpenSnapshot(ctx context.Context, orgID, bucketID uint64, start, end int64) (*Snapshot, error) {
+	ss, ok := s.TSDBStore.(TSDBSnapshotter)
+	if !ok {
+		return nil, ErrSnapshotUnsupported
+	}
+
+	database, _, start, end, err := s.validateArgs(orgID, bucketID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	mc, err := newSnapshotMetaClient(s.MetaClient, database, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, release, err := ss.Snapshot(ctx, mc.shardIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	// The copy shares the reads in flight for each organization, which are
+	// held by pointer. The captured shard groups are not cached.
+	store := *s
+	store.TSDBStore = ts
+	store.MetaClient = mc
+	store.shardGroups = nil
+	return &Snapshot{Store: &store, release: release}, nil
+}
+
+// Close releases the files pinned by the snapshot. Close is idempotent.
+func (s *Snapshot) Close() error {
+	s.once.Do(func() {
+		if s.release != nil {
+			s.err = s.release()
+		}
+	})
+	return s.err
+}
+
+// snapshotMetaClient serves the shard groups of a database overlapping the
+// range of a snapshot, as they were when the snapshot was opened.
+type snapshotMetaClient struct {
+	db *meta.DatabaseInfo
+}
+
+// newSnapshotMetaClient captures the database and the shard groups of each of
+// its retention policies overlapping the range from mc.
+func newSnapshotMetaClient(mc MetaClient, database string, start, end int64) (*snapshotMetaClient, error) {
+	di := mc.Database(database)
+	if di == nil {
+		return nil, ErrDatabaseNotFound
+	}
+
+	db := *di
+	db.RetentionPolicies = make([]meta.RetentionPolicyInfo, len(di.RetentionPolicies))
+	for i, rpi := range di.RetentionPolicies {
+		groups, err := mc.ShardGroupsByTimeRange(database, rpi.Name, time.Unix(0, start), time.Unix(0, end))
+		if err != nil {
+			return nil, err
+		}
+		rpi.ShardGroups = groups
+		db.RetentionPolicies[i] = rpi
+	}
+	return &snapshotMetaClient{db: &db}, nil
+}
+
+// shardIDs returns the IDs of the shards of the captured shard groups.
+func (c *snapshotMetaClient) shardIDs() []uint64 {
+	var ids []uint64
+	for _, rpi := range c.db.RetentionPolicies {
+		for _, g := range rpi.ShardGroups {
+			for _, si := range g.Shards {
+				ids = append(ids, si.ID)
+			}
+		}
+	}
+	return uniqueShardIDs(ids)
+}
+
+func (c *snapshotMetaClient) Database(name string) *meta.DatabaseInfo {
+	if name != c.db.Name {
+		return nil
+	}
+	return c.db
+}
+
+func (c *snapshotMetaClient) ShardGroupsByTimeRange(database, policy string, min, max time.Time) ([]meta.ShardGroupInfo, error) {
+	if database != c.db.Name {
+		return nil, ErrDatabaseNotFound
+	}
+	rpi := c.db.RetentionPolicy(policy)
+	if rpi == nil {
+		return nil, ErrRetentionPolicyNotFound
+	}
+	var groups []meta.ShardGroupInfo
+	for _, g := range rpi.ShardGroups {
+		if g.Overlaps(min, max) {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
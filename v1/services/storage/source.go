@@ -1,15 +1,25 @@
 package storage
 
 import (
+	"fmt"
+
 	"github.com/gogo/protobuf/types"
 	"github.com/influxdata/influxdb/v2"
 )
 
+// ReadSourceVersion is the schema version of the read sources created by
+// GetSource. A source without a version predates versioning and has the
+// layout of version 1; sources of a later version are rejected with
+// ErrUnknownSourceVersion rather than misread, as a peer of an older
+// release would otherwise ignore fields it does not know.
+const ReadSourceVersion = 1
+
 // this is easier than fooling around with .proto files.
 
 type readSource struct {
 	BucketID       uint64 `protobuf:"varint,1,opt,name=bucket_id,proto3"`
 	OrganizationID uint64 `protobuf:"varint,2,opt,name=organization_id,proto3"`
+	Version        uint32 `protobuf:"varint,3,opt,name=version,proto3"`
 }
 
 func (r *readSource) XXX_MessageName() string { return "readSource" }
@@ -20,11 +30,23 @@ func (r *readSource) ProtoMessage()           {}
 func getReadSource(any types.Any) (readSource, error) {
 	var source readSource
 	if err := types.UnmarshalAny(&any, &source); err != nil {
-		return source, err
+		return readSource{}, err
+	}
+	if err := checkReadSourceVersion(source.Version); err != nil {
+		return readSource{}, err
 	}
 	return source, nil
 }
 
+// checkReadSourceVersion returns an error if a read source of version v
+// cannot be read.
+func checkReadSourceVersion(v uint32) error {
+	if v > ReadSourceVersion {
+		return fmt.Errorf("%w: version %d, expected at most %d", ErrUnknownSourceVersion, v, ReadSourceVersion)
+	}
+	return nil
+}
+
 func (r *readSource) GetOrgID() influxdb.ID {
 	return influxdb.ID(r.OrganizationID)
 }
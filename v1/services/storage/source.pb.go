@@ -40,6 +40,9 @@ type ReadSource struct {
 	Database string `protobuf:"bytes,1,opt,name=database,proto3" json:"database,omitempty"`
 	// RetentionPolicy identifies which retention policy to query.
 	RetentionPolicy string `protobuf:"bytes,2,opt,name=retention_policy,json=retentionPolicy,proto3" json:"retention_policy,omitempty"`
+	// Version is the schema version of the source. Sources without a version
+	// predate versioning.
+	Version uint32 `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
 }
 
 func (m *ReadSource) Reset()                    { *m = ReadSource{} }
@@ -77,6 +80,11 @@ func (m *ReadSource) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintSource(dAtA, i, uint64(len(m.RetentionPolicy)))
 		i += copy(dAtA[i:], m.RetentionPolicy)
 	}
+	if m.Version != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintSource(dAtA, i, uint64(m.Version))
+	}
 	return i, nil
 }
 
@@ -118,6 +126,9 @@ func (m *ReadSource) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovSource(uint64(l))
 	}
+	if m.Version != 0 {
+		n += 1 + sovSource(uint64(m.Version))
+	}
 	return n
 }
 
@@ -221,6 +232,25 @@ func (m *ReadSource) Unmarshal(dAtA []byte) error {
 			}
 			m.RetentionPolicy = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSource
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSource(dAtA[iNdEx:])
@@ -350,19 +380,19 @@ var (
 func init() { proto.RegisterFile("source.proto", fileDescriptorSource) }
 
 var fileDescriptorSource = []byte{
-	// 210 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x29, 0xce, 0x2f, 0x2d,
+	// 220 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe3, 0xe2, 0x29, 0xce, 0x2f, 0x2d,
 	0x4a, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xd2, 0x4f, 0xce, 0xcf, 0xd5, 0x4b, 0xcf,
 	0x2c, 0xc9, 0x28, 0x4d, 0xd2, 0xcb, 0xcc, 0x4b, 0xcb, 0x29, 0xad, 0x48, 0x49, 0x2c, 0x49, 0x84,
 	0x31, 0x93, 0xf4, 0x8a, 0x53, 0x8b, 0xca, 0x32, 0x93, 0x53, 0x8b, 0xf5, 0x8a, 0x4b, 0xf2, 0x8b,
-	0x12, 0xd3, 0x53, 0xa5, 0x74, 0xa1, 0x8a, 0x93, 0xf3, 0x73, 0xf5, 0xd3, 0xf3, 0xd3, 0xf3, 0xf5,
-	0xc1, 0xe6, 0x24, 0x95, 0xa6, 0x81, 0x79, 0x60, 0x0e, 0x98, 0x05, 0x31, 0x5f, 0x29, 0x83, 0x8b,
-	0x2b, 0x28, 0x35, 0x31, 0x25, 0x18, 0x6c, 0xa7, 0x90, 0x14, 0x17, 0x07, 0xc8, 0xf8, 0xa4, 0xc4,
+	0x12, 0xd3, 0x53, 0xa5, 0x74, 0xa1, 0x8a, 0x81, 0xfa, 0xf4, 0xd3, 0xf3, 0xd3, 0xf3, 0xf5, 0xc1,
+	0xe6, 0x24, 0x95, 0xa6, 0x81, 0x79, 0x60, 0x0e, 0x98, 0x05, 0x31, 0x5f, 0xa9, 0x89, 0x91, 0x8b,
+	0x2b, 0x28, 0x35, 0x31, 0x25, 0x18, 0x6c, 0xa9, 0x90, 0x14, 0x17, 0x07, 0xc8, 0xfc, 0xa4, 0xc4,
 	0xe2, 0x54, 0x09, 0x46, 0x05, 0x46, 0x0d, 0xce, 0x20, 0x38, 0x5f, 0xc8, 0x8e, 0x4b, 0xa0, 0x28,
 	0xb5, 0x24, 0x35, 0xaf, 0x24, 0x33, 0x3f, 0x2f, 0xbe, 0x20, 0x3f, 0x27, 0x33, 0xb9, 0x52, 0x82,
 	0x09, 0xa4, 0xc6, 0x49, 0xf8, 0xd1, 0x3d, 0x79, 0xfe, 0x20, 0x98, 0x5c, 0x00, 0x58, 0x2a, 0x88,
-	0xbf, 0x08, 0x55, 0xc0, 0x49, 0xf6, 0xc4, 0x43, 0x39, 0x86, 0x13, 0x8f, 0xe4, 0x18, 0x2f, 0x3c,
-	0x92, 0x63, 0x7c, 0xf0, 0x48, 0x8e, 0x71, 0xc2, 0x63, 0x39, 0x86, 0x28, 0x76, 0xa8, 0xbb, 0x93,
-	0xd8, 0xc0, 0xee, 0x31, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x9c, 0x5a, 0xd6, 0xd1, 0xff, 0x00,
-	0x00, 0x00,
+	0xbf, 0x08, 0x55, 0x40, 0x48, 0x82, 0x8b, 0xbd, 0x2c, 0xb5, 0xa8, 0x18, 0x28, 0x20, 0xc1, 0x0c,
+	0xd4, 0xc6, 0x1b, 0x04, 0xe3, 0x3a, 0xc9, 0x9e, 0x78, 0x28, 0xc7, 0x70, 0xe2, 0x91, 0x1c, 0xe3,
+	0x05, 0x20, 0x7e, 0x00, 0xc4, 0x13, 0x1e, 0xcb, 0x31, 0x44, 0xb1, 0x43, 0xbd, 0x94, 0xc4, 0x06,
+	0x76, 0xaa, 0x31, 0x00, 0x90, 0xcb, 0x4d, 0x3c, 0x1a, 0x01, 0x00, 0x00,
 }
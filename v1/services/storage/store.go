@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"bytes"
+	"container/heap"
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -17,13 +23,51 @@ import (
 	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
 	"github.com/influxdata/influxdb/v2/tsdb"
 	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+	"github.com/influxdata/influxdb/v2/tsdb/engine/tsm1"
 	"github.com/influxdata/influxdb/v2/v1/services/meta"
 	"github.com/influxdata/influxql"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 var (
-	ErrMissingReadSource = errors.New("missing ReadSource")
+	ErrMissingReadSource       = errors.New("missing ReadSource")
+	ErrPredicateTooComplex     = errors.New("predicate too complex")
+	ErrConflictingFieldOptions = errors.New("fields and exclude fields are mutually exclusive")
+	ErrResponseTooLarge        = errors.New("response exceeds maximum size")
+	ErrRateLimited             = errors.New("rate limit exceeded")
+	ErrInvalidTagKeyAliases    = errors.New("tag key aliases must be unique and may not include _measurement or _field")
+	ErrRetentionPolicyConflict = errors.New("series has points in more than one retention policy")
+	ErrInvalidWindowFill       = errors.New("window fill requires a fixed window duration and a bounded range")
+	ErrInvalidCoercion         = errors.New("fields may only be coerced to float or integer")
+	ErrPredicateTooSlow        = errors.New("predicate evaluation exceeds maximum time")
+	ErrMissingShard            = errors.New("shard not found")
+	ErrRehydrationTimeout      = errors.New("timed out rehydrating shard")
+	ErrInvalidTimeOfDayBucket  = errors.New("time of day bucket must evenly divide a day and may not be combined with an aggregate")
+	ErrInvalidMultiAggregate   = errors.New("invalid multiple aggregate request")
+	ErrOrgConcurrencyExceeded  = errors.New("organization has too many concurrent reads")
+	ErrInvalidGroupTopN        = errors.New("group top n requires a field and a count, sum, mean, min or max aggregate")
+	ErrTooManyDistinctValues   = errors.New("tag key has too many distinct values")
+	ErrInvalidDescending       = errors.New("descending reads may not be combined with gap detection, duplicate timestamp handling or several retention policies")
+	ErrDatabaseNotFound        = errors.New("database not found")
+	ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+	ErrQueryTimeout            = errors.New("query exceeded maximum duration")
+	ErrInvalidRange            = errors.New("invalid range")
+	ErrInvalidGroupOrder       = errors.New("group order requires grouping by tag keys")
+	ErrUnknownSourceVersion    = errors.New("unknown read source version")
+	ErrUnknownPredicateKey     = errors.New("predicate references unknown key")
+)
+
+const (
+	// DefaultMaxPredicateDepth is the default maximum nesting depth of a
+	// request predicate.
+	DefaultMaxPredicateDepth = 100
+
+	// DefaultMaxPredicateNodes is the default maximum number of nodes in a
+	// request predicate.
+	DefaultMaxPredicateNodes = 10000
 )
 
 type TSDBStore interface {
@@ -40,12 +84,16 @@ type MetaClient interface {
 }
 
 // getReadSource will attempt to unmarshal a ReadSource from the ReadRequest or
-// return an error if no valid resource is present.
+// return an error if no valid resource is present. A source of a later
+// version than ReadSourceVersion returns ErrUnknownSourceVersion.
 func GetReadSource(any types.Any) (*ReadSource, error) {
 	var source ReadSource
 	if err := types.UnmarshalAny(&any, &source); err != nil {
 		return nil, err
 	}
+	if err := checkReadSourceVersion(source.Version); err != nil {
+		return nil, err
+	}
 	return &source, nil
 }
 
@@ -53,11 +101,186 @@ type Store struct {
 	TSDBStore  TSDBStore
 	MetaClient MetaClient
 	Logger     *zap.Logger
+
+	// MaxPredicateDepth and MaxPredicateNodes limit the size of request
+	// predicates, which are rejected with ErrPredicateTooComplex before
+	// they are translated. A value of 0 disables the respective limit.
+	MaxPredicateDepth int
+	MaxPredicateNodes int
+
+	// RateLimiters maps a method name, such as "TagValues", to a token
+	// bucket limiting the rate at which the method is served. Requests
+	// exceeding the rate fail with ErrRateLimited before any shards are
+	// resolved. Methods without a limiter are not rate limited.
+	RateLimiters map[string]*rate.Limiter
+
+	// DefaultRange, when greater than 0, is the duration up to the current
+	// time read by requests that specify neither a start nor an end time.
+	// By default, such requests read the entire time range. A request
+	// explicitly starting at models.MinNanoTime specifies a start time.
+	DefaultRange time.Duration
+
+	// Now returns the current time, from which DefaultRange is resolved.
+	// When nil, time.Now is used.
+	Now func() time.Time
+
+	// DatabaseNameFn returns the name of the database holding the bucket of
+	// a request, such as from a table mapping buckets to 1.x databases. An
+	// error it returns fails the request. When nil, the database is named
+	// after the bucket ID, as influxdb.ID(bucketID).String().
+	DatabaseNameFn func(orgID, bucketID uint64) (string, error)
+
+	// ParallelShardScans, when greater than 1, is the number of shards
+	// whose indexes are scanned concurrently by ReadFilter. The series of
+	// the shards are merged, so that the order of the results is the same
+	// as that of a serial scan.
+	ParallelShardScans int
+
+	// SlowScanConcurrency is the number of shards scanned concurrently by
+	// the block scans serving metadata requests whose predicates reference
+	// _field, such as TagValues and MeasurementNames. When 0, GOMAXPROCS
+	// is used, and 1 scans the shards serially.
+	SlowScanConcurrency int
+
+	// ShardSelector chooses the shards read by each request. When nil,
+	// DefaultShardSelector is used.
+	ShardSelector ShardSelector
+
+	// MissingShardPolicy determines how reads handle a selected shard that
+	// is not found by the TSDBStore.
+	MissingShardPolicy MissingShardPolicy
+
+	// ShardRehydrator, when not nil, rehydrates the cold shards selected
+	// by a request before they are read. RehydrationTimeout, when greater
+	// than 0, limits the time spent rehydrating each shard, after which the
+	// request fails with ErrRehydrationTimeout. Otherwise rehydration is
+	// only limited by the context of the request.
+	ShardRehydrator    ShardRehydrator
+	RehydrationTimeout time.Duration
+
+	// MaxConcurrentReadsPerOrg, when greater than 0, limits the number of
+	// reads in flight for each organization. A read exceeding the limit
+	// fails with ErrOrgConcurrencyExceeded rather than waiting, so that an
+	// organization issuing many reads cannot starve the others. A request
+	// returning a result set remains in flight until the result set is
+	// closed, and any other request until it returns.
+	MaxConcurrentReadsPerOrg int
+
+	// RetentionPolicyFallbacks lists the retention policies read, in order,
+	// when the retention policy of a request has no shards overlapping its
+	// range, such as downsampled retention policies holding older data. The
+	// first with shards overlapping the range is read, and those not defined
+	// for the bucket are skipped. A ReadFilter request read from a fallback
+	// only produces the series with points in the range. Reads of explicitly
+	// named retention policies, such as with the RetentionPolicies read
+	// option, do not fall back.
+	RetentionPolicyFallbacks []string
+
+	// ShardGroupCacheTTL, when greater than 0, is the duration for which the
+	// shard groups of a database, retention policy and range are cached,
+	// saving a lookup in the MetaClient by subsequent reads of the same
+	// range. When the MetaClient signals changes of the meta data, as
+	// *meta.Client does, the cached groups are also discarded on any change.
+	// Otherwise, newly created or deleted shard groups may be missed or read
+	// until the groups expire.
+	ShardGroupCacheTTL time.Duration
+
+	// orgReads is shared with the snapshots of the store, so that their
+	// reads count towards the same MaxConcurrentReadsPerOrg.
+	orgReads *orgReadLimiter
+
+	// shardGroups caches the shard groups of reads for ShardGroupCacheTTL.
+	shardGroups *shardGroupCache
+
+	metrics *storeMetrics
+
+	maxQueryDuration time.Duration
+}
+
+// checkRateLimit returns ErrRateLimited if method has a limiter and no token
+// is currently available.
+func (s *Store) checkRateLimit(method string) error {
+	if l := s.RateLimiters[method]; l != nil && !l.Allow() {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// orgReadLimiter counts the reads in flight for each organization.
+type orgReadLimiter struct {
+	mu    sync.Mutex
+	reads map[uint64]int
+}
+
+func newOrgReadLimiter() *orgReadLimiter {
+	return &orgReadLimiter{reads: make(map[uint64]int)}
+}
+
+// acquire reserves one of the concurrent reads of the organization, returning
+// a function releasing it. It returns ErrOrgConcurrencyExceeded if the
+// organization already has max reads in flight.
+func (l *orgReadLimiter) acquire(orgID uint64, max int) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reads[orgID] >= max {
+		return nil, ErrOrgConcurrencyExceeded
+	}
+	l.reads[orgID]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.reads[orgID]--; l.reads[orgID] == 0 {
+				delete(l.reads, orgID)
+			}
+		})
+	}, nil
+}
+
+// acquireOrgRead reserves one of the concurrent reads of the organization,
+// returning a function releasing it. It returns ErrOrgConcurrencyExceeded if
+// the organization already has MaxConcurrentReadsPerOrg reads in flight.
+// Reads are only limited by a Store created with NewStore.
+func (s *Store) acquireOrgRead(orgID uint64) (func(), error) {
+	if s.MaxConcurrentReadsPerOrg <= 0 || s.orgReads == nil {
+		return func() {}, nil
+	}
+	return s.orgReads.acquire(orgID, s.MaxConcurrentReadsPerOrg)
 }
 
-func (s *Store) WindowAggregate(ctx context.Context, req *datatypes.ReadWindowAggregateRequest) (reads.ResultSet, error) {
+// WindowAggregate returns a result set producing an aggregate of each window
+// of each series and field matching the request. The min and max selectors
+// produce the timestamp of the point they select, rather than that of the
+// window, so that the time at which each extreme occurred is preserved.
+//
+// A request with more than one aggregate returns a MultiAggregateResultSet,
+// computing every aggregate with a single read of each series. Its cursors
+// report every aggregate, selectors included, at the stop time of the
+// window, so that the values of a window share a timestamp. Windows must be
+// of a fixed duration, and sum, min, max and mean are only supported for
+// numeric fields, otherwise the request fails with
+// ErrInvalidMultiAggregate. The aggregates of a series are held in memory,
+// and WindowFill is not supported.
+//
+// Like ReadFilter, a read selecting no shards or series returns an empty
+// result set, which is a MultiAggregateResultSet for several aggregates.
+func (s *Store) WindowAggregate(ctx context.Context, req *datatypes.ReadWindowAggregateRequest) (_ reads.ResultSet, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer func() { deadline.done(&err) }()
+
+	if err := s.checkRateLimit("WindowAggregate"); err != nil {
+		return nil, err
+	}
+
 	if req.ReadSource == nil {
-		return nil, errors.New("missing read source")
+		return nil, ErrMissingReadSource
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if err := opts.validate(); err != nil {
+		return nil, err
 	}
 
 	source, err := getReadSource(*req.ReadSource)
@@ -65,36 +288,191 @@ func (s *Store) WindowAggregate(ctx context.Context, req *datatypes.ReadWindowAg
 		return nil, err
 	}
 
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return nil, err
+	}
+
 	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkPredicateKeys(ctx, req.Predicate, source.OrganizationID, database, []string{rp}, start, end); err != nil {
+		return nil, err
+	}
+
+	if len(req.Aggregate) > 1 && opts != nil && opts.WindowFill != WindowFillNone {
+		return nil, ErrInvalidMultiAggregate
+	}
 
-	shardIDs, err := s.findShardIDs(database, rp, false, start, end)
+	var fill *windowFill
+	if opts != nil && opts.WindowFill != WindowFillNone {
+		if fill, err = newWindowFill(req, opts.WindowFill, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
 	if err != nil {
 		return nil, err
 	}
-	if len(shardIDs) == 0 { // TODO(jeff): this was a typed nil
-		return nil, nil
+	if len(shardIDs) == 0 {
+		return emptyWindowAggregateResultSet(req)
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
 	}
 
 	var cur reads.SeriesCursor
-	if ic, err := newIndexSeriesCursor(ctx, req.Predicate, s.TSDBStore.Shards(shardIDs)); err != nil {
+	if ic, err := newIndexSeriesCursor(ctx, req.Predicate, shards); err != nil {
 		return nil, err
-	} else if ic == nil { // TODO(jeff): this was a typed nil
-		return nil, nil
+	} else if ic == nil {
+		return emptyWindowAggregateResultSet(req)
 	} else {
 		cur = ic
 	}
 
-	return reads.NewWindowAggregateResultSet(ctx, req, cur)
+	if len(req.Aggregate) > 1 {
+		var rs reads.ResultSet = &releaseResultSet{ResultSet: reads.NewFilteredResultSet(ctx, start, end, cur), release: release}
+		release = nil
+		rs = &contextResultSet{ResultSet: rs, ctx: ctx}
+		if deadline != nil {
+			rs = &deadlineResultSet{ResultSet: rs, deadline: deadline}
+			deadline = nil
+		}
+		mrs, err := newMultiAggregateResultSet(req, rs)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		return mrs, nil
+	}
+
+	rs, err := reads.NewWindowAggregateResultSet(ctx, req, cur)
+	if err != nil {
+		return nil, err
+	}
+	rs = &releaseResultSet{ResultSet: rs, release: release}
+	release = nil
+	rs = &contextResultSet{ResultSet: rs, ctx: ctx}
+	if deadline != nil {
+		rs = &deadlineResultSet{ResultSet: rs, deadline: deadline}
+		deadline = nil
+	}
+	if fill == nil {
+		return rs, nil
+	}
+	return &windowFillResultSet{ResultSet: rs, fill: fill}, nil
+}
+
+// newWindowFill returns the windows of req over the range [start, end),
+// filled according to mode. It returns ErrInvalidWindowFill if the windows
+// are measured in months or span the range, or if the range is unbounded.
+func newWindowFill(req *datatypes.ReadWindowAggregateRequest, mode WindowFill, start, end int64) (*windowFill, error) {
+	every, offset, ok := fixedWindow(req)
+	if !ok || every <= 0 || every == math.MaxInt64 || start == models.MinNanoTime || end == models.MaxNanoTime {
+		return nil, ErrInvalidWindowFill
+	}
+
+	f := &windowFill{mode: mode, every: every, offset: offset}
+	if len(req.Aggregate) > 0 {
+		switch req.Aggregate[0].Type {
+		case datatypes.AggregateTypeFirst, datatypes.AggregateTypeLast, datatypes.AggregateTypeMin, datatypes.AggregateTypeMax:
+			f.selector = true
+		}
+	}
+	f.first = f.windowStop(start)
+	f.last = f.windowStop(end - 1)
+	return f, nil
+}
+
+// fixedWindow returns the duration and offset of the windows of req. It
+// returns false if the windows are measured in months or are negative.
+func fixedWindow(req *datatypes.ReadWindowAggregateRequest) (every, offset int64, ok bool) {
+	every, offset = req.WindowEvery, req.Offset
+	if w := req.Window; w != nil {
+		if w.Every == nil || w.Every.Months != 0 || w.Every.Negative {
+			return 0, 0, false
+		}
+		every, offset = w.Every.Nsecs, 0
+		if w.Offset != nil {
+			if w.Offset.Months != 0 {
+				return 0, 0, false
+			}
+			offset = w.Offset.Nsecs
+			if w.Offset.Negative {
+				offset = -offset
+			}
+		}
+	}
+	return every, offset, true
+}
+
+// newMultiAggregateResultSet returns a result set computing the aggregates
+// of req over the series of rs in a single pass. It returns
+// ErrInvalidMultiAggregate if the windows are measured in months or an
+// aggregate is not supported.
+func newMultiAggregateResultSet(req *datatypes.ReadWindowAggregateRequest, rs reads.ResultSet) (reads.ResultSet, error) {
+	every, offset, ok := fixedWindow(req)
+	if !ok {
+		return nil, ErrInvalidMultiAggregate
+	}
+
+	aggs := make([]datatypes.Aggregate_AggregateType, len(req.Aggregate))
+	for i, agg := range req.Aggregate {
+		switch agg.Type {
+		case datatypes.AggregateTypeCount, datatypes.AggregateTypeSum, datatypes.AggregateTypeMean,
+			datatypes.AggregateTypeMin, datatypes.AggregateTypeMax,
+			datatypes.AggregateTypeFirst, datatypes.AggregateTypeLast:
+		default:
+			return nil, ErrInvalidMultiAggregate
+		}
+		aggs[i] = agg.Type
+	}
+
+	// A single window spanning the range is reported at math.MaxInt64, as
+	// by the count, sum and mean of a single aggregate request.
+	stop := func(int64) int64 { return math.MaxInt64 }
+	if every > 0 && every != math.MaxInt64 {
+		stop = func(ts int64) int64 { return windowStop(ts, every, offset) }
+	}
+
+	return &multiAggregateResultSet{
+		ResultSet:  rs,
+		aggs:       aggs,
+		windowStop: stop,
+	}, nil
+}
+
+// emptyWindowAggregateResultSet returns the result set of a WindowAggregate
+// of req selecting no series.
+func emptyWindowAggregateResultSet(req *datatypes.ReadWindowAggregateRequest) (reads.ResultSet, error) {
+	if len(req.Aggregate) > 1 {
+		return newMultiAggregateResultSet(req, emptyResultSet{})
+	}
+	return emptyResultSet{}, nil
 }
 
 func NewStore(store TSDBStore, metaClient MetaClient) *Store {
 	return &Store{
-		TSDBStore:  store,
-		MetaClient: metaClient,
-		Logger:     zap.NewNop(),
+		TSDBStore:         store,
+		MetaClient:        metaClient,
+		Logger:            zap.NewNop(),
+		MaxPredicateDepth: DefaultMaxPredicateDepth,
+		MaxPredicateNodes: DefaultMaxPredicateNodes,
+		orgReads:          newOrgReadLimiter(),
+		shardGroups:       &shardGroupCache{},
 	}
 }
 
@@ -103,12 +481,72 @@ func (s *Store) WithLogger(log *zap.Logger) {
 	s.Logger = log.With(zap.String("service", "store"))
 }
 
-func (s *Store) findShardIDs(database, rp string, desc bool, start, end int64) ([]uint64, error) {
-	groups, err := s.MetaClient.ShardGroupsByTimeRange(database, rp, time.Unix(0, start), time.Unix(0, end))
+// WithMetrics registers the metrics of the store with reg and records them
+// from then on. The number, errors and duration of ReadFilter, ReadGroup,
+// TagKeys, TagValues and MeasurementNames calls are recorded, where the
+// duration of a call returning a result set excludes reading it. The tag
+// values requests served by the index and by a block scan are also counted.
+// Without metrics, nothing is recorded.
+//
+// The metrics are registered with reg, which panics if they already are, so
+// WithMetrics must be called at most once for each registerer, and stores
+// sharing a registerer must not both call it. Snapshots of the store record
+// to the metrics of the store.
+func (s *Store) WithMetrics(reg prometheus.Registerer) {
+	s.metrics = newStoreMetrics(reg)
+}
+
+// findShardIDs returns the shards of rp selected for the range or, if there
+// are none, those of the first of RetentionPolicyFallbacks with any.
+func (s *Store) findShardIDs(ctx context.Context, database, rp string, desc bool, start, end int64) ([]uint64, error) {
+	// Reads bounded by MaxQueryDuration may expire before their shards are
+	// resolved.
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.findRetentionPolicyShardIDs(ctx, database, rp, desc, start, end)
+	if err != nil || len(ids) > 0 || len(s.RetentionPolicyFallbacks) == 0 {
+		return ids, err
+	}
+
+	di := s.MetaClient.Database(database)
+	if di == nil {
+		return nil, nil
+	}
+	for _, fallback := range s.RetentionPolicyFallbacks {
+		if fallback == rp || di.RetentionPolicy(fallback) == nil {
+			continue
+		}
+		ids, err := s.findRetentionPolicyShardIDs(ctx, database, fallback, desc, start, end)
+		if err != nil || len(ids) > 0 {
+			return ids, err
+		}
+	}
+	return nil, nil
+}
+
+// readsFallback reports whether shardIDs, selected by findShardIDs for a
+// read of rp, belong to one of RetentionPolicyFallbacks.
+func (s *Store) readsFallback(rp string, shardIDs []uint64) bool {
+	if len(s.RetentionPolicyFallbacks) == 0 || len(shardIDs) == 0 {
+		return false
+	}
+	for _, sh := range s.TSDBStore.Shards(shardIDs[:1]) {
+		return sh.RetentionPolicy() != rp
+	}
+	return false
+}
+
+// findRetentionPolicyShardIDs returns the shards of rp selected for the
+// range, without falling back to RetentionPolicyFallbacks.
+func (s *Store) findRetentionPolicyShardIDs(ctx context.Context, database, rp string, desc bool, start, end int64) ([]uint64, error) {
+	groups, err := s.shardGroupsByTimeRange(database, rp, start, end)
 	if err != nil {
 		return nil, err
 	}
 
+	groups = filterShardGroups(groups, ReadOptionsFromContext(ctx))
 	if len(groups) == 0 {
 		return nil, nil
 	}
@@ -119,306 +557,3714 @@ func (s *Store) findShardIDs(database, rp string, desc bool, start, end int64) (
 		sort.Sort(meta.ShardGroupInfos(groups))
 	}
 
-	shardIDs := make([]uint64, 0, len(groups[0].Shards)*len(groups))
-	for _, g := range groups {
+	// Overlapping groups referencing the same shard indicate an
+	// inconsistency in the meta store. Each shard is only scanned once,
+	// so as not to produce duplicate results.
+	seen := make(map[uint64]struct{}, len(groups[0].Shards)*len(groups))
+	for i, g := range groups {
+		shards := make([]meta.ShardInfo, 0, len(g.Shards))
 		for _, si := range g.Shards {
-			shardIDs = append(shardIDs, si.ID)
+			if _, ok := seen[si.ID]; ok {
+				s.Logger.Warn("Duplicate shard ID in shard groups",
+					zap.String("database", database),
+					zap.String("retention_policy", rp),
+					zap.Uint64("shard_group_id", g.ID),
+					zap.Uint64("shard_id", si.ID))
+				continue
+			}
+			seen[si.ID] = struct{}{}
+			shards = append(shards, si)
 		}
+		groups[i].Shards = shards
 	}
-	return shardIDs, nil
+
+	selector := s.ShardSelector
+	if selector == nil {
+		selector = DefaultShardSelector{}
+	}
+	return uniqueShardIDs(selector.SelectShards(groups)), nil
 }
 
-func (s *Store) validateArgs(orgID, bucketID uint64, start, end int64) (string, string, int64, int64, error) {
-	database := influxdb.ID(bucketID).String()
-	rp := meta.DefaultRetentionPolicyName
+// uniqueShardIDs removes repeated IDs from ids in place, keeping the first
+// of each, so that a shard selected twice is scanned once.
+func uniqueShardIDs(ids []uint64) []uint64 {
+	seen := make(map[uint64]struct{}, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+	return unique
+}
 
-	di := s.MetaClient.Database(database)
-	if di == nil {
-		return "", "", 0, 0, errors.New("no database")
+// filterShardGroups returns the groups selected by the IncludeShardGroups and
+// ExcludeShardGroups read options.
+func filterShardGroups(groups []meta.ShardGroupInfo, opts *ReadOptions) []meta.ShardGroupInfo {
+	if opts == nil || (len(opts.IncludeShardGroups) == 0 && len(opts.ExcludeShardGroups) == 0) {
+		return groups
 	}
 
-	rpi := di.RetentionPolicy(rp)
-	if rpi == nil {
-		return "", "", 0, 0, errors.New("invalid retention policy")
+	include := make(map[uint64]struct{}, len(opts.IncludeShardGroups))
+	for _, id := range opts.IncludeShardGroups {
+		include[id] = struct{}{}
+	}
+	exclude := make(map[uint64]struct{}, len(opts.ExcludeShardGroups))
+	for _, id := range opts.ExcludeShardGroups {
+		exclude[id] = struct{}{}
+	}
+
+	filtered := groups[:0]
+	for _, g := range groups {
+		if _, ok := include[g.ID]; len(include) > 0 && !ok {
+			continue
+		}
+		if _, ok := exclude[g.ID]; ok {
+			continue
+		}
+		filtered = append(filtered, g)
 	}
+	return filtered
+}
+
+// ShardSelector chooses the shards read by a request from the shard groups
+// overlapping its time range.
+type ShardSelector interface {
+	// SelectShards returns the IDs of the shards to read, which must be
+	// referenced by groups. The groups are ordered by time, descending for
+	// descending reads, and reference each shard at most once. The shards
+	// are read in the order of the returned IDs, and an ID returned more
+	// than once is only read at its first position.
+	SelectShards(groups []meta.ShardGroupInfo) []uint64
+}
 
-	if start <= 0 {
-		start = models.MinNanoTime
+// DefaultShardSelector selects every shard of the groups, in group order.
+type DefaultShardSelector struct{}
+
+func (DefaultShardSelector) SelectShards(groups []meta.ShardGroupInfo) []uint64 {
+	var n int
+	for _, g := range groups {
+		n += len(g.Shards)
 	}
-	if end <= 0 {
-		end = models.MaxNanoTime
+	shardIDs := make([]uint64, 0, n)
+	for _, g := range groups {
+		for _, si := range g.Shards {
+			shardIDs = append(shardIDs, si.ID)
+		}
 	}
-	return database, rp, start, end, nil
+	return shardIDs
 }
 
-func (s *Store) ReadFilter(ctx context.Context, req *datatypes.ReadFilterRequest) (reads.ResultSet, error) {
-	if req.ReadSource == nil {
-		return nil, errors.New("missing read source")
+// MissingShardPolicy determines how a read handles a shard selected for a
+// request that is not found by the TSDBStore, for example because it was
+// deleted after the shard groups were read from the meta store.
+type MissingShardPolicy int
+
+const (
+	// MissingShardSkip reads the shards that were found, logging a warning
+	// for each missing shard. It is the default.
+	MissingShardSkip MissingShardPolicy = iota
+
+	// MissingShardError fails the read with ErrMissingShard.
+	MissingShardError
+
+	// MissingShardRetry looks up the missing shards again, up to
+	// missingShardRetries times, waiting missingShardRetryInterval between
+	// attempts, and fails the read with ErrMissingShard if any are still
+	// missing.
+	MissingShardRetry
+)
+
+const (
+	missingShardRetries       = 3
+	missingShardRetryInterval = 10 * time.Millisecond
+)
+
+// ShardRehydrator pages in archived shards, which must be rehydrated before
+// they can be read.
+type ShardRehydrator interface {
+	// IsCold reports whether the shard is archived.
+	IsCold(shardID uint64) bool
+
+	// Rehydrate makes the archived shard available to the TSDBStore. It
+	// must return once the shard can be read, or with an error once ctx is
+	// done.
+	Rehydrate(ctx context.Context, shardID uint64) error
+}
+
+// rehydrate rehydrates the cold shards of ids, one at a time, each within
+// RehydrationTimeout.
+func (s *Store) rehydrate(ctx context.Context, ids []uint64) error {
+	if s.ShardRehydrator == nil {
+		return nil
+	}
+	for _, id := range ids {
+		if !s.ShardRehydrator.IsCold(id) {
+			continue
+		}
+		if err := s.rehydrateShard(ctx, id); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	source, err := getReadSource(*req.ReadSource)
-	if err != nil {
-		return nil, err
+func (s *Store) rehydrateShard(ctx context.Context, id uint64) error {
+	if s.RehydrationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.RehydrationTimeout)
+		defer cancel()
 	}
 
-	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
-	if err != nil {
-		return nil, err
+	err := s.ShardRehydrator.Rehydrate(ctx, id)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		s.Logger.Warn("Shard rehydration timed out", zap.Uint64("shard_id", id), zap.Error(err))
+		return ErrRehydrationTimeout
 	}
+	return err
+}
 
-	shardIDs, err := s.findShardIDs(database, rp, false, start, end)
-	if err != nil {
+// shards returns the shards with the given IDs, handling those not found by
+// the TSDBStore according to the MissingShardPolicy of the store. Cold shards
+// are rehydrated first. The shards are returned in the order of ids.
+func (s *Store) shards(ctx context.Context, ids []uint64) ([]*tsdb.Shard, error) {
+	if err := s.rehydrate(ctx, ids); err != nil {
 		return nil, err
 	}
-	if len(shardIDs) == 0 { // TODO(jeff): this was a typed nil
-		return nil, nil
+
+	shards := s.TSDBStore.Shards(ids)
+	missing := missingShardIDs(ids, shards)
+	for i := 0; len(missing) > 0 && s.MissingShardPolicy == MissingShardRetry && i < missingShardRetries; i++ {
+		time.Sleep(missingShardRetryInterval)
+		shards = append(shards, s.TSDBStore.Shards(missing)...)
+		missing = missingShardIDs(ids, shards)
 	}
 
-	var cur reads.SeriesCursor
-	if ic, err := newIndexSeriesCursor(ctx, req.Predicate, s.TSDBStore.Shards(shardIDs)); err != nil {
-		return nil, err
-	} else if ic == nil { // TODO(jeff): this was a typed nil
-		return nil, nil
-	} else {
-		cur = ic
+	if len(missing) > 0 {
+		if s.MissingShardPolicy != MissingShardSkip {
+			return nil, ErrMissingShard
+		}
+		for _, id := range missing {
+			s.Logger.Warn("Shard not found", zap.Uint64("shard_id", id))
+		}
 	}
 
-	req.Range.Start = start
-	req.Range.End = end
+	// The shards found are ordered as ids, without nil entries.
+	byID := make(map[uint64]*tsdb.Shard, len(shards))
+	for _, sh := range shards {
+		if sh != nil {
+			byID[sh.ID()] = sh
+		}
+	}
+	ordered := make([]*tsdb.Shard, 0, len(byID))
+	for _, id := range ids {
+		if sh, ok := byID[id]; ok {
+			ordered = append(ordered, sh)
+		}
+	}
+	return ordered, nil
+}
+
+// missingShardIDs returns the IDs of ids for which shards holds no shard.
+func missingShardIDs(ids []uint64, shards []*tsdb.Shard) []uint64 {
+	found := make(map[uint64]struct{}, len(shards))
+	for _, sh := range shards {
+		if sh != nil {
+			found[sh.ID()] = struct{}{}
+		}
+	}
+	var missing []uint64
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
 
-	return reads.NewFilteredResultSet(ctx, req.Range.Start, req.Range.End, cur), nil
+// ShardGroupInfo describes a shard group selected to serve a time range.
+type ShardGroupInfo struct {
+	ID        uint64
+	StartTime int64 // StartTime is the inclusive lower bound in nanoseconds.
+	EndTime   int64 // EndTime is the exclusive upper bound in nanoseconds.
+	ShardIDs  []uint64
 }
 
-func (s *Store) ReadGroup(ctx context.Context, req *datatypes.ReadGroupRequest) (reads.GroupResultSet, error) {
-	if req.ReadSource == nil {
-		return nil, errors.New("missing read source")
+// ShardGroups returns the shard groups of the bucket that overlap the range,
+// ordered by time, as they would be selected for a read.
+func (s *Store) ShardGroups(ctx context.Context, orgID, bucketID uint64, start, end int64) (_ []ShardGroupInfo, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	database, rp, start, end, err := s.validateArgs(orgID, bucketID, start, end)
+	if err != nil {
+		return nil, err
 	}
 
-	source, err := getReadSource(*req.ReadSource)
+	groups, err := s.shardGroupsByTimeRange(database, rp, start, end)
 	if err != nil {
 		return nil, err
 	}
+	sort.Sort(meta.ShardGroupInfos(groups))
 
-	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	infos := make([]ShardGroupInfo, 0, len(groups))
+	for _, g := range groups {
+		info := ShardGroupInfo{
+			ID:        g.ID,
+			StartTime: g.StartTime.UnixNano(),
+			EndTime:   g.EndTime.UnixNano(),
+			ShardIDs:  make([]uint64, 0, len(g.Shards)),
+		}
+		if g.Truncated() {
+			info.EndTime = g.TruncatedAt.UnixNano()
+		}
+		for _, si := range g.Shards {
+			info.ShardIDs = append(info.ShardIDs, si.ID)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ShardCardinalities returns the number of series in each shard of the
+// bucket that overlaps the range, keyed by shard ID. The counts are read from
+// the series ID set of each shard's index, so they are exact and exclude
+// deleted series, but include series without points in the range. Shards
+// that are not open on this node are omitted.
+func (s *Store) ShardCardinalities(ctx context.Context, orgID, bucketID uint64, start, end int64) (_ map[uint64]int64, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	database, rp, start, end, err := s.validateArgs(orgID, bucketID, start, end)
 	if err != nil {
 		return nil, err
 	}
 
-	shardIDs, err := s.findShardIDs(database, rp, false, start, end)
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
 	if err != nil {
 		return nil, err
 	}
-	if len(shardIDs) == 0 {
-		return nil, nil
+
+	counts := make(map[uint64]int64, len(shardIDs))
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	shards := s.TSDBStore.Shards(shardIDs)
+	for _, sh := range shards {
+		counts[sh.ID()] = sh.SeriesN()
+	}
+	return counts, nil
+}
 
-	req.Range.Start = start
-	req.Range.End = end
+// NonEmptyRetentionPolicies returns the names of the retention policies of
+// the bucket's database holding series in a shard that overlaps the range,
+// ordered by name. As with ShardCardinalities, a shard holds series if its
+// index does, so a retention policy whose series have no points in the range
+// is included. Shards that are not open on this node are ignored.
+func (s *Store) NonEmptyRetentionPolicies(ctx context.Context, orgID, bucketID uint64, start, end int64) (_ []string, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
 
-	newCursor := func() (reads.SeriesCursor, error) {
-		cur, err := newIndexSeriesCursor(ctx, req.Predicate, shards)
-		if cur == nil || err != nil {
-			return nil, err
-		}
-		return cur, nil
+	database, _, start, end, err := s.validateArgs(orgID, bucketID, start, end)
+	if err != nil {
+		return nil, err
 	}
 
-	rs := reads.NewGroupResultSet(ctx, req, newCursor)
-	if rs == nil {
-		return nil, nil
+	di := s.MetaClient.Database(database)
+	if di == nil {
+		return nil, ErrDatabaseNotFound
 	}
 
-	return rs, nil
-}
+	var names []string
+	for _, rpi := range di.RetentionPolicies {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
 
-type metaqueryAttributes struct {
-	orgID      influxdb.ID
-	db, rp     string
-	start, end int64
-	pred       influxql.Expr
+		shardIDs, err := s.findRetentionPolicyShardIDs(ctx, database, rpi.Name, false, start, end)
+		if err != nil {
+			return nil, err
+		}
+		shards, err := s.shards(ctx, shardIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sh := range shards {
+			if sh.SeriesN() > 0 {
+				names = append(names, rpi.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
-func (s *Store) tagKeysWithFieldPredicate(ctx context.Context, mqAttrs *metaqueryAttributes, shardIDs []uint64) (cursors.StringIterator, error) {
+// validatePredicate returns ErrPredicateTooComplex if the predicate
+// exceeds the configured depth or node limits. The tree is walked
+// iteratively so an excessively deep predicate cannot exhaust the stack.
+func (s *Store) validatePredicate(pred *datatypes.Predicate) error {
+	root := pred.GetRoot()
+	if root == nil || (s.MaxPredicateDepth <= 0 && s.MaxPredicateNodes <= 0) {
+		return nil
+	}
+
+	type item struct {
+		node  *datatypes.Node
+		depth int
+	}
+	stack := []item{{node: root, depth: 1}}
+	var n int
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n++
+		if s.MaxPredicateNodes > 0 && n > s.MaxPredicateNodes {
+			return ErrPredicateTooComplex
+		}
+		if s.MaxPredicateDepth > 0 && it.depth > s.MaxPredicateDepth {
+			return ErrPredicateTooComplex
+		}
+		for _, child := range it.node.Children {
+			if child != nil {
+				stack = append(stack, item{node: child, depth: it.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// checkPredicateKeys returns ErrUnknownPredicateKey, naming the key, if the
+// StrictPredicateKeys read option is set and pred references a tag key, or
+// compares _field to a field, that no measurement has in the shards of rps
+// overlapping the range.
+func (s *Store) checkPredicateKeys(ctx context.Context, pred *datatypes.Predicate, orgID uint64, database string, rps []string, start, end int64) error {
+	if opts := ReadOptionsFromContext(ctx); opts == nil || !opts.StrictPredicateKeys {
+		return nil
+	}
+	tagKeys, fields := predicateKeys(pred.GetRoot())
+	if len(tagKeys) == 0 && len(fields) == 0 {
+		return nil
+	}
+
+	knownTagKeys := make(map[string]struct{})
+	knownFields := make(map[string]struct{})
+	var found bool
+	for _, rp := range rps {
+		shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+		if err != nil {
+			return err
+		}
+		if len(shardIDs) == 0 {
+			continue
+		}
+		found = true
+
+		keys, err := s.TSDBStore.TagKeys(authorizerFromContext(ctx), shardIDs, nil)
+		if err != nil {
+			return err
+		}
+		for _, m := range keys {
+			for _, k := range m.Keys {
+				knownTagKeys[k] = struct{}{}
+			}
+		}
+
+		if len(fields) > 0 {
+			mqAttrs := &metaqueryAttributes{orgID: influxdb.ID(orgID), db: database, rp: rp, start: start, end: end}
+			itr, err := s.fieldKeysIterator(ctx, mqAttrs, shardIDs)
+			if err != nil {
+				return err
+			}
+			names, err := fieldKeysIteratorNames(itr)
+			_ = itr.Close()
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				knownFields[name] = struct{}{}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	for _, k := range tagKeys {
+		if _, ok := knownTagKeys[k]; !ok {
+			return fmt.Errorf("%w: tag key %q", ErrUnknownPredicateKey, k)
+		}
+	}
+	for _, f := range fields {
+		if _, ok := knownFields[f]; !ok {
+			return fmt.Errorf("%w: field %q", ErrUnknownPredicateKey, f)
+		}
+	}
+	return nil
+}
+
+// predicateKeys returns the tag keys referenced by the predicate rooted at
+// node, other than _measurement and _field, and the fields compared to _field
+// by = or !=, each once and in the order they are referenced.
+func predicateKeys(node *datatypes.Node) (tagKeys, fields []string) {
+	seenTagKeys := make(map[string]struct{})
+	seenFields := make(map[string]struct{})
+	var walk func(node *datatypes.Node)
+	walk = func(node *datatypes.Node) {
+		if node == nil {
+			return
+		}
+		if node.NodeType != datatypes.NodeTypeComparisonExpression {
+			for _, child := range node.Children {
+				walk(child)
+			}
+			return
+		}
+
+		var ref, lit *datatypes.Node
+		for _, child := range node.Children {
+			if child.GetNodeType() == datatypes.NodeTypeTagRef {
+				ref = child
+			} else {
+				lit = child
+			}
+		}
+		if ref == nil {
+			return
+		}
+		switch k := ref.GetTagRefValue(); {
+		case k == "_field" || k == models.FieldKeyTagKey:
+			if cmp := node.GetComparison(); cmp != datatypes.ComparisonEqual && cmp != datatypes.ComparisonNotEqual {
+				return
+			}
+			if _, ok := lit.GetValue().(*datatypes.Node_StringValue); !ok {
+				return
+			}
+			if f := lit.GetStringValue(); f != "" {
+				if _, ok := seenFields[f]; !ok {
+					seenFields[f] = struct{}{}
+					fields = append(fields, f)
+				}
+			}
+		default:
+			if _, ok := measurementRemap[k]; ok {
+				return
+			}
+			if _, ok := seenTagKeys[k]; !ok {
+				seenTagKeys[k] = struct{}{}
+				tagKeys = append(tagKeys, k)
+			}
+		}
+	}
+	walk(node)
+	return tagKeys, fields
+}
+
+// rewritePredicateNEQRequiresTag returns a copy of pred in which each != or
+// !~ comparison of a tag also requires the series to have the tag, by adding
+// a comparison of the tag to the empty string. Comparisons of the
+// measurement and field, and comparisons to the empty string, are unchanged.
+func rewritePredicateNEQRequiresTag(pred *datatypes.Predicate) *datatypes.Predicate {
+	if pred.GetRoot() == nil {
+		return pred
+	}
+	return &datatypes.Predicate{Root: rewriteNodeNEQRequiresTag(pred.Root)}
+}
+
+func rewriteNodeNEQRequiresTag(node *datatypes.Node) *datatypes.Node {
+	if node == nil {
+		return nil
+	}
+
+	if node.NodeType == datatypes.NodeTypeComparisonExpression {
+		if cmp := node.GetComparison(); cmp != datatypes.ComparisonNotEqual && cmp != datatypes.ComparisonNotRegex {
+			return node
+		}
+
+		var ref, lit *datatypes.Node
+		for _, child := range node.Children {
+			if child.GetNodeType() == datatypes.NodeTypeTagRef {
+				ref = child
+			} else {
+				lit = child
+			}
+		}
+		if ref == nil || lit == nil {
+			return node
+		}
+		if _, ok := measurementRemap[ref.GetTagRefValue()]; ok || ref.GetTagRefValue() == "_field" {
+			return node
+		}
+		if _, ok := lit.GetValue().(*datatypes.Node_StringValue); ok && lit.GetStringValue() == "" {
+			return node
+		}
+
+		return &datatypes.Node{
+			NodeType: datatypes.NodeTypeLogicalExpression,
+			Value:    &datatypes.Node_Logical_{Logical: datatypes.LogicalAnd},
+			Children: []*datatypes.Node{
+				node,
+				{
+					NodeType: datatypes.NodeTypeComparisonExpression,
+					Value:    &datatypes.Node_Comparison_{Comparison: datatypes.ComparisonNotEqual},
+					Children: []*datatypes.Node{
+						ref,
+						{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_StringValue{StringValue: ""}},
+					},
+				},
+			},
+		}
+	}
+
+	children := make([]*datatypes.Node, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = rewriteNodeNEQRequiresTag(child)
+	}
+	return &datatypes.Node{NodeType: node.NodeType, Value: node.Value, Children: children}
+}
+
+func (s *Store) validateArgs(orgID, bucketID uint64, start, end int64) (string, string, int64, int64, error) {
+	database, err := s.databaseName(orgID, bucketID)
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	rp := meta.DefaultRetentionPolicyName
+
+	di := s.MetaClient.Database(database)
+	if di == nil {
+		return "", "", 0, 0, ErrDatabaseNotFound
+	}
+
+	rpi := di.RetentionPolicy(rp)
+	if rpi == nil {
+		return "", "", 0, 0, ErrRetentionPolicyNotFound
+	}
+
+	r := s.resolveRange(start, end)
+	if r.start > r.end {
+		return "", "", 0, 0, fmt.Errorf("%w: start %d is after end %d", ErrInvalidRange, r.start, r.end)
+	}
+	return database, rp, r.start, r.end, nil
+}
+
+// timeRange is the range read by a request, with the bounds left unset by the
+// request substituted.
+type timeRange struct {
+	start, end int64
+
+	// startSet and endSet report whether the request set the start or end
+	// explicitly, including to models.MinNanoTime or models.MaxNanoTime.
+	startSet, endSet bool
+}
+
+// unset reports whether the request set neither a start nor an end.
+func (r timeRange) unset() bool { return !r.startSet && !r.endSet }
+
+// now returns the current time of the clock of the store.
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// databaseName returns the name of the database holding the bucket, as
+// resolved by DatabaseNameFn.
+func (s *Store) databaseName(orgID, bucketID uint64) (string, error) {
+	if s.DatabaseNameFn != nil {
+		return s.DatabaseNameFn(orgID, bucketID)
+	}
+	return influxdb.ID(bucketID).String(), nil
+}
+
+// resolveRange resolves the range of a request. A start or end of 0 or less
+// is unset, with the exception of the models.MinNanoTime sentinel, which
+// explicitly sets the start of the entire time range. An unset start is
+// replaced by models.MinNanoTime and an unset end by models.MaxNanoTime,
+// unless both are unset and DefaultRange applies. Bounds beyond the
+// sentinels are clamped to them.
+func (s *Store) resolveRange(start, end int64) timeRange {
+	r := timeRange{
+		start:    start,
+		end:      end,
+		startSet: start > 0 || start <= models.MinNanoTime,
+		endSet:   end > 0,
+	}
+
+	if r.unset() && s.DefaultRange > 0 {
+		r.end = s.now().UnixNano()
+		r.start = r.end - int64(s.DefaultRange)
+		return r
+	}
+	if !r.startSet || r.start < models.MinNanoTime {
+		r.start = models.MinNanoTime
+	}
+	if !r.endSet || r.end > models.MaxNanoTime {
+		r.end = models.MaxNanoTime
+	}
+	return r
+}
+
+// ReadFilter returns a result set producing an entry for each series and
+// field matching the request. The tags of an entry are reported once by Tags,
+// and its points are read as arrays of timestamps and values from the cursor
+// returned by Cursor, so the tags are not repeated for each point. A read
+// selecting no shards or series returns an empty result set, never nil, so
+// that only failures return an error.
+func (s *Store) ReadFilter(ctx context.Context, req *datatypes.ReadFilterRequest) (_ reads.ResultSet, err error) {
+	defer s.metrics.record("read_filter")(&err)
+
+	return s.readFilter(ctx, req, nil)
+}
+
+// readFilter serves ReadFilter, resolving the shards of the read through sets
+// if it is not nil.
+func (s *Store) readFilter(ctx context.Context, req *datatypes.ReadFilterRequest, sets shardSets) (_ reads.ResultSet, err error) {
+	span, ctx := startSpan(ctx, "ReadFilter")
+	defer finishSpan(span, &err)
+
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer func() { deadline.done(&err) }()
+
+	if err := s.checkRateLimit("ReadFilter"); err != nil {
+		return nil, err
+	}
+
+	if req.ReadSource == nil {
+		return nil, ErrMissingReadSource
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if err := opts.validateReadFilter(req); err != nil {
+		return nil, err
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return nil, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return nil, err
+	}
+	setSpanSource(ctx, database, rp)
+
+	rps := []string{rp}
+	if opts != nil && len(opts.RetentionPolicies) > 0 {
+		rps = opts.RetentionPolicies
+	}
+	if err := s.checkPredicateKeys(ctx, req.Predicate, source.OrganizationID, database, rps, start, end); err != nil {
+		return nil, err
+	}
+
+	pred := req.Predicate
+	if opts != nil && opts.NEQRequiresTag {
+		pred = rewritePredicateNEQRequiresTag(pred)
+	}
+	setSpanReadPath(ctx, pred)
+
 	var cur reads.SeriesCursor
-	if ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, s.TSDBStore.Shards(shardIDs)); err != nil {
+	var shards []*tsdb.Shard
+	if opts != nil && len(opts.RetentionPolicies) > 0 {
+		rc, err := s.newRetentionPolicySeriesCursor(ctx, pred, database, start, end, opts)
+		if err != nil {
+			return nil, err
+		} else if rc == nil {
+			return newEmptyFilterResultSet(), nil
+		}
+		cur = rc
+		shards = rc.shards
+		setSpanTag(ctx, spanTagShards, len(shards))
+	} else {
+		var shardIDs []uint64
+		shardIDs, shards, err = sets.resolve(ctx, s, shardSetKey{database: database, rp: rp, desc: req.Descending, start: start, end: end})
+		if err != nil {
+			return nil, err
+		}
+		setSpanTag(ctx, spanTagShards, len(shardIDs))
+		if len(shardIDs) == 0 {
+			return newEmptyFilterResultSet(), nil
+		}
+
+		if s.ParallelShardScans > 1 && len(shardIDs) > 1 {
+			pc, err := newParallelSeriesCursor(ctx, pred, shards, s.ParallelShardScans, opts)
+			if err != nil {
+				return nil, err
+			} else if pc == nil {
+				return newEmptyFilterResultSet(), nil
+			}
+			cur = pc
+		} else if ic, err := newIndexSeriesCursor(ctx, pred, shards); err != nil {
+			return nil, err
+		} else if ic == nil {
+			return newEmptyFilterResultSet(), nil
+		} else {
+			ic.applyReadOptions(opts)
+			cur = ic
+		}
+
+		// The index may be shared with the other retention policies of the
+		// database, so the series without points in a fallback are skipped.
+		if s.readsFallback(rp, shardIDs) {
+			cur = &dataSeriesCursor{
+				SeriesCursor: cur,
+				ctx:          ctx,
+				req:          cursors.CursorRequest{Ascending: true, StartTime: start, EndTime: end},
+			}
+		}
+	}
+
+	req.Range.Start = start
+	req.Range.End = end
+
+	var coerce *coercion
+	if opts != nil && len(opts.CoerceFields) > 0 {
+		coerce = &coercion{types: opts.CoerceFields}
+		cur = &coerceSeriesCursor{SeriesCursor: cur, coerce: coerce}
+	}
+
+	rs := reads.NewFilteredResultSetOrder(ctx, req.Range.Start, req.Range.End, !req.Descending, cur)
+	rs = &releaseResultSet{ResultSet: rs, release: release}
+	release = nil
+	rs = &contextResultSet{ResultSet: rs, ctx: ctx}
+	if deadline != nil {
+		rs = &deadlineResultSet{ResultSet: rs, deadline: deadline}
+		deadline = nil
+	}
+	switch cur.(type) {
+	case *retentionPolicySeriesCursor, *parallelSeriesCursor, *dataSeriesCursor, *coerceSeriesCursor:
+		rs = &seriesCursorResultSet{ResultSet: rs, cur: cur}
+	case *indexSeriesCursor:
+		if opts != nil && opts.MaxPredicateEvalTime > 0 {
+			rs = &seriesCursorResultSet{ResultSet: rs, cur: cur}
+		}
+	}
+	if opts != nil && opts.DuplicateTimestamps != DuplicateTimestampsKeep {
+		rs = &dedupResultSet{ResultSet: rs, keepLast: opts.DuplicateTimestamps == DuplicateTimestampsLast}
+	}
+	var gaps *gapRecorder
+	if opts != nil && opts.GapThreshold > 0 {
+		gaps = &gapRecorder{threshold: int64(opts.GapThreshold), offset: int64(opts.TimeShift)}
+		rs = &gapResultSet{ResultSet: rs, gaps: gaps, only: opts.GapsOnly}
+	}
+	if opts != nil && opts.MaxPointsPerSeries > 0 {
+		rs = &decimateResultSet{ResultSet: rs, max: int64(opts.MaxPointsPerSeries)}
+	}
+	if opts != nil && opts.TimeShift != 0 {
+		rs = &timeShiftResultSet{ResultSet: rs, offset: int64(opts.TimeShift)}
+	}
+	if req.SeriesPointLimit > 0 || req.PointLimit > 0 {
+		rs = &pointLimitResultSet{ResultSet: rs, perSeries: req.SeriesPointLimit, total: req.PointLimit}
+	}
+	if opts != nil && opts.MaxStringLength > 0 {
+		rs = &stringTruncateResultSet{ResultSet: rs, max: opts.MaxStringLength}
+	}
+	if opts != nil && opts.MaxResponseBytes > 0 {
+		rs = newSizeLimitResultSet(rs, opts.MaxResponseBytes, opts.FailOnMaxResponseBytes)
+	}
+	if opts != nil && opts.CountFieldPoints {
+		rs = &fieldCountResultSet{ResultSet: rs, counts: make(map[string]*int64)}
+	}
+	return &fieldTypeResultSet{
+		ResultSet: rs,
+		shards:    shards,
+		coerce:    coerce,
+		gaps:      gaps,
+		gapsOnly:  gaps != nil && opts.GapsOnly,
+	}, nil
+}
+
+// Prefetch warms the caches read by a subsequent ReadFilter of req, without
+// reading any points. For each shard of the request, it reads the series and
+// fields matching the predicate from the index, and opens the cursor of the
+// first series. The cursors are closed before Prefetch returns. ctx is checked
+// before each shard, and a *ContextError is returned once it is done.
+func (s *Store) Prefetch(ctx context.Context, req *datatypes.ReadFilterRequest) (err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("Prefetch"); err != nil {
+		return err
+	}
+
+	if req.ReadSource == nil {
+		return ErrMissingReadSource
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil {
+		return err
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, sh := range shards {
+		if err := checkContext(ctx); err != nil {
+			return err
+		}
+		if err := prefetchShard(ctx, req.Predicate, sh, start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Warm opens the shards of the bucket selected for the range and creates a
+// series cursor over their index, which is closed without reading any series,
+// so that the first read of a cold bucket does not pay for opening them. Warm
+// may be called concurrently and repeatedly, as shards already open are not
+// opened again. ctx is checked before the shards are opened, and a
+// *ContextError is returned once it is done.
+func (s *Store) Warm(ctx context.Context, orgID, bucketID uint64, start, end int64) (err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	database, rp, start, end, err := s.validateArgs(orgID, bucketID, start, end)
+	if err != nil {
+		return err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil || len(shardIDs) == 0 {
+		return err
+	}
+
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return err
+	}
+
+	ic, err := newIndexSeriesCursor(ctx, nil, shards)
+	if err != nil {
+		return err
+	}
+	if ic != nil {
+		ic.Close()
+	}
+	return nil
+}
+
+// BucketHasData reports whether the bucket has shards selected for the range,
+// from the meta data alone, without opening the shards. It is a cheap probe
+// before a read: a shard may hold no points in the range, but a read of a
+// range without shards returns no data. It fails with ErrDatabaseNotFound if
+// the bucket does not exist.
+func (s *Store) BucketHasData(ctx context.Context, orgID, bucketID uint64, start, end int64) (_ bool, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	database, rp, start, end, err := s.validateArgs(orgID, bucketID, start, end)
+	if err != nil {
+		return false, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil {
+		return false, err
+	}
+	return len(shardIDs) > 0, nil
+}
+
+// EstimateBytes returns an estimate of the number of bytes of TSM blocks a
+// ReadFilter of req would read, without reading them. It sums the sizes
+// recorded in the TSM index of the blocks of the matching series and fields
+// that overlap the range, honoring the read options that select series and
+// fields. The estimate is an upper bound of the blocks read from disk:
+// blocks partially in the range, or holding points excluded by a field value
+// predicate or partially deleted, are counted in full. Points that have not
+// yet been written to a TSM file are read from memory and are not counted.
+func (s *Store) EstimateBytes(ctx context.Context, req *datatypes.ReadFilterRequest) (_ int64, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+	if err := s.checkRateLimit("EstimateBytes"); err != nil {
+		return 0, err
+	}
+
+	if req.ReadSource == nil {
+		return 0, ErrMissingReadSource
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return 0, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return 0, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return 0, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sh := range shards {
+		size, err := estimateShardBytes(ctx, req.Predicate, sh, start, end, opts)
+		if err != nil {
+			return 0, err
+		}
+		n += size
+	}
+	return n, nil
+}
+
+// estimateShardBytes returns the size of the TSM blocks of sh overlapping the
+// range of the series and fields matching predicate.
+func estimateShardBytes(ctx context.Context, predicate *datatypes.Predicate, sh *tsdb.Shard, start, end int64, opts *ReadOptions) (int64, error) {
+	eng, err := sh.Engine()
+	if err != nil {
+		return 0, err
+	}
+	e, ok := eng.(*tsm1.Engine)
+	if !ok {
+		return 0, nil
+	}
+
+	ic, err := newIndexSeriesCursor(ctx, predicate, []*tsdb.Shard{sh})
+	if err != nil || ic == nil {
+		return 0, err
+	}
+	defer ic.Close()
+	ic.applyReadOptions(opts)
+
+	var n int64
+	var key []byte
+	for row := ic.Next(); row != nil; row = ic.Next() {
+		if err := checkContext(ctx); err != nil {
+			return 0, err
+		}
+		key = models.AppendMakeKey(key[:0], row.Name, row.SeriesTags)
+		key = append(key, fieldKeySeparator...)
+		key = append(key, row.Field...)
+		n += e.FileStore.Cost(key, start, end).BlockSize
+	}
+	return n, ic.Err()
+}
+
+// prefetchShard opens and closes the cursor of the first series of sh
+// matching predicate.
+func prefetchShard(ctx context.Context, predicate *datatypes.Predicate, sh *tsdb.Shard, start, end int64) error {
+	ic, err := newIndexSeriesCursor(ctx, predicate, []*tsdb.Shard{sh})
+	if err != nil || ic == nil {
+		return err
+	}
+	defer ic.Close()
+
+	row := ic.Next()
+	if row == nil {
+		return ic.Err()
+	}
+	req := &cursors.CursorRequest{
+		Name:      row.Name,
+		Tags:      row.SeriesTags,
+		Field:     row.Field,
+		Ascending: true,
+		StartTime: start,
+		EndTime:   end,
+	}
+	for _, itr := range row.Query {
+		cur, err := itr.Next(ctx, req)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			cur.Close()
+		}
+	}
+	return nil
+}
+
+// ReadPointCounts returns the number of points in the requested range for
+// each series and field matching req. Points are counted from the array
+// cursors without retaining their values. The result is keyed by the series
+// key and field name, joined by the TSM field separator; for example
+// "cpu,host=a#!~#usage".
+func (s *Store) ReadPointCounts(ctx context.Context, req *datatypes.ReadFilterRequest) (map[string]int64, error) {
+	rs, err := s.ReadFilter(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	counts := make(map[string]int64)
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		n, err := cursorCount(c)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			counts[seriesFieldKey(rs.Tags())] += n
+		}
+	}
+	return counts, rs.Err()
+}
+
+// ReadSeriesCardinality returns the number of series matching the predicate
+// of req in the shards overlapping its range. The series are counted from
+// the index without reading their points, so the count is exact for the
+// shards but includes series without points in the range. A series is
+// counted if any of its fields matches the predicate, and a series held by
+// several shards is counted once.
+func (s *Store) ReadSeriesCardinality(ctx context.Context, req *datatypes.ReadFilterRequest) (_ int64, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+	if err := s.checkRateLimit("ReadSeriesCardinality"); err != nil {
+		return 0, err
+	}
+
+	if req.ReadSource == nil {
+		return 0, ErrMissingReadSource
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return 0, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return 0, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return 0, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil || len(shardIDs) == 0 {
+		return 0, err
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	ic, err := newIndexSeriesCursor(ctx, req.Predicate, shards)
+	if err != nil || ic == nil {
+		return 0, err
+	}
+	defer ic.Close()
+
+	// The rows of the fields of a series are consecutive.
+	var (
+		n         int64
+		key, prev []byte
+	)
+	for row := ic.Next(); row != nil; row = ic.Next() {
+		if err := checkContext(ctx); err != nil {
+			return 0, err
+		}
+		key = models.AppendMakeKey(key[:0], row.Name, row.SeriesTags)
+		if !bytes.Equal(key, prev) {
+			n++
+			key, prev = prev, key
+		}
+	}
+	return n, ic.Err()
+}
+
+// EmptySeries returns the keys of the series matching the predicate of req
+// that have no points within its range, ordered by key. Such series are held
+// by the index of the shards overlapping the range, but their points fall
+// outside it or were deleted, so they are candidates for deletion. A series
+// is only reported if none of its fields have points in the range. Each key
+// excludes the field and is in the escaped form of line protocol, such as
+// "cpu,host=a,region=east". Determining the series requires a block scan,
+// which stops at the first point of each series and field.
+func (s *Store) EmptySeries(ctx context.Context, req *datatypes.ReadFilterRequest) (_ cursors.StringIterator, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+	if err := s.checkRateLimit("EmptySeries"); err != nil {
+		return nil, err
+	}
+
+	if req.ReadSource == nil {
+		return nil, ErrMissingReadSource
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return nil, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return nil, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return cursors.EmptyStringIterator, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ic, err := newIndexSeriesCursor(ctx, req.Predicate, shards)
+	if err != nil {
+		return nil, err
+	} else if ic == nil {
+		return cursors.EmptyStringIterator, nil
+	}
+
+	rs := reads.NewFilteredResultSet(ctx, start, end, ic)
+	defer rs.Close()
+
+	// hasData records whether each series has points of any field.
+	hasData := make(map[string]bool)
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		name, _, st := splitSeriesTags(rs.Tags())
+		key := string(models.MakeKey(name, st))
+		if hasData[key] {
+			continue
+		}
+
+		var ok bool
+		if c := rs.Cursor(); c != nil {
+			var err error
+			ok, err = cursorHasData(c)
+			c.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		hasData[key] = ok
+	}
+	if err := ic.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, ok := range hasData {
+		if !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return cursors.NewStringSliceIterator(keys), nil
+}
+
+// seriesFieldKey returns the series key and field name for tags produced by
+// an indexSeriesCursor, joined by fieldKeySeparator.
+func seriesFieldKey(tags models.Tags) string {
+	name, field, st := splitSeriesTags(tags)
+	key := models.AppendMakeKey(nil, name, st)
+	key = append(key, fieldKeySeparator...)
+	key = append(key, field...)
+	return string(key)
+}
+
+// splitSeriesTags returns the measurement and field of tags produced by an
+// indexSeriesCursor, and the remaining tags of the series.
+func splitSeriesTags(tags models.Tags) (name, field []byte, st models.Tags) {
+	name = tags.Get(measurementKeyBytes)
+	field = tags.Get(fieldKeyBytes)
+	st = make(models.Tags, 0, len(tags))
+	for _, t := range tags {
+		if bytes.Equal(t.Key, measurementKeyBytes) || bytes.Equal(t.Key, fieldKeyBytes) {
+			continue
+		}
+		st = append(st, t)
+	}
+	return name, field, st
+}
+
+// ReadGroup returns a result set producing the groups of the series and fields
+// matching the request. Like ReadFilter, a read selecting no shards or series
+// returns an empty result set rather than nil.
+func (s *Store) ReadGroup(ctx context.Context, req *datatypes.ReadGroupRequest) (_ reads.GroupResultSet, err error) {
+	defer s.metrics.record("read_group")(&err)
+
+	span, ctx := startSpan(ctx, "ReadGroup")
+	defer finishSpan(span, &err)
+
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer func() { deadline.done(&err) }()
+
+	if err := s.checkRateLimit("ReadGroup"); err != nil {
+		return nil, err
+	}
+
+	if req.ReadSource == nil {
+		return nil, ErrMissingReadSource
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if err := opts.validateReadGroup(req); err != nil {
+		return nil, err
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return nil, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return nil, err
+	}
+	setSpanSource(ctx, database, rp)
+	setSpanReadPath(ctx, req.Predicate)
+	if err := s.checkPredicateKeys(ctx, req.Predicate, source.OrganizationID, database, []string{rp}, start, end); err != nil {
+		return nil, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, database, rp, false, start, end)
+	if err != nil {
+		return nil, err
+	}
+	setSpanTag(ctx, spanTagShards, len(shardIDs))
+	if len(shardIDs) == 0 {
+		return emptyGroupResultSet{}, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Range.Start = start
+	req.Range.End = end
+
+	var aliases map[string]string
+	if opts != nil && len(opts.TagKeyAliases) > 0 {
+		aliases = opts.TagKeyAliases
+
+		// The group keys are read from the emitted tags, which are renamed.
+		// The keys of the caller's request are left unchanged.
+		keys := make([]string, len(req.GroupKeys))
+		for i, k := range req.GroupKeys {
+			if alias, ok := aliases[k]; ok {
+				k = alias
+			}
+			keys[i] = k
+		}
+		r := *req
+		r.GroupKeys = keys
+		req = &r
+	}
+
+	newCursor := func() (reads.SeriesCursor, error) {
+		cur, err := newIndexSeriesCursor(ctx, req.Predicate, shards)
+		if cur == nil || err != nil {
+			return nil, err
+		}
+		cur.aliasTagKeys(aliases)
+		return cur, nil
+	}
+
+	var groupOpts []reads.GroupOption
+	if opts != nil && opts.GroupOrder == GroupOrderKeyNilFirst {
+		groupOpts = append(groupOpts, reads.GroupOptionNilSortLo())
+	}
+
+	var rs reads.GroupResultSet = reads.NewGroupResultSet(ctx, req, newCursor, groupOpts...)
+	if rs == nil {
+		return emptyGroupResultSet{}, nil
+	}
+	rs = &releaseGroupResultSet{GroupResultSet: rs, release: release}
+	release = nil
+	rs = &contextGroupResultSet{GroupResultSet: rs, ctx: ctx}
+	if deadline != nil {
+		// The bound is released by the result set once it is returned, and
+		// by ReadGroup until then.
+		rs = &deadlineGroupResultSet{GroupResultSet: rs, deadline: deadline}
+	}
+
+	if opts != nil && opts.GroupTopN > 0 {
+		selected, err := groupTopNSeries(ctx, req, newCursor, opts)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		rs = &topNGroupResultSet{GroupResultSet: rs, selected: selected}
+	}
+
+	if opts != nil && opts.TimeOfDayBucket > 0 {
+		loc := opts.TimeOfDayLocation
+		if loc == nil {
+			loc = time.UTC
+		}
+		rs = &timeOfDayGroupResultSet{
+			GroupResultSet: rs,
+			width:          opts.TimeOfDayBucket,
+			bucket:         timeOfDayBucket(opts.TimeOfDayBucket, loc),
+		}
+	}
+
+	if opts != nil && opts.GroupSeriesTags > 0 {
+		groups, err := groupSeriesTags(ctx, req, newCursor, opts.GroupSeriesTags)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		deadline = nil
+		return &seriesTagsGroupResultSet{GroupResultSet: rs, groups: groups}, nil
+	}
+	deadline = nil
+	return rs, nil
+}
+
+type metaqueryAttributes struct {
+	orgID      influxdb.ID
+	db, rp     string
+	start, end int64
+	pred       influxql.Expr
+
+	// measurements, when not nil, restricts the block scans of
+	// tagValuesSlowSets to the series of the named measurements, which
+	// are sorted.
+	measurements [][]byte
+
+	// limit is the Limit of a TagValues request, retaining the least values
+	// of the tag key.
+	limit int
+
+	// offset is the Offset of a TagValues request, skipping the least names
+	// returned by MeasurementNames.
+	offset int
+}
+
+func (s *Store) tagKeysWithFieldPredicate(ctx context.Context, mqAttrs *metaqueryAttributes, shardIDs []uint64) (cursors.StringIterator, error) {
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var cur reads.SeriesCursor
+	if ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards); err != nil {
+		return nil, err
+	} else if ic == nil {
+		return cursors.EmptyStringIterator, nil
+	} else {
+		cur = ic
+	}
+	m := make(map[string]struct{})
+	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, cur)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		err := func() error {
+			c := rs.Cursor()
+			if c == nil {
+				// no data for series key + field combination
+				return nil
+			}
+			defer c.Close()
+			hasData, err := cursorHasData(c)
+			if hasData {
+				tags := rs.Tags()
+				for i := range tags {
+					m[string(tags[i].Key)] = struct{}{}
+				}
+			}
+			return err
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	arr := make([]string, 0, len(m))
+	for tag := range m {
+		arr = append(arr, tag)
+	}
+	sort.Strings(arr)
+	return cursors.NewStringSliceIterator(arr), nil
+}
+
+// TagKeysForField returns the tag keys of the series matching the predicate
+// of req that have points of the named field in its range, ordered by key.
+// As with TagKeys, the _measurement and _field keys are included. A tag key
+// is only returned if it is written by a series with the field, so a key
+// appearing only on series of the measurement lacking the field is omitted.
+// The field is not indexed with the tags, so the series are found by a block
+// scan.
+func (s *Store) TagKeysForField(ctx context.Context, req *datatypes.TagKeysRequest, field string) (_ cursors.StringIterator, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("TagKeysForField"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.tagKeysForField(ctx, mqAttrs, field)
+}
+
+func (s *Store) tagKeysForField(ctx context.Context, mqAttrs *metaqueryAttributes, field string) (cursors.StringIterator, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return cursors.EmptyStringIterator, nil
+	}
+
+	var pred influxql.Expr = &influxql.BinaryExpr{
+		Op:  influxql.EQ,
+		LHS: &influxql.VarRef{Val: fieldKey},
+		RHS: &influxql.StringLiteral{Val: field},
+	}
+	if mqAttrs.pred != nil {
+		pred = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: pred,
+			RHS: &influxql.ParenExpr{Expr: mqAttrs.pred},
+		}
+	}
+
+	attrs := *mqAttrs
+	attrs.pred = pred
+	return s.tagKeysWithFieldPredicate(ctx, &attrs, shardIDs)
+}
+
+func (s *Store) TagKeys(ctx context.Context, req *datatypes.TagKeysRequest) (_ cursors.StringIterator, err error) {
+	defer s.metrics.record("tag_keys")(&err)
+
+	span, ctx := startSpan(ctx, "TagKeys")
+	defer finishSpan(span, &err)
+
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("TagKeys"); err != nil {
+		return nil, err
+	}
+
+	if req.TagsSource == nil {
+		return nil, ErrMissingReadSource
+	}
+	source, err := getReadSource(*req.TagsSource)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return nil, err
+	}
+	db, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return nil, err
+	}
+	setSpanSource(ctx, db, rp)
+	if err := s.checkPredicateKeys(ctx, req.Predicate, source.OrganizationID, db, []string{rp}, start, end); err != nil {
+		return nil, err
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, db, rp, false, start, end)
+	if err != nil {
+		return nil, err
+	}
+	setSpanTag(ctx, spanTagShards, len(shardIDs))
+	if len(shardIDs) == 0 {
+		return limitTagKeys(ctx, cursors.EmptyStringIterator), nil
+	}
+
+	var expr influxql.Expr
+	if root := req.Predicate.GetRoot(); root != nil {
+		var err error
+		expr, err = reads.NodeToExpr(root, measurementRemap)
+		if err != nil {
+			return nil, err
+		}
+
+		if found := reads.HasFieldValueKey(expr); found {
+			return nil, errors.New("field values unsupported")
+		}
+		if found := reads.ExprHasKey(expr, fieldKey); found {
+			mqAttrs := &metaqueryAttributes{
+				orgID: source.GetOrgID(),
+				db:    db,
+				rp:    rp,
+				start: start,
+				end:   end,
+				pred:  expr,
+			}
+			setSpanTag(ctx, spanTagSlowPath, true)
+			itr, err := s.tagKeysWithFieldPredicate(ctx, mqAttrs, shardIDs)
+			if err != nil {
+				return nil, err
+			}
+			return limitTagKeys(ctx, itr), nil
+		}
+		expr = influxql.Reduce(influxql.CloneExpr(expr), nil)
+		if reads.IsTrueBooleanLiteral(expr) {
+			expr = nil
+		}
+	}
+
+	setSpanTag(ctx, spanTagSlowPath, false)
+	auth := authorizerFromContext(ctx)
+	keys, err := s.TSDBStore.TagKeys(auth, shardIDs, expr)
+	if err != nil {
+		return cursors.EmptyStringIterator, err
+	}
+
+	m := map[string]bool{
+		measurementKey: true,
+		fieldKey:       true,
+	}
+	for _, ks := range keys {
+		for _, k := range ks.Keys {
+			m[k] = true
+		}
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return limitTagKeys(ctx, cursors.NewStringSliceIterator(names)), nil
+}
+
+// limitTagKeys returns an iterator over the least sorted keys of itr selected
+// by the TagKeysLimit read option, or itr if it is not set.
+func limitTagKeys(ctx context.Context, itr cursors.StringIterator) cursors.StringIterator {
+	opts := ReadOptionsFromContext(ctx)
+	if opts == nil || opts.TagKeysLimit <= 0 {
+		return itr
+	}
+
+	keys := cursors.StringIteratorToSlice(itr)
+	var truncated bool
+	if len(keys) > opts.TagKeysLimit {
+		keys, truncated = keys[:opts.TagKeysLimit], true
+	}
+	return &truncatedStringIterator{StringSliceIterator: cursors.NewStringSliceIterator(keys), truncated: truncated}
+}
+
+func (s *Store) TagValues(ctx context.Context, req *datatypes.TagValuesRequest) (_ cursors.StringIterator, err error) {
+	defer s.metrics.record("tag_values")(&err)
+
+	span, ctx := startSpan(ctx, "TagValues")
+	defer finishSpan(span, &err)
+
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("TagValues"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	setSpanSource(ctx, mqAttrs.db, mqAttrs.rp)
+
+	tagKey, ok := measurementRemap[req.TagKey]
+	if !ok {
+		tagKey = req.TagKey
+	}
+
+	if req.CountOnly {
+		n, err := s.tagValuesCardinality(ctx, mqAttrs, tagKey)
+		if err != nil {
+			return nil, err
+		}
+		return &countStringIterator{StringIterator: cursors.EmptyStringIterator, count: n}, nil
+	}
+	return s.tagValuesOfKey(ctx, mqAttrs, tagKey)
+}
+
+// tagValuesOfKey returns the values of tagKey served by TagValues.
+func (s *Store) tagValuesOfKey(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
+	// Getting values of _measurement or _field are handled specially
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.V1Compat {
+		switch tagKey {
+		case "_name", "_field":
+			return s.tagValuesV1(ctx, mqAttrs, tagKey)
+		}
+	}
+
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.SortTagValuesByRecency {
+		return s.tagValuesByRecency(ctx, mqAttrs, tagKey)
+	}
+
+	switch tagKey {
+	case "_name":
+		return s.MeasurementNames(ctx, mqAttrs)
+
+	case "_field":
+		return s.measurementFields(ctx, mqAttrs)
+	}
+
+	return s.tagValues(ctx, mqAttrs, tagKey)
+}
+
+// TagValuesForKeys returns the values of each of the TagKeys of req, in the
+// same order. The shards are resolved and the index is queried once for all
+// keys, or, when the predicate references _field, a single block scan is
+// performed, rather than once by each of several TagValues requests. The
+// _measurement and _field keys are served as by TagValues. The TagKey of req
+// is ignored.
+//
+// When the Limit of req is greater than 0, each key is limited to its first
+// Limit values after sorting and Truncated reports if any were dropped.
+func (s *Store) TagValuesForKeys(ctx context.Context, req *datatypes.TagValuesRequest) (_ []TagKeyValues, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+	if err := s.checkRateLimit("TagValuesForKeys"); err != nil {
+		return nil, err
+	}
+	if len(req.TagKeys) == 0 {
+		return nil, errors.New("missing tag keys")
+	}
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.tagValuesForKeys(ctx, mqAttrs, req.TagKeys, int(req.Limit))
+}
+
+// TagValuesCardinality returns the number of distinct values of the tag key of
+// req, as returned by TagValues, without sorting them or reporting them as
+// strings. The values of a tag key are accumulated by the index, or by a
+// block scan if the predicate references _field, and are subject to the same
+// Limit and read options, MaxDistinctValues included. The values of
+// _measurement and _field, and of a request using SortTagValuesByRecency or
+// V1Compat, are not accumulated in a set, and are counted as TagValues
+// produces them. The CountOnly of req is ignored.
+func (s *Store) TagValuesCardinality(ctx context.Context, req *datatypes.TagValuesRequest) (_ int64, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+	if err := s.checkRateLimit("TagValuesCardinality"); err != nil {
+		return 0, err
+	}
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	tagKey, ok := measurementRemap[req.TagKey]
+	if !ok {
+		tagKey = req.TagKey
+	}
+	return s.tagValuesCardinality(ctx, mqAttrs, tagKey)
+}
+
+// tagValuesCardinality returns the number of values of tagKey served by
+// TagValuesCardinality.
+func (s *Store) tagValuesCardinality(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (int64, error) {
+	if opts := ReadOptionsFromContext(ctx); tagKey == "_name" || tagKey == "_field" ||
+		(opts != nil && (opts.SortTagValuesByRecency || opts.V1Compat)) {
+		itr, err := s.tagValuesOfKey(ctx, mqAttrs, tagKey)
+		if err != nil {
+			return 0, err
+		}
+		var n int64
+		for itr.Next() {
+			n++
+		}
+		return n, nil
+	}
+
+	set, truncated, err := s.tagValueSet(ctx, mqAttrs, tagKey)
+	if err != nil {
+		return 0, err
+	}
+	if opts := ReadOptionsFromContext(ctx); truncated && opts != nil && opts.FailOnMaxDistinctValues {
+		return 0, ErrTooManyDistinctValues
+	}
+	return int64(newValueLimit(ctx, mqAttrs).count(set)), nil
+}
+
+// tagValuesRequestAttrs validates req and returns the attributes of the
+// metaquery it requests, with a function releasing the read reserved for
+// the organization, which must be called once the request is served.
+func (s *Store) tagValuesRequestAttrs(ctx context.Context, req *datatypes.TagValuesRequest) (*metaqueryAttributes, func(), error) {
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Limit > 0 {
+		mqAttrs.limit = int(req.Limit)
+	}
+	if req.Offset > 0 {
+		mqAttrs.offset = int(req.Offset)
+	}
+	return mqAttrs, release, nil
+}
+
+// metaqueryRequestAttrs validates the source, range and predicate of a
+// metaquery request and returns its attributes, as tagValuesRequestAttrs
+// does.
+func (s *Store) metaqueryRequestAttrs(ctx context.Context, tagsSource *types.Any, rng datatypes.TimestampRange, predicate *datatypes.Predicate) (_ *metaqueryAttributes, _ func(), err error) {
+	if tagsSource == nil {
+		return nil, nil, ErrMissingReadSource
+	}
+
+	source, err := getReadSource(*tagsSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	if err := s.validatePredicate(predicate); err != nil {
+		return nil, nil, err
+	}
+
+	db, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, rng.Start, rng.End)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkPredicateKeys(ctx, predicate, source.OrganizationID, db, []string{rp}, start, end); err != nil {
+		return nil, nil, err
+	}
+
+	pred := predicate
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.NEQRequiresTag {
+		pred = rewritePredicateNEQRequiresTag(pred)
+	}
+
+	var influxqlPred influxql.Expr
+	if root := pred.GetRoot(); root != nil {
+		var err error
+		influxqlPred, err = reads.NodeToExpr(root, measurementRemap)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if found := reads.HasFieldValueKey(influxqlPred); found {
+			return nil, nil, errors.New("field values unsupported")
+		}
+
+		if opts := ReadOptionsFromContext(ctx); opts != nil && len(opts.CaseInsensitiveTagKeys) > 0 {
+			influxqlPred = rewriteExprCaseInsensitive(influxqlPred, opts.CaseInsensitiveTagKeys)
+		}
+
+		influxqlPred = influxql.Reduce(influxql.CloneExpr(influxqlPred), nil)
+		if reads.IsTrueBooleanLiteral(influxqlPred) {
+			influxqlPred = nil
+		}
+	}
+
+	mqAttrs := &metaqueryAttributes{
+		orgID: source.GetOrgID(),
+		db:    db,
+		rp:    rp,
+		start: start,
+		end:   end,
+		pred:  influxqlPred,
+	}
+	return mqAttrs, release, nil
+}
+
+func (s *Store) tagValues(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
+	set, truncated, err := s.tagValueSet(ctx, mqAttrs, tagKey)
+	if err != nil {
+		return nil, err
+	}
+	return distinctValuesIterator(ctx, newValueLimit(ctx, mqAttrs).values(set), truncated)
+}
+
+// tagValueSet returns the distinct values of tagKey served by tagValues,
+// before they are sorted, and whether any were ignored because of
+// MaxDistinctValues.
+func (s *Store) tagValueSet(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (map[string]struct{}, bool, error) {
+	// If there are any references to _field, we need to use the slow path
+	// since we cannot rely on the index alone.
+	if mqAttrs.pred != nil {
+		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
+			s.metrics.tagValuesPath(tagValuesPathScan)
+			setSpanTag(ctx, spanTagSlowPath, true)
+			return s.tagValueSetSlow(ctx, mqAttrs, tagKey)
+		}
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, false, err
+	}
+	// The index may be shared with the other retention policies of the
+	// database, so a fallback is scanned for the values with points.
+	if s.readsFallback(mqAttrs.rp, shardIDs) {
+		s.metrics.tagValuesPath(tagValuesPathScan)
+		setSpanTag(ctx, spanTagSlowPath, true)
+		return s.tagValueSetSlow(ctx, mqAttrs, tagKey)
+	}
+
+	s.metrics.tagValuesPath(tagValuesPathIndex)
+	setSpanTag(ctx, spanTagSlowPath, false)
+	setSpanTag(ctx, spanTagShards, len(shardIDs))
+	if len(shardIDs) == 0 {
+		return map[string]struct{}{}, false, nil
+	}
+
+	var includeEmpty bool
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.IncludeEmptyTagValues {
+		shards, err := s.shards(ctx, shardIDs)
+		if err != nil {
+			return nil, false, err
+		}
+		// The index does not hold empty values, which are recorded as
+		// the absence of the tag.
+		if includeEmpty, err = hasSeriesWithoutTag(ctx, mqAttrs.pred, shards, tagKey); err != nil {
+			return nil, false, err
+		}
+	}
+
+	tagKeyExpr := &influxql.BinaryExpr{
+		Op: influxql.EQ,
+		LHS: &influxql.VarRef{
+			Val: "_tagKey",
+		},
+		RHS: &influxql.StringLiteral{
+			Val: tagKey,
+		},
+	}
+
+	if mqAttrs.pred != nil {
+		mqAttrs.pred = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: tagKeyExpr,
+			RHS: &influxql.ParenExpr{
+				Expr: mqAttrs.pred,
+			},
+		}
+	} else {
+		mqAttrs.pred = tagKeyExpr
+	}
+
+	auth := authorizerFromContext(ctx)
+	values, err := s.TSDBStore.TagValues(auth, shardIDs, mqAttrs.pred)
+	if err != nil {
+		return nil, false, err
+	}
+
+	limit := newValueLimit(ctx, mqAttrs)
+	m := make(map[string]struct{})
+	var truncated bool
+	for _, kvs := range values {
+		for _, kv := range kvs.Values {
+			if !limit.add(m, kv.Value) {
+				truncated = true
+			}
+		}
+	}
+	if includeEmpty {
+		m[""] = struct{}{}
+	}
+	return m, truncated, nil
+}
+
+// TruncatedStringIterator is implemented by the iterators returned by
+// TagValues when MaxDistinctValues is set, and by TagKeys when TagKeysLimit
+// is set.
+type TruncatedStringIterator interface {
+	cursors.StringIterator
+
+	// Truncated reports whether values were ignored because
+	// MaxDistinctValues or TagKeysLimit was reached.
+	Truncated() bool
+}
+
+type truncatedStringIterator struct {
+	*cursors.StringSliceIterator
+	truncated bool
+}
+
+func (itr *truncatedStringIterator) Truncated() bool { return itr.truncated }
+
+// CountStringIterator is implemented by the iterators returned by TagValues
+// when the CountOnly of the request is set. They produce no values.
+type CountStringIterator interface {
+	cursors.StringIterator
+
+	// Count returns the number of distinct values of the tag key, as
+	// TagValuesCardinality does.
+	Count() int64
+}
+
+type countStringIterator struct {
+	cursors.StringIterator
+	count int64
+}
+
+func (itr *countStringIterator) Count() int64 { return itr.count }
+
+// valueLimit bounds the distinct values of a tag key accumulated by
+// TagValues. The empty value, recorded for series without the key, is not
+// counted.
+type valueLimit struct {
+	max   int // max is MaxDistinctValues, retaining the values found first.
+	least int // least is the limit of the request, retaining the least values.
+}
+
+func newValueLimit(ctx context.Context, mqAttrs *metaqueryAttributes) valueLimit {
+	l := valueLimit{least: mqAttrs.limit}
+	if opts := ReadOptionsFromContext(ctx); opts != nil {
+		l.max = opts.MaxDistinctValues
+	}
+	return l
+}
+
+// add adds v to the set m, unless m already holds max values, in which case
+// it returns false. Once m holds twice the least values, all but the least
+// values are removed.
+func (l valueLimit) add(m map[string]struct{}, v string) bool {
+	if _, ok := m[v]; ok {
+		return true
+	}
+	if v == "" {
+		m[v] = struct{}{}
+		return true
+	}
+
+	n := len(m)
+	if _, ok := m[""]; ok {
+		n--
+	}
+	if l.max > 0 && n >= l.max {
+		return false
+	}
+	m[v] = struct{}{}
+	if l.least > 0 && n+1 >= 2*l.least {
+		values := sortedSet(m)
+		if values[0] == "" {
+			values = values[1:]
+		}
+		for _, v := range values[l.least:] {
+			delete(m, v)
+		}
+	}
+	return true
+}
+
+// values returns the values of m in ascending order, limited to the least
+// values.
+func (l valueLimit) values(m map[string]struct{}) []string {
+	values := sortedSet(m)
+	n := l.least
+	if len(values) > 0 && values[0] == "" {
+		n++
+	}
+	if l.least > 0 && len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
+
+// count returns the number of values returned by values for m, without
+// sorting them.
+func (l valueLimit) count(m map[string]struct{}) int {
+	n := len(m)
+	if l.least <= 0 {
+		return n
+	}
+	least := l.least
+	if _, ok := m[""]; ok {
+		least++
+	}
+	if n > least {
+		n = least
+	}
+	return n
+}
+
+// distinctValuesIterator returns an iterator over the sorted values of a
+// TagValues request, which reports whether they were truncated if the
+// request sets MaxDistinctValues.
+func distinctValuesIterator(ctx context.Context, values []string, truncated bool) (cursors.StringIterator, error) {
+	opts := ReadOptionsFromContext(ctx)
+	if opts == nil || opts.MaxDistinctValues <= 0 {
+		return cursors.NewStringSliceIterator(values), nil
+	}
+	if truncated && opts.FailOnMaxDistinctValues {
+		return nil, ErrTooManyDistinctValues
+	}
+	return &truncatedStringIterator{StringSliceIterator: cursors.NewStringSliceIterator(values), truncated: truncated}, nil
+}
+
+// hasSeriesWithoutTag reports whether a series of shards matching pred has
+// no value for tagKey.
+func hasSeriesWithoutTag(ctx context.Context, pred influxql.Expr, shards []*tsdb.Shard, tagKey string) (bool, error) {
+	var cond influxql.Expr = &influxql.BinaryExpr{
+		Op:  influxql.EQ,
+		LHS: &influxql.VarRef{Val: tagKey},
+		RHS: &influxql.StringLiteral{Val: ""},
+	}
+	if pred != nil {
+		cond = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: cond,
+			RHS: &influxql.ParenExpr{Expr: pred},
+		}
+	}
+
+	ic, err := newIndexSeriesCursorInfluxQLPred(ctx, cond, shards)
+	if err != nil || ic == nil {
+		return false, err
+	}
+	defer ic.Close()
+	return ic.Next() != nil, ic.Err()
+}
+
+// TagKeyValues holds the values of a single tag key returned by
+// TagValuesForKeys.
+type TagKeyValues struct {
+	Key    string
+	Values []string // Values are sorted in ascending order.
+
+	// Truncated is true when the key had more values than the limit.
+	Truncated bool
+}
+
+// tagValuesForKeys returns the values of each of tagKeys, in the same order
+// as tagKeys. The shards are resolved once and the index is queried once for
+// all keys, or, when the predicate references _field, a single block scan
+// is performed. The _measurement and _field keys are served by
+// MeasurementNames and measurementFields respectively.
+//
+// When limitPerKey is greater than 0, each key is limited to its first
+// limitPerKey values after sorting and Truncated reports if any were dropped.
+func (s *Store) tagValuesForKeys(ctx context.Context, mqAttrs *metaqueryAttributes, tagKeys []string, limitPerKey int) ([]TagKeyValues, error) {
+	sets := make(map[string]map[string]struct{}, len(tagKeys))
+	var indexKeys []string
+	for _, k := range tagKeys {
+		key, ok := measurementRemap[k]
+		if !ok {
+			key = k
+		}
+		if _, ok := sets[key]; ok {
+			continue
+		}
+
+		switch key {
+		case "_name", "_field":
+			// The values are limited per key below, so the names are not
+			// paged.
+			attrs := *mqAttrs
+			attrs.limit, attrs.offset = 0, 0
+			var (
+				itr cursors.StringIterator
+				err error
+			)
+			if key == "_name" {
+				itr, err = s.MeasurementNames(ctx, &attrs)
+			} else {
+				itr, err = s.measurementFields(ctx, &attrs)
+			}
+			if err != nil {
+				return nil, err
+			}
+			m := make(map[string]struct{})
+			for itr.Next() {
+				m[itr.Value()] = struct{}{}
+			}
+			sets[key] = m
+
+		default:
+			sets[key] = nil
+			indexKeys = append(indexKeys, key)
+		}
+	}
+
+	if len(indexKeys) > 0 {
+		m, err := s.tagValuesMulti(ctx, mqAttrs, indexKeys)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range m {
+			sets[k] = v
+		}
+	}
+
+	result := make([]TagKeyValues, 0, len(tagKeys))
+	for _, k := range tagKeys {
+		key, ok := measurementRemap[k]
+		if !ok {
+			key = k
+		}
+		tkv := TagKeyValues{Key: k, Values: sortedSet(sets[key])}
+		if limitPerKey > 0 && len(tkv.Values) > limitPerKey {
+			tkv.Values = tkv.Values[:limitPerKey]
+			tkv.Truncated = true
+		}
+		result = append(result, tkv)
+	}
+	return result, nil
+}
+
+// tagValuesMulti returns the set of values for each of tagKeys using a
+// single index query, or a single block scan if the predicate references
+// _field.
+func (s *Store) tagValuesMulti(ctx context.Context, mqAttrs *metaqueryAttributes, tagKeys []string) (map[string]map[string]struct{}, error) {
+	sets := make(map[string]map[string]struct{}, len(tagKeys))
+	for _, k := range tagKeys {
+		sets[k] = make(map[string]struct{})
+	}
+
+	if mqAttrs.pred != nil && reads.ExprHasKey(mqAttrs.pred, fieldKey) {
+		a, _, err := s.tagValuesSlowSets(ctx, mqAttrs, tagKeys, valueLimit{})
+		if err != nil {
+			return nil, err
+		}
+		for i, k := range tagKeys {
+			sets[k] = a[i]
+		}
+		return sets, nil
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return sets, nil
+	}
+
+	var pred influxql.Expr
+	for _, k := range tagKeys {
+		expr := &influxql.BinaryExpr{
+			Op:  influxql.EQ,
+			LHS: &influxql.VarRef{Val: "_tagKey"},
+			RHS: &influxql.StringLiteral{Val: k},
+		}
+		if pred == nil {
+			pred = expr
+		} else {
+			pred = &influxql.BinaryExpr{Op: influxql.OR, LHS: pred, RHS: expr}
+		}
+	}
+	if mqAttrs.pred != nil {
+		pred = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: &influxql.ParenExpr{Expr: pred},
+			RHS: &influxql.ParenExpr{Expr: mqAttrs.pred},
+		}
+	}
+
+	values, err := s.TSDBStore.TagValues(authorizerFromContext(ctx), shardIDs, pred)
+	if err != nil {
+		return nil, err
+	}
+	for _, kvs := range values {
+		for _, kv := range kvs.Values {
+			if m, ok := sets[kv.Key]; ok {
+				m[kv.Value] = struct{}{}
+			}
+		}
+	}
+
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.IncludeEmptyTagValues {
+		shards, err := s.shards(ctx, shardIDs)
+		if err != nil {
+			return nil, err
+		}
+		// As for tagValues, the index does not hold empty values.
+		for _, k := range tagKeys {
+			ok, err := hasSeriesWithoutTag(ctx, mqAttrs.pred, shards, k)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				sets[k][""] = struct{}{}
+			}
+		}
+	}
+	return sets, nil
+}
+
+// TagValuesRegex returns the values of each tag key matching the TagKeyRegex
+// of req, ordered by key. Keys without values are omitted and the
+// _measurement and _field keys are never matched. As with TagValuesForKeys,
+// the index is queried once for all matching keys, or, when the predicate
+// references _field, a single block scan is performed. The TagKey of req is
+// ignored.
+//
+// When the Limit of req is greater than 0, each key is limited to its first
+// Limit values after sorting and Truncated reports if any were dropped.
+func (s *Store) TagValuesRegex(ctx context.Context, req *datatypes.TagValuesRequest) (_ []TagKeyValues, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("TagValuesRegex"); err != nil {
+		return nil, err
+	}
+
+	var keyRegex *regexp.Regexp
+	if req.TagKeyRegex != "" {
+		if keyRegex, err = regexp.Compile(req.TagKeyRegex); err != nil {
+			return nil, fmt.Errorf("invalid tag key regex: %w", err)
+		}
+	}
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.tagValuesRegex(ctx, mqAttrs, keyRegex, int(req.Limit))
+}
+
+func (s *Store) tagValuesRegex(ctx context.Context, mqAttrs *metaqueryAttributes, keyRegex *regexp.Regexp, limitPerKey int) ([]TagKeyValues, error) {
+	if keyRegex == nil {
+		return nil, errors.New("missing tag key regex")
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return nil, nil
+	}
+
+	sets, err := s.tagValueSetsByKeyRegex(ctx, mqAttrs, shardIDs, keyRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TagKeyValues, 0, len(sets))
+	for k, m := range sets {
+		if len(m) == 0 {
+			continue
+		}
+		tkv := TagKeyValues{Key: k, Values: sortedSet(m)}
+		if limitPerKey > 0 && len(tkv.Values) > limitPerKey {
+			tkv.Values = tkv.Values[:limitPerKey]
+			tkv.Truncated = true
+		}
+		result = append(result, tkv)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+// tagValueSetsByKeyRegex returns the set of values of each tag key of
+// shardIDs matching re, excluding the _measurement and _field keys. The
+// index is queried once, or, if the predicate references _field, the keys
+// are found and their values read by block scans. Keys found by the block
+// scan may have an empty set.
+func (s *Store) tagValueSetsByKeyRegex(ctx context.Context, mqAttrs *metaqueryAttributes, shardIDs []uint64, re *regexp.Regexp) (map[string]map[string]struct{}, error) {
+	var sets map[string]map[string]struct{}
+	if mqAttrs.pred != nil && reads.ExprHasKey(mqAttrs.pred, fieldKey) {
+		// The keys must be found by a block scan before their values.
+		itr, err := s.tagKeysWithFieldPredicate(ctx, mqAttrs, shardIDs)
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		for itr.Next() {
+			if k := itr.Value(); k != measurementKey && k != fieldKey && re.MatchString(k) {
+				keys = append(keys, k)
+			}
+		}
+		a, _, err := s.tagValuesSlowSets(ctx, mqAttrs, keys, valueLimit{})
+		if err != nil {
+			return nil, err
+		}
+		sets = make(map[string]map[string]struct{}, len(keys))
+		for i, k := range keys {
+			// TagValuesRegex never reports the empty value.
+			delete(a[i], "")
+			sets[k] = a[i]
+		}
+	} else {
+		var pred influxql.Expr = &influxql.BinaryExpr{
+			Op:  influxql.EQREGEX,
+			LHS: &influxql.VarRef{Val: "_tagKey"},
+			RHS: &influxql.RegexLiteral{Val: re},
+		}
+		if mqAttrs.pred != nil {
+			pred = &influxql.BinaryExpr{
+				Op:  influxql.AND,
+				LHS: pred,
+				RHS: &influxql.ParenExpr{Expr: mqAttrs.pred},
+			}
+		}
+
+		values, err := s.TSDBStore.TagValues(authorizerFromContext(ctx), shardIDs, pred)
+		if err != nil {
+			return nil, err
+		}
+		sets = make(map[string]map[string]struct{})
+		for _, kvs := range values {
+			for _, kv := range kvs.Values {
+				m, ok := sets[kv.Key]
+				if !ok {
+					m = make(map[string]struct{})
+					sets[kv.Key] = m
+				}
+				m[kv.Value] = struct{}{}
+			}
+		}
+	}
+	return sets, nil
+}
+
+// TagKeyCardinality is the number of distinct values of a tag key.
+type TagKeyCardinality struct {
+	Key         string
+	Cardinality int
+}
+
+// HighCardinalityTagKeys returns the topN tag keys with the most distinct
+// values matching req, ordered by descending cardinality and then by key.
+// The index keeps no per-key sketches, so the cardinalities are exact counts
+// of the values, deduplicated across shards and measurements. If topN is 0,
+// all tag keys are returned. The _measurement and _field keys are excluded.
+func (s *Store) HighCardinalityTagKeys(ctx context.Context, req *datatypes.TagKeysRequest, topN int) (_ []TagKeyCardinality, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("HighCardinalityTagKeys"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.highCardinalityTagKeys(ctx, mqAttrs, topN)
+}
+
+func (s *Store) highCardinalityTagKeys(ctx context.Context, mqAttrs *metaqueryAttributes, topN int) ([]TagKeyCardinality, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return nil, nil
+	}
+
+	sets, err := s.tagValueSetsByKeyRegex(ctx, mqAttrs, shardIDs, regexp.MustCompile(`.*`))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]TagKeyCardinality, 0, len(sets))
+	for k, m := range sets {
+		result = append(result, TagKeyCardinality{Key: k, Cardinality: len(m)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cardinality != result[j].Cardinality {
+			return result[i].Cardinality > result[j].Cardinality
+		}
+		return result[i].Key < result[j].Key
+	})
+	if topN > 0 && len(result) > topN {
+		result = result[:topN]
+	}
+	return result, nil
+}
+
+// MeasurementCardinality describes the contribution of a measurement and its
+// tag keys to the series cardinality of a bucket.
+type MeasurementCardinality struct {
+	Measurement string
+
+	// Series is the number of distinct series of the measurement.
+	Series int
+
+	// TagKeys are the tag keys of the series of the measurement with the
+	// number of their distinct values, ordered by descending cardinality
+	// and then by key. A tag key whose cardinality approaches Series is the
+	// likely cause of the cardinality of the measurement.
+	TagKeys []TagKeyCardinality
+}
+
+// CardinalityBreakdown returns the topN measurements with the most series
+// with points in the range of req that match its predicate, ordered by
+// descending series count and then by name. If topN is 0, all measurements
+// are returned. The series are found by a block scan, so only series with
+// points in the range contribute, and the distinct series and tag values of
+// the scanned measurements are held in memory.
+func (s *Store) CardinalityBreakdown(ctx context.Context, req *datatypes.TagKeysRequest, topN int) (_ []MeasurementCardinality, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("CardinalityBreakdown"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.cardinalityBreakdown(ctx, mqAttrs, topN)
+}
+
+func (s *Store) cardinalityBreakdown(ctx context.Context, mqAttrs *metaqueryAttributes, topN int) ([]MeasurementCardinality, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return nil, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards)
+	if err != nil || ic == nil {
+		return nil, err
+	}
+
+	type measurement struct {
+		series map[string]struct{}
+		values map[string]map[string]struct{}
+	}
+	measurements := make(map[string]*measurement)
+
+	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, ic)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		hasData, err := cursorHasData(c)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !hasData {
+			continue
+		}
+
+		var name string
+		tags := make(models.Tags, 0, len(rs.Tags()))
+		for _, t := range rs.Tags() {
+			switch {
+			case bytes.Equal(t.Key, measurementKeyBytes):
+				name = string(t.Value)
+			case !bytes.Equal(t.Key, fieldKeyBytes):
+				tags = append(tags, t)
+			}
+		}
+
+		m := measurements[name]
+		if m == nil {
+			m = &measurement{series: make(map[string]struct{}), values: make(map[string]map[string]struct{})}
+			measurements[name] = m
+		}
+		key := string(tags.HashKey())
+		if _, ok := m.series[key]; ok {
+			// Another field of a series already counted.
+			continue
+		}
+		m.series[key] = struct{}{}
+		for _, t := range tags {
+			v, ok := m.values[string(t.Key)]
+			if !ok {
+				v = make(map[string]struct{})
+				m.values[string(t.Key)] = v
+			}
+			v[string(t.Value)] = struct{}{}
+		}
+	}
+	if err := ic.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]MeasurementCardinality, 0, len(measurements))
+	for name, m := range measurements {
+		mc := MeasurementCardinality{Measurement: name, Series: len(m.series)}
+		for k, v := range m.values {
+			mc.TagKeys = append(mc.TagKeys, TagKeyCardinality{Key: k, Cardinality: len(v)})
+		}
+		sort.Slice(mc.TagKeys, func(i, j int) bool {
+			if mc.TagKeys[i].Cardinality != mc.TagKeys[j].Cardinality {
+				return mc.TagKeys[i].Cardinality > mc.TagKeys[j].Cardinality
+			}
+			return mc.TagKeys[i].Key < mc.TagKeys[j].Key
+		})
+		result = append(result, mc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Series != result[j].Series {
+			return result[i].Series > result[j].Series
+		}
+		return result[i].Measurement < result[j].Measurement
+	})
+	if topN > 0 && len(result) > topN {
+		result = result[:topN]
+	}
+	return result, nil
+}
+
+// FieldTypeConflict describes a field written with more than one type.
+type FieldTypeConflict struct {
+	Measurement string
+	Field       string
+
+	// Types are the types of the field with points in the range, in
+	// ascending order.
+	Types []cursors.FieldType
+}
+
+// FieldTypeConflicts returns the fields of the series matching the predicate
+// of req that have points of more than one type in its range, ordered by
+// measurement and then by field. A shard rejects writes of a field with a
+// type other than the one it holds, so a conflict is between the shards of
+// the range. Each shard is read with a block scan, so a shard only
+// contributes the type of a field if it holds points of the field in the
+// range; predicates on _value are not applied.
+func (s *Store) FieldTypeConflicts(ctx context.Context, req *datatypes.TagKeysRequest) (_ []FieldTypeConflict, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("FieldTypeConflicts"); err != nil {
 		return nil, err
-	} else if ic == nil {
-		return cursors.EmptyStringIterator, nil
-	} else {
-		cur = ic
 	}
-	m := make(map[string]struct{})
-	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, cur)
-	for rs.Next() {
-		func() {
-			c := rs.Cursor()
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.fieldTypeConflicts(ctx, mqAttrs)
+}
+
+func (s *Store) fieldTypeConflicts(ctx context.Context, mqAttrs *metaqueryAttributes) ([]FieldTypeConflict, error) {
+	types, err := s.scanFieldTypes(ctx, mqAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []FieldTypeConflict
+	for key, set := range types {
+		if len(set) < 2 {
+			continue
+		}
+		conflict := FieldTypeConflict{Measurement: key.measurement, Field: key.field}
+		for typ := range set {
+			conflict.Types = append(conflict.Types, typ)
+		}
+		sort.Slice(conflict.Types, func(i, j int) bool { return conflict.Types[i] < conflict.Types[j] })
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Measurement != conflicts[j].Measurement {
+			return conflicts[i].Measurement < conflicts[j].Measurement
+		}
+		return conflicts[i].Field < conflicts[j].Field
+	})
+	return conflicts, nil
+}
+
+type measurementField struct{ measurement, field string }
+
+// scanFieldTypes returns the types of each field of the series matching the
+// predicate of mqAttrs with points in its range, which are found by a block
+// scan of each shard.
+func (s *Store) scanFieldTypes(ctx context.Context, mqAttrs *metaqueryAttributes) (map[measurementField]map[cursors.FieldType]struct{}, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return nil, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards)
+	if err != nil || ic == nil {
+		return nil, err
+	}
+	defer ic.Close()
+
+	types := make(map[measurementField]map[cursors.FieldType]struct{})
+
+	req := cursors.CursorRequest{
+		Ascending: true,
+		StartTime: mqAttrs.start,
+		EndTime:   mqAttrs.end,
+	}
+	for row := ic.Next(); row != nil; row = ic.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		req.Name = row.Name
+		req.Tags = row.SeriesTags
+		req.Field = row.Field
+
+		key := measurementField{measurement: string(row.Name), field: row.Field}
+		for _, itr := range row.Query {
+			c, err := itr.Next(ctx, &req)
+			if err != nil {
+				return nil, err
+			}
 			if c == nil {
-				// no data for series key + field combination
-				return
+				continue
 			}
-			defer c.Close()
-			if cursorHasData(c) {
-				tags := rs.Tags()
-				for i := range tags {
-					m[string(tags[i].Key)] = struct{}{}
-				}
+			typ := cursorFieldType(c)
+			hasData, err := cursorHasData(c)
+			c.Close()
+			if err != nil {
+				return nil, err
 			}
-		}()
+			if !hasData {
+				continue
+			}
+
+			set := types[key]
+			if set == nil {
+				set = make(map[cursors.FieldType]struct{})
+				types[key] = set
+			}
+			set[typ] = struct{}{}
+		}
+	}
+	if err := ic.Err(); err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// MeasurementTimeBounds returns the timestamps of the earliest and latest
+// points within the range of req of each measurement, considering the
+// series matching its predicate. Measurements without points in the range
+// are omitted. Rather than a block scan, the first and last points of each
+// series and field are looked up in each shard, reading a single block in
+// each direction.
+func (s *Store) MeasurementTimeBounds(ctx context.Context, req *datatypes.TagKeysRequest) (_ map[string][2]int64, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("MeasurementTimeBounds"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.measurementTimeBounds(ctx, mqAttrs)
+}
+
+func (s *Store) measurementTimeBounds(ctx context.Context, mqAttrs *metaqueryAttributes) (map[string][2]int64, error) {
+	bounds := make(map[string][2]int64)
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return bounds, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards)
+	if err != nil {
+		return nil, err
+	} else if ic == nil {
+		return bounds, nil
+	}
+	defer ic.Close()
+
+	req := cursors.CursorRequest{
+		StartTime: mqAttrs.start,
+		EndTime:   mqAttrs.end,
+	}
+	// first returns the timestamp of the first point of itr in the
+	// direction of req.
+	first := func(itr cursors.CursorIterator, ascending bool) (int64, bool, error) {
+		req.Ascending = ascending
+		c, err := itr.Next(ctx, &req)
+		if err != nil || c == nil {
+			return 0, false, err
+		}
+		defer c.Close()
+		ts, ok, err := cursorFirstTimestamp(c)
+		if err != nil {
+			return 0, false, err
+		}
+		return ts, ok, c.Err()
+	}
+
+	for row := ic.Next(); row != nil; row = ic.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		req.Name = row.Name
+		req.Tags = row.SeriesTags
+		req.Field = row.Field
+
+		for _, itr := range row.Query {
+			min, ok, err := first(itr, true)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			max, _, err := first(itr, false)
+			if err != nil {
+				return nil, err
+			}
+
+			b, seen := bounds[string(row.Name)]
+			if !seen || min < b[0] {
+				b[0] = min
+			}
+			if !seen || max > b[1] {
+				b[1] = max
+			}
+			bounds[string(row.Name)] = b
+		}
+	}
+	if err := ic.Err(); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
+
+func (s *Store) MeasurementNames(ctx context.Context, mqAttrs *metaqueryAttributes) (_ cursors.StringIterator, err error) {
+	defer s.metrics.record("measurement_names")(&err)
+
+	span, ctx := startSpan(ctx, "MeasurementNames")
+	defer finishSpan(span, &err)
+	setSpanSource(ctx, mqAttrs.db, mqAttrs.rp)
+
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if mqAttrs.pred != nil {
+		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
+			// If there is a predicate on _field, we cannot use the index
+			// alone to filter out unwanted measurement names. Use a slower
+			// block scan of the measurements the index selects instead.
+			setSpanTag(ctx, spanTagSlowPath, true)
+
+			// The scan retains the least names, which must include those
+			// of the page and the name following it.
+			attrs := *mqAttrs
+			if attrs.limit > 0 {
+				attrs.limit += attrs.offset + 1
+			}
+			itr, err := s.measurementNamesByField(ctx, &attrs)
+			if err != nil {
+				return nil, err
+			}
+			return pageMeasurementNames(mqAttrs, itr), nil
+		}
+
+		if hasNegatedTagComparison(mqAttrs.pred) {
+			setSpanTag(ctx, spanTagSlowPath, false)
+			itr, err := s.measurementNamesBySeries(ctx, mqAttrs)
+			if err != nil {
+				return nil, err
+			}
+			return pageMeasurementNames(mqAttrs, itr), nil
+		}
+	}
+
+	setSpanTag(ctx, spanTagSlowPath, false)
+	cond := mqAttrs.pred
+	if re := measurementNameRegexFromContext(ctx); re != nil {
+		cond = andMeasurementNameRegex(cond, re)
+	}
+	auth := authorizerFromContext(ctx)
+	values, err := s.TSDBStore.MeasurementNames(auth, mqAttrs.db, cond)
+	if err != nil {
+		return nil, err
+	}
+	return pageMeasurementNames(mqAttrs, newMergeNamesIterator(values)), nil
+}
+
+// mergeNamesIterator produces the distinct names of a list made of sorted
+// runs, such as the names of each index concatenated by a TSDBStore, in order.
+// The runs are merged as the iterator advances, and each name is converted to
+// a string only when it is produced, so that the names are neither copied nor
+// sorted in full. A list that is sorted, as the index returns it, is a single
+// run and is read in one pass.
+type mergeNamesIterator struct {
+	runs  namesHeap
+	value string
+	valid bool
+}
+
+func newMergeNamesIterator(names [][]byte) *mergeNamesIterator {
+	itr := &mergeNamesIterator{}
+	for start := 0; start < len(names); {
+		end := start + 1
+		for end < len(names) && bytes.Compare(names[end-1], names[end]) <= 0 {
+			end++
+		}
+		itr.runs = append(itr.runs, names[start:end])
+		start = end
+	}
+	heap.Init(&itr.runs)
+	return itr
+}
+
+func (itr *mergeNamesIterator) Next() bool {
+	for len(itr.runs) > 0 {
+		run := itr.runs[0]
+		name := run[0]
+		if len(run) == 1 {
+			heap.Pop(&itr.runs)
+		} else {
+			itr.runs[0] = run[1:]
+			heap.Fix(&itr.runs, 0)
+		}
+		if itr.valid && string(name) == itr.value {
+			continue
+		}
+		itr.value, itr.valid = string(name), true
+		return true
+	}
+	return false
+}
+
+func (itr *mergeNamesIterator) Value() string { return itr.value }
+
+func (itr *mergeNamesIterator) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+// namesHeap is a min-heap of sorted runs of names, ordered by their first
+// name.
+type namesHeap [][][]byte
+
+func (h namesHeap) Len() int            { return len(h) }
+func (h namesHeap) Less(i, j int) bool  { return bytes.Compare(h[i][0], h[j][0]) < 0 }
+func (h namesHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *namesHeap) Push(x interface{}) { *h = append(*h, x.([][]byte)) }
+
+func (h *namesHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// measurementNamesByField returns the names of the measurements matching the
+// predicate of mqAttrs, which compares _field. The index selects the
+// measurements matching the comparisons of the predicate other than those of
+// _field and field values, and the MeasurementNameRegex read option, and only
+// the series of those are block scanned.
+func (s *Store) measurementNamesByField(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
+	cond := influxql.Reduce(RewriteExprRemoveFieldKeyAndValue(influxql.CloneExpr(mqAttrs.pred)), nil)
+	if reads.IsTrueBooleanLiteral(cond) {
+		cond = nil
+	}
+	if re := measurementNameRegexFromContext(ctx); re != nil {
+		cond = andMeasurementNameRegex(cond, re)
+	}
+	if cond == nil {
+		// The index does not narrow the measurements.
+		return s.tagValuesSlow(ctx, mqAttrs, measurementKey)
+	}
+
+	auth := authorizerFromContext(ctx)
+	candidates, err := s.TSDBStore.MeasurementNames(auth, mqAttrs.db, cond)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return cursors.EmptyStringIterator, nil
+	}
+
+	// The scan only iterates the series of the candidates, rather than
+	// comparing the name of every series to them.
+	attrs := *mqAttrs
+	attrs.measurements = candidates
+	return s.tagValuesSlow(ctx, &attrs, measurementKey)
+}
+
+// hasNegatedTagComparison reports whether expr compares a tag with != or !~.
+func hasNegatedTagComparison(expr influxql.Expr) bool {
+	var found bool
+	influxql.WalkFunc(expr, func(node influxql.Node) {
+		if e, ok := node.(*influxql.BinaryExpr); ok && (e.Op == influxql.NEQ || e.Op == influxql.NEQREGEX) {
+			if ref, ok := e.LHS.(*influxql.VarRef); ok && ref.Val != measurementKey && ref.Val != fieldKey && ref.Val != "$" {
+				found = true
+			}
+		}
+	})
+	return found
+}
+
+// measurementNamesBySeries returns the measurements with a series matching
+// the predicate of mqAttrs in the shards of its range. The index evaluates a
+// negated tag comparison per measurement, rejecting a measurement if any of
+// its series has the value, whereas a predicate selects series, so the index
+// series of the shards are read instead.
+func (s *Store) measurementNamesBySeries(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return cursors.EmptyStringIterator, nil
+	}
+
+	cur, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards)
+	if err != nil {
+		return nil, err
+	} else if cur == nil {
+		return cursors.EmptyStringIterator, nil
+	}
+	defer cur.Close()
+
+	re := measurementNameRegexFromContext(ctx)
+	var names []string
+	for row := cur.Next(); row != nil; row = cur.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		// The rows of a measurement are consecutive.
+		if len(names) > 0 && names[len(names)-1] == string(row.Name) {
+			continue
+		}
+		if re != nil && !re.Match(row.Name) {
+			continue
+		}
+		names = append(names, string(row.Name))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	return cursors.NewStringSliceIterator(names), nil
+}
+
+// measurementNameRegexFromContext returns the MeasurementNameRegex read option
+// of ctx, or nil if it is not set.
+func measurementNameRegexFromContext(ctx context.Context) *regexp.Regexp {
+	if opts := ReadOptionsFromContext(ctx); opts != nil {
+		return opts.MeasurementNameRegex
+	}
+	return nil
+}
+
+// andMeasurementNameRegex returns cond restricted to the measurements whose
+// names match re. cond may be nil.
+func andMeasurementNameRegex(cond influxql.Expr, re *regexp.Regexp) influxql.Expr {
+	var expr influxql.Expr = &influxql.BinaryExpr{
+		Op:  influxql.EQREGEX,
+		LHS: &influxql.VarRef{Val: "_name"},
+		RHS: &influxql.RegexLiteral{Val: re},
+	}
+	if cond != nil {
+		expr = &influxql.BinaryExpr{
+			Op:  influxql.AND,
+			LHS: expr,
+			RHS: &influxql.ParenExpr{Expr: cond},
+		}
+	}
+	return expr
+}
+
+// PagedStringIterator is implemented by the iterators returned by
+// MeasurementNames, including those of a TagValues request for _measurement,
+// when the Offset or Limit of the request is set.
+type PagedStringIterator interface {
+	cursors.StringIterator
+
+	// More reports whether names follow those of the page.
+	More() bool
+}
+
+type pagedStringIterator struct {
+	*cursors.StringSliceIterator
+	more      bool
+	truncated bool
+}
+
+func (itr *pagedStringIterator) More() bool      { return itr.more }
+func (itr *pagedStringIterator) Truncated() bool { return itr.truncated }
+
+// pageMeasurementNames returns an iterator over the page of the sorted names
+// of itr selected by the offset and limit of mqAttrs, or itr if neither is
+// set. The names are paged after they are sorted, whether they are read
+// from the index or by a block scan, so that pages are stable. Whether itr
+// was truncated is preserved.
+func pageMeasurementNames(mqAttrs *metaqueryAttributes, itr cursors.StringIterator) cursors.StringIterator {
+	if mqAttrs.offset <= 0 && mqAttrs.limit <= 0 {
+		return itr
+	}
+
+	var truncated bool
+	if t, ok := itr.(TruncatedStringIterator); ok {
+		truncated = t.Truncated()
+	}
+	names := cursors.StringIteratorToSlice(itr)
+	if offset := mqAttrs.offset; offset >= len(names) {
+		names = nil
+	} else if offset > 0 {
+		names = names[offset:]
+	}
+	var more bool
+	if limit := mqAttrs.limit; limit > 0 && len(names) > limit {
+		names, more = names[:limit], true
+	}
+	return &pagedStringIterator{StringSliceIterator: cursors.NewStringSliceIterator(names), more: more, truncated: truncated}
+}
+
+// SeriesFields lists the fields written to a series, as reported by
+// FieldPresence.
+type SeriesFields struct {
+	// Key is the series key, excluding the field, in the escaped form of
+	// line protocol, such as "cpu,host=a,region=east".
+	Key string
+
+	// Tags are the tags of the series, excluding _measurement and _field.
+	Tags models.Tags
+
+	// Fields are the fields of the series with points in the range, sorted
+	// by name.
+	Fields []string
+}
+
+// FieldPresence returns the fields written to each series matching the
+// predicate of req, ordered by series key. Comparing the fields of the
+// series of a measurement finds those missing a field written to the
+// others. A field is only reported if the series has a point of the field
+// within the range, and series without points in the range are omitted, so
+// determining the presence requires a block scan of the matching series.
+func (s *Store) FieldPresence(ctx context.Context, req *datatypes.TagKeysRequest) (_ []SeriesFields, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("FieldPresence"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.fieldPresence(ctx, mqAttrs)
+}
+
+func (s *Store) fieldPresence(ctx context.Context, mqAttrs *metaqueryAttributes) ([]SeriesFields, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return nil, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards)
+	if err != nil {
+		return nil, err
+	} else if ic == nil {
+		return nil, nil
+	}
+	if opts := ReadOptionsFromContext(ctx); opts != nil {
+		ic.evalMax = opts.MaxPredicateEvalTime
+	}
+
+	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, ic)
+	defer rs.Close()
+
+	series := make(map[string]*SeriesFields)
+	fields := make(map[string]map[string]struct{})
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		ok, err := cursorHasData(c)
+		c.Close()
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		name, field, st := splitSeriesTags(rs.Tags())
+		key := string(models.MakeKey(name, st))
+		if _, ok := series[key]; !ok {
+			series[key] = &SeriesFields{Key: key, Tags: st.Clone()}
+			fields[key] = make(map[string]struct{})
+		}
+		fields[key][string(field)] = struct{}{}
+	}
+	if err := ic.Err(); err != nil {
+		return nil, err
 	}
 
-	arr := make([]string, 0, len(m))
-	for tag := range m {
-		arr = append(arr, tag)
+	result := make([]SeriesFields, 0, len(series))
+	for key, sf := range series {
+		sf.Fields = sortedSet(fields[key])
+		result = append(result, *sf)
 	}
-	sort.Strings(arr)
-	return cursors.NewStringSliceIterator(arr), nil
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
 }
 
-func (s *Store) TagKeys(ctx context.Context, req *datatypes.TagKeysRequest) (cursors.StringIterator, error) {
-	if req.TagsSource == nil {
-		return nil, errors.New("missing read source")
+// ActiveMeasurements returns the measurements with write activity in the
+// range of req, ordered by name. A measurement is active if a series of
+// the measurement matching the predicate has a point of any field with a
+// timestamp in the range. Unlike MeasurementNames, which reports every
+// measurement held by the index of the shards overlapping the range,
+// measurements whose points all fall outside the range, or were deleted, are
+// omitted. Determining the activity requires a block scan of the matching
+// series.
+func (s *Store) ActiveMeasurements(ctx context.Context, req *datatypes.TagKeysRequest) (_ cursors.StringIterator, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("ActiveMeasurements"); err != nil {
+		return nil, err
 	}
-	source, err := getReadSource(*req.TagsSource)
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
 	if err != nil {
 		return nil, err
 	}
-	db, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	defer release()
+
+	return s.activeMeasurements(ctx, mqAttrs)
+}
+
+func (s *Store) activeMeasurements(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
+	return s.tagValuesSlow(ctx, mqAttrs, measurementKey)
+}
+
+func (s *Store) GetSource(orgID, bucketID uint64) proto.Message {
+	return &readSource{
+		BucketID:       bucketID,
+		OrganizationID: orgID,
+		Version:        ReadSourceVersion,
+	}
+}
+
+// tagValuesV1 returns the values of the _name or _field tag key with the
+// semantics of ReadOptions.V1Compat.
+func (s *Store) tagValuesV1(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
+	fields, err := s.measurementFieldsV1(ctx, mqAttrs)
 	if err != nil {
 		return nil, err
 	}
 
-	shardIDs, err := s.findShardIDs(db, rp, false, start, end)
+	m := make(map[string]struct{})
+	for name, keys := range fields {
+		if tagKey == "_name" {
+			m[name] = struct{}{}
+			continue
+		}
+		for _, key := range keys {
+			m[key] = struct{}{}
+		}
+	}
+	return cursors.NewStringSliceIterator(sortedSet(m)), nil
+}
+
+// measurementFieldsV1 returns the fields of each measurement with series
+// matching the tag comparisons of mqAttrs.pred, which match the _field
+// comparisons. Measurements without a matching field are omitted when the
+// predicate compares _field. The measurements and fields are read from the
+// index of the shards in the requested range.
+func (s *Store) measurementFieldsV1(ctx context.Context, mqAttrs *metaqueryAttributes) (map[string][]string, error) {
+	var tagPred influxql.Expr
+	hasFieldPred := false
+	if mqAttrs.pred != nil {
+		tagPred = influxql.Reduce(RewriteExprRemoveFieldKeyAndValue(influxql.CloneExpr(mqAttrs.pred)), nil)
+		if reads.IsTrueBooleanLiteral(tagPred) {
+			tagPred = nil
+		}
+		hasFieldPred = reads.ExprHasKey(mqAttrs.pred, fieldKey)
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
 	if err != nil {
 		return nil, err
 	}
 	if len(shardIDs) == 0 {
-		return cursors.EmptyStringIterator, nil
+		return nil, nil
 	}
 
-	var expr influxql.Expr
-	if root := req.Predicate.GetRoot(); root != nil {
-		var err error
-		expr, err = reads.NodeToExpr(root, measurementRemap)
-		if err != nil {
-			return nil, err
-		}
+	auth := authorizerFromContext(ctx)
+	names, err := s.TSDBStore.MeasurementNames(auth, mqAttrs.db, tagPred)
+	if err != nil {
+		return nil, err
+	}
 
-		if found := reads.HasFieldValueKey(expr); found {
-			return nil, errors.New("field values unsupported")
-		}
-		if found := reads.ExprHasKey(expr, fieldKey); found {
-			mqAttrs := &metaqueryAttributes{
-				orgID: source.GetOrgID(),
-				db:    db,
-				rp:    rp,
-				start: start,
-				end:   end,
-				pred:  expr,
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	sg := tsdb.Shards(shards)
+	fields := make(map[string][]string, len(names))
+	for _, name := range names {
+		keys := sg.FieldKeysByMeasurement(name)
+		if hasFieldPred {
+			matched := keys[:0]
+			for _, key := range keys {
+				// The comparisons of other keys remain unresolved, so a
+				// field only fails to match if the predicate reduces to
+				// false.
+				expr := influxql.Reduce(mqAttrs.pred, influxql.MapValuer{fieldKey: key})
+				if lit, ok := expr.(*influxql.BooleanLiteral); ok && !lit.Val {
+					continue
+				}
+				matched = append(matched, key)
 			}
-			return s.tagKeysWithFieldPredicate(ctx, mqAttrs, shardIDs)
+			if len(matched) == 0 {
+				continue
+			}
+			keys = matched
+		} else if len(keys) == 0 {
+			continue
 		}
-		expr = influxql.Reduce(influxql.CloneExpr(expr), nil)
-		if reads.IsTrueBooleanLiteral(expr) {
-			expr = nil
+		fields[string(name)] = keys
+	}
+	return fields, nil
+}
+
+func (s *Store) measurementFields(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.SortFieldsByFrequency {
+		return s.measurementFieldsByFrequency(ctx, mqAttrs)
+	}
+
+	if mqAttrs.pred != nil {
+		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
+			return s.tagValuesSlow(ctx, mqAttrs, fieldKey)
+		}
+
+		// If there predicates on anything besides _measurement, we can't
+		// use the index and need to use the slow path.
+		if hasTagKey(mqAttrs.pred) {
+			return s.tagValuesSlow(ctx, mqAttrs, fieldKey)
 		}
 	}
 
-	// TODO(jsternberg): Use a real authorizer.
-	auth := query.OpenAuthorizer
-	keys, err := s.TSDBStore.TagKeys(auth, shardIDs, expr)
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
 	if err != nil {
-		return cursors.EmptyStringIterator, err
+		return nil, err
 	}
-
-	m := map[string]bool{
-		measurementKey: true,
-		fieldKey:       true,
+	if len(shardIDs) == 0 {
+		return cursors.EmptyStringIterator, nil
 	}
-	for _, ks := range keys {
-		for _, k := range ks.Keys {
-			m[k] = true
-		}
+
+	iter, err := s.fieldKeysIterator(ctx, mqAttrs, shardIDs)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = iter.Close() }()
 
-	names := make([]string, 0, len(m))
-	for name := range m {
-		names = append(names, name)
+	fieldNames, err := fieldKeysIteratorNames(iter)
+	if err != nil {
+		return nil, err
 	}
-	sort.Strings(names)
-	return cursors.NewStringSliceIterator(names), nil
+
+	sort.Strings(fieldNames)
+	fieldNames = slices.MergeSortedStrings(fieldNames)
+
+	return cursors.NewStringSliceIterator(fieldNames), nil
 }
 
-func (s *Store) TagValues(ctx context.Context, req *datatypes.TagValuesRequest) (cursors.StringIterator, error) {
-	if req.TagsSource == nil {
-		return nil, errors.New("missing read source")
+// fieldKeysIterator returns a _fieldKeys system iterator over the fields of
+// the measurements of shardIDs matching the predicate of mqAttrs.
+func (s *Store) fieldKeysIterator(ctx context.Context, mqAttrs *metaqueryAttributes, shardIDs []uint64) (query.Iterator, error) {
+	sg := s.TSDBStore.ShardGroup(shardIDs)
+	ms := &influxql.Measurement{
+		Database:        mqAttrs.db,
+		RetentionPolicy: mqAttrs.rp,
+		SystemIterator:  "_fieldKeys",
+	}
+	opts := query.IteratorOptions{
+		OrgID:      mqAttrs.orgID,
+		Condition:  mqAttrs.pred,
+		Authorizer: authorizerFromContext(ctx),
 	}
+	return sg.CreateIterator(ctx, ms, opts)
+}
 
-	source, err := getReadSource(*req.TagsSource)
-	if err != nil {
+// FieldKeyType is a field key and one of its types.
+type FieldKeyType struct {
+	Name string
+	Type cursors.FieldType
+}
+
+// MeasurementFieldTypes returns the fields of the measurements matching the
+// predicate of req with their types, ordered by name and then by type.
+// A field with more than one type, in different measurements or shards, is
+// returned once for each type. The fields are those of measurementFields,
+// and, as for it, a predicate on _field or a tag requires a block scan,
+// which only reports the types of fields with points in the range.
+func (s *Store) MeasurementFieldTypes(ctx context.Context, req *datatypes.TagKeysRequest) (_ []FieldKeyType, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("MeasurementFieldTypes"); err != nil {
 		return nil, err
 	}
 
-	db, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	var influxqlPred influxql.Expr
-	if root := req.Predicate.GetRoot(); root != nil {
-		var err error
-		influxqlPred, err = reads.NodeToExpr(root, measurementRemap)
+	return s.measurementFieldTypes(ctx, mqAttrs)
+}
+
+func (s *Store) measurementFieldTypes(ctx context.Context, mqAttrs *metaqueryAttributes) ([]FieldKeyType, error) {
+	set := make(map[FieldKeyType]struct{})
+	if mqAttrs.pred != nil && (reads.ExprHasKey(mqAttrs.pred, fieldKey) || hasTagKey(mqAttrs.pred)) {
+		types, err := s.scanFieldTypes(ctx, mqAttrs)
+		if err != nil {
+			return nil, err
+		}
+		for key, ts := range types {
+			for typ := range ts {
+				set[FieldKeyType{Name: key.field, Type: typ}] = struct{}{}
+			}
+		}
+	} else {
+		shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
 		if err != nil {
 			return nil, err
 		}
+		if len(shardIDs) == 0 {
+			return nil, nil
+		}
 
-		if found := reads.HasFieldValueKey(influxqlPred); found {
-			return nil, errors.New("field values unsupported")
+		iter, err := s.fieldKeysIterator(ctx, mqAttrs, shardIDs)
+		if err != nil {
+			return nil, err
 		}
+		defer func() { _ = iter.Close() }()
 
-		influxqlPred = influxql.Reduce(influxql.CloneExpr(influxqlPred), nil)
-		if reads.IsTrueBooleanLiteral(influxqlPred) {
-			influxqlPred = nil
+		keys, err := fieldKeysIteratorTypes(iter)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			set[k] = struct{}{}
 		}
 	}
 
-	mqAttrs := &metaqueryAttributes{
-		orgID: source.GetOrgID(),
-		db:    db,
-		rp:    rp,
-		start: start,
-		end:   end,
-		pred:  influxqlPred,
+	fields := make([]FieldKeyType, 0, len(set))
+	for k := range set {
+		fields = append(fields, k)
 	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Name != fields[j].Name {
+			return fields[i].Name < fields[j].Name
+		}
+		return fields[i].Type < fields[j].Type
+	})
+	return fields, nil
+}
 
-	tagKey, ok := measurementRemap[req.TagKey]
-	if !ok {
-		tagKey = req.TagKey
+// fieldKeysIteratorNames returns the field keys produced by a _fieldKeys
+// system iterator, which are the first auxiliary value of each point.
+func fieldKeysIteratorNames(itr query.Iterator) ([]string, error) {
+	var names []string
+	err := readFieldKeysIterator(itr, func(aux []interface{}) error {
+		if len(aux) == 0 {
+			return nil
+		}
+		name, ok := aux[0].(string)
+		if !ok {
+			return fmt.Errorf("unexpected field key of type %T", aux[0])
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return names, nil
+}
 
-	// Getting values of _measurement or _field are handled specially
-	switch tagKey {
-	case "_name":
-		return s.MeasurementNames(ctx, mqAttrs)
-
-	case "_field":
-		return s.measurementFields(ctx, mqAttrs)
+// fieldKeysIteratorTypes returns the field keys produced by a _fieldKeys
+// system iterator with their types, which are the first and second
+// auxiliary values of each point.
+func fieldKeysIteratorTypes(itr query.Iterator) ([]FieldKeyType, error) {
+	var keys []FieldKeyType
+	err := readFieldKeysIterator(itr, func(aux []interface{}) error {
+		if len(aux) == 0 {
+			return nil
+		}
+		name, ok := aux[0].(string)
+		if !ok {
+			return fmt.Errorf("unexpected field key of type %T", aux[0])
+		}
+		if len(aux) < 2 {
+			return fmt.Errorf("missing type of field key %q", name)
+		}
+		typ, ok := aux[1].(string)
+		if !ok {
+			return fmt.Errorf("unexpected field type of type %T", aux[1])
+		}
+		keys = append(keys, FieldKeyType{Name: name, Type: fieldTypeFromString(typ)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return keys, nil
+}
 
-	return s.tagValues(ctx, mqAttrs, tagKey)
+// fieldTypeFromString returns the type named by s, as produced by
+// influxql.DataType.String, or cursors.Undefined if s is not a field type.
+func fieldTypeFromString(s string) cursors.FieldType {
+	switch s {
+	case "float":
+		return cursors.Float
+	case "integer":
+		return cursors.Integer
+	case "unsigned":
+		return cursors.Unsigned
+	case "string":
+		return cursors.String
+	case "boolean":
+		return cursors.Boolean
+	default:
+		return cursors.Undefined
+	}
 }
 
-func (s *Store) tagValues(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
-	// If there are any references to _field, we need to use the slow path
-	// since we cannot rely on the index alone.
-	if mqAttrs.pred != nil {
-		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
-			return s.tagValuesSlow(ctx, mqAttrs, tagKey)
+// readFieldKeysIterator calls fn with the auxiliary values of each point
+// produced by a _fieldKeys system iterator. The iterators of the shards
+// produce float points, but the type of the points is checked rather than
+// assumed, so that an unexpected iterator fails the request rather than
+// panicking.
+func readFieldKeysIterator(itr query.Iterator, fn func(aux []interface{}) error) error {
+	switch itr := itr.(type) {
+	case query.FloatIterator:
+		for {
+			p, err := itr.Next()
+			if err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if err := fn(p.Aux); err != nil {
+				return err
+			}
+		}
+	case query.IntegerIterator:
+		for {
+			p, err := itr.Next()
+			if err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if err := fn(p.Aux); err != nil {
+				return err
+			}
+		}
+	case query.UnsignedIterator:
+		for {
+			p, err := itr.Next()
+			if err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if err := fn(p.Aux); err != nil {
+				return err
+			}
+		}
+	case query.StringIterator:
+		for {
+			p, err := itr.Next()
+			if err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if err := fn(p.Aux); err != nil {
+				return err
+			}
+		}
+	case query.BooleanIterator:
+		for {
+			p, err := itr.Next()
+			if err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if err := fn(p.Aux); err != nil {
+				return err
+			}
 		}
+	default:
+		return fmt.Errorf("unexpected field keys iterator of type %T", itr)
 	}
+}
 
-	shardIDs, err := s.findShardIDs(mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+// measurementFieldsByFrequency returns the field keys matching the
+// predicate ordered by the number of points in the range, most frequent
+// first. Fields with the same number of points are ordered by name.
+func (s *Store) measurementFieldsByFrequency(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
 	if err != nil {
 		return nil, err
 	}
@@ -426,140 +4272,190 @@ func (s *Store) tagValues(ctx context.Context, mqAttrs *metaqueryAttributes, tag
 		return cursors.EmptyStringIterator, nil
 	}
 
-	tagKeyExpr := &influxql.BinaryExpr{
-		Op: influxql.EQ,
-		LHS: &influxql.VarRef{
-			Val: "_tagKey",
-		},
-		RHS: &influxql.StringLiteral{
-			Val: tagKey,
-		},
-	}
-
-	if mqAttrs.pred != nil {
-		mqAttrs.pred = &influxql.BinaryExpr{
-			Op:  influxql.AND,
-			LHS: tagKeyExpr,
-			RHS: &influxql.ParenExpr{
-				Expr: mqAttrs.pred,
-			},
-		}
-	} else {
-		mqAttrs.pred = tagKeyExpr
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO(jsternberg): Use a real authorizer.
-	auth := query.OpenAuthorizer
-	values, err := s.TSDBStore.TagValues(auth, shardIDs, mqAttrs.pred)
-	if err != nil {
+	var cur reads.SeriesCursor
+	if ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards); err != nil {
 		return nil, err
+	} else if ic == nil {
+		return cursors.EmptyStringIterator, nil
+	} else {
+		cur = ic
 	}
 
-	m := make(map[string]struct{})
-	for _, kvs := range values {
-		for _, kv := range kvs.Values {
-			m[kv.Value] = struct{}{}
+	counts := make(map[string]int64)
+	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, cur)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		n, err := cursorCount(c)
+		c.Close()
+		if err != nil {
+			return nil, err
 		}
+		if n > 0 {
+			counts[string(rs.Tags().Get(fieldKeyBytes))] += n
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
 	}
 
-	names := make([]string, 0, len(m))
-	for name := range m {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
 		names = append(names, name)
 	}
-	sort.Strings(names)
+	sort.Slice(names, func(i, j int) bool {
+		if ci, cj := counts[names[i]], counts[names[j]]; ci != cj {
+			return ci > cj
+		}
+		return names[i] < names[j]
+	})
 	return cursors.NewStringSliceIterator(names), nil
 }
 
-func (s *Store) MeasurementNames(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
-	if mqAttrs.pred != nil {
-		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
-			// If there is a predicate on _field, we cannot use the index
-			// to filter out unwanted measurement names. Use a slower
-			// block scan instead.
-			return s.tagValuesSlow(ctx, mqAttrs, measurementKey)
-		}
+// tagValuesByRecency returns the values of tagKey ordered by the time of the
+// most recent point of a series with the value, most recent first.
+func (s *Store) tagValuesByRecency(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardIDs) == 0 {
+		return cursors.EmptyStringIterator, nil
 	}
 
-	// TODO(jsternberg): Use a real authorizer.
-	auth := query.OpenAuthorizer
-	values, err := s.TSDBStore.MeasurementNames(auth, mqAttrs.db, mqAttrs.pred)
+	shards, err := s.shards(ctx, shardIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	m := make(map[string]struct{})
-	for _, name := range values {
-		m[string(name)] = struct{}{}
+	var cur reads.SeriesCursor
+	if ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, shards); err != nil {
+		return nil, err
+	} else if ic == nil {
+		return cursors.EmptyStringIterator, nil
+	} else {
+		cur = ic
 	}
 
-	names := make([]string, 0, len(m))
-	for name := range m {
-		names = append(names, name)
+	key := []byte(tagKey)
+	if tagKey == "_name" {
+		key = measurementKeyBytes
 	}
-	sort.Strings(names)
-	return cursors.NewStringSliceIterator(names), nil
-}
 
-func (s *Store) GetSource(orgID, bucketID uint64) proto.Message {
-	return &readSource{
-		BucketID:       bucketID,
-		OrganizationID: orgID,
-	}
-}
+	opts := ReadOptionsFromContext(ctx)
+	includeEmpty := opts != nil && opts.IncludeEmptyTagValues
 
-func (s *Store) measurementFields(ctx context.Context, mqAttrs *metaqueryAttributes) (cursors.StringIterator, error) {
-	if mqAttrs.pred != nil {
-		if hasFieldKey := reads.ExprHasKey(mqAttrs.pred, fieldKey); hasFieldKey {
-			return s.tagValuesSlow(ctx, mqAttrs, fieldKey)
+	latest := make(map[string]int64)
+	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, cur)
+	defer rs.Close()
+	for rs.Next() {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
 		}
-
-		// If there predicates on anything besides _measurement, we can't
-		// use the index and need to use the slow path.
-		if hasTagKey(mqAttrs.pred) {
-			return s.tagValuesSlow(ctx, mqAttrs, fieldKey)
+		v := rs.Tags().Get(key)
+		if len(v) == 0 && !includeEmpty {
+			continue
+		}
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		ts, ok, err := cursorLastTimestamp(c)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		if prev, seen := latest[string(v)]; ok && (!seen || ts > prev) {
+			latest[string(v)] = ts
 		}
 	}
-
-	shardIDs, err := s.findShardIDs(mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
-	if err != nil {
+	if err := cur.Err(); err != nil {
 		return nil, err
 	}
-	if len(shardIDs) == 0 {
-		return cursors.EmptyStringIterator, nil
-	}
 
-	sg := s.TSDBStore.ShardGroup(shardIDs)
-	ms := &influxql.Measurement{
-		Database:        mqAttrs.db,
-		RetentionPolicy: mqAttrs.rp,
-		SystemIterator:  "_fieldKeys",
+	vals := make([]string, 0, len(latest))
+	for v := range latest {
+		vals = append(vals, v)
 	}
-	opts := query.IteratorOptions{
-		OrgID:      mqAttrs.orgID,
-		Condition:  mqAttrs.pred,
-		Authorizer: query.OpenAuthorizer,
+	sort.Slice(vals, func(i, j int) bool {
+		if ti, tj := latest[vals[i]], latest[vals[j]]; ti != tj {
+			return ti > tj
+		}
+		return vals[i] < vals[j]
+	})
+	return cursors.NewStringSliceIterator(vals), nil
+}
+
+// cursorFirstTimestamp returns the timestamp of the first point of c, or
+// false if c has no points. Only the first block of c is read. It returns the
+// error of c if reading it failed, or an error if c is not an array cursor of
+// a known type.
+func cursorFirstTimestamp(c cursors.Cursor) (int64, bool, error) {
+	var a []int64
+	switch typedCur := c.(type) {
+	case cursors.IntegerArrayCursor:
+		a = typedCur.Next().Timestamps
+	case cursors.FloatArrayCursor:
+		a = typedCur.Next().Timestamps
+	case cursors.UnsignedArrayCursor:
+		a = typedCur.Next().Timestamps
+	case cursors.BooleanArrayCursor:
+		a = typedCur.Next().Timestamps
+	case cursors.StringArrayCursor:
+		a = typedCur.Next().Timestamps
+	default:
+		return 0, false, fmt.Errorf("unexpected cursor type %T", typedCur)
 	}
-	iter, err := sg.CreateIterator(ctx, ms, opts)
-	if err != nil {
-		return nil, err
+	if len(a) == 0 {
+		return 0, false, c.Err()
 	}
-	defer func() { _ = iter.Close() }()
+	return a[0], true, nil
+}
 
-	var fieldNames []string
-	fitr := iter.(query.FloatIterator)
-	for p, _ := fitr.Next(); p != nil; p, _ = fitr.Next() {
-		if len(p.Aux) >= 1 {
-			fieldNames = append(fieldNames, p.Aux[0].(string))
+// cursorLastTimestamp returns the timestamp of the last point of c, or false
+// if c has no points. It returns the error of c if reading it failed, or an
+// error if c is not an array cursor of a known type.
+func cursorLastTimestamp(c cursors.Cursor) (int64, bool, error) {
+	var ts int64
+	var ok bool
+	for {
+		var a []int64
+		switch typedCur := c.(type) {
+		case cursors.IntegerArrayCursor:
+			a = typedCur.Next().Timestamps
+		case cursors.FloatArrayCursor:
+			a = typedCur.Next().Timestamps
+		case cursors.UnsignedArrayCursor:
+			a = typedCur.Next().Timestamps
+		case cursors.BooleanArrayCursor:
+			a = typedCur.Next().Timestamps
+		case cursors.StringArrayCursor:
+			a = typedCur.Next().Timestamps
+		default:
+			return 0, false, fmt.Errorf("unexpected cursor type %T", typedCur)
+		}
+		if len(a) == 0 {
+			return ts, ok, c.Err()
 		}
+		ts, ok = a[len(a)-1], true
 	}
-
-	sort.Strings(fieldNames)
-	fieldNames = slices.MergeSortedStrings(fieldNames)
-
-	return cursors.NewStringSliceIterator(fieldNames), nil
 }
 
-func cursorHasData(c cursors.Cursor) bool {
+// cursorHasData reports whether the first array read from c holds any values.
+// It returns the error of c if reading it failed, or an error if c is not an
+// array cursor of a known type.
+func cursorHasData(c cursors.Cursor) (bool, error) {
 	var l int
 	switch typedCur := c.(type) {
 	case cursors.IntegerArrayCursor:
@@ -578,9 +4474,58 @@ func cursorHasData(c cursors.Cursor) bool {
 		ia := typedCur.Next()
 		l = ia.Len()
 	default:
-		panic(fmt.Sprintf("unreachable: %T", typedCur))
+		return false, fmt.Errorf("unexpected cursor type %T", typedCur)
+	}
+	if l == 0 {
+		return false, c.Err()
+	}
+	return true, nil
+}
+
+// cursorFieldType returns the type of the values produced by c.
+func cursorFieldType(c cursors.Cursor) cursors.FieldType {
+	switch c.(type) {
+	case cursors.FloatArrayCursor:
+		return cursors.Float
+	case cursors.IntegerArrayCursor:
+		return cursors.Integer
+	case cursors.UnsignedArrayCursor:
+		return cursors.Unsigned
+	case cursors.StringArrayCursor:
+		return cursors.String
+	case cursors.BooleanArrayCursor:
+		return cursors.Boolean
+	default:
+		return cursors.Undefined
+	}
+}
+
+// cursorCount drains c and returns the number of points it produced, or the
+// error of c if reading it failed. It returns an error, without reading c, if
+// c is not an array cursor of a known type.
+func cursorCount(c cursors.Cursor) (int64, error) {
+	var n int64
+	for {
+		var l int
+		switch typedCur := c.(type) {
+		case cursors.IntegerArrayCursor:
+			l = typedCur.Next().Len()
+		case cursors.FloatArrayCursor:
+			l = typedCur.Next().Len()
+		case cursors.UnsignedArrayCursor:
+			l = typedCur.Next().Len()
+		case cursors.BooleanArrayCursor:
+			l = typedCur.Next().Len()
+		case cursors.StringArrayCursor:
+			l = typedCur.Next().Len()
+		default:
+			return 0, fmt.Errorf("unexpected cursor type %T", typedCur)
+		}
+		if l == 0 {
+			return n, c.Err()
+		}
+		n += int64(l)
 	}
-	return l != 0
 }
 
 // tagValuesSlow will determine the tag values for the given tagKey.
@@ -590,27 +4535,207 @@ func cursorHasData(c cursors.Cursor) bool {
 // of correlating fields to tag values, so we sometimes need to consult tsm to
 // provide an accurate answer.
 func (s *Store) tagValuesSlow(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (cursors.StringIterator, error) {
-	shardIDs, err := s.findShardIDs(mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	set, truncated, err := s.tagValueSetSlow(ctx, mqAttrs, tagKey)
 	if err != nil {
 		return nil, err
 	}
+	return distinctValuesIterator(ctx, newValueLimit(ctx, mqAttrs).values(set), truncated)
+}
+
+// tagValueSetSlow returns the distinct values of tagKey served by
+// tagValuesSlow, before they are sorted, and whether any were ignored
+// because of MaxDistinctValues.
+func (s *Store) tagValueSetSlow(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (map[string]struct{}, bool, error) {
+	sets, truncated, err := s.tagValuesSlowSets(ctx, mqAttrs, []string{tagKey}, newValueLimit(ctx, mqAttrs))
+	if err != nil {
+		return nil, false, err
+	}
+	if re := measurementNameRegexFromContext(ctx); re != nil && tagKey == measurementKey {
+		for name := range sets[0] {
+			if !re.MatchString(name) {
+				delete(sets[0], name)
+			}
+		}
+	}
+	return sets[0], truncated, nil
+}
+
+// tagValuesSlowSets performs the block scan of tagValuesSlow once,
+// collecting the values of each of tagKeys. The returned sets are in the
+// same order as tagKeys. The values of each set are bounded by limit, and
+// truncated reports whether any value was ignored because of its max. A
+// series without a key contributes the empty value to its set only if the
+// IncludeEmptyTagValues read option is set, as for the index path.
+//
+// The shards are scanned by up to SlowScanConcurrency workers, each
+// collecting the values of a shard, which are then merged. As the values
+// retained by a max are those found first, scans bounded by a max are
+// serial.
+//
+// The scan is logged at debug level when it starts, with the reason the index
+// could not be used, and when it finishes, with the number of shards scanned
+// and the time taken, so that predicates defeating the index can be found.
+func (s *Store) tagValuesSlowSets(ctx context.Context, mqAttrs *metaqueryAttributes, tagKeys []string, limit valueLimit) (_ []map[string]struct{}, _ bool, err error) {
+	var shardN int
+	if log := s.Logger; log.Core().Enabled(zap.DebugLevel) {
+		var pred string
+		if mqAttrs.pred != nil {
+			pred = mqAttrs.pred.String()
+		}
+		log = log.With(
+			zap.String("database", mqAttrs.db),
+			zap.String("retention_policy", mqAttrs.rp),
+			zap.Strings("tag_keys", tagKeys),
+			zap.String("predicate", pred),
+			zap.String("reason", slowPathReason(mqAttrs.pred)))
+		log.Debug("Tag values falling back to block scan")
+
+		start := time.Now()
+		defer func() {
+			log.Debug("Tag values block scan finished",
+				zap.Int("shards", shardN),
+				zap.Duration("elapsed", time.Since(start)),
+				zap.Error(err))
+		}()
+	}
+
+	keys := make([][]byte, len(tagKeys))
+	for i := range tagKeys {
+		keys[i] = []byte(tagKeys[i])
+	}
+
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, false, err
+	}
+	shardN = len(shardIDs)
+	setSpanTag(ctx, spanTagShards, len(shardIDs))
 	if len(shardIDs) == 0 {
-		return cursors.EmptyStringIterator, nil
+		return newValueSets(len(keys)), false, nil
+	}
+
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	includeEmpty := opts != nil && opts.IncludeEmptyTagValues
+
+	n := s.slowScanConcurrency()
+	if n <= 1 || len(shards) == 1 || limit.max > 0 {
+		return scanTagValueSets(ctx, mqAttrs, shards, keys, limit, includeEmpty)
+	}
+
+	type shardValues struct {
+		sets      []map[string]struct{}
+		truncated bool
+	}
+	results := make([]shardValues, len(shards))
+	sem := make(chan struct{}, n)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range shards {
+		i := i
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-gctx.Done():
+				return checkContext(gctx)
+			}
+			// The predicate is cloned, as the cursors of the shards are
+			// not guaranteed to leave it unmodified.
+			attrs := *mqAttrs
+			attrs.pred = influxql.CloneExpr(mqAttrs.pred)
+			var err error
+			results[i].sets, results[i].truncated, err = scanTagValueSets(gctx, &attrs, shards[i:i+1], keys, limit, includeEmpty)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, false, err
+	}
+
+	sets := newValueSets(len(keys))
+	var truncated bool
+	for _, r := range results {
+		truncated = truncated || r.truncated
+		for i, m := range r.sets {
+			for v := range m {
+				limit.add(sets[i], v)
+			}
+		}
+	}
+	return sets, truncated, nil
+}
+
+// The reasons logged by tagValuesSlowSets for a block scan.
+const (
+	slowPathReasonFieldPredicate = "field predicate"
+	slowPathReasonTagPredicate   = "tag predicate"
+	slowPathReasonRequest        = "request"
+)
+
+// slowPathReason returns the reason the values of a request with the
+// predicate pred are found by a block scan rather than the index: the
+// predicate compares _field, which the index does not relate to series, or
+// compares tags, which the index does not relate to fields. Otherwise the
+// request itself requires a block scan, such as ActiveMeasurements.
+func slowPathReason(pred influxql.Expr) string {
+	switch {
+	case pred != nil && reads.ExprHasKey(pred, fieldKey):
+		return slowPathReasonFieldPredicate
+	case pred != nil && hasTagKey(pred):
+		return slowPathReasonTagPredicate
+	default:
+		return slowPathReasonRequest
+	}
+}
+
+// slowScanConcurrency returns the number of shards scanned concurrently by
+// the block scans of tagValuesSlowSets.
+func (s *Store) slowScanConcurrency() int {
+	if s.SlowScanConcurrency > 0 {
+		return s.SlowScanConcurrency
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// newValueSets returns n empty sets of values.
+func newValueSets(n int) []map[string]struct{} {
+	sets := make([]map[string]struct{}, n)
+	for i := range sets {
+		sets[i] = make(map[string]struct{})
 	}
+	return sets
+}
+
+// scanTagValueSets collects the values of each of keys from the series of
+// shards with data in the range of mqAttrs, as described by
+// tagValuesSlowSets.
+func scanTagValueSets(ctx context.Context, mqAttrs *metaqueryAttributes, shards []*tsdb.Shard, keys [][]byte, limit valueLimit, includeEmpty bool) ([]map[string]struct{}, bool, error) {
+	sets := newValueSets(len(keys))
 
 	var cur reads.SeriesCursor
-	if ic, err := newIndexSeriesCursorInfluxQLPred(ctx, mqAttrs.pred, s.TSDBStore.Shards(shardIDs)); err != nil {
-		return nil, err
+	if ic, err := newIndexSeriesCursorMeasurements(ctx, mqAttrs.pred, shards, mqAttrs.measurements); err != nil {
+		return nil, false, err
 	} else if ic == nil {
-		return cursors.EmptyStringIterator, nil
+		return sets, false, nil
 	} else {
+		if opts := ReadOptionsFromContext(ctx); opts != nil {
+			ic.evalMax = opts.MaxPredicateEvalTime
+		}
 		cur = ic
 	}
-	m := make(map[string]struct{})
 
 	rs := reads.NewFilteredResultSet(ctx, mqAttrs.start, mqAttrs.end, cur)
+	defer rs.Close()
+	var truncated bool
 	for rs.Next() {
-		func() {
+		if err := checkContext(ctx); err != nil {
+			return nil, false, err
+		}
+		err := func() error {
 			c := rs.Cursor()
 			if c == nil {
 				// no data for series key + field combination?
@@ -618,21 +4743,353 @@ func (s *Store) tagValuesSlow(ctx context.Context, mqAttrs *metaqueryAttributes,
 				// combo that the cursor may be not nil. We need to
 				// request invoke an array cursor to be sure.
 				// This is the reason for the call to cursorHasData below.
-				return
+				return nil
 			}
 			defer c.Close()
 
-			if cursorHasData(c) {
-				f := rs.Tags().Get([]byte(tagKey))
-				m[string(f)] = struct{}{}
+			hasData, err := cursorHasData(c)
+			if hasData {
+				tags := rs.Tags()
+				for i, key := range keys {
+					f := tags.Get(key)
+					if len(f) == 0 && !includeEmpty {
+						continue
+					}
+					if !limit.add(sets[i], string(f)) {
+						truncated = true
+					}
+				}
 			}
+			return err
 		}()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, false, err
+	}
+	return sets, truncated, nil
+}
+
+// TagValuePathsDiff lists the values returned by only one of the paths
+// compared by CompareTagValuePaths. Both lists are sorted.
+type TagValuePathsDiff struct {
+	IndexOnly []string // IndexOnly are the values returned only by the index path.
+	ScanOnly  []string // ScanOnly are the values returned only by the block scan.
+}
+
+// CompareTagValuePaths is a diagnostic that reads the values of the tag key
+// of req both by the path TagValues takes, which uses the index where the
+// predicate permits, and by a block scan. It reports whether the paths agree
+// and the values returned by only one of them. The index reports series that
+// have no points in the requested range, which the block scan omits, so the
+// paths may legitimately diverge for such series.
+func (s *Store) CompareTagValuePaths(ctx context.Context, req *datatypes.TagValuesRequest) (_ bool, _ TagValuePathsDiff, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("CompareTagValuePaths"); err != nil {
+		return false, TagValuePathsDiff{}, err
+	}
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return false, TagValuePathsDiff{}, err
+	}
+	defer release()
+
+	return s.compareTagValuePaths(ctx, mqAttrs, req.TagKey)
+}
+
+func (s *Store) compareTagValuePaths(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (bool, TagValuePathsDiff, error) {
+	key, ok := measurementRemap[tagKey]
+	if !ok {
+		key = tagKey
+	}
+
+	// Both paths may modify the attributes, so each is given a copy.
+	indexAttrs, scanAttrs := *mqAttrs, *mqAttrs
+
+	// The paths are compared in full, so their values are not limited.
+	indexAttrs.limit, scanAttrs.limit = 0, 0
+	indexAttrs.offset, scanAttrs.offset = 0, 0
+	if opts := ReadOptionsFromContext(ctx); opts != nil && opts.MaxDistinctValues > 0 {
+		o := *opts
+		o.MaxDistinctValues = 0
+		ctx = NewContextWithReadOptions(ctx, &o)
+	}
+
+	var (
+		itr cursors.StringIterator
+		err error
+	)
+	switch key {
+	case "_name":
+		itr, err = s.MeasurementNames(ctx, &indexAttrs)
+	case "_field":
+		itr, err = s.measurementFields(ctx, &indexAttrs)
+	default:
+		itr, err = s.tagValues(ctx, &indexAttrs, key)
+	}
+	if err != nil {
+		return false, TagValuePathsDiff{}, err
+	}
+	index := cursors.StringIteratorToSlice(itr)
+
+	scanKey := key
+	if key == "_name" {
+		scanKey = measurementKey
+	}
+	sets, _, err := s.tagValuesSlowSets(ctx, &scanAttrs, []string{scanKey}, valueLimit{})
+	if err != nil {
+		return false, TagValuePathsDiff{}, err
+	}
+	scan := sortedSet(sets[0])
+
+	var diff TagValuePathsDiff
+	i, j := 0, 0
+	for i < len(index) || j < len(scan) {
+		switch {
+		case j == len(scan) || (i < len(index) && index[i] < scan[j]):
+			diff.IndexOnly = append(diff.IndexOnly, index[i])
+			i++
+		case i == len(index) || index[i] > scan[j]:
+			diff.ScanOnly = append(diff.ScanOnly, scan[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return len(diff.IndexOnly) == 0 && len(diff.ScanOnly) == 0, diff, nil
+}
+
+// TagEnumerationPath is the method by which the values of a tag key are
+// enumerated.
+type TagEnumerationPath int
+
+const (
+	// TagEnumerationIndex reads the values from the index of the shards.
+	TagEnumerationIndex TagEnumerationPath = iota
+
+	// TagEnumerationScan reads the values of the series with points in the
+	// range with a block scan, which is considerably more expensive.
+	TagEnumerationScan
+)
+
+func (p TagEnumerationPath) String() string {
+	switch p {
+	case TagEnumerationIndex:
+		return "index"
+	case TagEnumerationScan:
+		return "scan"
+	default:
+		return fmt.Sprintf("TagEnumerationPath(%d)", int(p))
+	}
+}
+
+// TagEnumerationPlan describes how TagValues enumerates the values of a tag
+// key.
+type TagEnumerationPlan struct {
+	Path   TagEnumerationPath
+	Reason string
+}
+
+// ExplainTagEnumeration returns the path by which TagValues enumerates the
+// values of the tag key of req for its predicate and the read options of
+// ctx, and the reason it is chosen, without reading any values. It fails
+// like TagValues if the predicate compares field values.
+func (s *Store) ExplainTagEnumeration(ctx context.Context, req *datatypes.TagValuesRequest) (_ TagEnumerationPlan, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	mqAttrs, release, err := s.tagValuesRequestAttrs(ctx, req)
+	if err != nil {
+		return TagEnumerationPlan{}, err
+	}
+	defer release()
+
+	return s.explainTagEnumeration(ctx, mqAttrs, req.TagKey)
+}
+
+func (s *Store) explainTagEnumeration(ctx context.Context, mqAttrs *metaqueryAttributes, tagKey string) (TagEnumerationPlan, error) {
+	var hasField bool
+	if mqAttrs.pred != nil {
+		var hasValue bool
+		if hasField, hasValue = HasFieldKeyOrValue(mqAttrs.pred); hasValue {
+			return TagEnumerationPlan{}, errors.New("field values unsupported")
+		}
+	}
+
+	key, ok := measurementRemap[tagKey]
+	if !ok {
+		key = tagKey
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if opts != nil && opts.V1Compat && (key == "_name" || key == "_field") {
+		return TagEnumerationPlan{Path: TagEnumerationIndex, Reason: "V1Compat reads measurements and fields from the index"}, nil
+	}
+	if opts != nil && opts.SortTagValuesByRecency {
+		return TagEnumerationPlan{Path: TagEnumerationScan, Reason: "SortTagValuesByRecency requires the time of the points of each value"}, nil
+	}
+
+	switch {
+	case key == "_field" && opts != nil && opts.SortFieldsByFrequency:
+		return TagEnumerationPlan{Path: TagEnumerationScan, Reason: "SortFieldsByFrequency requires the number of points of each field"}, nil
+	case hasField:
+		return TagEnumerationPlan{Path: TagEnumerationScan, Reason: "the predicate compares _field, which is not indexed"}, nil
+	case key == "_field" && mqAttrs.pred != nil && hasTagKey(mqAttrs.pred):
+		return TagEnumerationPlan{Path: TagEnumerationScan, Reason: "the predicate compares tags, which the index does not correlate with fields"}, nil
+	}
+	return TagEnumerationPlan{Path: TagEnumerationIndex, Reason: "no option or comparison of the predicate requires a block scan"}, nil
+}
+
+// ReadPath is the path by which ReadFilter selects the series of a read.
+type ReadPath int
+
+const (
+	// ReadPathIndex selects the series matching the predicate from the
+	// index.
+	ReadPathIndex ReadPath = iota
+	// ReadPathScan selects the series matching the measurement and tag
+	// comparisons of the predicate from the index, and evaluates its
+	// comparisons of _field and field values against each series.
+	ReadPathScan
+)
+
+func (p ReadPath) String() string {
+	switch p {
+	case ReadPathIndex:
+		return "index"
+	case ReadPathScan:
+		return "scan"
+	default:
+		return fmt.Sprintf("ReadPath(%d)", int(p))
+	}
+}
+
+// ReadPlan describes how ReadFilter reads a request.
+type ReadPlan struct {
+	Database string
+	// RetentionPolicies are the retention policies read, which are those of
+	// the RetentionPolicies read option if it is set.
+	RetentionPolicies []string
+	// ShardIDs are the shards selected for the range of the read, in the
+	// order they are read.
+	ShardIDs []uint64
+	// Predicate is the InfluxQL translation of the predicate of the read, or
+	// empty if it has none.
+	Predicate string
+	Path      ReadPath
+	Reason    string
+}
+
+// ExplainRead returns the plan by which ReadFilter reads req with the read
+// options of ctx, without rehydrating or reading any shards. It fails like
+// ReadFilter if the request is invalid.
+func (s *Store) ExplainRead(ctx context.Context, req *datatypes.ReadFilterRequest) (_ ReadPlan, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("ExplainRead"); err != nil {
+		return ReadPlan{}, err
+	}
+
+	if req.ReadSource == nil {
+		return ReadPlan{}, ErrMissingReadSource
+	}
+
+	opts := ReadOptionsFromContext(ctx)
+	if err := opts.validateReadFilter(req); err != nil {
+		return ReadPlan{}, err
+	}
+
+	source, err := getReadSource(*req.ReadSource)
+	if err != nil {
+		return ReadPlan{}, err
+	}
+
+	release, err := s.acquireOrgRead(source.OrganizationID)
+	if err != nil {
+		return ReadPlan{}, err
+	}
+	defer release()
+
+	if err := s.validatePredicate(req.Predicate); err != nil {
+		return ReadPlan{}, err
+	}
+
+	database, rp, start, end, err := s.validateArgs(source.OrganizationID, source.BucketID, req.Range.Start, req.Range.End)
+	if err != nil {
+		return ReadPlan{}, err
+	}
+
+	pred := req.Predicate
+	if opts != nil && opts.NEQRequiresTag {
+		pred = rewritePredicateNEQRequiresTag(pred)
+	}
+
+	plan := ReadPlan{Database: database}
+	if opts != nil && len(opts.RetentionPolicies) > 0 {
+		di := s.MetaClient.Database(database)
+		if di == nil {
+			return ReadPlan{}, ErrDatabaseNotFound
+		}
+		for _, name := range opts.RetentionPolicies {
+			if di.RetentionPolicy(name) == nil {
+				return ReadPlan{}, fmt.Errorf("%w: %q", ErrRetentionPolicyNotFound, name)
+			}
+			shardIDs, err := s.findRetentionPolicyShardIDs(ctx, database, name, false, start, end)
+			if err != nil {
+				return ReadPlan{}, err
+			}
+			plan.ShardIDs = append(plan.ShardIDs, shardIDs...)
+		}
+		plan.RetentionPolicies = append(plan.RetentionPolicies, opts.RetentionPolicies...)
+	} else {
+		shardIDs, err := s.findShardIDs(ctx, database, rp, req.Descending, start, end)
+		if err != nil {
+			return ReadPlan{}, err
+		}
+		plan.RetentionPolicies = []string{rp}
+		plan.ShardIDs = shardIDs
+	}
+
+	var expr influxql.Expr
+	if root := pred.GetRoot(); root != nil {
+		if expr, err = reads.NodeToExpr(root, measurementRemap); err != nil {
+			return ReadPlan{}, err
+		}
+		plan.Predicate = expr.String()
+	}
+
+	plan.Path, plan.Reason = readPath(expr)
+	return plan, nil
+}
+
+// readPath returns the path by which ReadFilter selects the series matching
+// the translated predicate expr, and the reason it is chosen.
+func readPath(expr influxql.Expr) (ReadPath, string) {
+	switch hasField, hasValue := HasFieldKeyOrValue(expr); {
+	case expr == nil:
+		return ReadPathIndex, "the read has no predicate"
+	case hasValue:
+		return ReadPathScan, "the predicate compares field values, which are not indexed"
+	case hasField:
+		return ReadPathScan, "the predicate compares _field, which is not indexed"
+	default:
+		return ReadPathIndex, "the predicate compares only measurements and tags, which are indexed"
 	}
+}
 
+// sortedSet returns the members of m in ascending order.
+func sortedSet(m map[string]struct{}) []string {
 	names := make([]string, 0, len(m))
 	for name := range m {
 		names = append(names, name)
 	}
 	sort.Strings(names)
-	return cursors.NewStringSliceIterator(names), nil
+	return names
 }
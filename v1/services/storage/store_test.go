@@ -0,0 +1,5967 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/influxql/query"
+	"github.com/influxdata/influxdb/v2/kit/prom/promtest"
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb"
+	"github.com/influxdata/influxdb/v2/tsdb/cursors"
+	_ "github.com/influxdata/influxdb/v2/tsdb/engine"
+	"github.com/influxdata/influxdb/v2/tsdb/engine/tsm1"
+	_ "github.com/influxdata/influxdb/v2/tsdb/index"
+	"github.com/influxdata/influxdb/v2/v1/services/meta"
+	"github.com/influxdata/influxql"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/time/rate"
+)
+
+const (
+	testOrgID    = 0x1000
+	testBucketID = 0x2000
+)
+
+// testMetaClient is an in-memory MetaClient holding a single database.
+type testMetaClient struct {
+	db *meta.DatabaseInfo
+}
+
+func (c *testMetaClient) Database(name string) *meta.DatabaseInfo {
+	if c.db == nil || c.db.Name != name {
+		return nil
+	}
+	return c.db
+}
+
+func (c *testMetaClient) ShardGroupsByTimeRange(database, policy string, min, max time.Time) ([]meta.ShardGroupInfo, error) {
+	di := c.Database(database)
+	if di == nil {
+		return nil, fmt.Errorf("database not found: %s", database)
+	}
+	rpi := di.RetentionPolicy(policy)
+	if rpi == nil {
+		return nil, fmt.Errorf("retention policy not found: %s", policy)
+	}
+	var groups []meta.ShardGroupInfo
+	for _, g := range rpi.ShardGroups {
+		if g.Deleted() || !g.Overlaps(min, max) {
+			continue
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// testStore is a Store backed by a tsdb.Store in a temporary directory.
+type testStore struct {
+	*Store
+	tsdb *tsdb.Store
+	meta *testMetaClient
+}
+
+// mustOpenTSDBStore opens a tsdb.Store in a temporary directory, which is
+// removed when the test completes.
+func mustOpenTSDBStore(tb testing.TB) *tsdb.Store {
+	tb.Helper()
+
+	path, err := ioutil.TempDir("", "storage-store-")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	ts := tsdb.NewStore(path)
+	ts.EngineOptions.IndexVersion = tsdb.InmemIndexName
+	ts.EngineOptions.Config.WALDir = filepath.Join(path, "wal")
+	if err := ts.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = ts.Close()
+		_ = os.RemoveAll(path)
+	})
+	return ts
+}
+
+func newTestStore(tb testing.TB) *testStore {
+	tb.Helper()
+
+	ts := mustOpenTSDBStore(tb)
+	mc := &testMetaClient{
+		db: &meta.DatabaseInfo{
+			Name:                   influxdb.ID(testBucketID).String(),
+			DefaultRetentionPolicy: meta.DefaultRetentionPolicyName,
+			RetentionPolicies: []meta.RetentionPolicyInfo{
+				{Name: meta.DefaultRetentionPolicyName},
+			},
+		},
+	}
+
+	return &testStore{Store: NewStore(ts, mc), tsdb: ts, meta: mc}
+}
+
+// mustWriteShardGroup creates a shard group in rp spanning [start, end) that
+// holds a single shard with the given id and writes lines to it.
+func (s *testStore) mustWriteShardGroup(tb testing.TB, rp string, id uint64, start, end int64, lines ...string) {
+	tb.Helper()
+
+	rpi := s.meta.db.RetentionPolicy(rp)
+	if rpi == nil {
+		s.meta.db.RetentionPolicies = append(s.meta.db.RetentionPolicies, meta.RetentionPolicyInfo{Name: rp})
+		rpi = &s.meta.db.RetentionPolicies[len(s.meta.db.RetentionPolicies)-1]
+	}
+	rpi.ShardGroups = append(rpi.ShardGroups, meta.ShardGroupInfo{
+		ID:        id,
+		StartTime: time.Unix(0, start),
+		EndTime:   time.Unix(0, end),
+		Shards:    []meta.ShardInfo{{ID: id}},
+	})
+
+	if err := s.tsdb.CreateShard(s.meta.db.Name, rp, id, true); err != nil {
+		tb.Fatal(err)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	points, err := models.ParsePointsString(strings.Join(lines, "\n"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := s.tsdb.WriteToShard(id, points); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// mustSnapshotShard writes the cached points of the shard with the given id
+// to a TSM file.
+func (s *testStore) mustSnapshotShard(tb testing.TB, id uint64) *tsm1.Engine {
+	tb.Helper()
+
+	eng, err := s.tsdb.Shard(id).Engine()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	e := eng.(*tsm1.Engine)
+	if err := e.WriteSnapshot(); err != nil {
+		tb.Fatal(err)
+	}
+	return e
+}
+
+func (s *testStore) source(tb testing.TB) *types.Any {
+	tb.Helper()
+	src, err := types.MarshalAny(s.GetSource(testOrgID, testBucketID))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return src
+}
+
+// tagKeysRequest returns a request for the range and influxql predicate of
+// metaqueries taking a *datatypes.TagKeysRequest.
+func (s *testStore) tagKeysRequest(tb testing.TB, start, end int64, pred string) *datatypes.TagKeysRequest {
+	tb.Helper()
+	return &datatypes.TagKeysRequest{
+		TagsSource: s.source(tb),
+		Range:      datatypes.TimestampRange{Start: start, End: end},
+		Predicate:  exprToPredicate(tb, pred),
+	}
+}
+
+// tagValuesRequest returns a request for the values of key in the range and
+// matching the influxql predicate.
+func (s *testStore) tagValuesRequest(tb testing.TB, start, end int64, pred, key string) *datatypes.TagValuesRequest {
+	tb.Helper()
+	return &datatypes.TagValuesRequest{
+		TagsSource: s.source(tb),
+		Range:      datatypes.TimestampRange{Start: start, End: end},
+		Predicate:  exprToPredicate(tb, pred),
+		TagKey:     key,
+	}
+}
+
+func (s *testStore) mqAttrs(start, end int64, pred string) *metaqueryAttributes {
+	attrs := &metaqueryAttributes{
+		orgID: influxdb.ID(testOrgID),
+		db:    s.meta.db.Name,
+		rp:    meta.DefaultRetentionPolicyName,
+		start: start,
+		end:   end,
+	}
+	if pred != "" {
+		attrs.pred = influxql.MustParseExpr(pred)
+	}
+	return attrs
+}
+
+// seriesString formats tags as a comma separated list of key=value pairs.
+func seriesString(tags models.Tags) string {
+	var b strings.Builder
+	for i, t := range tags {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(t.Key)
+		b.WriteByte('=')
+		b.Write(t.Value)
+	}
+	return b.String()
+}
+
+// cursorTimestamps drains c and returns the timestamps of all points.
+func cursorTimestamps(c cursors.Cursor) []int64 {
+	var ts []int64
+	for {
+		var a []int64
+		switch tc := c.(type) {
+		case cursors.FloatArrayCursor:
+			a = tc.Next().Timestamps
+		case cursors.IntegerArrayCursor:
+			a = tc.Next().Timestamps
+		case cursors.UnsignedArrayCursor:
+			a = tc.Next().Timestamps
+		case cursors.StringArrayCursor:
+			a = tc.Next().Timestamps
+		case cursors.BooleanArrayCursor:
+			a = tc.Next().Timestamps
+		}
+		if len(a) == 0 {
+			return ts
+		}
+		ts = append(ts, a...)
+	}
+}
+
+// readAll drains rs, returning the timestamps of every series, keyed by
+// seriesString.
+func readAll(tb testing.TB, rs reads.ResultSet) map[string][]int64 {
+	tb.Helper()
+	got := make(map[string][]int64)
+	if rs == nil {
+		return got
+	}
+	defer rs.Close()
+	for rs.Next() {
+		c := rs.Cursor()
+		if c == nil {
+			continue
+		}
+		got[seriesString(rs.Tags())] = cursorTimestamps(c)
+		c.Close()
+	}
+	if err := rs.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return got
+}
+
+func sortedKeys(m map[string][]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestStore_ReadFilter_SeriesFilter(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=h1 v=1 10",
+		"cpu,host=h2 v=1 10",
+		"cpu,host=h3 v=1 10",
+		"cpu,host=h4 v=1 10",
+	)
+
+	// select hosts whose numeric suffix is even
+	filter := func(key []byte, tags models.Tags) bool {
+		host := tags.Get([]byte("host"))
+		return len(host) > 0 && (host[len(host)-1]-'0')%2 == 0
+	}
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{SeriesFilter: filter})
+
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := sortedKeys(readAll(t, rs))
+	exp := []string{
+		"_field=v,_measurement=cpu,host=h2",
+		"_field=v,_measurement=cpu,host=h4",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected series: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_Descending(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=2 20",
+		"cpu,host=b v=1 30",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=3 1010",
+		"cpu,host=a v=4 1020",
+		"cpu,host=a v=5 1030",
+	)
+
+	read := func(opts *ReadOptions, start, end int64) (map[string][]int64, error) {
+		rs, err := s.ReadFilter(NewContextWithReadOptions(context.Background(), opts), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: start, End: end},
+			Descending: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAll(t, rs), nil
+	}
+
+	got, err := read(nil, 0, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {1030, 1020, 1010, 20, 10},
+		"_field=v,_measurement=cpu,host=b": {30},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	// The range is applied as for an ascending read.
+	got, err = read(nil, 15, 1025)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {1020, 1010, 20},
+		"_field=v,_measurement=cpu,host=b": {30},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("range: got %v, exp %v", got, exp)
+	}
+
+	if _, err := read(&ReadOptions{GapThreshold: time.Second}, 0, 2000); err != ErrInvalidDescending {
+		t.Fatalf("got error %v, exp %v", err, ErrInvalidDescending)
+	}
+}
+
+func TestStore_ReadPointCounts(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a usage=1,idle=1 10",
+		"cpu,host=a usage=2 20",
+		"cpu,host=a usage=3 30",
+		"cpu,host=b usage=1 10",
+		"mem,host=a free=1 10",
+		"mem,host=a free=2 2000", // outside of the requested range
+	)
+
+	got, err := s.ReadPointCounts(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]int64{
+		"cpu,host=a#!~#idle":  1,
+		"cpu,host=a#!~#usage": 3,
+		"cpu,host=b#!~#usage": 1,
+		"mem,host=a#!~#free":  1,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected counts: got %v, exp %v", got, exp)
+	}
+}
+
+// denyTagAuthorizer authorizes reading every series except those with a
+// tag of the given value.
+type denyTagAuthorizer struct {
+	query.Authorizer
+	key, value string
+}
+
+func (a denyTagAuthorizer) AuthorizeSeriesRead(database string, measurement []byte, tags models.Tags) bool {
+	return tags.GetString(a.key) != a.value
+}
+
+func TestStore_Authorizer(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"mem,host=b,region=east v=1 10",
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+		Authorizer: denyTagAuthorizer{Authorizer: query.OpenAuthorizer, key: "host", value: "b"},
+	})
+
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := sortedKeys(readAll(t, rs)), []string{"_field=v,_measurement=cpu,host=a"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("ReadFilter: got %v, exp %v", got, exp)
+	}
+
+	// The index is used without a predicate on _field, and a block scan
+	// with one.
+	for _, pred := range []string{"", `_field = 'v'`} {
+		itr, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "host",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, exp := cursors.StringIteratorToSlice(itr), []string{"a"}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("TagValues, predicate %q: got %v, exp %v", pred, got, exp)
+		}
+	}
+
+	itr, err := s.TagKeys(ctx, &datatypes.TagKeysRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := cursors.StringIteratorToSlice(itr), []string{"_field", "_measurement", "host"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("TagKeys: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadSeriesCardinality(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"mem,host=a free=1,used=1 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=1 1010",
+		"cpu,host=b v=1 1010",
+	)
+
+	for _, tt := range []struct {
+		pred       string
+		start, end int64
+		exp        int64
+	}{
+		{start: 0, end: 2000, exp: 3},
+		{pred: `host = 'a'`, start: 0, end: 2000, exp: 2},
+		{pred: `_field = 'free'`, start: 0, end: 2000, exp: 1},
+		{start: 1000, end: 2000, exp: 2},
+	} {
+		got, err := s.ReadSeriesCardinality(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: tt.start, End: tt.end},
+			Predicate:  exprToPredicate(t, tt.pred),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.exp {
+			t.Errorf("predicate %q, range [%d, %d]: got %d, exp %d", tt.pred, tt.start, tt.end, got, tt.exp)
+		}
+	}
+}
+
+func TestStore_EmptySeries(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 900",
+		"cpu,host=c u=1 10",
+		"cpu,host=c v=1 900",
+		"mem,host=a v=1 900",
+	)
+
+	emptySeries := func(pred string) []string {
+		t.Helper()
+		itr, err := s.EmptySeries(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 100},
+			Predicate:  exprToPredicate(t, pred),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(itr)
+	}
+
+	// Host c has points of one of its fields in the range.
+	if got, exp := emptySeries(""), []string{"cpu,host=b", "mem,host=a"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if got, exp := emptySeries(`_measurement = 'cpu'`), []string{"cpu,host=b"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("with predicate: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_PredicateTooComplex(t *testing.T) {
+	s := newTestStore(t)
+
+	// build tag = 'v' AND (tag = 'v' AND (...)) nested well beyond the limit
+	cmp := func() *datatypes.Node {
+		return &datatypes.Node{
+			NodeType: datatypes.NodeTypeComparisonExpression,
+			Value:    &datatypes.Node_Comparison_{Comparison: datatypes.ComparisonEqual},
+			Children: []*datatypes.Node{
+				{NodeType: datatypes.NodeTypeTagRef, Value: &datatypes.Node_TagRefValue{TagRefValue: "tag"}},
+				{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_StringValue{StringValue: "v"}},
+			},
+		}
+	}
+	root := cmp()
+	for i := 0; i < 10*DefaultMaxPredicateDepth; i++ {
+		root = &datatypes.Node{
+			NodeType: datatypes.NodeTypeLogicalExpression,
+			Value:    &datatypes.Node_Logical_{Logical: datatypes.LogicalAnd},
+			Children: []*datatypes.Node{cmp(), root},
+		}
+	}
+	pred := &datatypes.Predicate{Root: root}
+
+	_, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Predicate:  pred,
+	})
+	if err != ErrPredicateTooComplex {
+		t.Fatalf("ReadFilter: got error %v, exp %v", err, ErrPredicateTooComplex)
+	}
+
+	_, err = s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Predicate:  pred,
+		TagKey:     "tag",
+	})
+	if err != ErrPredicateTooComplex {
+		t.Fatalf("TagValues: got error %v, exp %v", err, ErrPredicateTooComplex)
+	}
+
+	// disabling the limits lets the predicate through validation
+	s.MaxPredicateDepth, s.MaxPredicateNodes = 0, 0
+	if err := s.validatePredicate(pred); err != nil {
+		t.Fatalf("unexpected error with limits disabled: %v", err)
+	}
+}
+
+func TestStore_ReadFilter_ExcludeFields(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		`log,host=a level=1i,msg="a very large message" 10`,
+		`log,host=a level=2i,msg="another very large message" 20`,
+	)
+
+	read := func(opts *ReadOptions) (map[string][]int64, error) {
+		ctx := NewContextWithReadOptions(context.Background(), opts)
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAll(t, rs), nil
+	}
+
+	got, err := read(&ReadOptions{ExcludeFields: []string{"msg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string][]int64{
+		"_field=level,_measurement=log,host=a": {10, 20},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected result: got %v, exp %v", got, exp)
+	}
+
+	_, err = read(&ReadOptions{Fields: []string{"level"}, ExcludeFields: []string{"msg"}})
+	if err != ErrConflictingFieldOptions {
+		t.Fatalf("got error %v, exp %v", err, ErrConflictingFieldOptions)
+	}
+}
+
+func TestStore_ShardGroups(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000)
+
+	got, err := s.ShardGroups(context.Background(), testOrgID, testBucketID, 500, 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []ShardGroupInfo{
+		{ID: 1, StartTime: 0, EndTime: 1000, ShardIDs: []uint64{1}},
+		{ID: 2, StartTime: 1000, EndTime: 2000, ShardIDs: []uint64{2}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected shard groups: got %+v, exp %+v", got, exp)
+	}
+}
+
+// countingMetaClient counts the shard group lookups of a testMetaClient and
+// signals changes of the meta data when changed is closed.
+type countingMetaClient struct {
+	*testMetaClient
+	lookups int
+	changed chan struct{}
+}
+
+func (c *countingMetaClient) ShardGroupsByTimeRange(database, policy string, min, max time.Time) ([]meta.ShardGroupInfo, error) {
+	c.lookups++
+	return c.testMetaClient.ShardGroupsByTimeRange(database, policy, min, max)
+}
+
+func (c *countingMetaClient) WaitForDataChanged() chan struct{} { return c.changed }
+
+func TestStore_ShardGroupCacheTTL(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000)
+
+	mc := &countingMetaClient{testMetaClient: s.meta, changed: make(chan struct{})}
+	now := time.Unix(0, 0)
+	s.MetaClient = mc
+	s.Now = func() time.Time { return now }
+	s.ShardGroupCacheTTL = time.Second
+
+	shardGroups := func(start, end int64) []ShardGroupInfo {
+		got, err := s.ShardGroups(context.Background(), testOrgID, testBucketID, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	check := func(name string, exp int) {
+		t.Helper()
+		if mc.lookups != exp {
+			t.Fatalf("%s: got %d lookups, exp %d", name, mc.lookups, exp)
+		}
+	}
+
+	exp := []ShardGroupInfo{{ID: 1, StartTime: 0, EndTime: 1000, ShardIDs: []uint64{1}}}
+	for i := 0; i < 3; i++ {
+		if got := shardGroups(1, 500); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %+v, exp %+v", got, exp)
+		}
+	}
+	check("cached", 1)
+
+	if got := shardGroups(1, 1500); len(got) != 2 {
+		t.Fatalf("other range: got %+v, exp 2 groups", got)
+	}
+	check("other range", 2)
+
+	now = now.Add(time.Second)
+	shardGroups(1, 500)
+	check("expired", 3)
+
+	// A new shard group is read once the meta data changes.
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 0, 1000)
+	if got := shardGroups(1, 500); len(got) != 1 {
+		t.Fatalf("unchanged: got %+v, exp the cached group", got)
+	}
+	close(mc.changed)
+	mc.changed = make(chan struct{})
+	if got := shardGroups(1, 500); len(got) != 2 {
+		t.Fatalf("changed: got %+v, exp 2 groups", got)
+	}
+	check("changed", 4)
+
+	// Reads select the cached shards.
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 500},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs != nil {
+		rs.Close()
+	}
+	check("read", 4)
+}
+
+func TestStore_ReadFilterBatch(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"mem,host=a v=1 1010",
+	)
+
+	mc := &countingMetaClient{testMetaClient: s.meta}
+	s.MetaClient = mc
+
+	request := func(start, end int64, pred string) *datatypes.ReadFilterRequest {
+		return &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: start, End: end},
+			Predicate:  exprToPredicate(t, pred),
+		}
+	}
+
+	results, err := s.ReadFilterBatch(context.Background(), []*datatypes.ReadFilterRequest{
+		request(1, 2000, `host = 'a'`),
+		request(1, 500, ""),
+		request(1, 2000, `host = 'b'`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, rs := range results {
+		got = append(got, sortedKeys(readAll(t, rs)))
+	}
+	exp := [][]string{
+		{"_field=v,_measurement=cpu,host=a", "_field=v,_measurement=mem,host=a"},
+		{"_field=v,_measurement=cpu,host=a", "_field=v,_measurement=cpu,host=b"},
+		{"_field=v,_measurement=cpu,host=b"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected series: got %v, exp %v", got, exp)
+	}
+	if mc.lookups != 2 {
+		t.Fatalf("got %d shard group lookups, exp 2", mc.lookups)
+	}
+
+	invalid := request(1, 2000, "")
+	invalid.ReadSource = nil
+	if _, err := s.ReadFilterBatch(context.Background(), []*datatypes.ReadFilterRequest{request(1, 2000, ""), invalid}); err != ErrMissingReadSource {
+		t.Fatalf("got error %v, exp %v", err, ErrMissingReadSource)
+	}
+}
+
+// newTagPredicate returns a predicate comparing the tag key with value.
+func newTagPredicate(key string, op datatypes.Node_Comparison, value string) *datatypes.Predicate {
+	return &datatypes.Predicate{
+		Root: &datatypes.Node{
+			NodeType: datatypes.NodeTypeComparisonExpression,
+			Value:    &datatypes.Node_Comparison_{Comparison: op},
+			Children: []*datatypes.Node{
+				{NodeType: datatypes.NodeTypeTagRef, Value: &datatypes.Node_TagRefValue{TagRefValue: key}},
+				{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_StringValue{StringValue: value}},
+			},
+		},
+	}
+}
+
+func TestStore_TagValues_CaseInsensitive(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=Server1,region=east v=1 10",
+		"cpu,host=SERVER1,region=west v=1 10",
+		"cpu,host=server2,region=north v=1 10",
+	)
+
+	tagValues := func(ctx context.Context) []string {
+		iter, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			Predicate:  newTagPredicate("host", datatypes.ComparisonEqual, "server1"),
+			TagKey:     "region",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(iter)
+	}
+
+	if got := tagValues(context.Background()); len(got) != 0 {
+		t.Fatalf("case-sensitive: got %v, expected no values", got)
+	}
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{CaseInsensitiveTagKeys: []string{"host"}})
+	got, exp := tagValues(ctx), []string{"east", "west"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("case-insensitive: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_TagValues_FieldPredicate(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a usage=1 10",
+		"cpu,host=b idle=1 10",
+		"cpu,host=c usage=1,idle=1 10",
+		"mem,host=d usage=1 10",
+	)
+
+	for _, tc := range []struct {
+		pred string
+		exp  []string
+	}{
+		{pred: "", exp: []string{"a", "b", "c", "d"}},
+		{pred: `_field = 'usage'`, exp: []string{"a", "c", "d"}},
+		{pred: `_field = 'idle'`, exp: []string{"b", "c"}},
+		{pred: `_field != 'usage'`, exp: []string{"b", "c"}},
+		{pred: `_measurement = 'cpu' AND _field = 'usage'`, exp: []string{"a", "c"}},
+		{pred: `_field = 'missing'`},
+	} {
+		t.Run(tc.pred, func(t *testing.T) {
+			iter, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+				Predicate:  exprToPredicate(t, tc.pred),
+				TagKey:     "host",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cursors.StringIteratorToSlice(iter)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tc.exp) {
+				t.Fatalf("got %v, exp %v", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestStore_TagValues_SlowScanConcurrency(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 4; i++ {
+		start := int64(i) * 1000
+		s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, uint64(i+1), start, start+1000,
+			fmt.Sprintf("cpu,host=a%d usage=1 %d", i, start+10),
+			fmt.Sprintf("cpu,host=b%d idle=1 %d", i, start+10),
+			fmt.Sprintf("cpu,host=c usage=1 %d", start+10),
+		)
+	}
+
+	tagValues := func(limit int64) []string {
+		iter, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 4000},
+			Predicate:  exprToPredicate(t, `_field = 'usage'`),
+			TagKey:     "host",
+			Limit:      limit,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(iter)
+	}
+
+	for _, n := range []int{1, 2, 8} {
+		s.SlowScanConcurrency = n
+		if got, exp := tagValues(0), []string{"a0", "a1", "a2", "a3", "c"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("concurrency %d: got %v, exp %v", n, got, exp)
+		}
+		if got, exp := tagValues(2), []string{"a0", "a1"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("concurrency %d, limited: got %v, exp %v", n, got, exp)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 4000},
+		Predicate:  exprToPredicate(t, `_field = 'usage'`),
+		TagKey:     "host",
+	})
+	var cerr *ContextError
+	if !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled: got %v, exp a *ContextError for %v", err, context.Canceled)
+	}
+}
+
+func TestStore_NEQRequiresTag(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b,region=west v=1 10",
+		"cpu,region=north v=1 10",
+	)
+
+	for _, tt := range []struct {
+		name       string
+		requireTag bool
+		series     []string
+		regions    []string
+	}{
+		{
+			name: "absent tag matches",
+			series: []string{
+				"_field=v,_measurement=cpu,host=b,region=west",
+				"_field=v,_measurement=cpu,region=north",
+			},
+			regions: []string{"north", "west"},
+		},
+		{
+			name:       "tag required",
+			requireTag: true,
+			series: []string{
+				"_field=v,_measurement=cpu,host=b,region=west",
+			},
+			regions: []string{"west"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{NEQRequiresTag: tt.requireTag})
+			pred := newTagPredicate("host", datatypes.ComparisonNotEqual, "a")
+
+			rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+				Predicate:  pred,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedKeys(readAll(t, rs)); !reflect.DeepEqual(got, tt.series) {
+				t.Errorf("ReadFilter: got %v, exp %v", got, tt.series)
+			}
+
+			iter, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+				Predicate:  pred,
+				TagKey:     "region",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cursors.StringIteratorToSlice(iter); !reflect.DeepEqual(got, tt.regions) {
+				t.Errorf("TagValues: got %v, exp %v", got, tt.regions)
+			}
+		})
+	}
+}
+
+func TestStore_EmptyTagValues(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b v=1 10",
+	)
+
+	// The empty value of region is omitted from the series key.
+	p, err := models.NewPoint("cpu", models.NewTags(map[string]string{"host": "c", "region": ""}), models.Fields{"v": 1.0}, time.Unix(0, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.tsdb.WriteToShard(1, []models.Point{p}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagValues := func(include bool, pred string) []string {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{IncludeEmptyTagValues: include})
+		itr, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "region",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(itr)
+	}
+
+	// The index is used without a predicate on _field, and a block scan
+	// with one.
+	for _, pred := range []string{"", `_field = 'v'`} {
+		if got, exp := tagValues(false, pred), []string{"east"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("exclude, predicate %q: got %v, exp %v", pred, got, exp)
+		}
+		if got, exp := tagValues(true, pred), []string{"", "east"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("include, predicate %q: got %v, exp %v", pred, got, exp)
+		}
+	}
+	for _, pred := range []string{`host = 'a'`, `_field = 'v' AND host = 'a'`} {
+		if got, exp := tagValues(true, pred), []string{"east"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("include, predicate %q: got %v, exp %v", pred, got, exp)
+		}
+	}
+
+	// ReadFilter reports no tag for an empty value, which compares equal to
+	// the empty string.
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		Predicate:  exprToPredicate(t, `region = ''`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := sortedKeys(readAll(t, rs)), []string{
+		"_field=v,_measurement=cpu,host=b",
+		"_field=v,_measurement=cpu,host=c",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got series %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_TagValues_MaxDistinctValues(t *testing.T) {
+	s := newTestStore(t)
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("cpu,host=h%d v=1 10", i))
+	}
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, lines...)
+
+	tagValues := func(opts *ReadOptions, pred string) (cursors.StringIterator, error) {
+		return s.TagValues(NewContextWithReadOptions(context.Background(), opts), &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "host",
+		})
+	}
+
+	// The index is used without a predicate on _field, and a block scan
+	// with one.
+	for _, pred := range []string{"", `_field = 'v'`} {
+		itr, err := tagValues(&ReadOptions{MaxDistinctValues: 4}, pred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursors.StringIteratorToSlice(itr); len(got) != 4 {
+			t.Errorf("predicate %q: got %v, exp 4 values", pred, got)
+		}
+		if !itr.(TruncatedStringIterator).Truncated() {
+			t.Errorf("predicate %q: expected truncation", pred)
+		}
+
+		itr, err = tagValues(&ReadOptions{MaxDistinctValues: 10}, pred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursors.StringIteratorToSlice(itr); len(got) != 10 {
+			t.Errorf("predicate %q: got %v, exp 10 values", pred, got)
+		}
+		if itr.(TruncatedStringIterator).Truncated() {
+			t.Errorf("predicate %q: unexpected truncation", pred)
+		}
+
+		if _, err := tagValues(&ReadOptions{MaxDistinctValues: 4, FailOnMaxDistinctValues: true}, pred); err != ErrTooManyDistinctValues {
+			t.Errorf("predicate %q: got error %v, exp %v", pred, err, ErrTooManyDistinctValues)
+		}
+	}
+}
+
+func TestStore_TagValues_Limit(t *testing.T) {
+	s := newTestStore(t)
+	lines := []string{"cpu v=1 10"}
+	for _, i := range []int{7, 3, 9, 0, 5, 8, 1, 6, 2, 4} {
+		lines = append(lines, fmt.Sprintf("cpu,host=h%d v=1 10", i))
+	}
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, lines...)
+
+	tagValues := func(opts *ReadOptions, limit int64, pred string) []string {
+		itr, err := s.TagValues(NewContextWithReadOptions(context.Background(), opts), &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "host",
+			Limit:      limit,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(itr)
+	}
+
+	// The index is used without a predicate on _field, and a block scan
+	// with one.
+	for _, pred := range []string{"", `_field = 'v'`} {
+		if got, exp := tagValues(nil, 3, pred), []string{"h0", "h1", "h2"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("predicate %q: got %v, exp %v", pred, got, exp)
+		}
+		if got, exp := tagValues(&ReadOptions{IncludeEmptyTagValues: true}, 3, pred), []string{"", "h0", "h1", "h2"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("include empty, predicate %q: got %v, exp %v", pred, got, exp)
+		}
+		if got := tagValues(nil, 20, pred); len(got) != 10 {
+			t.Errorf("predicate %q: got %v, exp 10 values", pred, got)
+		}
+	}
+}
+
+func TestStore_MeasurementNames_Paging(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"m3 v=1 10",
+		"m1 v=1 10",
+		"m4 v=1 10",
+		"m0 v=1 10",
+		"m2 v=1 10",
+	)
+
+	for _, tc := range []struct {
+		offset, limit int64
+		exp           []string
+		more          bool
+	}{
+		{offset: 0, limit: 2, exp: []string{"m0", "m1"}, more: true},
+		{offset: 2, limit: 2, exp: []string{"m2", "m3"}, more: true},
+		{offset: 4, limit: 2, exp: []string{"m4"}},
+		{offset: 5, limit: 2},
+		{offset: 3, exp: []string{"m3", "m4"}},
+	} {
+		// The index is used without a predicate on _field, and a block scan
+		// with one.
+		for _, pred := range []string{"", `_field = 'v'`} {
+			itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+				Predicate:  exprToPredicate(t, pred),
+				TagKey:     "_measurement",
+				Limit:      tc.limit,
+				Offset:     tc.offset,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pitr, ok := itr.(PagedStringIterator)
+			if !ok {
+				t.Fatalf("got %T, exp a PagedStringIterator", itr)
+			}
+			got := cursors.StringIteratorToSlice(pitr)
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tc.exp) || pitr.More() != tc.more {
+				t.Errorf("predicate %q, offset %d, limit %d: got %v, more %v, exp %v, more %v", pred, tc.offset, tc.limit, got, pitr.More(), tc.exp, tc.more)
+			}
+		}
+	}
+}
+
+func TestStore_TagValuesForKeys_MatchesTagValues(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east usage=1 10",
+		"cpu,host=b,region=east usage=1 10",
+		"cpu,host=c,region=west idle=1 10",
+		"cpu,host=d,region=west,service=db usage=1 10",
+		"mem,host=a,region=north free=1 10",
+	)
+
+	for _, tc := range []struct {
+		name string
+		opts *ReadOptions
+	}{
+		{name: "default"},
+		{name: "include empty", opts: &ReadOptions{IncludeEmptyTagValues: true}},
+	} {
+		for _, pred := range []string{"", `region = 'east'`, `_field = 'usage'`} {
+			t.Run(tc.name+"/"+pred, func(t *testing.T) {
+				ctx := NewContextWithReadOptions(context.Background(), tc.opts)
+				// Some series matching each predicate have no service tag.
+				keys := []string{"host", "region", "service", "_measurement", "_field"}
+				req := s.tagValuesRequest(t, 1, 1000, pred, "")
+				req.TagKeys = keys
+				got, err := s.TagValuesForKeys(ctx, req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i, key := range keys {
+					itr, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+						TagsSource: s.source(t),
+						Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+						Predicate:  exprToPredicate(t, pred),
+						TagKey:     key,
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					exp := cursors.StringIteratorToSlice(itr)
+					if len(exp) == 0 {
+						exp = []string{}
+					}
+					if got[i].Key != key || !reflect.DeepEqual(got[i].Values, exp) || got[i].Truncated {
+						t.Errorf("key %q: got %+v, exp values %v", key, got[i], exp)
+					}
+				}
+			})
+		}
+	}
+
+	req := s.tagValuesRequest(t, 1, 1000, "", "")
+	req.TagKeys, req.Limit = []string{"host", "region", "_field"}, 2
+	got, err := s.TagValuesForKeys(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []TagKeyValues{
+		{Key: "host", Values: []string{"a", "b"}, Truncated: true},
+		{Key: "region", Values: []string{"east", "north"}, Truncated: true},
+		{Key: "_field", Values: []string{"free", "idle"}, Truncated: true},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("limit: got %+v, exp %+v", got, exp)
+	}
+}
+
+func TestStore_TagValuesForKeys(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east usage=1 10",
+		"cpu,host=b,region=west idle=1 10",
+		"mem,host=c,service=db free=1 10",
+	)
+
+	keys := []string{"host", "service", "_measurement", "_field"}
+	for _, tc := range []struct {
+		pred string
+		exp  [][]string
+	}{
+		{
+			exp: [][]string{{"a", "b", "c"}, {"db"}, {"cpu", "mem"}, {"free", "idle", "usage"}},
+		},
+		{
+			pred: `region = 'east'`,
+			exp:  [][]string{{"a"}, {}, {"cpu"}, {"usage"}},
+		},
+		{
+			pred: `_field = 'free'`,
+			exp:  [][]string{{"c"}, {"db"}, {"mem"}, {"free"}},
+		},
+	} {
+		t.Run(tc.pred, func(t *testing.T) {
+			got, err := s.TagValuesForKeys(context.Background(), &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+				Predicate:  exprToPredicate(t, tc.pred),
+				TagKeys:    keys,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp := make([]TagKeyValues, len(keys))
+			for i, key := range keys {
+				exp[i] = TagKeyValues{Key: key, Values: tc.exp[i]}
+			}
+			if !reflect.DeepEqual(got, exp) {
+				t.Fatalf("got %+v, exp %+v", got, exp)
+			}
+		})
+	}
+
+	if _, err := s.TagValuesForKeys(context.Background(), &datatypes.TagValuesRequest{TagKeys: keys}); err != ErrMissingReadSource {
+		t.Fatalf("got %v, exp %v", err, ErrMissingReadSource)
+	}
+	if _, err := s.TagValuesForKeys(context.Background(), s.tagValuesRequest(t, 0, 1000, "", "")); err == nil {
+		t.Fatal("expected an error without tag keys")
+	}
+}
+
+func TestStore_TagValuesRegex(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east usage=1 10",
+		"cpu,host=b,region=west idle=1 10",
+		"mem,hostname=x,zone=z1 free=1 10",
+	)
+
+	for _, tc := range []struct {
+		name  string
+		re    string
+		pred  string
+		limit int64
+		exp   []TagKeyValues
+	}{
+		{
+			name: "prefix",
+			re:   `^host`,
+			exp: []TagKeyValues{
+				{Key: "host", Values: []string{"a", "b"}},
+				{Key: "hostname", Values: []string{"x"}},
+			},
+		},
+		{
+			name: "tag predicate",
+			re:   `^host`,
+			pred: `_name = 'cpu'`,
+			exp: []TagKeyValues{
+				{Key: "host", Values: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "field predicate",
+			re:   `^(host|region)$`,
+			pred: `_field = 'usage'`,
+			exp: []TagKeyValues{
+				{Key: "host", Values: []string{"a"}},
+				{Key: "region", Values: []string{"east"}},
+			},
+		},
+		{
+			name: "system keys",
+			re:   `^_`,
+		},
+		{
+			name:  "limit",
+			re:    `.`,
+			limit: 1,
+			exp: []TagKeyValues{
+				{Key: "host", Values: []string{"a"}, Truncated: true},
+				{Key: "hostname", Values: []string{"x"}},
+				{Key: "region", Values: []string{"east"}, Truncated: true},
+				{Key: "zone", Values: []string{"z1"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := s.tagValuesRequest(t, 1, 1000, tc.pred, "")
+			req.TagKeyRegex, req.Limit = tc.re, tc.limit
+			got, err := s.TagValuesRegex(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tc.exp) {
+				t.Fatalf("got %+v, exp %+v", got, tc.exp)
+			}
+		})
+	}
+}
+
+// exprToPredicate converts an influxql expression consisting of tag
+// comparisons joined by AND or OR to a predicate.
+func exprToPredicate(tb testing.TB, s string) *datatypes.Predicate {
+	tb.Helper()
+	if s == "" {
+		return nil
+	}
+
+	var conv func(expr influxql.Expr) *datatypes.Node
+	conv = func(expr influxql.Expr) *datatypes.Node {
+		switch e := expr.(type) {
+		case *influxql.ParenExpr:
+			return conv(e.Expr)
+		case *influxql.BinaryExpr:
+			switch e.Op {
+			case influxql.AND, influxql.OR:
+				op := datatypes.LogicalAnd
+				if e.Op == influxql.OR {
+					op = datatypes.LogicalOr
+				}
+				return &datatypes.Node{
+					NodeType: datatypes.NodeTypeLogicalExpression,
+					Value:    &datatypes.Node_Logical_{Logical: op},
+					Children: []*datatypes.Node{conv(e.LHS), conv(e.RHS)},
+				}
+			}
+
+			var op datatypes.Node_Comparison
+			switch e.Op {
+			case influxql.EQ:
+				op = datatypes.ComparisonEqual
+			case influxql.NEQ:
+				op = datatypes.ComparisonNotEqual
+			case influxql.EQREGEX:
+				op = datatypes.ComparisonRegex
+			case influxql.NEQREGEX:
+				op = datatypes.ComparisonNotRegex
+			default:
+				tb.Fatalf("unsupported operator %s", e.Op)
+			}
+
+			lhs := &datatypes.Node{NodeType: datatypes.NodeTypeTagRef, Value: &datatypes.Node_TagRefValue{TagRefValue: e.LHS.(*influxql.VarRef).Val}}
+			var rhs *datatypes.Node
+			switch lit := e.RHS.(type) {
+			case *influxql.StringLiteral:
+				rhs = &datatypes.Node{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_StringValue{StringValue: lit.Val}}
+			case *influxql.RegexLiteral:
+				rhs = &datatypes.Node{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_RegexValue{RegexValue: lit.Val.String()}}
+			default:
+				tb.Fatalf("unsupported literal %T", e.RHS)
+			}
+			return &datatypes.Node{
+				NodeType: datatypes.NodeTypeComparisonExpression,
+				Value:    &datatypes.Node_Comparison_{Comparison: op},
+				Children: []*datatypes.Node{lhs, rhs},
+			}
+		}
+		tb.Fatalf("unsupported expression %T", expr)
+		return nil
+	}
+	return &datatypes.Predicate{Root: conv(influxql.MustParseExpr(s))}
+}
+
+func TestStore_ReadFilter_MaxResponseBytes(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=2 20",
+		"cpu,host=a v=3 30",
+		"cpu,host=a v=4 40",
+		"cpu,host=a v=5 50",
+		"cpu,host=b v=1 10",
+	)
+
+	// _field=v, _measurement=cpu and host=a take 27 bytes and each float
+	// point 16 bytes, leaving room for 3 points of the first series.
+	const limit = 27 + 3*16
+
+	read := func(fail bool) (TruncatedResultSet, []int64) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+			MaxResponseBytes:       limit,
+			FailOnMaxResponseBytes: fail,
+		})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		trs := rs.(TruncatedResultSet)
+		var ts []int64
+		for trs.Next() {
+			if c := trs.Cursor(); c != nil {
+				ts = append(ts, cursorTimestamps(c)...)
+				c.Close()
+			}
+		}
+		trs.Close()
+		return trs, ts
+	}
+
+	rs, ts := read(false)
+	if exp := []int64{10, 20, 30}; !reflect.DeepEqual(ts, exp) {
+		t.Fatalf("unexpected timestamps: got %v, exp %v", ts, exp)
+	}
+	if !rs.Truncated() {
+		t.Fatal("expected result set to be truncated")
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rs, _ = read(true)
+	if err := rs.Err(); err != ErrResponseTooLarge {
+		t.Fatalf("got error %v, exp %v", err, ErrResponseTooLarge)
+	}
+}
+
+func TestStore_TagValues_SortFieldsByFrequency(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a a=1,b=1,c=1 10",
+		"cpu,host=a a=1,c=1 20",
+		"cpu,host=b a=1 20",
+		"cpu,host=b d=1 2000", // outside of the requested range
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{SortFieldsByFrequency: true})
+	iter, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		TagKey:     "_field",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, exp := cursors.StringIteratorToSlice(iter), []string{"a", "c", "b"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected fields: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_OpenSnapshot(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+
+	// The store hides the Snapshot method of the tsdb.Store.
+	unsupported := *s.Store
+	unsupported.TSDBStore = struct{ TSDBStore }{s.tsdb}
+	if _, err := unsupported.OpenSnapshot(context.Background(), testOrgID, testBucketID, 1, 1000); err != ErrSnapshotUnsupported {
+		t.Fatalf("got error %v, exp %v", err, ErrSnapshotUnsupported)
+	}
+
+	snap, err := s.OpenSnapshot(context.Background(), testOrgID, testBucketID, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	points, err := models.ParsePointsString("cpu,host=a v=2 20\ncpu,host=b v=1 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.tsdb.WriteToShard(1, points); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(st *Store) map[string][]int64 {
+		rs, err := st.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)
+	}
+
+	got, exp := read(snap.Store), map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {10},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("snapshot: got %v, exp %v", got, exp)
+	}
+
+	got, exp = read(s.Store), map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {10, 20},
+		"_field=v,_measurement=cpu,host=b": {20},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("live: got %v, exp %v", got, exp)
+	}
+
+	// Shard groups created or deleted after the snapshot was opened are
+	// not seen by its reads.
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 0, 1000, "cpu,host=c v=1 30")
+	s.meta.db.RetentionPolicy(meta.DefaultRetentionPolicyName).ShardGroups[0].DeletedAt = time.Unix(0, 1)
+	snap.MissingShardPolicy = MissingShardError
+
+	got, exp = read(snap.Store), map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {10},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("snapshot after shard group changes: got %v, exp %v", got, exp)
+	}
+
+	got, exp = read(s.Store), map[string][]int64{
+		"_field=v,_measurement=cpu,host=c": {30},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("live after shard group changes: got %v, exp %v", got, exp)
+	}
+
+	// The snapshot shares the reads in flight of the store.
+	s.MaxConcurrentReadsPerOrg, snap.MaxConcurrentReadsPerOrg = 1, 1
+	req := &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+	}
+	rs, err := s.ReadFilter(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := snap.ReadFilter(context.Background(), req); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("snapshot: got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+	rs.Close()
+
+	if err := snap.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_RateLimit(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+
+	// The bucket does not refill during the test, so exactly burst requests
+	// are allowed.
+	s.RateLimiters = map[string]*rate.Limiter{
+		"TagValues": rate.NewLimiter(rate.Every(time.Hour), 2),
+	}
+
+	req := &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		TagKey:     "host",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.TagValues(context.Background(), req); err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	if _, err := s.TagValues(context.Background(), req); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+
+	// Methods without a limiter are unaffected.
+	if _, err := s.TagKeys(context.Background(), &datatypes.TagKeysRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_ReadFilter_TagKeyAliases(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b,instance=x v=1 20",
+	)
+
+	read := func(aliases map[string]string) (map[string][]int64, error) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{TagKeyAliases: aliases})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAll(t, rs), nil
+	}
+
+	got, err := read(map[string]string{"host": "instance"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stored instance tag of the second series is replaced by the
+	// renamed host tag; region passes through unchanged.
+	exp := map[string][]int64{
+		"_field=v,_measurement=cpu,instance=a,region=east": {10},
+		"_field=v,_measurement=cpu,instance=b":             {20},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	for _, aliases := range []map[string]string{
+		{"host": "_field"},
+		{"_measurement": "name"},
+		{"host": "instance", "region": "instance"},
+	} {
+		if _, err := read(aliases); err != ErrInvalidTagKeyAliases {
+			t.Fatalf("aliases %v: got error %v, exp %v", aliases, err, ErrInvalidTagKeyAliases)
+		}
+	}
+}
+
+func TestStore_ReadGroup_TagKeyAliases(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 20",
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+		TagKeyAliases: map[string]string{"host": "instance"},
+	})
+	req := &datatypes.ReadGroupRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		Group:      datatypes.GroupBy,
+		GroupKeys:  []string{"host"},
+	}
+	rs, err := s.ReadGroup(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	var got []string
+	for gc := rs.Next(); gc != nil; gc = rs.Next() {
+		got = append(got, string(gc.PartitionKeyVals()[0]))
+		gc.Close()
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"a", "b"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got groups %v, exp %v", got, exp)
+	}
+
+	// The group keys of the request are not replaced by their aliases.
+	if got, exp := req.GroupKeys, []string{"host"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got request group keys %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_FindShardIDs_Duplicates(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+
+	// An inconsistent meta store returns a second group referencing shard 1.
+	rpi := s.meta.db.RetentionPolicy(meta.DefaultRetentionPolicyName)
+	rpi.ShardGroups = append(rpi.ShardGroups, meta.ShardGroupInfo{
+		ID:        3,
+		StartTime: time.Unix(0, 500),
+		EndTime:   time.Unix(0, 1500),
+		Shards:    []meta.ShardInfo{{ID: 1}},
+	})
+
+	core, logs := observer.New(zap.WarnLevel)
+	s.Logger = zap.New(core)
+
+	shardIDs, err := s.findShardIDs(context.Background(), s.meta.db.Name, meta.DefaultRetentionPolicyName, false, 0, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := shardIDs, []uint64{1, 2}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got shard IDs %v, exp %v", got, exp)
+	}
+	if got := logs.FilterMessage("Duplicate shard ID in shard groups").Len(); got != 1 {
+		t.Fatalf("got %d warnings, exp 1", got)
+	}
+
+	counts, err := s.ReadPointCounts(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 2000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := counts, map[string]int64{"cpu,host=a#!~#v": 2}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got counts %v, exp %v", got, exp)
+	}
+}
+
+// evenShardSelector selects the shards at even indexes of the groups.
+type evenShardSelector struct{}
+
+func (evenShardSelector) SelectShards(groups []meta.ShardGroupInfo) []uint64 {
+	ids := DefaultShardSelector{}.SelectShards(groups)
+	var even []uint64
+	for i := 0; i < len(ids); i += 2 {
+		even = append(even, ids[i])
+	}
+	return even
+}
+
+func TestStore_ShardSelector(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000, "cpu,host=a v=1 2010")
+	s.ShardSelector = evenShardSelector{}
+
+	shardIDs, err := s.findShardIDs(context.Background(), s.meta.db.Name, meta.DefaultRetentionPolicyName, false, 0, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := shardIDs, []uint64{1, 3}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got shard IDs %v, exp %v", got, exp)
+	}
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 3000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := readAll(t, rs)["_field=v,_measurement=cpu,host=a"], []int64{10, 2010}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got timestamps %v, exp %v", got, exp)
+	}
+}
+
+// repeatShardSelector selects every shard of the groups twice.
+type repeatShardSelector struct{}
+
+func (repeatShardSelector) SelectShards(groups []meta.ShardGroupInfo) []uint64 {
+	ids := DefaultShardSelector{}.SelectShards(groups)
+	return append(ids, ids...)
+}
+
+func TestStore_ShardSelector_Duplicates(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	s.ShardSelector = repeatShardSelector{}
+
+	shardIDs, err := s.findShardIDs(context.Background(), s.meta.db.Name, meta.DefaultRetentionPolicyName, false, 0, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := shardIDs, []uint64{1, 2}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got shard IDs %v, exp %v", got, exp)
+	}
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 2000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := readAll(t, rs)["_field=v,_measurement=cpu,host=a"], []int64{10, 1010}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got timestamps %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_RetentionPolicies(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=1 20",
+	)
+	s.mustWriteShardGroup(t, "downsampled", 2, 0, 1000,
+		"cpu,host=a v=2 10",
+		"cpu,host=a v=2 30",
+		"cpu,host=b v=2 30",
+	)
+
+	read := func(conflict RetentionPolicyConflict) (map[string][]float64, error) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+			RetentionPolicies:       []string{meta.DefaultRetentionPolicyName, "downsampled"},
+			RetentionPolicyConflict: conflict,
+		})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer rs.Close()
+
+		// Each series is keyed by its tags and lists its points as
+		// timestamp and value pairs.
+		got := make(map[string][]float64)
+		for rs.Next() {
+			c := rs.Cursor()
+			if c == nil {
+				continue
+			}
+			key := seriesString(rs.Tags())
+			fc := c.(cursors.FloatArrayCursor)
+			for a := fc.Next(); a.Len() > 0; a = fc.Next() {
+				for i := range a.Timestamps {
+					got[key] = append(got[key], float64(a.Timestamps[i]), a.Values[i])
+				}
+			}
+			c.Close()
+		}
+		return got, rs.Err()
+	}
+
+	t.Run("error", func(t *testing.T) {
+		if _, err := read(RetentionPolicyConflictError); err != ErrRetentionPolicyConflict {
+			t.Fatalf("got error %v, exp %v", err, ErrRetentionPolicyConflict)
+		}
+	})
+
+	t.Run("prefer", func(t *testing.T) {
+		got, err := read(RetentionPolicyConflictPrefer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := map[string][]float64{
+			"_field=v,_measurement=cpu,host=a": {10, 1, 20, 1},
+			"_field=v,_measurement=cpu,host=b": {30, 2},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		got, err := read(RetentionPolicyConflictMerge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := map[string][]float64{
+			"_field=v,_measurement=cpu,host=a": {10, 1, 20, 1, 30, 2},
+			"_field=v,_measurement=cpu,host=b": {30, 2},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+	})
+}
+
+// A series held by the index of more than one retention policy is only in
+// conflict if it has points in the range in more than one of them.
+func TestStore_ReadFilter_RetentionPolicies_SeriesWithoutData(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 2000,
+		"cpu,host=a v=1 10",
+	)
+	// host=a is indexed by the shard of downsampled, but its only point is
+	// outside the range.
+	s.mustWriteShardGroup(t, "downsampled", 2, 0, 2000,
+		"cpu,host=a v=2 1500",
+		"cpu,host=b v=2 30",
+	)
+
+	for _, conflict := range []RetentionPolicyConflict{
+		RetentionPolicyConflictError,
+		RetentionPolicyConflictPrefer,
+		RetentionPolicyConflictMerge,
+	} {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+			RetentionPolicies:       []string{"downsampled", meta.DefaultRetentionPolicyName},
+			RetentionPolicyConflict: conflict,
+		})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The points of host=a are read from autogen alone, although
+		// downsampled has precedence.
+		got, exp := readAll(t, rs), map[string][]int64{
+			"_field=v,_measurement=cpu,host=a": {10},
+			"_field=v,_measurement=cpu,host=b": {30},
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("conflict %v: got %v, exp %v", conflict, got, exp)
+		}
+	}
+}
+
+func TestStore_HighCardinalityTagKeys(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east,dc=1 v=1 10",
+		"cpu,host=b,region=east,dc=1 v=1 10",
+		"cpu,host=c,region=west,dc=1 v=1 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"mem,host=d,region=east v=1 1010",
+		"mem,host=a,region=north u=1 1010",
+	)
+
+	for _, tc := range []struct {
+		name string
+		pred string
+		topN int
+		exp  []TagKeyCardinality
+	}{
+		{
+			name: "all",
+			exp: []TagKeyCardinality{
+				{Key: "host", Cardinality: 4},
+				{Key: "region", Cardinality: 3},
+				{Key: "dc", Cardinality: 1},
+			},
+		},
+		{
+			name: "top",
+			topN: 2,
+			exp: []TagKeyCardinality{
+				{Key: "host", Cardinality: 4},
+				{Key: "region", Cardinality: 3},
+			},
+		},
+		{
+			name: "predicate",
+			pred: `_name = 'cpu'`,
+			exp: []TagKeyCardinality{
+				{Key: "host", Cardinality: 3},
+				{Key: "region", Cardinality: 2},
+				{Key: "dc", Cardinality: 1},
+			},
+		},
+		{
+			name: "field predicate",
+			pred: `_field = 'u'`,
+			exp: []TagKeyCardinality{
+				{Key: "host", Cardinality: 1},
+				{Key: "region", Cardinality: 1},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.HighCardinalityTagKeys(context.Background(), s.tagKeysRequest(t, 0, 2000, tc.pred), tc.topN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.exp) {
+				t.Fatalf("got %v, exp %v", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestStore_DefaultRange(t *testing.T) {
+	now := int64(24 * time.Hour)
+	old, recent := now-int64(2*time.Hour), now-int64(10*time.Minute)
+
+	s := newTestStore(t)
+	s.Now = func() time.Time { return time.Unix(0, now) }
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, now-int64(3*time.Hour), now+int64(time.Hour),
+		fmt.Sprintf("cpu,host=a v=1 %d", old),
+		fmt.Sprintf("cpu,host=a v=1 %d", recent),
+	)
+
+	read := func(start, end int64) []int64 {
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: start, End: end},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)["_field=v,_measurement=cpu,host=a"]
+	}
+
+	if got, exp := read(0, 0), []int64{old, recent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("no default range: got %v, exp %v", got, exp)
+	}
+
+	s.DefaultRange = time.Hour
+	if got, exp := read(0, 0), []int64{recent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unset range: got %v, exp %v", got, exp)
+	}
+	if got, exp := read(1, now), []int64{old, recent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("explicit range: got %v, exp %v", got, exp)
+	}
+	if got, exp := read(models.MinNanoTime, 0), []int64{old, recent}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("explicit full range: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_CardinalityBreakdown(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a u=1,v=1 10",
+		"cpu,host=b v=1 10",
+		"cpu,host=c v=1 900",
+		"http,method=GET,request_id=1 n=1 10",
+		"http,method=GET,request_id=2 n=1 10",
+		"http,method=GET,request_id=3 n=1 10",
+		"http,method=GET,request_id=4 n=1 10",
+		"mem,host=a free=1 10",
+	)
+
+	got, err := s.CardinalityBreakdown(context.Background(), s.tagKeysRequest(t, 0, 100, ""), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []MeasurementCardinality{
+		{
+			Measurement: "http",
+			Series:      4,
+			TagKeys:     []TagKeyCardinality{{Key: "request_id", Cardinality: 4}, {Key: "method", Cardinality: 1}},
+		},
+		{
+			Measurement: "cpu",
+			Series:      2,
+			TagKeys:     []TagKeyCardinality{{Key: "host", Cardinality: 2}},
+		},
+		{
+			Measurement: "mem",
+			Series:      1,
+			TagKeys:     []TagKeyCardinality{{Key: "host", Cardinality: 1}},
+		},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %+v, exp %+v", got, exp)
+	}
+
+	got, err = s.CardinalityBreakdown(context.Background(), s.tagKeysRequest(t, 0, 100, ""), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp[:1]) {
+		t.Fatalf("top: got %+v, exp %+v", got, exp[:1])
+	}
+}
+
+func TestStore_FieldTypeConflicts(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1,w=1 10",
+		"mem,host=a free=1i 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		`cpu,host=a v="high",w=2 1010`,
+		"mem,host=a free=2i 1010",
+	)
+	// A field has a single type within a shard.
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000,
+		"mem,host=b free=true 2900",
+	)
+
+	got, err := s.FieldTypeConflicts(context.Background(), s.tagKeysRequest(t, 0, 3000, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []FieldTypeConflict{
+		{Measurement: "cpu", Field: "v", Types: []cursors.FieldType{cursors.Float, cursors.String}},
+		{Measurement: "mem", Field: "free", Types: []cursors.FieldType{cursors.Integer, cursors.Boolean}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %+v, exp %+v", got, exp)
+	}
+
+	// The boolean point of mem.free is outside the range.
+	got, err = s.FieldTypeConflicts(context.Background(), s.tagKeysRequest(t, 0, 1999, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exp[:1]) {
+		t.Fatalf("range: got %+v, exp %+v", got, exp[:1])
+	}
+}
+
+func TestStore_MeasurementTimeBounds(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 500",
+		"mem,host=a free=1 20",
+		"mem,host=a free=1 900",
+		"disk,host=a used=1 5",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=1 1500",
+		"cpu,host=a w=1 1600",
+		"disk,host=a used=1 1900",
+	)
+
+	got, err := s.MeasurementTimeBounds(context.Background(), s.tagKeysRequest(t, 8, 1800, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The points of disk are outside the range.
+	exp := map[string][2]int64{
+		"cpu": {10, 1600},
+		"mem": {20, 900},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	got, err = s.MeasurementTimeBounds(context.Background(), s.tagKeysRequest(t, 0, 2000, "host = 'b'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string][2]int64{"cpu": {500, 500}}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("predicate: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ValidationErrors(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	readFilter := func(ctx context.Context, src *types.Any) error {
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: src,
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+		if rs != nil {
+			rs.Close()
+		}
+		return err
+	}
+
+	if err := readFilter(context.Background(), nil); err != ErrMissingReadSource {
+		t.Errorf("ReadFilter: got %v, exp %v", err, ErrMissingReadSource)
+	}
+	if _, err := s.TagKeys(context.Background(), &datatypes.TagKeysRequest{}); err != ErrMissingReadSource {
+		t.Errorf("TagKeys: got %v, exp %v", err, ErrMissingReadSource)
+	}
+	if _, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{TagKey: "host"}); err != ErrMissingReadSource {
+		t.Errorf("TagValues: got %v, exp %v", err, ErrMissingReadSource)
+	}
+
+	src, err := types.MarshalAny(s.GetSource(testOrgID, testBucketID+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := readFilter(context.Background(), src); err != ErrDatabaseNotFound {
+		t.Errorf("unknown bucket: got %v, exp %v", err, ErrDatabaseNotFound)
+	}
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{RetentionPolicies: []string{"missing"}})
+	if err := readFilter(ctx, s.source(t)); !errors.Is(err, ErrRetentionPolicyNotFound) {
+		t.Errorf("unknown retention policy option: got %v, exp %v", err, ErrRetentionPolicyNotFound)
+	}
+
+	s.meta.db.RetentionPolicies = nil
+	if err := readFilter(context.Background(), s.source(t)); err != ErrRetentionPolicyNotFound {
+		t.Errorf("missing default retention policy: got %v, exp %v", err, ErrRetentionPolicyNotFound)
+	}
+}
+
+func TestStore_InvalidRange(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 500",
+	)
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 100, End: 50},
+	})
+	if rs != nil {
+		rs.Close()
+	}
+	if !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("ReadFilter: got %v, exp %v", err, ErrInvalidRange)
+	}
+
+	if _, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 100, End: 50},
+		TagKey:     "host",
+	}); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("TagValues: got %v, exp %v", err, ErrInvalidRange)
+	}
+
+	// An unset end is normalized to models.MaxNanoTime, after the start.
+	itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 100},
+		TagKey:     "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cursors.StringIteratorToSlice(itr); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("unset end: got %v, exp [a]", got)
+	}
+}
+
+func TestStore_EmptyResultSets(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	// The range [5000, 6000] has no shards, and the measurement mem no
+	// series.
+	for _, tt := range []struct {
+		name       string
+		start, end int64
+		pred       string
+	}{
+		{name: "no shards", start: 5000, end: 6000},
+		{name: "no series", start: 0, end: 1000, pred: `_measurement = 'mem'`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: tt.start, End: tt.end},
+				Predicate:  exprToPredicate(t, tt.pred),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rs == nil {
+				t.Fatal("ReadFilter: got nil result set")
+			}
+			if _, ok := rs.(FieldPointCountResultSet); !ok {
+				t.Fatalf("ReadFilter: got %T, exp FieldPointCountResultSet", rs)
+			}
+			if got := readAll(t, rs); len(got) != 0 {
+				t.Fatalf("ReadFilter: got %v, exp no series", got)
+			}
+
+			grs, err := s.ReadGroup(context.Background(), &datatypes.ReadGroupRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: tt.start, End: tt.end},
+				Predicate:  exprToPredicate(t, tt.pred),
+				Group:      datatypes.GroupBy,
+				GroupKeys:  []string{"host"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grs == nil {
+				t.Fatal("ReadGroup: got nil result set")
+			}
+			if gc := grs.Next(); gc != nil {
+				t.Fatal("ReadGroup: expected no groups")
+			}
+			if err := grs.Err(); err != nil {
+				t.Fatal(err)
+			}
+			grs.Close()
+
+			req := &datatypes.ReadWindowAggregateRequest{
+				ReadSource:  s.source(t),
+				Range:       datatypes.TimestampRange{Start: tt.start, End: tt.end},
+				Predicate:   exprToPredicate(t, tt.pred),
+				WindowEvery: 100,
+				Aggregate: []*datatypes.Aggregate{
+					{Type: datatypes.AggregateTypeCount},
+					{Type: datatypes.AggregateTypeSum},
+				},
+			}
+			rs, err = s.WindowAggregate(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := rs.(MultiAggregateResultSet); !ok {
+				t.Fatalf("WindowAggregate: got %T, exp MultiAggregateResultSet", rs)
+			}
+			if got := readAll(t, rs); len(got) != 0 {
+				t.Fatalf("WindowAggregate: got %v, exp no series", got)
+			}
+		})
+	}
+
+	keys, err := s.TagKeys(context.Background(), &datatypes.TagKeysRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 5000, End: 6000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys == nil || keys.Next() {
+		t.Fatal("TagKeys: expected an empty iterator")
+	}
+
+	values, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 5000, End: 6000},
+		TagKey:     "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values == nil || values.Next() {
+		t.Fatal("TagValues: expected an empty iterator")
+	}
+}
+
+func TestStore_ResolveRange(t *testing.T) {
+	now := time.Unix(0, int64(10*time.Hour))
+	s := &Store{DefaultRange: time.Hour, Now: func() time.Time { return now }}
+	for _, tt := range []struct {
+		name       string
+		start, end int64
+		exp        timeRange
+	}{
+		{
+			name: "unset",
+			exp:  timeRange{start: int64(9 * time.Hour), end: int64(10 * time.Hour)},
+		},
+		{
+			name:  "explicit full",
+			start: models.MinNanoTime,
+			end:   models.MaxNanoTime,
+			exp:   timeRange{start: models.MinNanoTime, end: models.MaxNanoTime, startSet: true, endSet: true},
+		},
+		{
+			name:  "explicit full start",
+			start: models.MinNanoTime,
+			exp:   timeRange{start: models.MinNanoTime, end: models.MaxNanoTime, startSet: true},
+		},
+		{
+			name:  "partial",
+			start: 10,
+			exp:   timeRange{start: 10, end: models.MaxNanoTime, startSet: true},
+		},
+		{
+			name: "partial end",
+			end:  10,
+			exp:  timeRange{start: models.MinNanoTime, end: 10, endSet: true},
+		},
+		{
+			name:  "beyond sentinels",
+			start: math.MinInt64,
+			end:   math.MaxInt64,
+			exp:   timeRange{start: models.MinNanoTime, end: models.MaxNanoTime, startSet: true, endSet: true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.resolveRange(tt.start, tt.end)
+			if got != tt.exp {
+				t.Fatalf("got %+v, exp %+v", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestStore_DatabaseNameFn(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	read := func(bucketID uint64) (map[string][]int64, error) {
+		src, err := types.MarshalAny(s.GetSource(testOrgID, bucketID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: src,
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAll(t, rs), nil
+	}
+	exp := map[string][]int64{"_field=v,_measurement=cpu,host=a": {10}}
+
+	// By default the database is named after the bucket ID.
+	if got, err := s.databaseName(testOrgID, testBucketID); err != nil || got != s.meta.db.Name {
+		t.Fatalf("got database %q, error %v, exp %q", got, err, s.meta.db.Name)
+	}
+	if got, err := read(testBucketID); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if _, err := read(0x3000); err != ErrDatabaseNotFound {
+		t.Fatalf("got error %v, exp %v", err, ErrDatabaseNotFound)
+	}
+
+	errNotMapped := errors.New("bucket not mapped")
+	var calls [][2]uint64
+	s.DatabaseNameFn = func(orgID, bucketID uint64) (string, error) {
+		calls = append(calls, [2]uint64{orgID, bucketID})
+		switch bucketID {
+		case 0x3000:
+			return s.meta.db.Name, nil
+		case 0x4000:
+			return "other", nil
+		default:
+			return "", errNotMapped
+		}
+	}
+
+	if got, err := read(0x3000); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if got, exp := calls, [][2]uint64{{testOrgID, 0x3000}}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got calls %v, exp %v", got, exp)
+	}
+	if _, err := read(0x4000); err != ErrDatabaseNotFound {
+		t.Fatalf("got error %v, exp %v", err, ErrDatabaseNotFound)
+	}
+	if _, err := read(testBucketID); err != errNotMapped {
+		t.Fatalf("got error %v, exp %v", err, errNotMapped)
+	}
+}
+
+func TestStore_ReadFilter_ParallelShardScans(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=c v=1,u=1 20",
+		"mem,host=a free=1 30",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=b u=1 1010",
+		"cpu,host=c v=1 1020",
+		"disk,host=a used=1 1030",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000,
+		"cpu,host=a v=1 2010",
+		"cpu,host=c u=1 2020",
+		"mem,host=b free=1 2030",
+	)
+
+	// read returns every series in the order produced, including those
+	// without a cursor, followed by their timestamps.
+	read := func(t *testing.T) []string {
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 3000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		var got []string
+		for rs.Next() {
+			line := seriesString(rs.Tags())
+			if c := rs.Cursor(); c != nil {
+				line += fmt.Sprint(cursorTimestamps(c))
+				c.Close()
+			}
+			got = append(got, line)
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	exp := read(t)
+	if len(exp) == 0 {
+		t.Fatal("expected series")
+	}
+	for _, n := range []int{2, 3} {
+		s.ParallelShardScans = n
+		if got := read(t); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("parallelism %d: got\n%s\nexp\n%s", n, strings.Join(got, "\n"), strings.Join(exp, "\n"))
+		}
+	}
+}
+
+func TestStore_TagValues_V1Compat(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=c u=1 10",
+		"mem,host=b free=1 10",
+	)
+
+	tagValues := func(t *testing.T, v1 bool, key, pred string) []string {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{V1Compat: v1})
+		req := &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			TagKey:     key,
+		}
+		if pred != "" {
+			req.Predicate = exprToPredicate(t, pred)
+		}
+		iter, err := s.TagValues(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]string{}, cursors.StringIteratorToSlice(iter)...)
+	}
+
+	for _, tc := range []struct {
+		name string
+		key  string
+		pred string
+		exp  []string // InfluxDB 1.x semantics
+		v2   []string
+	}{
+		{
+			name: "fields",
+			key:  "_field",
+			exp:  []string{"free", "u", "v"},
+			v2:   []string{"free", "u", "v"},
+		},
+		{
+			// Every field of a measurement with matching series is listed,
+			// as SHOW FIELD KEYS does.
+			name: "fields with tag predicate",
+			key:  "_field",
+			pred: `host = 'a'`,
+			exp:  []string{"u", "v"},
+			v2:   []string{"v"},
+		},
+		{
+			name: "fields with field predicate",
+			key:  "_field",
+			pred: `_field =~ /^[uv]$/`,
+			exp:  []string{"u", "v"},
+			v2:   []string{"u", "v"},
+		},
+		{
+			name: "measurements",
+			key:  "_measurement",
+			exp:  []string{"cpu", "mem"},
+			v2:   []string{"cpu", "mem"},
+		},
+		{
+			name: "measurements with field predicate",
+			key:  "_measurement",
+			pred: `_field = 'free'`,
+			exp:  []string{"mem"},
+			v2:   []string{"mem"},
+		},
+		{
+			name: "measurements with tag and field predicate",
+			key:  "_measurement",
+			pred: `host = 'a' AND _field = 'u'`,
+			exp:  []string{"cpu"},
+			v2:   []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tagValues(t, true, tc.key, tc.pred); !reflect.DeepEqual(got, tc.exp) {
+				t.Errorf("v1: got %v, exp %v", got, tc.exp)
+			}
+			if got := tagValues(t, false, tc.key, tc.pred); !reflect.DeepEqual(got, tc.v2) {
+				t.Errorf("v2: got %v, exp %v", got, tc.v2)
+			}
+		})
+	}
+}
+
+func TestStore_ShardCardinalities(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"mem,host=a v=1 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=1 1010",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000,
+		"cpu,host=a v=1 2010",
+		"cpu,host=b v=1 2010",
+	)
+
+	got, err := s.ShardCardinalities(context.Background(), testOrgID, testBucketID, 0, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[uint64]int64{1: 3, 2: 1, 3: 2}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	got, err = s.ShardCardinalities(context.Background(), testOrgID, testBucketID, 1000, 1999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[uint64]int64{2: 1}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_TimeShift(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, models.MinNanoTime, models.MaxNanoTime,
+		fmt.Sprintf("cpu,host=a v=1 %d", models.MinNanoTime+5),
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=1 20",
+		fmt.Sprintf("cpu,host=a v=1 %d", models.MaxNanoTime-5),
+	)
+
+	read := func(shift time.Duration, start, end int64) []int64 {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{TimeShift: shift})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: start, End: end},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)["_field=v,_measurement=cpu,host=a"]
+	}
+
+	// The range selects the stored timestamps.
+	if got, exp := read(time.Hour, 1, 100), []int64{10 + int64(time.Hour), 20 + int64(time.Hour)}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("forward: got %v, exp %v", got, exp)
+	}
+	if got, exp := read(-15, 1, 100), []int64{-5, 5}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("backward: got %v, exp %v", got, exp)
+	}
+
+	// Points shifted beyond the valid range are dropped.
+	if got, exp := read(10, 0, 0), []int64{models.MinNanoTime + 15, 20, 30}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("overflow: got %v, exp %v", got, exp)
+	}
+	if got, exp := read(-10, 0, 0), []int64{0, 10, models.MaxNanoTime - 15}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("underflow: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_FieldType(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		`cpu,host=a b=true,f=1.5,i=2i,s="x",u=3u 10`,
+	)
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	got := make(map[string]cursors.FieldType)
+	for rs.Next() {
+		got[string(rs.Tags().Get([]byte("_field")))] = rs.(FieldTypeResultSet).FieldType()
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]cursors.FieldType{
+		"b": cursors.Boolean,
+		"f": cursors.Float,
+		"i": cursors.Integer,
+		"s": cursors.String,
+		"u": cursors.Unsigned,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_TagsOncePerSeries(t *testing.T) {
+	s := newTestStore(t)
+
+	// Enough points that the series spans several arrays.
+	n := 2*cursors.DefaultMaxPointsPerBlock + 1
+	lines := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("cpu,host=a v=%d %d", i, i+1))
+	}
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, int64(n+1), lines...)
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: int64(n + 1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	var series, points, arrays int
+	for rs.Next() {
+		series++
+		if got, exp := seriesString(rs.Tags()), "_field=v,_measurement=cpu,host=a"; got != exp {
+			t.Fatalf("got series %q, exp %q", got, exp)
+		}
+		cur := rs.Cursor().(cursors.FloatArrayCursor)
+		for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+			arrays++
+			points += a.Len()
+		}
+		cur.Close()
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if series != 1 {
+		t.Fatalf("got tags %d times, exp once", series)
+	}
+	if points != n {
+		t.Fatalf("got %d points, exp %d", points, n)
+	}
+	if arrays < 2 {
+		t.Fatalf("got %d arrays, exp several", arrays)
+	}
+}
+
+func TestStore_DeletedMeasurements(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"mem,host=a v=1 10",
+	)
+
+	// Tombstones are only written for points held by TSM files.
+	s.mustSnapshotShard(t, 1)
+	if err := s.tsdb.DeleteMeasurement(s.meta.db.Name, "cpu"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.DeletedMeasurements(context.Background(), s.tagKeysRequest(t, 0, 1000, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "cpu" {
+		t.Fatalf("got %v, exp cpu", got)
+	}
+	if got[0].DeletedAt.IsZero() || got[0].DeletedAt.After(time.Now()) {
+		t.Fatalf("got deletion time %v", got[0].DeletedAt)
+	}
+
+	got, err = s.DeletedMeasurements(context.Background(), s.tagKeysRequest(t, 0, 1000, "_name = 'mem'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %v, exp none", got)
+	}
+
+	s.RateLimiters = map[string]*rate.Limiter{
+		"DeletedMeasurements": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	if _, err := s.DeletedMeasurements(context.Background(), s.tagKeysRequest(t, 0, 1000, "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeletedMeasurements(context.Background(), s.tagKeysRequest(t, 0, 1000, "")); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_WindowAggregate_SelectorTimestamps(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=5 10",
+		"cpu,host=a v=1 20",
+		"cpu,host=a v=9 30",
+		"cpu,host=a v=3 110",
+		"cpu,host=a v=7 150",
+		"cpu,host=a v=2 190",
+	)
+
+	read := func(typ datatypes.Aggregate_AggregateType) ([]int64, []float64) {
+		rs, err := s.WindowAggregate(context.Background(), &datatypes.ReadWindowAggregateRequest{
+			ReadSource:  s.source(t),
+			Range:       datatypes.TimestampRange{Start: 0, End: 200},
+			WindowEvery: 100,
+			Aggregate:   []*datatypes.Aggregate{{Type: typ}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		var ts []int64
+		var vs []float64
+		for rs.Next() {
+			cur := rs.Cursor().(cursors.FloatArrayCursor)
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				ts = append(ts, a.Timestamps...)
+				vs = append(vs, a.Values...)
+			}
+			cur.Close()
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ts, vs
+	}
+
+	for _, tt := range []struct {
+		typ datatypes.Aggregate_AggregateType
+		ts  []int64
+		vs  []float64
+	}{
+		{typ: datatypes.AggregateTypeMin, ts: []int64{20, 190}, vs: []float64{1, 2}},
+		{typ: datatypes.AggregateTypeMax, ts: []int64{30, 150}, vs: []float64{9, 7}},
+	} {
+		ts, vs := read(tt.typ)
+		if !reflect.DeepEqual(ts, tt.ts) || !reflect.DeepEqual(vs, tt.vs) {
+			t.Fatalf("%v: got %v at %v, exp %v at %v", tt.typ, vs, ts, tt.vs, tt.ts)
+		}
+	}
+}
+
+// shardRecordingTSDBStore records the IDs of the shards resolved through it.
+type shardRecordingTSDBStore struct {
+	TSDBStore
+	shardIDs []uint64
+}
+
+func (s *shardRecordingTSDBStore) Shards(ids []uint64) []*tsdb.Shard {
+	s.shardIDs = append(s.shardIDs, ids...)
+	return s.TSDBStore.Shards(ids)
+}
+
+func TestStore_Prefetch(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000, "cpu,host=a v=1 2010")
+
+	rec := &shardRecordingTSDBStore{TSDBStore: s.TSDBStore}
+	s.TSDBStore = rec
+
+	req := &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1999},
+	}
+	if err := s.Prefetch(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := rec.shardIDs, []uint64{1, 2}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got shards %v, exp %v", got, exp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var cerr *ContextError
+	if err := s.Prefetch(ctx, req); !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, exp *ContextError", err)
+	}
+}
+
+func TestStore_Warm(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- s.Warm(context.Background(), testOrgID, testBucketID, 0, 1000) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A range without shards has nothing to warm.
+	if err := s.Warm(context.Background(), testOrgID, testBucketID, 5000, 6000); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Warm(context.Background(), testOrgID, testBucketID+1, 0, 1000); err != ErrDatabaseNotFound {
+		t.Fatalf("got error %v, exp %v", err, ErrDatabaseNotFound)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var cerr *ContextError
+	if err := s.Warm(ctx, testOrgID, testBucketID, 0, 1000); !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, exp *ContextError", err)
+	}
+
+	// The bucket is readable once warmed.
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := sortedKeys(readAll(t, rs)), []string{"_field=v,_measurement=cpu,host=a"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_BucketHasData(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	for _, tt := range []struct {
+		start, end int64
+		exp        bool
+	}{
+		{start: 0, end: 1000, exp: true},
+		{start: 500, end: 600, exp: true},
+		{start: 5000, end: 6000, exp: false},
+	} {
+		got, err := s.BucketHasData(context.Background(), testOrgID, testBucketID, tt.start, tt.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.exp {
+			t.Errorf("[%d, %d]: got %v, exp %v", tt.start, tt.end, got, tt.exp)
+		}
+	}
+
+	if _, err := s.BucketHasData(context.Background(), testOrgID, testBucketID+1, 0, 1000); err != ErrDatabaseNotFound {
+		t.Fatalf("got error %v, exp %v", err, ErrDatabaseNotFound)
+	}
+}
+
+func TestStore_ReadFilter_MaxStringLength(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		`log,host=a msg="hello world" 10`,
+		`log,host=a msg="héllo" 20`,
+		`log,host=a msg="ok" 30`,
+		`log,host=a n=1i 10`,
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{MaxStringLength: 2})
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	var got []string
+	for rs.Next() {
+		cur := rs.Cursor()
+		if sc, ok := cur.(cursors.StringArrayCursor); ok {
+			for a := sc.Next(); a.Len() > 0; a = sc.Next() {
+				got = append(got, a.Values...)
+			}
+		} else if _, ok := cur.(cursors.IntegerArrayCursor); !ok {
+			t.Fatalf("unexpected cursor %T", cur)
+		}
+		cur.Close()
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second value is cut before its two byte character.
+	exp := []string{"he" + StringTruncationMarker, "h" + StringTruncationMarker, "ok"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %q, exp %q", got, exp)
+	}
+}
+
+func TestStore_NonEmptyRetentionPolicies(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, "archive", 2, 0, 1000, "cpu,host=a v=1 20")
+	s.mustWriteShardGroup(t, "archive", 3, 1000, 2000, "cpu,host=a v=1 1010")
+	// A configured retention policy holding data outside the range.
+	s.mustWriteShardGroup(t, "hourly", 4, 1000, 2000, "cpu,host=a v=1 1020")
+	// A configured retention policy with an empty shard in the range.
+	s.mustWriteShardGroup(t, "empty", 5, 0, 1000)
+
+	got, err := s.NonEmptyRetentionPolicies(context.Background(), testOrgID, testBucketID, 0, 999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"archive", meta.DefaultRetentionPolicyName}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_WindowAggregate_MultipleAggregates(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=5 10",
+		"cpu,host=a v=1 20",
+		"cpu,host=a v=9 30",
+		"cpu,host=a v=3 110",
+		"cpu,host=b v=7 150",
+		"cpu,host=b v=2 250",
+		`log,host=a msg="x" 10`,
+	)
+
+	// drain returns the points of cur as "value@timestamp".
+	drain := func(cur cursors.Cursor) []string {
+		var points []string
+		switch cur := cur.(type) {
+		case cursors.FloatArrayCursor:
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				for i, ts := range a.Timestamps {
+					points = append(points, fmt.Sprintf("%v@%d", a.Values[i], ts))
+				}
+			}
+		case cursors.IntegerArrayCursor:
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				for i, ts := range a.Timestamps {
+					points = append(points, fmt.Sprintf("%v@%d", a.Values[i], ts))
+				}
+			}
+		default:
+			t.Fatalf("unexpected cursor type %T", cur)
+		}
+		cur.Close()
+		return points
+	}
+
+	request := func(pred string, types ...datatypes.Aggregate_AggregateType) *datatypes.ReadWindowAggregateRequest {
+		req := &datatypes.ReadWindowAggregateRequest{
+			ReadSource:  s.source(t),
+			Range:       datatypes.TimestampRange{Start: 0, End: 300},
+			WindowEvery: 100,
+			Predicate:   exprToPredicate(t, pred),
+		}
+		for _, typ := range types {
+			req.Aggregate = append(req.Aggregate, &datatypes.Aggregate{Type: typ})
+		}
+		return req
+	}
+
+	types := []datatypes.Aggregate_AggregateType{
+		datatypes.AggregateTypeCount,
+		datatypes.AggregateTypeSum,
+		datatypes.AggregateTypeMean,
+	}
+
+	// The columns of each series of a single pass.
+	rs, err := s.WindowAggregate(context.Background(), request("_measurement = 'cpu'", types...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][][]string)
+	for rs.Next() {
+		key := seriesString(rs.Tags())
+		for _, cur := range rs.(MultiAggregateResultSet).Cursors() {
+			got[key] = append(got[key], drain(cur))
+		}
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rs.Close()
+
+	// The same columns from a request for each aggregate.
+	exp := make(map[string][][]string)
+	for _, typ := range types {
+		rs, err := s.WindowAggregate(context.Background(), request("_measurement = 'cpu'", typ))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rs.Next() {
+			key := seriesString(rs.Tags())
+			exp[key] = append(exp[key], drain(rs.Cursor()))
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rs.Close()
+	}
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if got, exp := got["_field=v,_measurement=cpu,host=a"], [][]string{
+		{"3@100", "1@200"},
+		{"15@100", "3@200"},
+		{"5@100", "3@200"},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("host a: got %v, exp %v", got, exp)
+	}
+
+	// The sum of a string field is not supported.
+	rs, err = s.WindowAggregate(context.Background(), request("_measurement = 'log'", types...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rs.Next() {
+		rs.Cursor()
+	}
+	if err := rs.Err(); !errors.Is(err, ErrInvalidMultiAggregate) {
+		t.Fatalf("got error %v, exp %v", err, ErrInvalidMultiAggregate)
+	}
+	rs.Close()
+}
+
+func TestStore_WindowAggregate_WindowFill(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=3 30",
+		"cpu,host=a v=5 250",
+	)
+
+	read := func(fill WindowFill, typ datatypes.Aggregate_AggregateType, start, end int64) ([]int64, []float64, []bool, error) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{WindowFill: fill})
+		rs, err := s.WindowAggregate(ctx, &datatypes.ReadWindowAggregateRequest{
+			ReadSource:  s.source(t),
+			Range:       datatypes.TimestampRange{Start: start, End: end},
+			WindowEvery: 100,
+			Aggregate:   []*datatypes.Aggregate{{Type: typ}},
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer rs.Close()
+
+		var ts []int64
+		var vs []float64
+		var nulls []bool
+		for rs.Next() {
+			cur := rs.Cursor().(cursors.FloatArrayCursor)
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				ts = append(ts, a.Timestamps...)
+				vs = append(vs, a.Values...)
+				if nc, ok := cur.(NullArrayCursor); ok {
+					nulls = append(nulls, nc.Nulls()...)
+				}
+			}
+			cur.Close()
+		}
+		return ts, vs, nulls, rs.Err()
+	}
+
+	for _, tt := range []struct {
+		name  string
+		fill  WindowFill
+		typ   datatypes.Aggregate_AggregateType
+		ts    []int64
+		vs    []float64
+		nulls []bool
+	}{
+		{
+			name: "none",
+			fill: WindowFillNone,
+			typ:  datatypes.AggregateTypeSum,
+			ts:   []int64{100, 300},
+			vs:   []float64{4, 5},
+		},
+		{
+			name:  "null",
+			fill:  WindowFillNull,
+			typ:   datatypes.AggregateTypeSum,
+			ts:    []int64{100, 200, 300, 400},
+			vs:    []float64{4, 0, 5, 0},
+			nulls: []bool{false, true, false, true},
+		},
+		{
+			name:  "previous",
+			fill:  WindowFillPrevious,
+			typ:   datatypes.AggregateTypeSum,
+			ts:    []int64{100, 200, 300, 400},
+			vs:    []float64{4, 4, 5, 5},
+			nulls: []bool{false, false, false, false},
+		},
+		{
+			name:  "previous selector",
+			fill:  WindowFillPrevious,
+			typ:   datatypes.AggregateTypeMin,
+			ts:    []int64{10, 200, 250, 400},
+			vs:    []float64{1, 1, 5, 5},
+			nulls: []bool{false, false, false, false},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, vs, nulls, err := read(tt.fill, tt.typ, 1, 400)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ts, tt.ts) || !reflect.DeepEqual(vs, tt.vs) || !reflect.DeepEqual(nulls, tt.nulls) {
+				t.Fatalf("got %v at %v (nulls %v), exp %v at %v (nulls %v)", vs, ts, nulls, tt.vs, tt.ts, tt.nulls)
+			}
+		})
+	}
+
+	if _, _, _, err := read(WindowFillNull, datatypes.AggregateTypeSum, 0, 0); err != ErrInvalidWindowFill {
+		t.Fatalf("unbounded range: got error %v, exp %v", err, ErrInvalidWindowFill)
+	}
+}
+
+func TestStore_TagValues_SortByRecency(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 3000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=1 50",
+		"cpu,host=b v=1 20",
+		"mem,host=b v=1 30",
+		"cpu,host=c v=1 50",
+		"cpu,host=d v=1 2000",
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{SortTagValuesByRecency: true})
+	iter, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		TagKey:     "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a and c were last written at the same time, and d has no points in
+	// the range.
+	if got, exp := cursors.StringIteratorToSlice(iter), []string{"a", "c", "b"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_SeriesKeyPrefix(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"acme_cpu,host=a v=1 10",
+		"acme_cpu,host=ab v=1 10",
+		"acme_cpu,host=b v=1 10",
+		"acme_mem,host=a v=1 10",
+		"globex_cpu,host=a v=1 10",
+	)
+
+	read := func(prefix string) []string {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{SeriesKeyPrefix: []byte(prefix)})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sortedKeys(readAll(t, rs))
+	}
+
+	if got, exp := read("acme_"), []string{
+		"_field=v,_measurement=acme_cpu,host=a",
+		"_field=v,_measurement=acme_cpu,host=ab",
+		"_field=v,_measurement=acme_cpu,host=b",
+		"_field=v,_measurement=acme_mem,host=a",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("measurement prefix: got %v, exp %v", got, exp)
+	}
+	if got, exp := read("acme_cpu,host=a"), []string{
+		"_field=v,_measurement=acme_cpu,host=a",
+		"_field=v,_measurement=acme_cpu,host=ab",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("tag prefix: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_EstimateBytes(t *testing.T) {
+	s := newTestStore(t)
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines,
+			fmt.Sprintf("cpu,host=a v=%d %d", i*7%13, i+1),
+			fmt.Sprintf("cpu,host=b v=%d %d", i*11%17, i+1),
+		)
+	}
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 10000, lines...)
+	e := s.mustSnapshotShard(t, 1)
+
+	// The blocks make up most of the single TSM file, the remainder being
+	// its index.
+	var fileSize int64
+	for _, stat := range e.FileStore.Stats() {
+		fileSize += int64(stat.Size)
+	}
+
+	estimate := func(pred *datatypes.Predicate) int64 {
+		n, err := s.EstimateBytes(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 10000},
+			Predicate:  pred,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	all := estimate(nil)
+	if all > fileSize || all < fileSize*3/4 {
+		t.Fatalf("got estimate %d, exp between %d and %d", all, fileSize*3/4, fileSize)
+	}
+
+	// The series are of similar size.
+	one := estimate(newTagPredicate("host", datatypes.ComparisonEqual, "a"))
+	if one < all/4 || one > all*3/4 {
+		t.Fatalf("got estimate %d for one series, exp about half of %d", one, all)
+	}
+}
+
+func TestStore_ReadFilter_DuplicateTimestamps(t *testing.T) {
+	s := newTestStore(t)
+	// The shard groups overlap, and both shards hold a point at 30.
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=2 20",
+		"cpu,host=a v=3 30",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 5, 1000,
+		"cpu,host=a v=30 30",
+		"cpu,host=a v=40 40",
+	)
+
+	read := func(t *testing.T, dup DuplicateTimestamps) ([]int64, []float64) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{DuplicateTimestamps: dup})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		var ts []int64
+		var vs []float64
+		for rs.Next() {
+			cur := rs.Cursor().(cursors.FloatArrayCursor)
+			for a := cur.Next(); a.Len() > 0; a = cur.Next() {
+				ts = append(ts, a.Timestamps...)
+				vs = append(vs, a.Values...)
+			}
+			cur.Close()
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ts, vs
+	}
+
+	for _, tt := range []struct {
+		name string
+		dup  DuplicateTimestamps
+		ts   []int64
+		vs   []float64
+	}{
+		{name: "keep", dup: DuplicateTimestampsKeep, ts: []int64{10, 20, 30, 30, 40}, vs: []float64{1, 2, 3, 30, 40}},
+		{name: "first", dup: DuplicateTimestampsFirst, ts: []int64{10, 20, 30, 40}, vs: []float64{1, 2, 3, 40}},
+		{name: "last", dup: DuplicateTimestampsLast, ts: []int64{10, 20, 30, 40}, vs: []float64{1, 2, 30, 40}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, vs := read(t, tt.dup)
+			if !reflect.DeepEqual(ts, tt.ts) || !reflect.DeepEqual(vs, tt.vs) {
+				t.Fatalf("got %v at %v, exp %v at %v", vs, ts, tt.vs, tt.ts)
+			}
+		})
+	}
+}
+
+func TestStore_ReadGroup_GroupSeriesTags(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 3000,
+		"cpu,host=a,region=east v=1,w=2 10",
+		"cpu,host=b,region=east v=1 10",
+		"cpu,host=c,region=west v=1 10",
+		"cpu,host=d,region=west v=1 2000",
+		"mem,host=a,region=east v=1 10",
+	)
+
+	read := func(max int) (map[string][]string, map[string]bool) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{GroupSeriesTags: max})
+		rs, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			Group:      datatypes.GroupBy,
+			GroupKeys:  []string{"region"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		series := make(map[string][]string)
+		truncated := make(map[string]bool)
+		for gc := rs.Next(); gc != nil; gc = rs.Next() {
+			region := string(gc.PartitionKeyVals()[0])
+			sc := gc.(SeriesTagsGroupCursor)
+			for _, tags := range sc.SeriesTags() {
+				series[region] = append(series[region], seriesString(tags))
+			}
+			truncated[region] = sc.SeriesTagsTruncated()
+			gc.Close()
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return series, truncated
+	}
+
+	// The series of host d has no points in the range.
+	series, truncated := read(10)
+	if exp := map[string][]string{
+		"east": {
+			"_measurement=cpu,host=a,region=east",
+			"_measurement=cpu,host=b,region=east",
+			"_measurement=mem,host=a,region=east",
+		},
+		"west": {
+			"_measurement=cpu,host=c,region=west",
+		},
+	}; !reflect.DeepEqual(series, exp) {
+		t.Fatalf("got series %v, exp %v", series, exp)
+	}
+	if exp := map[string]bool{"east": false, "west": false}; !reflect.DeepEqual(truncated, exp) {
+		t.Fatalf("got truncated %v, exp %v", truncated, exp)
+	}
+
+	series, truncated = read(2)
+	if got, exp := series["east"], []string{
+		"_measurement=cpu,host=a,region=east",
+		"_measurement=cpu,host=b,region=east",
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("limited: got series %v, exp %v", got, exp)
+	}
+	if exp := map[string]bool{"east": true, "west": false}; !reflect.DeepEqual(truncated, exp) {
+		t.Fatalf("limited: got truncated %v, exp %v", truncated, exp)
+	}
+}
+
+func TestStore_ReadGroup_GroupTopN(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east usage=10,idle=90 10",
+		"cpu,host=a,region=east usage=30,idle=70 20",
+		"cpu,host=b,region=east usage=50,idle=50 10",
+		"cpu,host=c,region=east usage=5,idle=95 10",
+		"cpu,host=d,region=east usage=40,idle=60 10",
+		"cpu,host=e,region=west usage=1,idle=99 10",
+		"cpu,host=f,region=west usage=2,idle=98 10",
+		"cpu,host=g,region=west idle=100 10",
+	)
+
+	read := func(opts *ReadOptions) map[string][]string {
+		ctx := NewContextWithReadOptions(context.Background(), opts)
+		rs, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Group:      datatypes.GroupBy,
+			GroupKeys:  []string{"region"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		got := make(map[string][]string)
+		for gc := rs.Next(); gc != nil; gc = rs.Next() {
+			region := string(gc.PartitionKeyVals()[0])
+			for gc.Next() {
+				got[region] = append(got[region], string(gc.Tags().Get([]byte("host")))+"."+string(gc.Tags().Get(fieldKeyBytes)))
+				gc.Cursor().Close()
+			}
+			gc.Close()
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// Host a has a mean usage of 20, and host g has no usage.
+	got := read(&ReadOptions{GroupTopN: 3, GroupTopNField: "usage", GroupTopNAggregate: datatypes.AggregateTypeMean})
+	exp := map[string][]string{
+		"east": {"a.idle", "a.usage", "b.idle", "b.usage", "d.idle", "d.usage"},
+		"west": {"e.idle", "e.usage", "f.idle", "f.usage"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	got = read(&ReadOptions{GroupTopN: 1, GroupTopNField: "usage", GroupTopNAggregate: datatypes.AggregateTypeMax, GroupTopNAscending: true})
+	exp = map[string][]string{
+		"east": {"c.idle", "c.usage"},
+		"west": {"e.idle", "e.usage"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("ascending: got %v, exp %v", got, exp)
+	}
+
+	// Groups without series of the field are omitted.
+	if got := read(&ReadOptions{GroupTopN: 1, GroupTopNField: "missing", GroupTopNAggregate: datatypes.AggregateTypeSum}); len(got) != 0 {
+		t.Fatalf("missing field: got %v", got)
+	}
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{GroupTopN: 1, GroupTopNField: "usage", GroupTopNAggregate: datatypes.AggregateTypeFirst})
+	if _, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{ReadSource: s.source(t), Group: datatypes.GroupNone}); err != ErrInvalidGroupTopN {
+		t.Fatalf("got error %v, exp %v", err, ErrInvalidGroupTopN)
+	}
+}
+
+func TestStore_ReadGroup_GroupOrder(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=b v=1 10",
+		"cpu,region=east v=1 10",
+		"cpu,host=a v=1 10",
+	)
+
+	read := func(group datatypes.ReadGroupRequest_Group, keys []string, order GroupOrder) ([]string, error) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{GroupOrder: order})
+		rs, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Group:      group,
+			GroupKeys:  keys,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer rs.Close()
+
+		var got []string
+		for gc := rs.Next(); gc != nil; gc = rs.Next() {
+			var key []string
+			for _, v := range gc.PartitionKeyVals() {
+				key = append(key, string(v))
+			}
+			got = append(got, strings.Join(key, ","))
+			for gc.Next() {
+				gc.Cursor().Close()
+			}
+			gc.Close()
+		}
+		return got, rs.Err()
+	}
+
+	for _, tt := range []struct {
+		name  string
+		group datatypes.ReadGroupRequest_Group
+		keys  []string
+		order GroupOrder
+		exp   []string
+		err   error
+	}{
+		{name: "default", group: datatypes.GroupBy, keys: []string{"host"}, exp: []string{"a", "b", ""}},
+		{name: "nil last", group: datatypes.GroupBy, keys: []string{"host"}, order: GroupOrderKeyNilLast, exp: []string{"a", "b", ""}},
+		{name: "nil first", group: datatypes.GroupBy, keys: []string{"host"}, order: GroupOrderKeyNilFirst, exp: []string{"", "a", "b"}},
+		{name: "ungrouped", group: datatypes.GroupNone, exp: []string{""}},
+		{name: "ungrouped ordered", group: datatypes.GroupNone, order: GroupOrderKeyNilLast, err: ErrInvalidGroupOrder},
+		{name: "without keys", group: datatypes.GroupBy, order: GroupOrderKeyNilFirst, err: ErrInvalidGroupOrder},
+		{name: "unknown", group: datatypes.GroupBy, keys: []string{"host"}, order: GroupOrderKeyNilFirst + 1, err: ErrInvalidGroupOrder},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read(tt.group, tt.keys, tt.order)
+			if err != tt.err {
+				t.Fatalf("got error %v, exp %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.exp) {
+				t.Fatalf("got %q, exp %q", got, tt.exp)
+			}
+		})
+	}
+
+	// An invalid order is rejected even if the range selects no shards.
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{GroupOrder: GroupOrderKeyNilFirst})
+	if _, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 5000, End: 6000},
+		Group:      datatypes.GroupNone,
+	}); err != ErrInvalidGroupOrder {
+		t.Fatalf("without shards: got error %v, exp %v", err, ErrInvalidGroupOrder)
+	}
+}
+
+func TestStore_ReadGroup_TimeOfDayBucket(t *testing.T) {
+	const hour = int64(time.Hour)
+	const day = 24 * hour
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 3*day,
+		fmt.Sprintf("cpu,host=a v=1 %d", 1*hour),
+		fmt.Sprintf("cpu,host=a v=2 %d", 13*hour),
+		fmt.Sprintf("cpu,host=a v=3 %d", day+hour+30*int64(time.Minute)),
+		fmt.Sprintf("cpu,host=b v=4 %d", day+13*hour),
+	)
+
+	read := func(opts *ReadOptions, agg *datatypes.Aggregate) (map[time.Duration][]string, error) {
+		ctx := NewContextWithReadOptions(context.Background(), opts)
+		rs, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 3 * day},
+			Group:      datatypes.GroupNone,
+			Aggregate:  agg,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer rs.Close()
+
+		got := make(map[time.Duration][]string)
+		for gc := rs.Next(); gc != nil; gc = rs.Next() {
+			tod := gc.(TimeOfDayGroupCursor).TimeOfDay()
+			for gc.Next() {
+				host := string(gc.Tags().Get([]byte("host")))
+				for _, ts := range cursorTimestamps(gc.Cursor()) {
+					got[tod] = append(got[tod], fmt.Sprintf("%s@%d", host, ts))
+				}
+			}
+			gc.Close()
+		}
+		return got, rs.Err()
+	}
+
+	got, err := read(&ReadOptions{TimeOfDayBucket: time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[time.Duration][]string{
+		time.Hour: {
+			fmt.Sprintf("a@%d", 1*hour),
+			fmt.Sprintf("a@%d", day+hour+30*int64(time.Minute)),
+		},
+		13 * time.Hour: {
+			fmt.Sprintf("a@%d", 13*hour),
+			fmt.Sprintf("b@%d", day+13*hour),
+		},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	// In UTC-2, the points at 01:00 UTC fall in the afternoon of the
+	// previous day, and those at 13:00 UTC in the morning.
+	got, err = read(&ReadOptions{TimeOfDayBucket: 12 * time.Hour, TimeOfDayLocation: time.FixedZone("", -2*3600)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = map[time.Duration][]string{
+		0: {
+			fmt.Sprintf("a@%d", 13*hour),
+			fmt.Sprintf("b@%d", day+13*hour),
+		},
+		12 * time.Hour: {
+			fmt.Sprintf("a@%d", 1*hour),
+			fmt.Sprintf("a@%d", day+hour+30*int64(time.Minute)),
+		},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("location: got %v, exp %v", got, exp)
+	}
+
+	if _, err := read(&ReadOptions{TimeOfDayBucket: 7 * time.Hour}, nil); err != ErrInvalidTimeOfDayBucket {
+		t.Fatalf("uneven bucket: got error %v, exp %v", err, ErrInvalidTimeOfDayBucket)
+	}
+	if _, err := read(&ReadOptions{TimeOfDayBucket: time.Hour}, &datatypes.Aggregate{Type: datatypes.AggregateTypeSum}); err != ErrInvalidTimeOfDayBucket {
+		t.Fatalf("aggregate: got error %v, exp %v", err, ErrInvalidTimeOfDayBucket)
+	}
+
+	// The combination is rejected even if the range selects no shards.
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{TimeOfDayBucket: time.Hour})
+	if _, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 10 * day, End: 11 * day},
+		Group:      datatypes.GroupNone,
+		Aggregate:  &datatypes.Aggregate{Type: datatypes.AggregateTypeSum},
+	}); err != ErrInvalidTimeOfDayBucket {
+		t.Fatalf("aggregate without shards: got error %v, exp %v", err, ErrInvalidTimeOfDayBucket)
+	}
+}
+
+func TestStore_ContextError(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+	)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+
+	methods := map[string]func(ctx context.Context) error{
+		"ReadPointCounts": func(ctx context.Context) error {
+			_, err := s.ReadPointCounts(ctx, &datatypes.ReadFilterRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			})
+			return err
+		},
+		"TagValues": func(ctx context.Context) error {
+			_, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+				Predicate:  exprToPredicate(t, `_field = 'v'`),
+				TagKey:     "host",
+			})
+			return err
+		},
+	}
+
+	for name, fn := range methods {
+		t.Run(name, func(t *testing.T) {
+			err := fn(canceled)
+			var cerr *ContextError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("canceled: got error %v, exp ContextError", err)
+			}
+			if !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || cerr.Timeout() {
+				t.Fatalf("canceled: unexpected error %v", err)
+			}
+
+			err = fn(expired)
+			if !errors.As(err, &cerr) {
+				t.Fatalf("expired: got error %v, exp ContextError", err)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || !cerr.Timeout() {
+				t.Fatalf("expired: unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_ReadFilter_Canceled(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"cpu,host=c v=1 10",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	if !rs.Next() {
+		t.Fatal("expected a series")
+	}
+	cancel()
+	if rs.Next() {
+		t.Fatal("expected the result set to stop once canceled")
+	}
+	var cerr *ContextError
+	if err := rs.Err(); !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, exp ContextError", err)
+	}
+}
+
+func TestStore_ReadGroup_Canceled(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b,region=east v=1 10",
+		"cpu,host=c,region=west v=1 10",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rs, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		Group:      datatypes.GroupBy,
+		GroupKeys:  []string{"region"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	gc := rs.Next()
+	if gc == nil || !gc.Next() {
+		t.Fatal("expected a group with a series")
+	}
+	cancel()
+
+	// The series of the group and the remaining groups are not read.
+	var cerr *ContextError
+	if gc.Next() {
+		t.Fatal("expected the group cursor to stop once canceled")
+	}
+	if err := gc.Err(); !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("group cursor: got error %v, exp ContextError", err)
+	}
+	gc.Close()
+	if rs.Next() != nil {
+		t.Fatal("expected the result set to stop once canceled")
+	}
+	if err := rs.Err(); !errors.As(err, &cerr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, exp ContextError", err)
+	}
+}
+
+func TestStore_ReadFilter_MaxPointsPerSeries(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2500; i++ {
+		lines = append(lines, fmt.Sprintf("cpu,host=a v=1 %d", i+1))
+	}
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("cpu,host=b v=1 %d", i+1))
+	}
+	lines = append(lines, "cpu,host=c v=1 1", "cpu,host=c v=1 2")
+
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 10000, lines...)
+
+	read := func(max int) map[string][]int64 {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{MaxPointsPerSeries: max})
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 10000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)
+	}
+
+	for _, max := range []int{3, 7, 100} {
+		for key, ts := range read(max) {
+			if len(ts) > max {
+				t.Fatalf("max %d: series %s has %d points", max, key, len(ts))
+			}
+			for i := 2; i < len(ts); i++ {
+				if ts[i]-ts[i-1] != ts[1]-ts[0] {
+					t.Fatalf("max %d: series %s is not evenly spaced: %v", max, key, ts)
+				}
+			}
+		}
+	}
+
+	got := read(3)
+	exp := map[string][]int64{
+		// The stride of 834 spans the blocks of the series.
+		"_field=v,_measurement=cpu,host=a": {1, 835, 1669},
+		"_field=v,_measurement=cpu,host=b": {1, 5, 9},
+		"_field=v,_measurement=cpu,host=c": {1, 2},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+}
+
+// divergentTSDBStore injects a value into the results of TagValues.
+type divergentTSDBStore struct {
+	*tsdb.Store
+	key, value string
+}
+
+func (s *divergentTSDBStore) TagValues(auth query.Authorizer, shardIDs []uint64, cond influxql.Expr) ([]tsdb.TagValues, error) {
+	values, err := s.Store.TagValues(auth, shardIDs, cond)
+	if err != nil {
+		return nil, err
+	}
+	return append(values, tsdb.TagValues{
+		Measurement: "cpu",
+		Values:      []tsdb.KeyValue{{Key: s.key, Value: s.value}},
+	}), nil
+}
+
+func TestStore_ReadFilter_PointLimit(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=2 20",
+		"cpu,host=b v=1 30",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=3 1010",
+		"cpu,host=a v=4 1020",
+		"cpu,host=a v=5 1030",
+	)
+
+	for _, tt := range []struct {
+		name      string
+		perSeries int64
+		total     int64
+		desc      bool
+		exp       map[string][]int64
+		truncated bool
+	}{
+		{
+			name: "unlimited",
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {10, 20, 1010, 1020, 1030},
+				"_field=v,_measurement=cpu,host=b": {30},
+			},
+		},
+		{
+			name:      "per series",
+			perSeries: 2,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {10, 20},
+				"_field=v,_measurement=cpu,host=b": {30},
+			},
+		},
+		{
+			name:      "per series descending",
+			perSeries: 2,
+			desc:      true,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {1030, 1020},
+				"_field=v,_measurement=cpu,host=b": {30},
+			},
+		},
+		{
+			name:  "total",
+			total: 3,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {10, 20, 1010},
+			},
+			truncated: true,
+		},
+		{
+			name:  "total at end of series",
+			total: 5,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {10, 20, 1010, 1020, 1030},
+			},
+			truncated: true,
+		},
+		{
+			name:  "total not reached",
+			total: 6,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {10, 20, 1010, 1020, 1030},
+				"_field=v,_measurement=cpu,host=b": {30},
+			},
+		},
+		{
+			name:      "both",
+			perSeries: 1,
+			total:     2,
+			desc:      true,
+			exp: map[string][]int64{
+				"_field=v,_measurement=cpu,host=a": {1030},
+				"_field=v,_measurement=cpu,host=b": {30},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+				ReadSource:       s.source(t),
+				Range:            datatypes.TimestampRange{Start: 0, End: 2000},
+				Descending:       tt.desc,
+				SeriesPointLimit: tt.perSeries,
+				PointLimit:       tt.total,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, rs); !reflect.DeepEqual(got, tt.exp) {
+				t.Fatalf("got %v, exp %v", got, tt.exp)
+			}
+			if got := rs.(TruncatedResultSet).Truncated(); got != tt.truncated {
+				t.Fatalf("got truncated %v, exp %v", got, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestStore_CompareTagValuePaths(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b,region=west u=1 10",
+		"mem,host=c free=1 10",
+	)
+
+	for _, key := range []string{"host", "region", "_measurement", "_field"} {
+		for _, pred := range []string{"", `host = 'a'`, `region =~ /e/`, `_name = 'cpu'`, `host != 'a' AND _name = 'cpu'`} {
+			ok, diff, err := s.CompareTagValuePaths(context.Background(), s.tagValuesRequest(t, 0, 1000, pred, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Errorf("key %s, predicate %q: paths diverge: %+v", key, pred, diff)
+			}
+		}
+	}
+
+	s.TSDBStore = &divergentTSDBStore{Store: s.tsdb, key: "host", value: "z"}
+	ok, diff, err := s.CompareTagValuePaths(context.Background(), s.tagValuesRequest(t, 0, 1000, "", "host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (TagValuePathsDiff{IndexOnly: []string{"z"}}); ok || !reflect.DeepEqual(diff, exp) {
+		t.Fatalf("got agreement %v and diff %+v, exp divergence %+v", ok, diff, exp)
+	}
+
+	s.RateLimiters = map[string]*rate.Limiter{
+		"CompareTagValuePaths": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	if _, _, err := s.CompareTagValuePaths(context.Background(), s.tagValuesRequest(t, 0, 1000, "", "host")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.CompareTagValuePaths(context.Background(), s.tagValuesRequest(t, 0, 1000, "", "host")); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_ExplainTagEnumeration(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+
+	for _, tt := range []struct {
+		name   string
+		key    string
+		pred   string
+		opts   *ReadOptions
+		path   TagEnumerationPath
+		reason string
+	}{
+		{
+			name:   "no predicate",
+			key:    "host",
+			path:   TagEnumerationIndex,
+			reason: "no option or comparison of the predicate requires a block scan",
+		},
+		{
+			name:   "tag predicate",
+			key:    "host",
+			pred:   `region = 'east'`,
+			path:   TagEnumerationIndex,
+			reason: "no option or comparison of the predicate requires a block scan",
+		},
+		{
+			name:   "field predicate",
+			key:    "host",
+			pred:   `_field = 'v' AND region = 'east'`,
+			path:   TagEnumerationScan,
+			reason: "the predicate compares _field, which is not indexed",
+		},
+		{
+			name:   "fields with tag predicate",
+			key:    "_field",
+			pred:   `host = 'a'`,
+			path:   TagEnumerationScan,
+			reason: "the predicate compares tags, which the index does not correlate with fields",
+		},
+		{
+			name:   "fields with v1 compatibility",
+			key:    "_field",
+			pred:   `host = 'a'`,
+			opts:   &ReadOptions{V1Compat: true},
+			path:   TagEnumerationIndex,
+			reason: "V1Compat reads measurements and fields from the index",
+		},
+		{
+			name:   "recency",
+			key:    "host",
+			opts:   &ReadOptions{SortTagValuesByRecency: true},
+			path:   TagEnumerationScan,
+			reason: "SortTagValuesByRecency requires the time of the points of each value",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContextWithReadOptions(context.Background(), tt.opts)
+			got, err := s.ExplainTagEnumeration(ctx, s.tagValuesRequest(t, 0, 1000, tt.pred, tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := (TagEnumerationPlan{Path: tt.path, Reason: tt.reason}); got != exp {
+				t.Fatalf("got %+v, exp %+v", got, exp)
+			}
+		})
+	}
+
+	req := s.tagValuesRequest(t, 0, 1000, "", "host")
+	req.Predicate = &datatypes.Predicate{Root: &datatypes.Node{
+		NodeType: datatypes.NodeTypeComparisonExpression,
+		Value:    &datatypes.Node_Comparison_{Comparison: datatypes.ComparisonGreater},
+		Children: []*datatypes.Node{
+			{NodeType: datatypes.NodeTypeFieldRef, Value: &datatypes.Node_FieldRefValue{FieldRefValue: "$"}},
+			{NodeType: datatypes.NodeTypeLiteral, Value: &datatypes.Node_IntegerValue{IntegerValue: 1}},
+		},
+	}}
+	if _, err := s.ExplainTagEnumeration(context.Background(), req); err == nil {
+		t.Fatal("expected an error for a field value predicate")
+	}
+}
+
+func TestStore_ExplainRead(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+
+	for _, tt := range []struct {
+		name   string
+		pred   string
+		desc   bool
+		shards []uint64
+		expr   string
+		path   ReadPath
+		reason string
+	}{
+		{
+			name:   "no predicate",
+			shards: []uint64{1, 2},
+			path:   ReadPathIndex,
+			reason: "the read has no predicate",
+		},
+		{
+			name:   "tag predicate",
+			pred:   `host = 'a'`,
+			shards: []uint64{1, 2},
+			expr:   `host::tag = 'a'`,
+			path:   ReadPathIndex,
+			reason: "the predicate compares only measurements and tags, which are indexed",
+		},
+		{
+			name:   "field predicate",
+			pred:   `_field = 'v' AND host = 'a'`,
+			desc:   true,
+			shards: []uint64{2, 1},
+			expr:   `_field::tag = 'v' AND host::tag = 'a'`,
+			path:   ReadPathScan,
+			reason: "the predicate compares _field, which is not indexed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ExplainRead(context.Background(), &datatypes.ReadFilterRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 2000},
+				Predicate:  exprToPredicate(t, tt.pred),
+				Descending: tt.desc,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp := ReadPlan{
+				Database:          s.meta.db.Name,
+				RetentionPolicies: []string{meta.DefaultRetentionPolicyName},
+				ShardIDs:          tt.shards,
+				Predicate:         tt.expr,
+				Path:              tt.path,
+				Reason:            tt.reason,
+			}
+			if !reflect.DeepEqual(got, exp) {
+				t.Fatalf("got %+v, exp %+v", got, exp)
+			}
+		})
+	}
+
+	req := &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 2000},
+	}
+
+	// An explained read counts towards the reads in flight of the
+	// organization while it is planned.
+	s.MaxConcurrentReadsPerOrg = 1
+	rs, err := s.ReadFilter(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ExplainRead(context.Background(), req); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+	rs.Close()
+
+	s.RateLimiters = map[string]*rate.Limiter{
+		"ExplainRead": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	if _, err := s.ExplainRead(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ExplainRead(context.Background(), req); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_ExportCSV(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east usage=1.5,up=true 10",
+		"cpu,host=a,region=east usage=2 20",
+		`log,host=b\,c msg="hello, \"world\"" 10`,
+		"mem free=3i 10",
+	)
+
+	var buf bytes.Buffer
+	if err := s.ExportCSV(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]string{
+		ExportCSVHeader,
+		{"1970-01-01T00:00:00.00000001Z", "cpu", "host=a,region=east", "up", "true"},
+		{"1970-01-01T00:00:00.00000001Z", "cpu", "host=a,region=east", "usage", "1.5"},
+		{"1970-01-01T00:00:00.00000002Z", "cpu", "host=a,region=east", "usage", "2"},
+		{"1970-01-01T00:00:00.00000001Z", "log", `host=b\,c`, "msg", `hello, "world"`},
+		{"1970-01-01T00:00:00.00000001Z", "mem", "", "free", "3"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %q, exp %q", got, exp)
+	}
+}
+
+func TestStore_ExportCSV_Canceled(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := s.ExportCSV(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	}, &buf)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, exp %v", err, context.Canceled)
+	}
+}
+
+func TestStore_ReadFilter_CoerceFields(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1i 10",
+		"cpu,host=a v=9007199254740993i 20",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"cpu,host=a v=2.5 1010",
+	)
+
+	read := func(t *testing.T, opts *ReadOptions) (reads.ResultSet, cursors.Cursor) {
+		t.Helper()
+		rs, err := s.ReadFilter(NewContextWithReadOptions(context.Background(), opts), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 2000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rs.Next() {
+			t.Fatal("expected a series")
+		}
+		return rs, rs.Cursor()
+	}
+
+	t.Run("none", func(t *testing.T) {
+		// Without coercion, the shard of the conflicting type is ignored.
+		rs, cur := read(t, &ReadOptions{})
+		defer rs.Close()
+		defer cur.Close()
+		if got, exp := cursorTimestamps(cur), []int64{10, 20}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+	})
+
+	t.Run("float", func(t *testing.T) {
+		rs, cur := read(t, &ReadOptions{CoerceFields: map[string]cursors.FieldType{"v": cursors.Float}})
+		fc, ok := cur.(cursors.FloatArrayCursor)
+		if !ok {
+			t.Fatalf("got cursor %T, exp float", cur)
+		}
+		var got []float64
+		for a := fc.Next(); a.Len() > 0; a = fc.Next() {
+			got = append(got, a.Values...)
+		}
+		cur.Close()
+		if exp := []float64{1, 9007199254740992, 2.5}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+		if got := rs.(FieldTypeResultSet).FieldType(); got != cursors.Float {
+			t.Fatalf("got field type %v, exp float", got)
+		}
+		rs.Next()
+		rs.Close()
+		if got, exp := rs.(CoercionResultSet).CoercionStats(), (CoercionStats{Lossy: 1}); got != exp {
+			t.Fatalf("got stats %+v, exp %+v", got, exp)
+		}
+	})
+
+	t.Run("integer", func(t *testing.T) {
+		rs, cur := read(t, &ReadOptions{CoerceFields: map[string]cursors.FieldType{"v": cursors.Integer}})
+		ic, ok := cur.(cursors.IntegerArrayCursor)
+		if !ok {
+			t.Fatalf("got cursor %T, exp integer", cur)
+		}
+		var got []int64
+		for a := ic.Next(); a.Len() > 0; a = ic.Next() {
+			got = append(got, a.Values...)
+		}
+		cur.Close()
+		rs.Close()
+		if exp := []int64{1, 9007199254740993, 2}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+		if got, exp := rs.(CoercionResultSet).CoercionStats(), (CoercionStats{Lossy: 1}); got != exp {
+			t.Fatalf("got stats %+v, exp %+v", got, exp)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{CoerceFields: map[string]cursors.FieldType{"v": cursors.String}})
+		if _, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 2000},
+		}); err != ErrInvalidCoercion {
+			t.Fatalf("got error %v, exp %v", err, ErrInvalidCoercion)
+		}
+	})
+}
+
+func TestStore_ActiveMeasurements(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"disk,host=b v=1 20",
+		"mem,host=a v=1 900",
+	)
+
+	names := func(iter cursors.StringIterator, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursors.StringIteratorToSlice(iter)
+	}
+
+	// mem is held by the index of the shard, but dormant in the range.
+	if got, exp := names(s.MeasurementNames(context.Background(), s.mqAttrs(0, 100, ""))), []string{"cpu", "disk", "mem"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("MeasurementNames: got %v, exp %v", got, exp)
+	}
+	if got, exp := names(s.ActiveMeasurements(context.Background(), s.tagKeysRequest(t, 0, 100, ""))), []string{"cpu", "disk"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("ActiveMeasurements: got %v, exp %v", got, exp)
+	}
+	if got, exp := names(s.ActiveMeasurements(context.Background(), s.tagKeysRequest(t, 0, 100, "host = 'a'"))), []string{"cpu"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("ActiveMeasurements with predicate: got %v, exp %v", got, exp)
+	}
+
+	s.RateLimiters = map[string]*rate.Limiter{
+		"ActiveMeasurements": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	if _, err := s.ActiveMeasurements(context.Background(), s.tagKeysRequest(t, 0, 100, "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ActiveMeasurements(context.Background(), s.tagKeysRequest(t, 0, 100, "")); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_MeasurementNames_FieldPredicate(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,region=us v=1,x=1 10",
+		"mem,region=us v=1 10",
+		"net,region=us x=1 900",
+		"disk,region=eu x=1 10",
+		"swap,region=eu x=1 10",
+	)
+
+	for _, tt := range []struct {
+		pred string
+		exp  []string
+	}{
+		// The index selects cpu, mem and net, of which net has no point of
+		// x in the range.
+		{pred: `region = 'us' AND _field = 'x'`, exp: []string{"cpu"}},
+		{pred: `region = 'eu' AND _field = 'x'`, exp: []string{"disk", "swap"}},
+		{pred: `_name = 'disk' AND _field = 'x'`, exp: []string{"disk"}},
+		{pred: `region = 'asia' AND _field = 'x'`, exp: nil},
+		// The index does not narrow the measurements.
+		{pred: `_field = 'x'`, exp: []string{"cpu", "disk", "swap"}},
+		{pred: `region = 'us' OR _field = 'x'`, exp: []string{"cpu", "disk", "mem", "swap"}},
+	} {
+		itr, err := s.MeasurementNames(context.Background(), s.mqAttrs(0, 100, tt.pred))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursors.StringIteratorToSlice(itr); len(got) != len(tt.exp) || (len(got) > 0 && !reflect.DeepEqual(got, tt.exp)) {
+			t.Errorf("%s: got %v, exp %v", tt.pred, got, tt.exp)
+		}
+	}
+}
+
+// The measurements selected by the index are scanned without being compiled
+// into an expression, so their number and names are not limited.
+func TestStore_MeasurementNames_FieldPredicateManyCandidates(t *testing.T) {
+	var lines, exp []string
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("m.%03d(%s)", i, strings.Repeat("x", 200))
+		lines = append(lines, fmt.Sprintf("%s,region=us v=1 10", name))
+		if i%2 == 0 {
+			lines = append(lines, fmt.Sprintf("%s,region=us x=1 10", name))
+			exp = append(exp, name)
+		}
+	}
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, lines...)
+
+	itr, err := s.MeasurementNames(context.Background(), s.mqAttrs(0, 100, `region = 'us' AND _field = 'x'`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cursors.StringIteratorToSlice(itr); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %d names, exp %d", len(got), len(exp))
+	}
+}
+
+// A negated tag comparison selects the measurements with a series that does
+// not have the value, rather than those none of whose series have it.
+func TestStore_MeasurementNames_NegatedTagPredicate(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"mem,host=a v=1 10",
+		"net,host=c v=1 10",
+		"disk v=1 10",
+	)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000,
+		"swap,host=d v=1 1010",
+	)
+
+	for _, tt := range []struct {
+		pred string
+		exp  []string
+	}{
+		{pred: `host != 'a'`, exp: []string{"cpu", "disk", "net"}},
+		{pred: `host !~ /^[ab]$/`, exp: []string{"disk", "net"}},
+		{pred: `host != 'a' AND _name = 'cpu'`, exp: []string{"cpu"}},
+		{pred: `host != 'b' AND host != 'a'`, exp: []string{"disk", "net"}},
+		{pred: `host != 'c' OR _name = 'mem'`, exp: []string{"cpu", "disk", "mem"}},
+	} {
+		itr, err := s.MeasurementNames(context.Background(), s.mqAttrs(0, 100, tt.pred))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursors.StringIteratorToSlice(itr); len(got) != len(tt.exp) || (len(got) > 0 && !reflect.DeepEqual(got, tt.exp)) {
+			t.Errorf("%q: got %v, exp %v", tt.pred, got, tt.exp)
+		}
+	}
+}
+
+func TestStore_MeasurementNames_Regex(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,region=us v=1,x=1 10",
+		"cpu_load,region=eu v=1 10",
+		"cpu_temp,region=us x=1 900",
+		"mem,region=us v=1 10",
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{
+		MeasurementNameRegex: regexp.MustCompile(`^cpu`),
+	})
+	for _, tt := range []struct {
+		pred string
+		exp  []string
+	}{
+		{exp: []string{"cpu", "cpu_load", "cpu_temp"}},
+		{pred: `region = 'us'`, exp: []string{"cpu", "cpu_temp"}},
+		{pred: `_name = 'mem'`, exp: nil},
+		{pred: `region != 'eu'`, exp: []string{"cpu", "cpu_temp"}},
+		// The block scan reads the series of the measurements selected by
+		// the index.
+		{pred: `_field = 'v'`, exp: []string{"cpu", "cpu_load"}},
+		{pred: `region = 'us' AND _field = 'x'`, exp: []string{"cpu"}},
+		{pred: `region = 'eu' OR _field = 'x'`, exp: []string{"cpu", "cpu_load"}},
+	} {
+		itr, err := s.MeasurementNames(ctx, s.mqAttrs(0, 100, tt.pred))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursors.StringIteratorToSlice(itr); len(got) != len(tt.exp) || (len(got) > 0 && !reflect.DeepEqual(got, tt.exp)) {
+			t.Errorf("%q: got %v, exp %v", tt.pred, got, tt.exp)
+		}
+	}
+
+	itr, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		TagKey:     "_measurement",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := cursors.StringIteratorToSlice(itr), []string{"cpu", "cpu_load", "cpu_temp"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("TagValues: got %v, exp %v", got, exp)
+	}
+
+	itr, err = s.ActiveMeasurements(ctx, s.tagKeysRequest(t, 0, 100, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := cursors.StringIteratorToSlice(itr), []string{"cpu", "cpu_load"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("ActiveMeasurements: got %v, exp %v", got, exp)
+	}
+}
+
+func TestMergeNamesIterator(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		names []string
+		exp   []string
+	}{
+		{name: "empty"},
+		{name: "sorted", names: []string{"a", "b", "c"}, exp: []string{"a", "b", "c"}},
+		{name: "duplicates", names: []string{"a", "a", "b", "b"}, exp: []string{"a", "b"}},
+		{
+			name:  "runs",
+			names: []string{"b", "d", "a", "c", "d", "a", "e"},
+			exp:   []string{"a", "b", "c", "d", "e"},
+		},
+		{name: "reversed", names: []string{"c", "b", "a", "a"}, exp: []string{"a", "b", "c"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			names := make([][]byte, len(tt.names))
+			for i, name := range tt.names {
+				names[i] = []byte(name)
+			}
+			if got := cursors.StringIteratorToSlice(newMergeNamesIterator(names)); len(got) != len(tt.exp) || (len(got) > 0 && !reflect.DeepEqual(got, tt.exp)) {
+				t.Fatalf("got %v, exp %v", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestStore_FieldPresence(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a usage=1,idle=1 10",
+		"cpu,host=b usage=1 10",
+		"cpu,host=c idle=1 10",
+		"cpu,host=c usage=1 900",
+		"mem,host=a free=1 20",
+	)
+
+	presence := func(pred string) map[string][]string {
+		t.Helper()
+		a, err := s.FieldPresence(context.Background(), s.tagKeysRequest(t, 0, 100, pred))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string][]string, len(a))
+		for _, sf := range a {
+			m[sf.Key] = sf.Fields
+		}
+		return m
+	}
+
+	// The usage field of host c is written outside the range.
+	if got, exp := presence(""), map[string][]string{
+		"cpu,host=a": {"idle", "usage"},
+		"cpu,host=b": {"usage"},
+		"cpu,host=c": {"idle"},
+		"mem,host=a": {"free"},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if got, exp := presence(`_name = 'cpu' AND host != 'a'`), map[string][]string{
+		"cpu,host=b": {"usage"},
+		"cpu,host=c": {"idle"},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("with predicate: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_MaxPredicateEvalTime(t *testing.T) {
+	s := newTestStore(t)
+	var lines []string
+	for i := 0; i < 2*predicateEvalWindow; i++ {
+		lines = append(lines, fmt.Sprintf("cpu,host=h%03d,region=r%d u=1,v=1 10", i, i%2))
+	}
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, lines...)
+
+	const pred = `_field = 'v' AND host =~ /^h(0|1)*[0-9]+$/`
+	readFilter := func(t *testing.T, ctx context.Context) error {
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+		})
+		if err != nil {
+			return err
+		}
+		defer rs.Close()
+		for rs.Next() {
+			if c := rs.Cursor(); c != nil {
+				c.Close()
+			}
+		}
+		return rs.Err()
+	}
+	tagValues := func(t *testing.T, ctx context.Context) error {
+		_, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "region",
+		})
+		return err
+	}
+
+	t.Run("within budget", func(t *testing.T) {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{MaxPredicateEvalTime: time.Hour})
+		if err := readFilter(t, ctx); err != nil {
+			t.Fatalf("ReadFilter: %v", err)
+		}
+		if err := tagValues(t, ctx); err != nil {
+			t.Fatalf("TagValues: %v", err)
+		}
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		// No evaluation of the regular expression completes in a nanosecond.
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{MaxPredicateEvalTime: time.Nanosecond})
+		if err := readFilter(t, ctx); err != ErrPredicateTooSlow {
+			t.Fatalf("ReadFilter: got error %v, exp %v", err, ErrPredicateTooSlow)
+		}
+		if err := tagValues(t, ctx); err != ErrPredicateTooSlow {
+			t.Fatalf("TagValues: got error %v, exp %v", err, ErrPredicateTooSlow)
+		}
+	})
+}
+
+func TestStore_ReadFilter_IncludeSeriesKey(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,region=east,host=a u=1,v=1 10",
+		`cpu,host=b\ c v=1 10`,
+		"mem free=1 10",
+	)
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{IncludeSeriesKey: true})
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sortedKeys(readAll(t, rs))
+	exp := []string{
+		`_field=free,_measurement=mem,_seriesKey=mem`,
+		`_field=u,_measurement=cpu,_seriesKey=cpu,host=a,region=east,host=a,region=east`,
+		`_field=u,_measurement=cpu,_seriesKey=cpu,host=b\ c,host=b c`,
+		`_field=v,_measurement=cpu,_seriesKey=cpu,host=a,region=east,host=a,region=east`,
+		`_field=v,_measurement=cpu,_seriesKey=cpu,host=b\ c,host=b c`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %q, exp %q", got, exp)
+	}
+}
+
+// missingShardTSDBStore hides a shard from the first calls to Shards.
+type missingShardTSDBStore struct {
+	TSDBStore
+	missing uint64
+	hidden  int // hidden is the number of calls hiding the shard, or -1 for all.
+	calls   int
+}
+
+func (s *missingShardTSDBStore) Shards(ids []uint64) []*tsdb.Shard {
+	s.calls++
+	var shards []*tsdb.Shard
+	for _, sh := range s.TSDBStore.Shards(ids) {
+		if sh.ID() == s.missing && (s.hidden < 0 || s.calls <= s.hidden) {
+			continue
+		}
+		shards = append(shards, sh)
+	}
+	return shards
+}
+
+func TestStore_MaxConcurrentReadsPerOrg(t *testing.T) {
+	s := newTestStore(t)
+	s.MaxConcurrentReadsPerOrg = 2
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+
+	source := func(orgID uint64) *types.Any {
+		src, err := types.MarshalAny(s.GetSource(orgID, testBucketID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+	readFilter := func(orgID uint64) (reads.ResultSet, error) {
+		return s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: source(orgID),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+	}
+
+	// The result sets of the org remain in flight until closed.
+	var open []reads.ResultSet
+	for i := 0; i < 2; i++ {
+		rs, err := readFilter(testOrgID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		open = append(open, rs)
+	}
+	if _, err := readFilter(testOrgID); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("saturated: got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+	if _, err := s.TagKeys(context.Background(), &datatypes.TagKeysRequest{
+		TagsSource: source(testOrgID),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	}); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("saturated tag keys: got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+	if _, err := s.FieldTypeConflicts(context.Background(), s.tagKeysRequest(t, 0, 1000, "")); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("saturated field type conflicts: got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+
+	// Another org proceeds.
+	rs, err := readFilter(testOrgID + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rs); len(got) != 1 {
+		t.Fatalf("other org: got %v", got)
+	}
+
+	// Closing a result set, more than once, frees a single read.
+	open[0].Close()
+	open[0].Close()
+	rs, err = readFilter(testOrgID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFilter(testOrgID); err != ErrOrgConcurrencyExceeded {
+		t.Fatalf("after close: got error %v, exp %v", err, ErrOrgConcurrencyExceeded)
+	}
+	rs.Close()
+	open[1].Close()
+}
+
+func TestStore_ShardGroupFilter(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 3, 2000, 3000, "cpu,host=a v=1 2010")
+
+	read := func(opts *ReadOptions) []int64 {
+		ctx := NewContextWithReadOptions(context.Background(), opts)
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 3000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)["_field=v,_measurement=cpu,host=a"]
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts *ReadOptions
+		exp  []int64
+	}{
+		{name: "none", opts: &ReadOptions{}, exp: []int64{10, 1010, 2010}},
+		{name: "exclude most recent", opts: &ReadOptions{ExcludeShardGroups: []uint64{3}}, exp: []int64{10, 1010}},
+		{name: "include", opts: &ReadOptions{IncludeShardGroups: []uint64{1, 3}}, exp: []int64{10, 2010}},
+		{name: "exclude precedence", opts: &ReadOptions{IncludeShardGroups: []uint64{1, 3}, ExcludeShardGroups: []uint64{1}}, exp: []int64{2010}},
+		{name: "include unknown", opts: &ReadOptions{IncludeShardGroups: []uint64{4}}, exp: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := read(tt.opts); !reflect.DeepEqual(got, tt.exp) {
+				t.Fatalf("got %v, exp %v", got, tt.exp)
+			}
+		})
+	}
+}
+
+func TestStore_RetentionPolicyFallbacks(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 1000, 2000, "cpu,host=a v=1 1010")
+	s.mustWriteShardGroup(t, "downsampled", 2, 0, 1000, "cpu,host=b v=1 10")
+	s.mustWriteShardGroup(t, "cold", 3, 0, 1000, "cpu,host=c v=1 20")
+
+	read := func(start, end int64) map[string][]int64 {
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: start, End: end},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, rs)
+	}
+
+	if got := read(0, 999); len(got) != 0 {
+		t.Fatalf("without fallbacks: got %v, exp no series", got)
+	}
+
+	// Retention policies not defined for the bucket are skipped, and the
+	// first with shards in the range is read.
+	s.RetentionPolicyFallbacks = []string{"missing", "downsampled", "cold"}
+	if got, exp := read(0, 999), map[string][]int64{
+		"_field=v,_measurement=cpu,host=b": {10},
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("fallback: got %v, exp %v", got, exp)
+	}
+	// The index is shared by the retention policies, and the series of the
+	// others are read without points from the retention policy of the
+	// request, as they are without fallbacks.
+	if got, exp := read(1000, 2000), map[string][]int64{
+		"_field=v,_measurement=cpu,host=a": {1010},
+		"_field=v,_measurement=cpu,host=b": nil,
+		"_field=v,_measurement=cpu,host=c": nil,
+	}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("primary: got %v, exp %v", got, exp)
+	}
+
+	itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 999},
+		TagKey:     "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := cursors.StringIteratorToSlice(itr), []string{"b"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("TagValues: got %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_MissingShardPolicy(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	tsdbStore := s.TSDBStore
+
+	for _, tt := range []struct {
+		name   string
+		policy MissingShardPolicy
+		hidden int
+		exp    []int64
+		err    error
+		warned bool
+	}{
+		{name: "skip", policy: MissingShardSkip, hidden: -1, exp: []int64{10}, warned: true},
+		{name: "error", policy: MissingShardError, hidden: -1, err: ErrMissingShard},
+		{name: "retry found", policy: MissingShardRetry, hidden: 1, exp: []int64{10, 1010}},
+		{name: "retry missing", policy: MissingShardRetry, hidden: -1, err: ErrMissingShard},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			s.Logger = zap.New(core)
+			s.TSDBStore = &missingShardTSDBStore{TSDBStore: tsdbStore, missing: 2, hidden: tt.hidden}
+			s.MissingShardPolicy = tt.policy
+
+			rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+				ReadSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 1, End: 2000},
+			})
+			if err != tt.err {
+				t.Fatalf("got error %v, exp %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := readAll(t, rs)["_field=v,_measurement=cpu,host=a"]; !reflect.DeepEqual(got, tt.exp) {
+				t.Fatalf("got %v, exp %v", got, tt.exp)
+			}
+			if got := logs.FilterMessage("Shard not found").Len() > 0; got != tt.warned {
+				t.Fatalf("got warning %t, exp %t", got, tt.warned)
+			}
+		})
+	}
+}
+
+func TestStore_TagKeysLimit(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=us,zone=z v=1 10",
+	)
+
+	for _, tt := range []struct {
+		pred      string
+		limit     int
+		exp       []string
+		truncated bool
+	}{
+		{limit: 3, exp: []string{"_field", "_measurement", "host"}, truncated: true},
+		{limit: 5, exp: []string{"_field", "_measurement", "host", "region", "zone"}},
+		{pred: `_field = 'v'`, limit: 3, exp: []string{"_field", "_measurement", "host"}, truncated: true},
+		{pred: `_field = 'v'`, limit: 6, exp: []string{"_field", "_measurement", "host", "region", "zone"}},
+	} {
+		ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{TagKeysLimit: tt.limit})
+		itr, err := s.TagKeys(ctx, &datatypes.TagKeysRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, tt.pred),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		titr, ok := itr.(TruncatedStringIterator)
+		if !ok {
+			t.Fatalf("predicate %q, limit %d: got %T, exp TruncatedStringIterator", tt.pred, tt.limit, itr)
+		}
+		if got := cursors.StringIteratorToSlice(itr); !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("predicate %q, limit %d: got %v, exp %v", tt.pred, tt.limit, got, tt.exp)
+		}
+		if got := titr.Truncated(); got != tt.truncated {
+			t.Errorf("predicate %q, limit %d: got truncated %v, exp %v", tt.pred, tt.limit, got, tt.truncated)
+		}
+	}
+}
+
+func TestStore_TagKeysForField(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a,region=east v=1 10",
+		"cpu,host=b,rack=r1 u=1 10",
+		"mem,dc=x v=1 10",
+		"mem,zone=z v=1 900",
+	)
+
+	for _, tt := range []struct {
+		name string
+		pred string
+		exp  []string
+	}{
+		{
+			// rack is only written by a series without v, and zone only
+			// outside the range.
+			name: "all",
+			exp:  []string{"_field", "_measurement", "dc", "host", "region"},
+		},
+		{
+			name: "predicate",
+			pred: `_name = 'cpu'`,
+			exp:  []string{"_field", "_measurement", "host", "region"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			iter, err := s.TagKeysForField(context.Background(), s.tagKeysRequest(t, 1, 100, tt.pred), "v")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cursors.StringIteratorToSlice(iter); !reflect.DeepEqual(got, tt.exp) {
+				t.Fatalf("got %v, exp %v", got, tt.exp)
+			}
+		})
+	}
+
+	s.RateLimiters = map[string]*rate.Limiter{
+		"TagKeysForField": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	if _, err := s.TagKeysForField(context.Background(), s.tagKeysRequest(t, 1, 100, ""), "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TagKeysForField(context.Background(), s.tagKeysRequest(t, 1, 100, ""), "v"); err != ErrRateLimited {
+		t.Fatalf("got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_ReadFilter_GapThreshold(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=a v=1 20",
+		"cpu,host=a v=1 30",
+		"cpu,host=a v=1 100",
+		"cpu,host=a v=1 110",
+		"cpu,host=a v=1 300",
+		"cpu,host=b v=1 10",
+		"cpu,host=b v=1 50",
+	)
+
+	read := func(opts *ReadOptions) (map[string][]int64, map[string][]Gap, map[string]cursors.FieldType) {
+		ctx := NewContextWithReadOptions(context.Background(), opts)
+		rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Close()
+
+		points := make(map[string][]int64)
+		gaps := make(map[string][]Gap)
+		types := make(map[string]cursors.FieldType)
+		for rs.Next() {
+			key := seriesString(rs.Tags())
+			cur := rs.Cursor()
+			if ic, ok := cur.(cursors.IntegerArrayCursor); ok {
+				for a := ic.Next(); a.Len() > 0; a = ic.Next() {
+					points[key] = append(points[key], a.Values...)
+				}
+			} else {
+				points[key] = cursorTimestamps(cur)
+			}
+			cur.Close()
+			gaps[key] = rs.(GapResultSet).Gaps()
+			types[key] = rs.(FieldTypeResultSet).FieldType()
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return points, gaps, types
+	}
+
+	const a, b = "_field=v,_measurement=cpu,host=a", "_field=v,_measurement=cpu,host=b"
+
+	// Gaps are reported alongside the points.
+	points, gaps, _ := read(&ReadOptions{GapThreshold: 50})
+	if got, exp := points[a], []int64{10, 20, 30, 100, 110, 300}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got points %v, exp %v", got, exp)
+	}
+	if exp := map[string][]Gap{
+		a: {{Start: 30, End: 100}, {Start: 110, End: 300}},
+		b: nil,
+	}; !reflect.DeepEqual(gaps, exp) {
+		t.Fatalf("got gaps %v, exp %v", gaps, exp)
+	}
+
+	// A gap must exceed the threshold.
+	_, gaps, _ = read(&ReadOptions{GapThreshold: 40})
+	if got, exp := gaps[b], []Gap(nil); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("threshold: got gaps %v, exp %v", got, exp)
+	}
+
+	// Only the durations of the gaps are produced, shifted with the points.
+	points, gaps, types := read(&ReadOptions{GapThreshold: 50, GapsOnly: true, TimeShift: 1000})
+	if got, exp := points[a], []int64{70, 190}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("gaps only: got durations %v, exp %v", got, exp)
+	}
+	if got, exp := gaps[a], []Gap{{Start: 1030, End: 1100}, {Start: 1110, End: 1300}}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("gaps only: got gaps %v, exp %v", got, exp)
+	}
+	if got, exp := types[a], cursors.Integer; got != exp {
+		t.Fatalf("gaps only: got type %v, exp %v", got, exp)
+	}
+}
+
+func TestStore_ReadFilter_CountFieldPoints(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a u=1,v=1 10",
+		"cpu,host=a v=2 20",
+		"cpu,host=b v=1 30",
+		"mem,host=a v=1,free=1 40",
+		"mem,host=a free=2 900",
+	)
+
+	read := func(t *testing.T, opts *ReadOptions) map[string]int64 {
+		rs, err := s.ReadFilter(NewContextWithReadOptions(context.Background(), opts), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 100},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		readAll(t, rs)
+		return rs.(FieldPointCountResultSet).FieldPointCounts()
+	}
+
+	if got := read(t, &ReadOptions{}); got != nil {
+		t.Fatalf("got counts %v without CountFieldPoints, exp nil", got)
+	}
+	if got, exp := read(t, &ReadOptions{CountFieldPoints: true}), map[string]int64{"free": 1, "u": 1, "v": 4}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+	if got, exp := read(t, &ReadOptions{CountFieldPoints: true, MaxPointsPerSeries: 1}), map[string]int64{"free": 1, "u": 1, "v": 3}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("decimated: got %v, exp %v", got, exp)
+	}
+}
+
+// cursorsResultSet is a reads.ResultSet whose Cursor returns curs in turn.
+type cursorsResultSet struct {
+	reads.ResultSet
+	curs []cursors.Cursor
+}
+
+func (r *cursorsResultSet) Cursor() cursors.Cursor {
+	cur := r.curs[0]
+	r.curs = r.curs[1:]
+	return cur
+}
+
+// A series whose points could not be counted is produced by a new cursor, as
+// the cursor that was counted may be partially read.
+func TestDecimateResultSet_CountError(t *testing.T) {
+	failed := &testFloatArrayCursor{
+		testArrayCursor: testArrayCursor{err: errors.New("read failed")},
+		arrays:          []*cursors.FloatArray{{Timestamps: []int64{10}, Values: []float64{1}}},
+	}
+	fresh := &testFloatArrayCursor{
+		arrays: []*cursors.FloatArray{{Timestamps: []int64{10, 20, 30}, Values: []float64{1, 2, 3}}},
+	}
+	rs := &decimateResultSet{
+		ResultSet: &cursorsResultSet{curs: []cursors.Cursor{failed, fresh}},
+		max:       1,
+	}
+
+	if cur := rs.Cursor(); cur != fresh {
+		t.Fatalf("got cursor %v, exp the undecimated new cursor", cur)
+	}
+	if !failed.closed {
+		t.Fatal("expected the counted cursor to be closed")
+	}
+}
+
+// testShardRehydrator makes the cold shard hidden by a missingShardTSDBStore
+// visible once rehydrated.
+type testShardRehydrator struct {
+	store      *missingShardTSDBStore
+	block      bool // block rehydrates until the context is done.
+	rehydrated []uint64
+}
+
+func (r *testShardRehydrator) IsCold(id uint64) bool {
+	return id == r.store.missing && r.store.hidden != 0
+}
+
+func (r *testShardRehydrator) Rehydrate(ctx context.Context, id uint64) error {
+	if r.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	r.rehydrated = append(r.rehydrated, id)
+	r.store.hidden = 0
+	return nil
+}
+
+func TestStore_ShardRehydrator(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 2, 1000, 2000, "cpu,host=a v=1 1010")
+	tsdbStore := s.TSDBStore
+	s.MissingShardPolicy = MissingShardError
+
+	read := func(t *testing.T) ([]int64, error) {
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 1, End: 2000},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return readAll(t, rs)["_field=v,_measurement=cpu,host=a"], nil
+	}
+
+	t.Run("rehydrated", func(t *testing.T) {
+		cold := &missingShardTSDBStore{TSDBStore: tsdbStore, missing: 2, hidden: -1}
+		r := &testShardRehydrator{store: cold}
+		s.TSDBStore, s.ShardRehydrator = cold, r
+
+		got, err := read(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := []int64{10, 1010}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("got %v, exp %v", got, exp)
+		}
+		if exp := []uint64{2}; !reflect.DeepEqual(r.rehydrated, exp) {
+			t.Fatalf("got rehydrated shards %v, exp %v", r.rehydrated, exp)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cold := &missingShardTSDBStore{TSDBStore: tsdbStore, missing: 2, hidden: -1}
+		s.TSDBStore, s.ShardRehydrator = cold, &testShardRehydrator{store: cold, block: true}
+		s.RehydrationTimeout = 10 * time.Millisecond
+		defer func() { s.RehydrationTimeout = 0 }()
+
+		if _, err := read(t); err != ErrRehydrationTimeout {
+			t.Fatalf("got error %v, exp %v", err, ErrRehydrationTimeout)
+		}
+	})
+}
+
+// integerPointsIterator is a query.IntegerIterator producing points.
+type integerPointsIterator struct {
+	points []query.IntegerPoint
+}
+
+func (itr *integerPointsIterator) Next() (*query.IntegerPoint, error) {
+	if len(itr.points) == 0 {
+		return nil, nil
+	}
+	p := &itr.points[0]
+	itr.points = itr.points[1:]
+	return p, nil
+}
+
+func (itr *integerPointsIterator) Stats() query.IteratorStats { return query.IteratorStats{} }
+func (itr *integerPointsIterator) Close() error               { return nil }
+
+// emptyIterator is a query.Iterator of no known point type.
+type emptyIterator struct{}
+
+func (emptyIterator) Stats() query.IteratorStats { return query.IteratorStats{} }
+func (emptyIterator) Close() error               { return nil }
+
+func TestStore_MeasurementFields_IteratorTypes(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		`log,host=a msg="a",level="info" 10`,
+		`log,host=b msg="b" 10`,
+	)
+
+	// The shards produce float points, regardless of the type of the fields.
+	itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		TagKey:     "_field",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := cursors.StringIteratorToSlice(itr), []string{"level", "msg"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("got %v, exp %v", got, exp)
+	}
+
+	names, err := fieldKeysIteratorNames(&integerPointsIterator{points: []query.IntegerPoint{
+		{Aux: []interface{}{"a"}},
+		{},
+		{Aux: []interface{}{"b"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"a", "b"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("integer iterator: got %v, exp %v", names, exp)
+	}
+
+	if _, err := fieldKeysIteratorNames(&integerPointsIterator{points: []query.IntegerPoint{{Aux: []interface{}{int64(1)}}}}); err == nil {
+		t.Fatal("expected an error for a field key that is not a string")
+	}
+	if _, err := fieldKeysIteratorNames(emptyIterator{}); err == nil {
+		t.Fatal("expected an error for an unexpected iterator")
+	}
+}
+
+func TestStore_MeasurementFieldTypes(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		`cpu,host=a v=1,s="x",b=true 10`,
+		`cpu,host=b i=1i 10`,
+		`mem,host=a v=2i 10`,
+	)
+
+	for _, tc := range []struct {
+		pred string
+		exp  []FieldKeyType
+	}{
+		{
+			exp: []FieldKeyType{
+				{Name: "b", Type: cursors.Boolean},
+				{Name: "i", Type: cursors.Integer},
+				{Name: "s", Type: cursors.String},
+				{Name: "v", Type: cursors.Float},
+				{Name: "v", Type: cursors.Integer},
+			},
+		},
+		{
+			pred: `_name = 'mem'`,
+			exp:  []FieldKeyType{{Name: "v", Type: cursors.Integer}},
+		},
+		{
+			pred: `_field = 'v'`,
+			exp: []FieldKeyType{
+				{Name: "v", Type: cursors.Float},
+				{Name: "v", Type: cursors.Integer},
+			},
+		},
+		{
+			pred: `host = 'b'`,
+			exp:  []FieldKeyType{{Name: "i", Type: cursors.Integer}},
+		},
+	} {
+		t.Run(tc.pred, func(t *testing.T) {
+			got, err := s.MeasurementFieldTypes(context.Background(), s.tagKeysRequest(t, 0, 1000, tc.pred))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.exp) {
+				t.Fatalf("got %v, exp %v", got, tc.exp)
+			}
+		})
+	}
+
+	if _, err := fieldKeysIteratorTypes(&integerPointsIterator{points: []query.IntegerPoint{{Aux: []interface{}{"a"}}}}); err == nil {
+		t.Fatal("expected an error for a field key without a type")
+	}
+}
+
+// untypedCursor is a cursors.Cursor that is not an array cursor.
+type untypedCursor struct{}
+
+func (untypedCursor) Close()                     {}
+func (untypedCursor) Err() error                 { return nil }
+func (untypedCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+func TestCursorHasData(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000, "cpu,host=a v=1 10")
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if !rs.Next() {
+		t.Fatal("expected a series")
+	}
+	c := rs.Cursor()
+	ok, err := cursorHasData(c)
+	c.Close()
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, exp true, nil", ok, err)
+	}
+
+	if _, err := cursorHasData(untypedCursor{}); err == nil {
+		t.Fatal("expected an error for an unknown cursor type")
+	}
+}
+
+// The helpers reading cursors fail, rather than panic, on a cursor that is
+// not an array cursor of a known type.
+func TestCursorHelpers_UnexpectedType(t *testing.T) {
+	if _, err := cursorCount(untypedCursor{}); err == nil {
+		t.Fatal("cursorCount: expected an error for an unknown cursor type")
+	}
+	if _, _, err := cursorLastTimestamp(untypedCursor{}); err == nil {
+		t.Fatal("cursorLastTimestamp: expected an error for an unknown cursor type")
+	}
+	if _, _, err := cursorFirstTimestamp(untypedCursor{}); err == nil {
+		t.Fatal("cursorFirstTimestamp: expected an error for an unknown cursor type")
+	}
+}
+
+// The helpers reading cursors report the error of a cursor that fails to
+// read, rather than treating it as having no more points.
+func TestCursorHelpers_Err(t *testing.T) {
+	errRead := errors.New("read failed")
+	cur := &testFloatArrayCursor{
+		testArrayCursor: testArrayCursor{err: errRead},
+		arrays:          []*cursors.FloatArray{{Timestamps: []int64{10}, Values: []float64{1}}},
+	}
+	if n, err := cursorCount(cur); err != errRead {
+		t.Fatalf("cursorCount: got %d, %v, exp error %v", n, err, errRead)
+	}
+
+	cur = &testFloatArrayCursor{
+		testArrayCursor: testArrayCursor{err: errRead},
+		arrays:          []*cursors.FloatArray{{Timestamps: []int64{10}, Values: []float64{1}}},
+	}
+	if ts, _, err := cursorLastTimestamp(cur); err != errRead {
+		t.Fatalf("cursorLastTimestamp: got %d, %v, exp error %v", ts, err, errRead)
+	}
+
+	if ok, err := cursorHasData(&testFloatArrayCursor{testArrayCursor: testArrayCursor{err: errRead}}); err != errRead {
+		t.Fatalf("cursorHasData: got %v, %v, exp error %v", ok, err, errRead)
+	}
+	if ts, _, err := cursorFirstTimestamp(&testFloatArrayCursor{testArrayCursor: testArrayCursor{err: errRead}}); err != errRead {
+		t.Fatalf("cursorFirstTimestamp: got %d, %v, exp error %v", ts, err, errRead)
+	}
+}
+
+func TestStore_Metrics(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+	reg := prometheus.NewRegistry()
+	s.WithMetrics(reg)
+
+	for _, pred := range []string{"", "", `_field = 'v'`} {
+		if _, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "host",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{TagKey: "host"}); err != ErrMissingReadSource {
+		t.Fatalf("got %v, exp %v", err, ErrMissingReadSource)
+	}
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, rs)
+
+	mfs := promtest.MustGather(t, reg)
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		exp    float64
+	}{
+		{"service_storage_reads_call_total", map[string]string{"method": "tag_values"}, 4},
+		{"service_storage_reads_call_total", map[string]string{"method": "read_filter"}, 1},
+		{"service_storage_reads_error_total", map[string]string{"method": "tag_values", "code": influxdb.ErrorCode(ErrMissingReadSource)}, 1},
+		{"service_storage_reads_tag_values_path_total", map[string]string{"path": "index"}, 2},
+		{"service_storage_reads_tag_values_path_total", map[string]string{"path": "scan"}, 1},
+	} {
+		m := promtest.MustFindMetric(t, mfs, tc.name, tc.labels)
+		if got := m.GetCounter().GetValue(); got != tc.exp {
+			t.Errorf("%s %v: got %v, exp %v", tc.name, tc.labels, got, tc.exp)
+		}
+	}
+	m := promtest.MustFindMetric(t, mfs, "service_storage_reads_duration", map[string]string{"method": "read_filter"})
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("read_filter duration: got %d samples, exp 1", got)
+	}
+	if m := promtest.FindMetric(mfs, "service_storage_reads_call_total", map[string]string{"method": "read_group"}); m != nil {
+		t.Errorf("read_group: got %v, exp no calls", m)
+	}
+}
+
+func TestStore_MaxQueryDuration(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 20",
+	)
+	req := &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+	}
+
+	// A read within the bound is served.
+	s.WithMaxQueryDuration(time.Minute)
+	rs, err := s.ReadFilter(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readAll(t, rs)); got != 2 {
+		t.Fatalf("unexpected number of series: got %d, exp 2", got)
+	}
+
+	// A read exceeding the bound fails with ErrQueryTimeout, either when it
+	// is requested or while its result set is read.
+	s.WithMaxQueryDuration(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	rs, err = s.ReadFilter(context.Background(), req)
+	if err == nil && rs != nil {
+		for rs.Next() {
+		}
+		err = rs.Err()
+		rs.Close()
+	}
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("unexpected error: got %v, exp %v", err, ErrQueryTimeout)
+	}
+
+	_, err = s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		TagKey:     "host",
+	})
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("unexpected error: got %v, exp %v", err, ErrQueryTimeout)
+	}
+
+	// Metaqueries and other calls reading shards are bounded as well.
+	if _, err := s.ActiveMeasurements(context.Background(), s.tagKeysRequest(t, 1, 1000, "")); !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("ActiveMeasurements: got error %v, exp %v", err, ErrQueryTimeout)
+	}
+	if err := s.Warm(context.Background(), testOrgID, testBucketID, 1, 1000); !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("Warm: got error %v, exp %v", err, ErrQueryTimeout)
+	}
+
+	// A read whose own context is done first reports the error of its context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.WithMaxQueryDuration(time.Minute)
+	_, err = s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 1, End: 1000},
+		TagKey:     "host",
+	})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("unexpected error: got %v, exp %v", err, context.Canceled)
+	}
+}
+
+func TestStore_Tracing(t *testing.T) {
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	parent, ctx := opentracing.StartSpanFromContext(context.Background(), "query")
+	rs, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, rs)
+	if _, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		Predicate:  exprToPredicate(t, `_field = 'v'`),
+		TagKey:     "host",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TagKeys(ctx, &datatypes.TagKeysRequest{}); err != ErrMissingReadSource {
+		t.Fatalf("got error %v, exp %v", err, ErrMissingReadSource)
+	}
+	parent.Finish()
+
+	spans := make(map[string]*mocktracer.MockSpan)
+	for _, span := range tracer.FinishedSpans() {
+		spans[span.OperationName] = span
+	}
+	parentID := parent.(*mocktracer.MockSpan).SpanContext.SpanID
+	for _, tt := range []struct {
+		op   string
+		tags map[string]interface{}
+	}{
+		{
+			op: "storage.Store.ReadFilter",
+			tags: map[string]interface{}{
+				"database":  s.meta.db.Name,
+				"rp":        meta.DefaultRetentionPolicyName,
+				"shards":    1,
+				"slow_path": false,
+			},
+		},
+		{
+			op: "storage.Store.TagValues",
+			tags: map[string]interface{}{
+				"database":  s.meta.db.Name,
+				"rp":        meta.DefaultRetentionPolicyName,
+				"shards":    1,
+				"slow_path": true,
+			},
+		},
+		{
+			op:   "storage.Store.TagKeys",
+			tags: map[string]interface{}{"error": true},
+		},
+	} {
+		span, ok := spans[tt.op]
+		if !ok {
+			t.Errorf("%s: span not finished", tt.op)
+			continue
+		}
+		if span.ParentID != parentID {
+			t.Errorf("%s: got parent %d, exp %d", tt.op, span.ParentID, parentID)
+		}
+		if got := span.Tags(); !reflect.DeepEqual(got, tt.tags) {
+			t.Errorf("%s: got tags %v, exp %v", tt.op, got, tt.tags)
+		}
+	}
+}
+
+func TestStore_SlowPathLogging(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b w=1 10",
+	)
+
+	for _, tt := range []struct {
+		name   string
+		key    string
+		pred   string
+		reason string
+	}{
+		{name: "index", key: "host", pred: `host = 'a'`},
+		{name: "field predicate", key: "host", pred: `_field = 'v'`, reason: "field predicate"},
+		{name: "tag predicate", key: "_field", pred: `host = 'a'`, reason: "tag predicate"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.DebugLevel)
+			s.Logger = zap.New(core)
+
+			itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+				Predicate:  exprToPredicate(t, tt.pred),
+				TagKey:     tt.key,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cursors.StringIteratorToSlice(itr)
+
+			if tt.reason == "" {
+				if got := logs.Len(); got != 0 {
+					t.Fatalf("got %d log entries, exp 0", got)
+				}
+				return
+			}
+
+			started := logs.FilterMessage("Tag values falling back to block scan").All()
+			if len(started) != 1 {
+				t.Fatalf("got %d start entries, exp 1", len(started))
+			}
+			fields := started[0].ContextMap()
+			if got, exp := fields["database"], s.meta.db.Name; got != exp {
+				t.Fatalf("got database %v, exp %v", got, exp)
+			}
+			if got := fields["reason"]; got != tt.reason {
+				t.Fatalf("got reason %v, exp %v", got, tt.reason)
+			}
+			if got, _ := fields["predicate"].(string); got == "" {
+				t.Fatal("expected the predicate to be logged")
+			}
+
+			finished := logs.FilterMessage("Tag values block scan finished").All()
+			if len(finished) != 1 {
+				t.Fatalf("got %d finish entries, exp 1", len(finished))
+			}
+			if got := finished[0].ContextMap()["shards"]; got != int64(1) {
+				t.Fatalf("got shards %v, exp 1", got)
+			}
+		})
+	}
+
+	// Nothing is logged above debug level.
+	core, logs := observer.New(zap.InfoLevel)
+	s.Logger = zap.New(core)
+	itr, err := s.TagValues(context.Background(), &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		Predicate:  exprToPredicate(t, `_field = 'v'`),
+		TagKey:     "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursors.StringIteratorToSlice(itr)
+	if got := logs.Len(); got != 0 {
+		t.Fatalf("got %d log entries, exp 0", got)
+	}
+}
+
+func TestStore_ReadSourceVersion(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	if got := s.GetSource(testOrgID, testBucketID).(*readSource).Version; got != ReadSourceVersion {
+		t.Fatalf("got version %d, exp %d", got, ReadSourceVersion)
+	}
+
+	read := func(version uint32) error {
+		src, err := types.MarshalAny(&readSource{
+			BucketID:       testBucketID,
+			OrganizationID: testOrgID,
+			Version:        version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+			ReadSource: src,
+			Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		})
+		if err != nil {
+			return err
+		}
+		if got := readAll(t, rs); len(got) != 1 {
+			t.Fatalf("version %d: got %v, exp 1 series", version, got)
+		}
+		return nil
+	}
+
+	// A source without a version predates versioning.
+	if err := read(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(ReadSourceVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := read(ReadSourceVersion + 1); !errors.Is(err, ErrUnknownSourceVersion) {
+		t.Fatalf("got error %v, exp %v", err, ErrUnknownSourceVersion)
+	}
+
+	for _, tt := range []struct {
+		version uint32
+		err     error
+	}{
+		{version: 0},
+		{version: ReadSourceVersion},
+		{version: ReadSourceVersion + 1, err: ErrUnknownSourceVersion},
+	} {
+		src, err := types.MarshalAny(&ReadSource{Database: "db", RetentionPolicy: "rp", Version: tt.version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetReadSource(*src)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("version %d: got error %v, exp %v", tt.version, err, tt.err)
+		}
+		if exp := (&ReadSource{Database: "db", RetentionPolicy: "rp", Version: tt.version}); err == nil && !reflect.DeepEqual(got, exp) {
+			t.Fatalf("version %d: got %v, exp %v", tt.version, got, exp)
+		}
+	}
+}
+
+func TestStore_TagValuesCardinality(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+		"cpu,host=b v=1 10",
+		"cpu,host=c w=1 10",
+		"cpu v=1 10",
+		"mem,host=d v=1 10",
+	)
+
+	for _, tt := range []struct {
+		name  string
+		key   string
+		pred  string
+		opts  *ReadOptions
+		limit int64
+		exp   int64
+	}{
+		{name: "index", key: "host", exp: 4},
+		{name: "predicate", key: "host", pred: `_measurement = 'cpu'`, exp: 3},
+		{name: "field predicate", key: "host", pred: `_field = 'v'`, exp: 3},
+		{name: "include empty", key: "host", pred: `_measurement = 'cpu'`, opts: &ReadOptions{IncludeEmptyTagValues: true}, exp: 4},
+		{name: "include empty field predicate", key: "host", pred: `_field = 'v'`, opts: &ReadOptions{IncludeEmptyTagValues: true}, exp: 4},
+		{name: "max distinct values", key: "host", opts: &ReadOptions{MaxDistinctValues: 2}, exp: 2},
+		{name: "limit", key: "host", limit: 3, exp: 3},
+		{name: "limit include empty", key: "host", pred: `_measurement = 'cpu'`, opts: &ReadOptions{IncludeEmptyTagValues: true}, limit: 1, exp: 2},
+		{name: "measurement", key: "_measurement", exp: 2},
+		{name: "field", key: "_field", pred: `_measurement = 'cpu'`, exp: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContextWithReadOptions(context.Background(), tt.opts)
+			req := &datatypes.TagValuesRequest{
+				TagsSource: s.source(t),
+				Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+				Predicate:  exprToPredicate(t, tt.pred),
+				TagKey:     tt.key,
+				Limit:      tt.limit,
+			}
+			got, err := s.TagValuesCardinality(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.exp {
+				t.Fatalf("got %d, exp %d", got, tt.exp)
+			}
+
+			itr, err := s.TagValues(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if values := cursors.StringIteratorToSlice(itr); int64(len(values)) != got {
+				t.Fatalf("got %d, TagValues returned %v", got, values)
+			}
+
+			r := *req
+			r.CountOnly = true
+			itr, err = s.TagValues(ctx, &r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			citr, ok := itr.(CountStringIterator)
+			if !ok {
+				t.Fatalf("got %T, exp a CountStringIterator", itr)
+			}
+			if citr.Next() || citr.Count() != got {
+				t.Fatalf("count only: got %d, exp %d and no values", citr.Count(), got)
+			}
+		})
+	}
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{MaxDistinctValues: 2, FailOnMaxDistinctValues: true})
+	if _, err := s.TagValuesCardinality(ctx, &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		TagKey:     "host",
+	}); err != ErrTooManyDistinctValues {
+		t.Fatalf("got error %v, exp %v", err, ErrTooManyDistinctValues)
+	}
+
+	// Counting the values of a TagValues request is limited as reading them.
+	s.RateLimiters = map[string]*rate.Limiter{
+		"TagValues": rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	req := &datatypes.TagValuesRequest{
+		TagsSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		TagKey:     "host",
+		CountOnly:  true,
+	}
+	if _, err := s.TagValues(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TagValues(context.Background(), req); err != ErrRateLimited {
+		t.Fatalf("count only: got error %v, exp %v", err, ErrRateLimited)
+	}
+}
+
+func TestStore_StrictPredicateKeys(t *testing.T) {
+	s := newTestStore(t)
+	s.mustWriteShardGroup(t, meta.DefaultRetentionPolicyName, 1, 0, 1000,
+		"cpu,host=a v=1 10",
+	)
+
+	read := func(ctx context.Context, pred string, start, end int64) error {
+		rng := datatypes.TimestampRange{Start: start, End: end}
+		if _, err := s.ReadFilter(ctx, &datatypes.ReadFilterRequest{
+			ReadSource: s.source(t),
+			Range:      rng,
+			Predicate:  exprToPredicate(t, pred),
+		}); err != nil {
+			return err
+		}
+		if _, err := s.ReadGroup(ctx, &datatypes.ReadGroupRequest{
+			ReadSource: s.source(t),
+			Range:      rng,
+			Predicate:  exprToPredicate(t, pred),
+			Group:      datatypes.GroupBy,
+			GroupKeys:  []string{"host"},
+		}); err != nil {
+			return err
+		}
+		if _, err := s.TagKeys(ctx, &datatypes.TagKeysRequest{
+			TagsSource: s.source(t),
+			Range:      rng,
+			Predicate:  exprToPredicate(t, pred),
+		}); err != nil {
+			return err
+		}
+		_, err := s.TagValues(ctx, &datatypes.TagValuesRequest{
+			TagsSource: s.source(t),
+			Range:      rng,
+			Predicate:  exprToPredicate(t, pred),
+			TagKey:     "host",
+		})
+		return err
+	}
+
+	rs, err := s.ReadFilter(context.Background(), &datatypes.ReadFilterRequest{
+		ReadSource: s.source(t),
+		Range:      datatypes.TimestampRange{Start: 0, End: 1000},
+		Predicate:  exprToPredicate(t, `hostt = 'a'`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rs); len(got) != 0 {
+		t.Fatalf("got %v, exp no series", got)
+	}
+
+	ctx := NewContextWithReadOptions(context.Background(), &ReadOptions{StrictPredicateKeys: true})
+	for _, tt := range []struct {
+		pred string
+		bad  string
+	}{
+		{pred: `hostt = 'a'`, bad: "hostt"},
+		{pred: `_measurement = 'cpu' AND hostt != 'a'`, bad: "hostt"},
+		{pred: `_field = 'vv'`, bad: "vv"},
+		{pred: `host = 'a' AND _field = 'v'`},
+		{pred: `_measurement = 'cpu'`},
+	} {
+		t.Run(tt.pred, func(t *testing.T) {
+			err := read(ctx, tt.pred, 0, 1000)
+			if tt.bad == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnknownPredicateKey) {
+				t.Fatalf("got error %v, exp %v", err, ErrUnknownPredicateKey)
+			}
+			if !strings.Contains(err.Error(), tt.bad) {
+				t.Fatalf("got error %q, exp it to name %q", err, tt.bad)
+			}
+		})
+	}
+
+	if err := read(ctx, `hostt = 'a'`, 5000, 6000); err != nil {
+		t.Fatalf("got error %v for a range without shards", err)
+	}
+}
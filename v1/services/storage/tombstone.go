@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/models"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/v2/tsdb/engine/tsm1"
+	"github.com/influxdata/influxql"
+)
+
+// DeletedMeasurement describes a measurement deleted from a bucket.
+type DeletedMeasurement struct {
+	Name string
+
+	// DeletedAt is the time at which the deletion was recorded, taken from
+	// the modification time of the tombstone files holding it. If the
+	// measurement was deleted from several shards, it is the latest time.
+	DeletedAt time.Time
+}
+
+// DeletedMeasurements returns the measurements deleted from the shards
+// overlapping the range of req, ordered by name. The predicate of req
+// is applied to the measurement name, and comparisons of other keys are
+// ignored.
+//
+// Deletions are read from the tombstones of the TSM files of each shard, so a
+// measurement is only reported until the files are compacted, and the
+// deletion of points that had not yet been written to a TSM file is not
+// reported. A measurement is reported if all of its points were deleted from
+// a shard whose index no longer holds it; the deletion of individual series or
+// time ranges is not reported.
+func (s *Store) DeletedMeasurements(ctx context.Context, req *datatypes.TagKeysRequest) (_ []DeletedMeasurement, err error) {
+	ctx, deadline := s.withQueryDeadline(ctx)
+	defer deadline.done(&err)
+
+	if err := s.checkRateLimit("DeletedMeasurements"); err != nil {
+		return nil, err
+	}
+
+	mqAttrs, release, err := s.metaqueryRequestAttrs(ctx, req.TagsSource, req.Range, req.Predicate)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.deletedMeasurements(ctx, mqAttrs)
+}
+
+func (s *Store) deletedMeasurements(ctx context.Context, mqAttrs *metaqueryAttributes) ([]DeletedMeasurement, error) {
+	shardIDs, err := s.findShardIDs(ctx, mqAttrs.db, mqAttrs.rp, false, mqAttrs.start, mqAttrs.end)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]time.Time)
+	shards, err := s.shards(ctx, shardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sh := range shards {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		eng, err := sh.Engine()
+		if err != nil {
+			return nil, err
+		}
+		e, ok := eng.(*tsm1.Engine)
+		if !ok {
+			continue
+		}
+
+		names := make(map[string]time.Time)
+		for _, stat := range e.FileStore.Stats() {
+			if !stat.HasTombstone {
+				continue
+			}
+
+			ts := tsm1.NewTombstoner(stat.Path, nil)
+			var modified int64
+			for _, tf := range ts.TombstoneFiles() {
+				if tf.LastModified > modified {
+					modified = tf.LastModified
+				}
+			}
+
+			if err := ts.Walk(func(t tsm1.Tombstone) error {
+				if t.Min != math.MinInt64 || t.Max != math.MaxInt64 {
+					return nil
+				}
+				seriesKey, _ := tsm1.SeriesAndFieldFromCompositeKey(t.Key)
+				name := string(models.ParseName(seriesKey))
+				if at := time.Unix(0, modified); at.After(names[name]) {
+					names[name] = at
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		for name, at := range names {
+			if mqAttrs.pred != nil {
+				expr := influxql.Reduce(mqAttrs.pred, influxql.MapValuer{"_name": name})
+				if lit, ok := expr.(*influxql.BooleanLiteral); ok && !lit.Val {
+					continue
+				}
+			}
+			if exists, err := sh.MeasurementExists([]byte(name)); err != nil {
+				return nil, err
+			} else if exists {
+				continue
+			}
+			if at.After(deleted[name]) {
+				deleted[name] = at
+			}
+		}
+	}
+
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	measurements := make([]DeletedMeasurement, 0, len(deleted))
+	for name, at := range deleted {
+		measurements = append(measurements, DeletedMeasurement{Name: name, DeletedAt: at})
+	}
+	sort.Slice(measurements, func(i, j int) bool {
+		return measurements[i].Name < measurements[j].Name
+	})
+	return measurements, nil
+}
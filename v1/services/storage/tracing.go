@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+	"github.com/influxdata/influxdb/v2/storage/reads"
+	"github.com/influxdata/influxdb/v2/storage/reads/datatypes"
+	"github.com/influxdata/influxql"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// The tags of the spans of the read methods.
+const (
+	spanTagDatabase        = "database"
+	spanTagRetentionPolicy = "rp"
+	spanTagShards          = "shards"
+	spanTagSlowPath        = "slow_path"
+)
+
+// startSpan starts the span of a call of method, a child of the span of ctx
+// if it has one, and returns it with a context referencing it.
+func startSpan(ctx context.Context, method string) (opentracing.Span, context.Context) {
+	return tracing.StartSpanFromContextWithOperationName(ctx, "storage.Store."+method)
+}
+
+// finishSpan finishes span, marking it as failed with *err if it is not nil.
+func finishSpan(span opentracing.Span, err *error) {
+	if *err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(*err))
+	}
+	span.Finish()
+}
+
+// setSpanTag sets the tag key of the span of ctx, if it has one, to value.
+func setSpanTag(ctx context.Context, key string, value interface{}) {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag(key, value)
+	}
+}
+
+// setSpanSource tags the span of ctx with the database and retention policy
+// read.
+func setSpanSource(ctx context.Context, database, rp string) {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag(spanTagDatabase, database)
+		span.SetTag(spanTagRetentionPolicy, rp)
+	}
+}
+
+// setSpanReadPath tags the span of ctx with whether the series of a read
+// with pred are selected by ReadPathScan.
+func setSpanReadPath(ctx context.Context, pred *datatypes.Predicate) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	var expr influxql.Expr
+	if root := pred.GetRoot(); root != nil {
+		var err error
+		if expr, err = reads.NodeToExpr(root, measurementRemap); err != nil {
+			return
+		}
+	}
+	path, _ := readPath(expr)
+	span.SetTag(spanTagSlowPath, path == ReadPathScan)
+}